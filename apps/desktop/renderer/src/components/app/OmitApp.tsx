@@ -16,12 +16,14 @@ interface Tab {
   openPath?: string | null;
   // dirty flag for unsaved changes
   isDirty?: boolean;
+  // server-side terminal session backing a terminal tab
+  terminalSessionId?: string | null;
   // transient UI animation flags
   isEntering?: boolean;
   isClosing?: boolean;
 }
 
-import { workspaceOpen } from '../../lib/serverApi';
+import { terminalProcess, workspaceOpen } from '../../lib/serverApi';
 
 const pathLabel = (value: string) => value.split(/[\\/]/).filter(Boolean).pop() || value;
 const TAB_ANIMATION_MS = 160;
@@ -144,6 +146,28 @@ export default function OmitApp() {
   };
 
   const closeTabById = (id: string, closeWindowIfLast = false) => {
+    const tab = tabs.find((candidate) => candidate.id === id);
+    const sessionId = tab?.type === 'terminal' ? tab.terminalSessionId : null;
+    if (!sessionId || closeWindowIfLast) {
+      performCloseTab(id, closeWindowIfLast);
+      return;
+    }
+
+    // warn before killing a terminal that is still running something
+    void terminalProcess(sessionId)
+      .then((info) => {
+        if (info?.busy) {
+          const name = info.foreground?.name || 'A process';
+          if (!window.confirm(`${name} is still running in this terminal — close it anyway?`)) {
+            return;
+          }
+        }
+        performCloseTab(id, closeWindowIfLast);
+      })
+      .catch(() => performCloseTab(id, closeWindowIfLast));
+  };
+
+  const performCloseTab = (id: string, closeWindowIfLast = false) => {
     const currentTabs = tabs;
     const closingIndex = currentTabs.findIndex((tab) => tab.id === id);
     if (closingIndex < 0) {
@@ -466,6 +490,7 @@ export default function OmitApp() {
               <TerminalWorkspace
                 onExit={() => closeTabById(tab.id, true)}
                 onTitleChange={(title) => updateTabTitle(tab.id, title)}
+                onSessionChange={(sessionId) => updateTab(tab.id, { terminalSessionId: sessionId })}
               />
             )}
           </div>
@@ -1,11 +1,93 @@
-import React from 'react';
-import { ChevronDown, FileDiff } from 'lucide-react';
+import React, { useCallback, useEffect, useState } from 'react';
+import { Check, ChevronDown, FileDiff, X } from 'lucide-react';
+import { CodeDiff } from './CodeDiff';
+import { DiffLine, FileDiff as FileDiffModel } from '../../types/ui';
+import { changesetApply, changesetGet, changesetReject, changesetsList } from '../../lib/serverApi';
 
 interface ChangesPanelProps {
   width: number;
 }
 
+interface ChangesetHunk {
+  oldStart: number;
+  newStart: number;
+  lines: string[];
+}
+
+interface ChangesetFile {
+  path: string;
+  status: 'added' | 'modified' | 'deleted';
+  conflict: boolean;
+  hunks: ChangesetHunk[];
+}
+
+interface ChangesetDetail {
+  id: string;
+  title: string;
+  changes: ChangesetFile[];
+}
+
+const pollIntervalMs = 3_000;
+
+function toFileDiff(file: ChangesetFile): FileDiffModel {
+  const lines: DiffLine[] = [];
+  for (const hunk of file.hunks) {
+    let oldLine = hunk.oldStart;
+    let newLine = hunk.newStart;
+    for (const raw of hunk.lines) {
+      if (raw.startsWith('\\')) {
+        continue;
+      }
+      const content = raw.slice(1);
+      if (raw.startsWith('+')) {
+        lines.push({ lineNum: newLine++, content, type: 'add' });
+      } else if (raw.startsWith('-')) {
+        lines.push({ lineNum: oldLine++, content, type: 'remove' });
+      } else {
+        lines.push({ lineNum: newLine++, content, type: 'normal' });
+        oldLine++;
+      }
+    }
+  }
+  return { path: file.path, lines };
+}
+
 export const ChangesPanel: React.FC<ChangesPanelProps> = ({ width }) => {
+  const [changesets, setChangesets] = useState<ChangesetDetail[]>([]);
+  const [error, setError] = useState('');
+
+  const refresh = useCallback(async () => {
+    try {
+      const summaries: { id: string }[] = (await changesetsList()) ?? [];
+      const details = await Promise.all(summaries.map((s) => changesetGet(s.id)));
+      setChangesets(details.filter((d: ChangesetDetail) => d.changes.length > 0));
+    } catch {
+      setChangesets([]);
+    }
+  }, []);
+
+  useEffect(() => {
+    void refresh();
+    const timer = window.setInterval(() => void refresh(), pollIntervalMs);
+    return () => window.clearInterval(timer);
+  }, [refresh]);
+
+  const resolve = async (id: string, file: ChangesetFile, accept: boolean) => {
+    setError('');
+    try {
+      if (accept) {
+        await changesetApply(id, file.path);
+      } else {
+        await changesetReject(id, file.path);
+      }
+    } catch (err: any) {
+      setError(String(err?.message ?? err));
+    }
+    await refresh();
+  };
+
+  const files = changesets.flatMap((cs) => cs.changes.map((file) => ({ id: cs.id, file })));
+
   return (
     <div style={{ width }} className="flex-shrink-0 flex flex-col h-full border-l border-[#27272a] bg-[#0a0a0a]">
       <div className="h-12 border-b border-[#27272a] flex items-center justify-between px-3 bg-[#0a0a0a]">
@@ -13,17 +95,44 @@ export const ChangesPanel: React.FC<ChangesPanelProps> = ({ width }) => {
           <span className="text-sm font-medium text-white">Changes</span>
           <ChevronDown size={14} className="text-zinc-500" />
         </div>
+        {files.length > 0 && <span className="text-xs text-zinc-500">{files.length} files</span>}
       </div>
 
-      <div className="flex-1 flex items-center justify-center p-6 text-center">
-        <div className="max-w-[280px]">
-          <div className="mx-auto mb-3 w-9 h-9 rounded-md border border-[#2b2b2f] bg-[#111112] flex items-center justify-center text-zinc-500">
-            <FileDiff size={16} />
+      {files.length === 0 ? (
+        <div className="flex-1 flex items-center justify-center p-6 text-center">
+          <div className="max-w-[280px]">
+            <div className="mx-auto mb-3 w-9 h-9 rounded-md border border-[#2b2b2f] bg-[#111112] flex items-center justify-center text-zinc-500">
+              <FileDiff size={16} />
+            </div>
+            <p className="text-sm text-zinc-300">No changes to display</p>
+            <p className="mt-1 text-xs text-zinc-500">Edits from the agent will appear here.</p>
           </div>
-          <p className="text-sm text-zinc-300">No changes to display</p>
-          <p className="mt-1 text-xs text-zinc-500">Edits from the agent will appear here.</p>
         </div>
-      </div>
+      ) : (
+        <div className="flex-1 overflow-y-auto p-2">
+          {error && <p className="mb-2 text-xs text-rose-400 break-all">{error}</p>}
+          {files.map(({ id, file }) => (
+            <div key={`${id}:${file.path}`} className="mb-2">
+              <div className="flex items-center justify-end gap-1 mb-1">
+                {file.conflict && <span className="mr-auto text-[10px] text-amber-400">changed on disk</span>}
+                <button
+                  className="flex items-center gap-1 px-2 py-0.5 rounded text-[11px] text-zinc-400 hover:text-white hover:bg-[#202022]"
+                  onClick={() => void resolve(id, file, false)}
+                >
+                  <X size={12} /> Reject
+                </button>
+                <button
+                  className="flex items-center gap-1 px-2 py-0.5 rounded text-[11px] text-emerald-400 hover:text-emerald-300 hover:bg-[#202022]"
+                  onClick={() => void resolve(id, file, true)}
+                >
+                  <Check size={12} /> Apply
+                </button>
+              </div>
+              <CodeDiff file={toFileDiff(file)} />
+            </div>
+          ))}
+        </div>
+      )}
     </div>
   );
 };
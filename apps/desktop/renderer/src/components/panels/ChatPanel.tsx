@@ -15,6 +15,7 @@ import {
   Plus,
   Sparkles,
 } from 'lucide-react';
+import { contextUsage, gitBranches, gitSwitch, type ContextComponentName, type ContextUsage } from '../../lib/serverApi';
 
 interface ChatPanelProps {
   isNewThread?: boolean;
@@ -22,6 +23,11 @@ interface ChatPanelProps {
 
 const pathLabel = (value: string) => value.split(/[\\/]/).filter(Boolean).pop() || value;
 
+const resolveProjectRoot = (): string => {
+  const openPaths = (window as any).omt?.app?.getOpenPaths?.() as string[] | undefined;
+  return openPaths?.[0] ?? '';
+};
+
 const resolveProjectNames = (): string[] => {
   const openPaths = (window as any).omt?.app?.getOpenPaths?.() as string[] | undefined;
   if (!openPaths || openPaths.length === 0) {
@@ -52,11 +58,13 @@ export const ChatPanel: React.FC<ChatPanelProps> = ({ isNewThread = false }) =>
   const [environment, setEnvironment] = useState<'Local' | 'Worktree'>('Local');
   const [isEnvDropdownOpen, setIsEnvDropdownOpen] = useState(false);
   const [branch, setBranch] = useState('main');
+  const [localBranches, setLocalBranches] = useState<string[]>([]);
   const [isBranchDropdownOpen, setIsBranchDropdownOpen] = useState(false);
   const [isContextLocked, setIsContextLocked] = useState(false);
   const [isContextHovered, setIsContextHovered] = useState(false);
 
   const [input, setInput] = useState('');
+  const [usage, setUsage] = useState<ContextUsage | null>(null);
 
   const modes = [
     { label: 'Agent', icon: Brain },
@@ -68,15 +76,94 @@ export const ChatPanel: React.FC<ChatPanelProps> = ({ isNewThread = false }) =>
   const CurrentModeIcon = currentMode.icon;
   const showContextInfo = isContextLocked || isContextHovered;
 
-  const contextLimitTokens = 200_000;
-  const estimatedTokens = Math.round(input.trim().length / 4);
+  // the server tokenizes the whole prompt for the selected model; until it
+  // answers, or without a project, fall back to a rough draft-only estimate
+  const contextLimitTokens = usage?.contextWindow ?? 200_000;
+  const draftEstimate = Math.round(input.trim().length / 4);
+  const estimatedTokens = usage?.total ?? draftEstimate;
   const usedTokens = Math.min(contextLimitTokens, Math.max(0, estimatedTokens));
   const contextPercent = Math.max(0, Math.min(100, Math.round((usedTokens / contextLimitTokens) * 100)));
+  const componentTokens = (...names: ContextComponentName[]) =>
+    (usage?.components ?? []).filter((item) => names.includes(item.name)).reduce((sum, item) => sum + item.tokens, 0);
+  const percentOf = (tokens: number) => Math.max(0, Math.min(100, Math.round((tokens / contextLimitTokens) * 100)));
   const circleCircumference = 62.83;
   const circleDashOffset = circleCircumference * (1 - contextPercent / 100);
 
   const environments = ['Local', 'Worktree'] as const;
-  const branches = useMemo(() => Array.from(new Set(['main', branch])), [branch]);
+  const branches = useMemo(
+    () => Array.from(new Set(localBranches.length > 0 ? localBranches : ['main', branch])),
+    [localBranches, branch]
+  );
+
+  useEffect(() => {
+    const root = resolveProjectRoot();
+    if (!root) {
+      setUsage(null);
+      return;
+    }
+
+    let cancelled = false;
+    const timer = window.setTimeout(() => {
+      contextUsage({ workspace: root, mode: mode.toLowerCase() as 'agent' | 'plan' | 'ask', draft: input })
+        .then((result) => {
+          if (!cancelled) {
+            setUsage(result);
+          }
+        })
+        .catch(() => {
+          if (!cancelled) {
+            setUsage(null);
+          }
+        });
+    }, 300);
+
+    return () => {
+      cancelled = true;
+      window.clearTimeout(timer);
+    };
+  }, [input, mode]);
+
+  useEffect(() => {
+    const root = resolveProjectRoot();
+    if (!root) {
+      return;
+    }
+
+    let cancelled = false;
+    gitBranches(root)
+      .then((result: any) => {
+        if (cancelled || !result) {
+          return;
+        }
+        const names = (result.branches ?? [])
+          .filter((item: any) => !item.remote)
+          .map((item: any) => String(item.name));
+        setLocalBranches(names);
+        if (result.current) {
+          setBranch(String(result.current));
+        }
+      })
+      .catch(() => {
+        // not a git repository; keep the placeholder branch
+      });
+
+    return () => {
+      cancelled = true;
+    };
+  }, []);
+
+  const selectBranch = (next: string) => {
+    setIsBranchDropdownOpen(false);
+    const root = resolveProjectRoot();
+    if (!root || localBranches.length === 0 || next === branch) {
+      setBranch(next);
+      return;
+    }
+
+    gitSwitch(root, next)
+      .then(() => setBranch(next))
+      .catch((err: any) => window.alert(`Could not switch to ${next}: ${String(err?.message ?? err)}`));
+  };
 
   useEffect(() => {
     const handleClickOutside = (event: MouseEvent) => {
@@ -332,10 +419,7 @@ export const ChatPanel: React.FC<ChatPanelProps> = ({ isNewThread = false }) =>
                       <button
                         key={item}
                         className="flex items-center gap-2 px-3 py-1.5 hover:bg-[#27272a] cursor-pointer text-zinc-300 text-left"
-                        onClick={() => {
-                          setBranch(item);
-                          setIsBranchDropdownOpen(false);
-                        }}
+                        onClick={() => selectBranch(item)}
                         type="button"
                       >
                         <span className={branch === item ? 'text-white font-medium' : 'text-zinc-400'}>{item}</span>
@@ -360,7 +444,10 @@ export const ChatPanel: React.FC<ChatPanelProps> = ({ isNewThread = false }) =>
                 >
                   <div className="mb-3">
                     <h3 className="text-xs font-semibold text-zinc-300 mb-1">Context Window</h3>
-                    <div className="text-[11px] text-zinc-500 flex justify-between mb-1.5">
+                    <div
+                      className="text-[11px] text-zinc-500 flex justify-between mb-1.5"
+                      title={usage ? `${usage.model} · ${usage.tokenizer} tokenizer${usage.estimated ? ' (estimate)' : ''}` : 'Rough estimate'}
+                    >
                       <span>{usedTokens.toLocaleString()} / {contextLimitTokens.toLocaleString()} tokens</span>
                       <span>{contextPercent}%</span>
                     </div>
@@ -374,15 +461,25 @@ export const ChatPanel: React.FC<ChatPanelProps> = ({ isNewThread = false }) =>
                       <h4 className="text-[11px] font-semibold text-zinc-400 mb-1.5">System</h4>
                       <div className="flex justify-between text-[11px] text-zinc-500">
                         <span>Instructions + tools</span>
-                        <span>0%</span>
+                        <span>{percentOf(componentTokens('system', 'tools'))}%</span>
                       </div>
                     </div>
 
                     <div>
                       <h4 className="text-[11px] font-semibold text-zinc-400 mb-1.5">User Context</h4>
-                      <div className="flex justify-between text-[11px] text-zinc-500">
-                        <span>Current draft</span>
-                        <span>{contextPercent}%</span>
+                      <div className="space-y-1">
+                        <div className="flex justify-between text-[11px] text-zinc-500">
+                          <span>History</span>
+                          <span>{percentOf(componentTokens('history', 'summary'))}%</span>
+                        </div>
+                        <div className="flex justify-between text-[11px] text-zinc-500">
+                          <span>Attached files</span>
+                          <span>{percentOf(componentTokens('files'))}%</span>
+                        </div>
+                        <div className="flex justify-between text-[11px] text-zinc-500">
+                          <span>Current draft</span>
+                          <span>{percentOf(usage ? componentTokens('draft') : draftEstimate)}%</span>
+                        </div>
                       </div>
                     </div>
                   </div>
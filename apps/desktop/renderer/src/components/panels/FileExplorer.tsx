@@ -1,6 +1,6 @@
 import React from 'react';
 import { ChevronDown, ChevronRight, FileText, RefreshCw } from 'lucide-react';
-import { fsList } from '../../lib/serverApi';
+import { diagnosticsStreamUrl, fsList, type FileDiagnosticsSummary } from '../../lib/serverApi';
 
 type TreeEntry = {
   name: string;
@@ -8,6 +8,11 @@ type TreeEntry = {
   isDir: boolean;
 };
 
+type DiagnosticCounts = {
+  errors: number;
+  warnings: number;
+};
+
 type NodeState = {
   loading: boolean;
   loaded: boolean;
@@ -38,6 +43,7 @@ function compareEntries(a: TreeEntry, b: TreeEntry): number {
 export const FileExplorer: React.FC<{ rootPath?: string; onOpenFile?: (p: string) => void }> = ({ rootPath, onOpenFile }) => {
   const [tree, setTree] = React.useState<Record<string, NodeState>>({});
   const [expanded, setExpanded] = React.useState<Record<string, boolean>>({});
+  const [problems, setProblems] = React.useState<Record<string, DiagnosticCounts>>({});
   const treeRef = React.useRef(tree);
 
   React.useEffect(() => {
@@ -138,6 +144,60 @@ export const FileExplorer: React.FC<{ rootPath?: string; onOpenFile?: (p: string
     void loadChildren(rootPath, true);
   }, [rootPath, loadChildren]);
 
+  React.useEffect(() => {
+    setProblems({});
+    if (!rootPath) {
+      return;
+    }
+
+    let source: EventSource | null = null;
+    let cancelled = false;
+    const apply = (files: FileDiagnosticsSummary[], replace: boolean) => {
+      setProblems((previous) => {
+        const next = replace ? {} : { ...previous };
+        for (const file of files) {
+          const key = normalizePath(file.path);
+          if (file.errors + file.warnings === 0) {
+            delete next[key];
+          } else {
+            next[key] = { errors: file.errors, warnings: file.warnings };
+          }
+        }
+        return next;
+      });
+    };
+
+    void diagnosticsStreamUrl(rootPath).then((url) => {
+      if (cancelled) {
+        return;
+      }
+      source = new EventSource(url);
+      source.addEventListener('snapshot', (event) => apply(JSON.parse((event as MessageEvent).data) ?? [], true));
+      source.addEventListener('update', (event) => apply([JSON.parse((event as MessageEvent).data)], false));
+    });
+
+    return () => {
+      cancelled = true;
+      source?.close();
+    };
+  }, [rootPath]);
+
+  const renderBadge = (path: string) => {
+    const counts = problems[normalizePath(path)];
+    if (!counts) {
+      return null;
+    }
+    const isError = counts.errors > 0;
+    return (
+      <span
+        className={`ml-auto shrink-0 text-[11px] ${isError ? 'text-red-400' : 'text-amber-400'}`}
+        title={`${counts.errors} errors, ${counts.warnings} warnings`}
+      >
+        {isError ? counts.errors : counts.warnings}
+      </span>
+    );
+  };
+
   const toggleFolder = (path: string) => {
     const nextOpen = !expanded[path];
     setExpanded((previous) => ({ ...previous, [path]: nextOpen }));
@@ -211,6 +271,7 @@ export const FileExplorer: React.FC<{ rootPath?: string; onOpenFile?: (p: string
             >
               <FileText size={13} className="text-zinc-500" />
               <span className="truncate text-[13px]">{entry.name}</span>
+              {renderBadge(entry.path)}
             </button>
           );
         })}
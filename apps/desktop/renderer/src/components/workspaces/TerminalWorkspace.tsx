@@ -11,10 +11,20 @@ type TerminalServerEvent = {
   message?: string;
   code?: number;
   shell?: string;
+  flow?: string;
+  sessionId?: string;
+  protocol?: string;
+  capabilities?: string[];
+  title?: string;
+  cwd?: string;
 };
 
 const DEFAULT_SERVER_ADDR = '127.0.0.1:8080';
 const UTF8_ENCODER = new TextEncoder();
+const ACK_BATCH_BYTES = 64 * 1024;
+const ACK_FLUSH_DELAY_MS = 50;
+const HEARTBEAT_INTERVAL_MS = 30_000;
+const TERMINAL_PROTOCOL = 'omt.terminal.v2';
 
 function toTerminalSocketURL(addr: string): string {
   const trimmed = addr.trim();
@@ -126,14 +136,16 @@ async function writeClipboardText(value: string): Promise<void> {
 type TerminalWorkspaceProps = {
   onExit?: () => void;
   onTitleChange?: (title: string) => void;
+  onSessionChange?: (sessionId: string | null) => void;
 };
 
-export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, onTitleChange }) => {
+export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, onTitleChange, onSessionChange }) => {
   const terminalContainerRef = useRef<HTMLDivElement>(null);
   const connectionStateRef = useRef<ConnectionState>('connecting');
   const refreshOrReconnectRef = useRef<(() => void) | null>(null);
   const onExitRef = useRef(onExit);
   const onTitleChangeRef = useRef(onTitleChange);
+  const onSessionChangeRef = useRef(onSessionChange);
   const [connectionState, setConnectionState] = useState<ConnectionState>('connecting');
   const [connectionLabel, setConnectionLabel] = useState('Connecting…');
 
@@ -146,7 +158,8 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
   useEffect(() => {
     onExitRef.current = onExit;
     onTitleChangeRef.current = onTitleChange;
-  }, [onExit, onTitleChange]);
+    onSessionChangeRef.current = onSessionChange;
+  }, [onExit, onTitleChange, onSessionChange]);
 
   useEffect(() => {
     const streamDecoder = new TextDecoder();
@@ -204,6 +217,9 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
     let resizeObserver: ResizeObserver | undefined;
     let socket: WebSocket | null = null;
     let commandBuffer = '';
+    let pendingAckBytes = 0;
+    let ackTimer: number | undefined;
+    let heartbeatTimer: number | undefined;
 
     const isMac = isMacPlatform();
 
@@ -253,6 +269,32 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
       return true;
     });
 
+    const flushAck = () => {
+      if (ackTimer !== undefined) {
+        window.clearTimeout(ackTimer);
+        ackTimer = undefined;
+      }
+      if (pendingAckBytes === 0 || !socket || socket.readyState !== WebSocket.OPEN) {
+        return;
+      }
+
+      socket.send(JSON.stringify({ type: 'ack', bytes: pendingAckBytes }));
+      pendingAckBytes = 0;
+    };
+
+    // Acknowledge output only after xterm has rendered it so the server
+    // pauses the PTY instead of flooding a slow renderer.
+    const acknowledgeOutput = (byteCount: number) => {
+      pendingAckBytes += byteCount;
+      if (pendingAckBytes >= ACK_BATCH_BYTES) {
+        flushAck();
+        return;
+      }
+      if (ackTimer === undefined) {
+        ackTimer = window.setTimeout(flushAck, ACK_FLUSH_DELAY_MS);
+      }
+    };
+
     const sendResize = () => {
       if (!socket || socket.readyState !== WebSocket.OPEN) {
         return;
@@ -280,6 +322,15 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
       resizeObserver?.disconnect();
       resizeObserver = undefined;
       commandBuffer = '';
+      if (ackTimer !== undefined) {
+        window.clearTimeout(ackTimer);
+        ackTimer = undefined;
+      }
+      pendingAckBytes = 0;
+      if (heartbeatTimer !== undefined) {
+        window.clearInterval(heartbeatTimer);
+        heartbeatTimer = undefined;
+      }
       if (socket && socket.readyState < WebSocket.CLOSING) {
         socket.close(1000, 'terminal-disconnect');
       }
@@ -317,8 +368,10 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
         if (terminalToken.length > 0) {
           socketURL.searchParams.set('token', terminalToken);
         }
+        // v1 servers ignore the subprotocol, so keep asking for ack flow control
+        socketURL.searchParams.set('flow', 'ack');
 
-        nextSocket = new WebSocket(socketURL.toString());
+        nextSocket = new WebSocket(socketURL.toString(), [TERMINAL_PROTOCOL]);
       } catch {
         setConnection('error', 'Connection error');
         return;
@@ -389,10 +442,27 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
           try {
             const message = JSON.parse(event.data) as TerminalServerEvent;
             if (message.type === 'ready') {
+              onSessionChangeRef.current?.(message.sessionId ?? null);
+              if (message.capabilities?.includes('heartbeat') && heartbeatTimer === undefined) {
+                heartbeatTimer = window.setInterval(() => {
+                  if (socket && socket.readyState === WebSocket.OPEN) {
+                    socket.send(JSON.stringify({ type: 'heartbeat' }));
+                  }
+                }, HEARTBEAT_INTERVAL_MS);
+              }
               terminal.writeln(`\x1b[90mConnected to shell ${message.shell ?? ''}\x1b[0m`);
               return;
             }
 
+            if (message.type === 'title') {
+              setTerminalTitle(message.title ?? '');
+              return;
+            }
+
+            if (message.type === 'heartbeat' || message.type === 'cwd' || message.type === 'bell' || message.type === 'process') {
+              return;
+            }
+
             if (message.type === 'exit') {
               setConnection('closed', `Exited (${message.code ?? -1})`);
               terminal.writeln(`\r\n\x1b[31mTerminal process exited with code ${message.code ?? -1}.\x1b[0m`);
@@ -412,7 +482,9 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
         }
 
         const output = await readTerminalBytes(event.data as Blob | ArrayBuffer);
-        terminal.write(streamDecoder.decode(output, { stream: true }));
+        terminal.write(streamDecoder.decode(output, { stream: true }), () => {
+          acknowledgeOutput(output.byteLength);
+        });
       };
 
       socket.onerror = () => {
@@ -438,6 +510,11 @@ export const TerminalWorkspace: React.FC<TerminalWorkspaceProps> = ({ onExit, on
         resizeObserver?.disconnect();
         resizeObserver = undefined;
         commandBuffer = '';
+        if (heartbeatTimer !== undefined) {
+          window.clearInterval(heartbeatTimer);
+          heartbeatTimer = undefined;
+        }
+        onSessionChangeRef.current?.(null);
 
         if (connectionStateRef.current !== 'error') {
           if (event.code === 1000) {
@@ -82,6 +82,9 @@ async function fetchJson(path: string, opts: RequestInit = {}) {
     const txt = await res.text();
     throw new Error(`${res.status} ${res.statusText}: ${txt}`);
   }
+  if (res.status === 204) {
+    return null;
+  }
   return res.json();
 }
 
@@ -93,15 +96,22 @@ export async function fsList(path: string) {
   return fetchJson(`/v1/fs/list?path=${encodeURIComponent(path)}`);
 }
 
-export async function fsRead(path: string) {
-  return fetchJson(`/v1/fs/read?path=${encodeURIComponent(path)}`);
+export async function fsRead(path: string, changesetId = '') {
+  const suffix = changesetId ? `&changesetId=${encodeURIComponent(changesetId)}` : '';
+  return fetchJson(`/v1/fs/read?path=${encodeURIComponent(path)}${suffix}`);
 }
 
-export async function fsWrite(path: string, content: string) {
+export type FsTextFormat = {
+  encoding?: 'utf-8' | 'utf-8-bom' | 'utf-16le' | 'utf-16be' | 'latin1';
+  lineEnding?: 'lf' | 'crlf' | 'cr';
+  trailingNewline?: boolean;
+};
+
+export async function fsWrite(path: string, content: string, changesetId = '', format: FsTextFormat = {}) {
   return fetchJson('/v1/fs/write', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify({ path, content }),
+    body: JSON.stringify({ path, content, changesetId, ...format }),
   });
 }
 
@@ -121,6 +131,55 @@ export async function fsDelete(path: string, recursive = false) {
   });
 }
 
+export type FsBatchOp =
+  | { op: 'create'; path: string; isDir?: boolean }
+  | { op: 'write'; path: string; content: string }
+  | { op: 'rename'; path: string; newPath: string; overwrite?: boolean }
+  | { op: 'delete'; path: string; recursive?: boolean };
+
+export async function fsBatch(ops: FsBatchOp[]) {
+  return fetchJson('/v1/fs/batch', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ops }),
+  });
+}
+
+export type FsPatchEdit = {
+  start?: { line: number; column: number };
+  end?: { line: number; column: number };
+  startOffset?: number;
+  endOffset?: number;
+  oldText?: string;
+  newText: string;
+};
+
+export async function fsPatch(request: {
+  root?: string;
+  diff?: string;
+  files?: { path: string; diff?: string; edits?: FsPatchEdit[] }[];
+  fuzz?: number;
+  dryRun?: boolean;
+}) {
+  return fetchJson('/v1/fs/patch', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(request),
+  });
+}
+
+export async function fsHistory(path: string) {
+  return fetchJson(`/v1/fs/history?path=${encodeURIComponent(path)}`);
+}
+
+export async function fsRestoreHistory(path: string, id: string) {
+  return fetchJson('/v1/fs/history/restore', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ path, id }),
+  });
+}
+
 export async function workspaceOpen(paths: string[]) {
   return fetchJson('/v1/workspaces/open', {
     method: 'POST',
@@ -128,3 +187,625 @@ export async function workspaceOpen(paths: string[]) {
     body: JSON.stringify({ paths }),
   });
 }
+
+export async function terminalSessions() {
+  return fetchJson('/v1/terminals/sessions');
+}
+
+export async function terminalProcess(id: string) {
+  return fetchJson(`/v1/terminals/process?id=${encodeURIComponent(id)}`);
+}
+
+export async function terminalSignal(id: string, signal: string, target: 'foreground' | 'tree' = 'foreground') {
+  return fetchJson('/v1/terminals/signal', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ id, signal, target }),
+  });
+}
+
+function postJson(path: string, body: unknown) {
+  return fetchJson(path, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body),
+  });
+}
+
+export async function gitStatus(root: string) {
+  return fetchJson(`/v1/git/status?root=${encodeURIComponent(root)}`);
+}
+
+export async function gitBranches(root: string) {
+  return fetchJson(`/v1/git/branches?root=${encodeURIComponent(root)}`);
+}
+
+export async function gitCreateBranch(root: string, name: string, startPoint = '', checkout = false) {
+  return postJson('/v1/git/branches/create', { root, name, startPoint, checkout });
+}
+
+export async function gitSwitch(root: string, branch: string, detach = false) {
+  return postJson('/v1/git/switch', { root, branch, detach });
+}
+
+export async function gitDiff(root: string, path: string, staged = false) {
+  return fetchJson(`/v1/git/diff?root=${encodeURIComponent(root)}&path=${encodeURIComponent(path)}&staged=${staged}`);
+}
+
+export async function gitStage(root: string, paths: string[], hunks?: number[]) {
+  return postJson('/v1/git/stage', { root, paths, hunks });
+}
+
+export async function gitUnstage(root: string, paths: string[], hunks?: number[]) {
+  return postJson('/v1/git/unstage', { root, paths, hunks });
+}
+
+export async function gitCommit(root: string, message: string, options: { amend?: boolean; allowEmpty?: boolean; noVerify?: boolean } = {}) {
+  return postJson('/v1/git/commit', { root, message, ...options });
+}
+
+export async function gitStash(root: string, action: 'push' | 'pop' | 'apply' | 'drop' | 'list', options: { message?: string; includeUntracked?: boolean; index?: number } = {}) {
+  return postJson('/v1/git/stash', { root, action, ...options });
+}
+
+export async function gitLog(root: string, skip = 0, limit = 50, rev = '') {
+  return fetchJson(`/v1/git/log?root=${encodeURIComponent(root)}&skip=${skip}&limit=${limit}&rev=${encodeURIComponent(rev)}`);
+}
+
+export async function workspaceRoots() {
+  return fetchJson('/v1/workspaces');
+}
+
+export async function gitWorktrees(root: string) {
+  return fetchJson(`/v1/git/worktrees?root=${encodeURIComponent(root)}`);
+}
+
+export async function gitCreateWorktree(root: string, options: { name?: string; branch?: string; startPoint?: string } = {}) {
+  return postJson('/v1/git/worktrees/create', { root, ...options });
+}
+
+export async function gitRemoveWorktree(root: string, path: string, options: { force?: boolean; deleteBranch?: boolean } = {}) {
+  return postJson('/v1/git/worktrees/remove', { root, path, ...options });
+}
+
+export async function gitPruneWorktrees(root: string) {
+  return postJson('/v1/git/worktrees/prune', { root });
+}
+
+export async function gitWorktreeDiff(path: string) {
+  return fetchJson(`/v1/git/worktrees/diff?path=${encodeURIComponent(path)}`);
+}
+
+export async function gitMergeWorktree(
+  root: string,
+  path: string,
+  options: { message?: string; squash?: boolean; remove?: boolean; deleteBranch?: boolean; noVerify?: boolean } = {}
+) {
+  return postJson('/v1/git/worktrees/merge', { root, path, ...options });
+}
+
+export async function gitBlame(path: string, rev = '') {
+  return fetchJson(`/v1/git/blame?path=${encodeURIComponent(path)}&rev=${encodeURIComponent(rev)}`);
+}
+
+export async function gitFileLog(path: string, skip = 0, limit = 50) {
+  return fetchJson(`/v1/git/log?path=${encodeURIComponent(path)}&skip=${skip}&limit=${limit}`);
+}
+
+export async function gitShow(path: string, rev = 'HEAD') {
+  return fetchJson(`/v1/git/show?path=${encodeURIComponent(path)}&rev=${encodeURIComponent(rev)}`);
+}
+
+export async function gitConflicts(root: string) {
+  return fetchJson(`/v1/git/conflicts?root=${encodeURIComponent(root)}`);
+}
+
+export async function gitConflict(path: string) {
+  return fetchJson(`/v1/git/conflicts/file?path=${encodeURIComponent(path)}`);
+}
+
+export async function gitResolveConflict(
+  path: string,
+  resolution: { content?: string; side?: 'ours' | 'theirs' | 'base'; hunks?: { index: number; side: 'ours' | 'theirs' | 'base' | 'both' }[] }
+) {
+  return postJson('/v1/git/conflicts/resolve', { path, ...resolution });
+}
+
+export async function changesetsList() {
+  return fetchJson('/v1/changesets');
+}
+
+export async function changesetGet(id: string) {
+  return fetchJson(`/v1/changesets/get?id=${encodeURIComponent(id)}`);
+}
+
+export async function changesetApply(id: string, path = '', hunks?: number[], force = false) {
+  return postJson('/v1/changesets/apply', { id, path, hunks, force });
+}
+
+export async function changesetReject(id: string, path = '', hunks?: number[]) {
+  return postJson('/v1/changesets/reject', { id, path, hunks });
+}
+
+export async function changesetDiscard(id: string) {
+  return postJson('/v1/changesets/discard', { id });
+}
+
+export async function lspServers() {
+  return fetchJson('/v1/lsp/servers');
+}
+
+export async function lspSocketUrl(lang: string, root: string) {
+  const addr = await getServerAddr().catch(() => defaultServerAddr);
+  const token = await getServerToken();
+  const params = new URLSearchParams({ lang, root });
+  if (token) {
+    params.set('token', token);
+  }
+  return `ws://${addr.replace(/\/$/, '')}/v1/lsp/ws?${params.toString()}`;
+}
+
+export type LLMProvider = {
+  name: string;
+  type: 'openai' | 'ollama' | 'fake' | string;
+  baseUrl?: string;
+  model: string;
+  models?: string[];
+  apiKeyEnv?: string;
+  contextWindow?: number;
+  default: boolean;
+  hasKey: boolean;
+  keySource?: 'env' | 'keyring';
+};
+
+export async function llmProviders(): Promise<LLMProvider[]> {
+  return fetchJson('/v1/llm/providers');
+}
+
+export type FileDiagnosticsSummary = {
+  root: string;
+  path: string;
+  errors: number;
+  warnings: number;
+  infos: number;
+  diagnostics: {
+    path: string;
+    line: number;
+    column?: number;
+    severity: 'error' | 'warning' | 'info';
+    message: string;
+    code?: string;
+    source: string;
+  }[];
+};
+
+export async function diagnosticsList(root: string, options: { path?: string; severity?: string; summary?: boolean } = {}) {
+  const params = new URLSearchParams({ root });
+  if (options.path) {
+    params.set('path', options.path);
+  }
+  if (options.severity) {
+    params.set('severity', options.severity);
+  }
+  if (options.summary) {
+    params.set('summary', '1');
+  }
+  return fetchJson(`/v1/diagnostics?${params.toString()}`);
+}
+
+export async function diagnosticsCheck(root: string, check: 'go-vet' | 'tsc') {
+  return postJson('/v1/diagnostics/check', { root, check });
+}
+
+export async function diagnosticsStreamUrl(root: string) {
+  const addr = await getServerAddr().catch(() => defaultServerAddr);
+  const token = await getServerToken();
+  const params = new URLSearchParams({ root });
+  if (token) {
+    params.set('token', token);
+  }
+  return buildHttpUrl(addr, `/v1/diagnostics/stream?${params.toString()}`);
+}
+
+export type ThreadMode = 'agent' | 'plan' | 'ask';
+export type ThreadEnvironment = 'local' | 'worktree';
+
+export type ChatThread = {
+  id: string;
+  title: string;
+  workspace: string;
+  mode: ThreadMode;
+  environment: ThreadEnvironment;
+  branch?: string;
+  archived: boolean;
+  createdAt: string;
+  updatedAt: string;
+  messageCount: number;
+};
+
+export type ChatThreadMessage = {
+  id: string;
+  role: 'user' | 'assistant' | 'system' | 'tool';
+  content: string;
+  meta?: unknown;
+  createdAt: string;
+};
+
+export async function threadsList(options: { workspace?: string; archived?: boolean | 'only'; offset?: number; limit?: number } = {}) {
+  const params = new URLSearchParams();
+  if (options.workspace) {
+    params.set('workspace', options.workspace);
+  }
+  if (options.archived !== undefined) {
+    params.set('archived', String(options.archived));
+  }
+  if (options.offset) {
+    params.set('offset', String(options.offset));
+  }
+  if (options.limit) {
+    params.set('limit', String(options.limit));
+  }
+  return fetchJson(`/v1/threads?${params.toString()}`);
+}
+
+export async function threadCreate(thread: { workspace: string; title?: string; mode?: ThreadMode; environment?: ThreadEnvironment; branch?: string }) {
+  return postJson('/v1/threads/create', thread);
+}
+
+export async function threadMessages(id: string, offset = 0, limit = 200) {
+  return fetchJson(`/v1/threads/messages?id=${encodeURIComponent(id)}&offset=${offset}&limit=${limit}`);
+}
+
+export async function threadAppend(id: string, role: ChatThreadMessage['role'], content: string, meta?: unknown) {
+  return postJson('/v1/threads/append', { id, role, content, meta });
+}
+
+export async function threadUpdate(id: string, update: { mode?: ThreadMode; environment?: ThreadEnvironment; branch?: string }) {
+  return postJson('/v1/threads/update', { id, ...update });
+}
+
+export async function threadRename(id: string, title: string) {
+  return postJson('/v1/threads/rename', { id, title });
+}
+
+export async function threadArchive(id: string, archived = true) {
+  return postJson('/v1/threads/archive', { id, archived });
+}
+
+export async function threadDelete(id: string) {
+  return postJson('/v1/threads/delete', { id });
+}
+
+export type AgentRunStatus = 'running' | 'completed' | 'canceled' | 'failed' | 'budget_exhausted';
+
+export type AgentRun = {
+  id: string;
+  threadId: string;
+  workspace: string;
+  mode: ThreadMode;
+  provider: string;
+  model: string;
+  status: AgentRunStatus;
+  step: number;
+  maxSteps: number;
+  waitingApproval?: string;
+  usage: { promptTokens: number; completionTokens: number; totalTokens: number };
+  error?: string;
+  startedAt: string;
+  finishedAt?: string;
+};
+
+export type AgentToolCall = { id: string; name: string; arguments: unknown };
+
+export type AgentToolResult = {
+  callId: string;
+  name: string;
+  content: string;
+  isError?: boolean;
+  truncated?: boolean;
+  durationMs: number;
+};
+
+export type AgentEvent = {
+  seq: number;
+  type: 'started' | 'step' | 'delta' | 'tool_call' | 'tool_result' | 'approval' | 'usage' | 'message' | 'compaction' | 'done';
+  step?: number;
+  delta?: string;
+  toolCall?: AgentToolCall;
+  toolResult?: AgentToolResult;
+  approval?: Approval;
+  usage?: AgentRun['usage'];
+  message?: ChatThreadMessage;
+  compaction?: ContextCompaction;
+  run?: AgentRun;
+};
+
+export async function agentRun(opts: {
+  threadId: string;
+  content: string;
+  provider?: string;
+  model?: string;
+  maxSteps?: number;
+  files?: string[];
+}): Promise<AgentRun> {
+  return postJson('/v1/agent/run', opts);
+}
+
+export async function agentCancel(id: string): Promise<AgentRun> {
+  return postJson('/v1/agent/cancel', { id });
+}
+
+export async function agentStatus(id: string): Promise<AgentRun> {
+  return fetchJson(`/v1/agent/status?id=${encodeURIComponent(id)}`);
+}
+
+export async function agentRuns(threadId?: string): Promise<AgentRun[]> {
+  const suffix = threadId ? `?thread=${encodeURIComponent(threadId)}` : '';
+  return fetchJson(`/v1/agent/runs${suffix}`);
+}
+
+export async function agentStreamUrl(id: string, after?: number) {
+  const addr = await getServerAddr().catch(() => defaultServerAddr);
+  const token = await getServerToken();
+  const params = new URLSearchParams({ id });
+  if (after !== undefined) {
+    params.set('after', String(after));
+  }
+  if (token) {
+    params.set('token', token);
+  }
+  return buildHttpUrl(addr, `/v1/agent/stream?${params.toString()}`);
+}
+
+export type ContextComponentName = 'system' | 'tools' | 'summary' | 'history' | 'files' | 'draft';
+
+export type ContextUsage = {
+  provider: string;
+  model: string;
+  tokenizer: string;
+  estimated: boolean;
+  measured?: number;
+  contextWindow: number;
+  reservedOutput: number;
+  components: { name: ContextComponentName; tokens: number; items: number }[];
+  total: number;
+  available: number;
+  percent: number;
+  compactAt: number;
+  compactRecommended: boolean;
+};
+
+export type ContextCompaction = {
+  message: ChatThreadMessage;
+  summarized: number;
+  tokensBefore: number;
+  tokensAfter: number;
+};
+
+export async function contextUsage(opts: {
+  threadId?: string;
+  workspace?: string;
+  mode?: 'agent' | 'plan' | 'ask';
+  provider?: string;
+  model?: string;
+  draft?: string;
+  files?: string[];
+}): Promise<ContextUsage> {
+  return postJson('/v1/context/usage', opts);
+}
+
+export type ContextReference =
+  | { kind: 'file'; path: string; startLine?: number; endLine?: number }
+  | { kind: 'folder'; path?: string; depth?: number }
+  | { kind: 'glob'; pattern: string }
+  | { kind: 'git_diff'; path?: string; staged?: boolean }
+  | { kind: 'terminal'; session: string; lines?: number }
+  | { kind: 'diagnostics'; path?: string; severity?: 'error' | 'warning' | 'info' };
+
+export type ContextBlock = {
+  kind: ContextReference['kind'];
+  title: string;
+  path?: string;
+  startLine?: number;
+  endLine?: number;
+  language?: string;
+  content: string;
+  bytes: number;
+  truncated?: boolean;
+  error?: string;
+};
+
+export type ContextResolution = {
+  blocks: ContextBlock[];
+  bytes: number;
+  maxBytes: number;
+  truncated: boolean;
+  prompt: string;
+};
+
+export async function contextResolve(
+  workspace: string,
+  references: ContextReference[],
+  opts: { maxBytes?: number; maxBlockBytes?: number } = {}
+): Promise<ContextResolution> {
+  return postJson('/v1/context/resolve', { workspace, references, ...opts });
+}
+
+export async function contextCompact(threadId: string, opts: { provider?: string; model?: string } = {}): Promise<ContextCompaction> {
+  return postJson('/v1/context/compact', { threadId, ...opts });
+}
+
+export type IndexStatus = {
+  workspace: string;
+  embedder: string;
+  files: number;
+  chunks: number;
+  dimensions?: number;
+  indexing: boolean;
+  pending: number;
+  updatedAt?: string;
+  scannedAt?: string;
+  error?: string;
+};
+
+export type IndexMatch = {
+  path: string;
+  startLine: number;
+  endLine: number;
+  kind?: string;
+  name?: string;
+  score: number;
+  content: string;
+};
+
+export type IndexQueryResult = {
+  matches: IndexMatch[];
+  index: IndexStatus;
+};
+
+export async function indexQuery(
+  workspace: string,
+  query: string,
+  opts: { limit?: number; paths?: string[] } = {}
+): Promise<IndexQueryResult> {
+  return postJson('/v1/index/query', { workspace, query, ...opts });
+}
+
+export async function indexStatus(workspace: string): Promise<IndexStatus> {
+  return fetchJson(`/v1/index/status?workspace=${encodeURIComponent(workspace)}`);
+}
+
+export async function indexRefresh(workspace: string, rebuild = false): Promise<IndexStatus> {
+  return postJson('/v1/index/refresh', { workspace, rebuild });
+}
+
+export type SymbolInfo = {
+  name: string;
+  kind: string;
+  detail?: string;
+  container?: string;
+  startLine: number;
+  endLine: number;
+  line: number;
+  children?: SymbolInfo[];
+};
+
+export type SymbolOutline = {
+  path: string;
+  language: string;
+  hash: string;
+  symbols: SymbolInfo[];
+};
+
+export type SymbolMatch = Omit<SymbolInfo, 'children'> & {
+  path: string;
+  score: number;
+};
+
+export type SymbolSearchResult = {
+  symbols: SymbolMatch[];
+  files: number;
+  truncated: boolean;
+};
+
+export async function symbolsDocument(path: string): Promise<SymbolOutline> {
+  return fetchJson(`/v1/symbols/document?path=${encodeURIComponent(path)}`);
+}
+
+export async function symbolsWorkspace(workspace: string, query: string, limit = 100): Promise<SymbolSearchResult> {
+  return fetchJson(`/v1/symbols/workspace?workspace=${encodeURIComponent(workspace)}&q=${encodeURIComponent(query)}&limit=${limit}`);
+}
+
+export type ApprovalCategory ='read' | 'write' | 'delete' | 'exec' | 'network';
+export type ApprovalDecision = 'allow' | 'deny' | 'ask';
+
+export type Approval = {
+  id: string;
+  runId?: string;
+  threadId?: string;
+  workspace: string;
+  tool: string;
+  category: ApprovalCategory;
+  subject: string;
+  arguments?: unknown;
+  status: 'pending' | 'allowed' | 'denied' | 'canceled';
+  automatic?: boolean;
+  ruleId?: string;
+  reason?: string;
+  createdAt: string;
+  resolvedAt?: string;
+};
+
+export type ApprovalRule = {
+  id: string;
+  category: ApprovalCategory;
+  pattern?: string;
+  decision: ApprovalDecision;
+  createdAt: string;
+};
+
+export async function approvalsPending(workspace?: string): Promise<Approval[]> {
+  const suffix = workspace ? `?workspace=${encodeURIComponent(workspace)}` : '';
+  return fetchJson(`/v1/approvals${suffix}`);
+}
+
+export async function approvalResolve(
+  id: string,
+  resolution: { decision: 'allow' | 'deny'; remember?: boolean; pattern?: string; reason?: string }
+): Promise<Approval> {
+  return postJson(`/v1/approvals/${encodeURIComponent(id)}`, resolution);
+}
+
+export async function approvalsStreamUrl(workspace?: string) {
+  const addr = await getServerAddr().catch(() => defaultServerAddr);
+  const token = await getServerToken();
+  const params = new URLSearchParams();
+  if (workspace) {
+    params.set('workspace', workspace);
+  }
+  if (token) {
+    params.set('token', token);
+  }
+  return buildHttpUrl(addr, `/v1/approvals/stream?${params.toString()}`);
+}
+
+export async function approvalRules(workspace: string): Promise<ApprovalRule[]> {
+  return fetchJson(`/v1/approvals/rules?workspace=${encodeURIComponent(workspace)}`);
+}
+
+export async function approvalRuleAdd(workspace: string, rule: { category: ApprovalCategory; pattern?: string; decision: ApprovalDecision }): Promise<ApprovalRule> {
+  return postJson('/v1/approvals/rules/add', { workspace, ...rule });
+}
+
+export async function approvalRuleDelete(workspace: string, id: string) {
+  return postJson('/v1/approvals/rules/delete', { workspace, id });
+}
+
+export type MCPServerState = 'connecting' | 'ready' | 'restarting' | 'failed' | 'disabled' | 'stopped';
+
+export type MCPServerStatus = {
+  name: string;
+  transport: 'stdio' | 'http';
+  command?: string;
+  args?: string[];
+  url?: string;
+  state: MCPServerState;
+  error?: string;
+  pid?: number;
+  restarts: number;
+  connectedAt?: string;
+  serverInfo?: { name: string; version: string };
+  protocolVersion?: string;
+  tools: { name: string; tool: string; description?: string }[];
+  resources: { uri: string; name: string; description?: string; mimeType?: string }[];
+  prompts: { name: string; description?: string; arguments?: { name: string; description?: string; required?: boolean }[] }[];
+  stderr?: string;
+};
+
+export async function mcpServers(): Promise<MCPServerStatus[]> {
+  return fetchJson('/v1/mcp/servers');
+}
+
+export async function mcpServerRestart(name: string): Promise<MCPServerStatus[]> {
+  return postJson('/v1/mcp/servers/restart', { name });
+}
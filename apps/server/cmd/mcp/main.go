@@ -0,0 +1,62 @@
+// Command mcp serves a workspace over the Model Context Protocol on stdin
+// and stdout, for agent tools that launch MCP servers as subprocesses. It
+// exposes the same tools, sandbox and resources as the server's /v1/mcp
+// endpoint. The process that launches it is trusted like a terminal, so
+// there is no token and no approval prompt; -mode bounds what it may do.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"local/monorepo/internal/config"
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/mcp"
+)
+
+func main() {
+	cfg := config.LoadFromEnv()
+	mcpConfig := mcp.DefaultConfig()
+	if cfg.MCP.Mode != "" {
+		mcpConfig.Mode = cfg.MCP.Mode
+	}
+
+	workspace := flag.String("workspace", "", "workspace root to serve (default: the working directory)")
+	flag.StringVar(&mcpConfig.Mode, "mode", mcpConfig.Mode, "tools to expose: ask, plan or agent")
+	flag.Parse()
+
+	root := *workspace
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			fatal(err)
+		}
+		root = wd
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		fatal(err)
+	}
+
+	fsConfig := fs.DefaultConfig()
+	fsConfig.HistoryDir = filepath.Join(cfg.DataDir, "history")
+	fsService := fs.NewService(fsConfig)
+	fsService.RegisterWorkspaceRoot(root, fs.WorkspaceRootFolder)
+	server := mcp.NewServer(mcpConfig, fsService, nil, nil)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.ServeStdio(ctx, root, os.Stdin, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "mcp:", err)
+	os.Exit(1)
+}
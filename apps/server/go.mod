@@ -5,7 +5,13 @@ go 1.20
 require (
 	github.com/creack/pty v1.1.24
 	github.com/gorilla/websocket v1.5.3
+	github.com/pkoukk/tiktoken-go v0.1.8
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
 	go.uber.org/zap v1.27.1
 )
 
-require go.uber.org/multierr v1.11.0 // indirect
+require (
+	github.com/dlclark/regexp2 v1.10.0 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+)
@@ -0,0 +1,779 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/approvals"
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/threads"
+)
+
+var (
+	ErrRunNotFound        = errors.New("agent run not found")
+	ErrRunFinished        = errors.New("agent run already finished")
+	ErrThreadBusy         = errors.New("thread already has a running agent")
+	ErrEmptyMessage       = errors.New("message content is required")
+	ErrWorkspaceNotFound  = errors.New("thread workspace does not exist")
+	ErrUnsupportedMode    = errors.New("thread mode has no agent tools")
+	errStepBudgetExceeded = errors.New("step budget exhausted")
+)
+
+const (
+	StatusRunning         = "running"
+	StatusCompleted       = "completed"
+	StatusCanceled        = "canceled"
+	StatusFailed          = "failed"
+	StatusBudgetExhausted = "budget_exhausted"
+)
+
+const (
+	EventStarted    = "started"
+	EventStep       = "step"
+	EventDelta      = "delta"
+	EventToolCall   = "tool_call"
+	EventToolResult = "tool_result"
+	EventApproval   = "approval"
+	EventUsage      = "usage"
+	EventMessage    = "message"
+	EventCompaction = "compaction"
+	EventDone       = "done"
+)
+
+const (
+	defaultMaxSteps           = 25
+	defaultMaxStepsLimit      = 100
+	defaultExecTimeout        = 2 * time.Minute
+	defaultMaxExecTimeout     = 10 * time.Minute
+	defaultMaxToolOutputBytes = 64 * 1024
+	defaultMaxRuns            = 50
+	defaultCompactThreshold   = 0.8
+	defaultReservedOutput     = 4_096
+	defaultMaxAttachmentBytes = 256 * 1024
+	maxRunEvents              = 20_000
+	execCancelGrace           = 3 * time.Second
+	execOutputWaitDelay       = 2 * time.Second
+	runFinishedWaitPeriod     = 10 * time.Second
+)
+
+type Config struct {
+	// MaxSteps is the default number of model calls per run; MaxStepsLimit
+	// caps what a request may ask for.
+	MaxSteps           int
+	MaxStepsLimit      int
+	ExecTimeout        time.Duration
+	MaxExecTimeout     time.Duration
+	MaxToolOutputBytes int
+	MaxRuns            int
+	// CompactThreshold is the share of the context window, less the tokens
+	// reserved for the reply, at which a run summarizes older history
+	// before its next model call.
+	CompactThreshold     float64
+	ReservedOutputTokens int
+	MaxAttachmentBytes   int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSteps:             defaultMaxSteps,
+		MaxStepsLimit:        defaultMaxStepsLimit,
+		ExecTimeout:          defaultExecTimeout,
+		MaxExecTimeout:       defaultMaxExecTimeout,
+		MaxToolOutputBytes:   defaultMaxToolOutputBytes,
+		MaxRuns:              defaultMaxRuns,
+		CompactThreshold:     defaultCompactThreshold,
+		ReservedOutputTokens: defaultReservedOutput,
+		MaxAttachmentBytes:   defaultMaxAttachmentBytes,
+	}
+}
+
+// RunInfo is a snapshot of an agent run.
+type RunInfo struct {
+	ID        string `json:"id"`
+	ThreadID  string `json:"threadId"`
+	Workspace string `json:"workspace"`
+	Mode      string `json:"mode"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Status    string `json:"status"`
+	Step      int    `json:"step"`
+	MaxSteps  int    `json:"maxSteps"`
+	// WaitingApproval is the ID of the approval the run is blocked on.
+	WaitingApproval string     `json:"waitingApproval,omitempty"`
+	Usage           llm.Usage  `json:"usage"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"startedAt"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Event is one entry of a run's stream. Seq increases by one per event so
+// clients can resume with the last Seq they saw.
+type Event struct {
+	Seq        int64               `json:"seq"`
+	Type       string              `json:"type"`
+	Step       int                 `json:"step,omitempty"`
+	Delta      string              `json:"delta,omitempty"`
+	ToolCall   *llm.ToolCall       `json:"toolCall,omitempty"`
+	ToolResult *ToolResult         `json:"toolResult,omitempty"`
+	Approval   *approvals.Approval `json:"approval,omitempty"`
+	Usage      *llm.Usage          `json:"usage,omitempty"`
+	Message    *threads.Message    `json:"message,omitempty"`
+	Compaction *CompactResult      `json:"compaction,omitempty"`
+	Run        *RunInfo            `json:"run,omitempty"`
+}
+
+// messageMeta is stored with the thread messages a run appends, so later
+// runs can rebuild the tool-calling conversation.
+type messageMeta struct {
+	RunID      string         `json:"runId,omitempty"`
+	ToolCalls  []llm.ToolCall `json:"toolCalls,omitempty"`
+	ToolCallID string         `json:"toolCallId,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	IsError    bool           `json:"isError,omitempty"`
+	Usage      *llm.Usage     `json:"usage,omitempty"`
+	// Model is the model that wrote an assistant message, whose tokens
+	// Usage counts.
+	Model    string `json:"model,omitempty"`
+	Canceled bool   `json:"canceled,omitempty"`
+	// Attachments are the files attached to a user message.
+	Attachments []attachment `json:"attachments,omitempty"`
+	// Summary marks a compaction summary, which stands in for the messages
+	// up to and including CompactedThrough.
+	Summary          bool   `json:"summary,omitempty"`
+	CompactedThrough string `json:"compactedThrough,omitempty"`
+	Summarized       int    `json:"summarized,omitempty"`
+}
+
+type StartOptions struct {
+	ThreadID string
+	Content  string
+	// Provider and Model select the model; empty means the configured
+	// default.
+	Provider string
+	Model    string
+	MaxSteps int
+	// Files are workspace paths attached to the message; their content is
+	// captured when the message is sent.
+	Files []string
+}
+
+type run struct {
+	mu       sync.Mutex
+	info     RunInfo
+	events   []Event
+	nextSeq  int64
+	changed  chan struct{}
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+	provider llm.Provider
+	window   int
+	tools    *toolbox
+}
+
+func (r *run) publish(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextSeq++
+	event.Seq = r.nextSeq
+	r.events = append(r.events, event)
+	if excess := len(r.events) - maxRunEvents; excess > 0 {
+		r.events = append(r.events[:0], r.events[excess:]...)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *run) snapshot() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.info
+}
+
+func (r *run) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Runner drives agent runs: it appends the user's message to a thread,
+// calls the model, executes the tool calls it makes and streams everything
+// as events until the model stops, the step budget runs out or the run is
+// canceled.
+type Runner struct {
+	cfg      Config
+	fs       *fs.Service
+	threads  *threads.Store
+	registry *llm.Registry
+	// gate, if set, decides every tool call before it runs.
+	gate *approvals.Gate
+	// external, if set, adds tools from outside the server.
+	external ExternalTools
+
+	mu     sync.Mutex
+	runs   map[string]*run
+	order  []string
+	active map[string]string
+}
+
+func NewRunner(cfg Config, fsService *fs.Service, threadStore *threads.Store, registry *llm.Registry, gate *approvals.Gate) *Runner {
+	defaults := DefaultConfig()
+	if cfg.MaxSteps <= 0 {
+		cfg.MaxSteps = defaults.MaxSteps
+	}
+	if cfg.MaxStepsLimit <= 0 {
+		cfg.MaxStepsLimit = defaults.MaxStepsLimit
+	}
+	if cfg.ExecTimeout <= 0 {
+		cfg.ExecTimeout = defaults.ExecTimeout
+	}
+	if cfg.MaxExecTimeout <= 0 {
+		cfg.MaxExecTimeout = defaults.MaxExecTimeout
+	}
+	if cfg.MaxToolOutputBytes <= 0 {
+		cfg.MaxToolOutputBytes = defaults.MaxToolOutputBytes
+	}
+	if cfg.MaxRuns <= 0 {
+		cfg.MaxRuns = defaults.MaxRuns
+	}
+	if cfg.CompactThreshold <= 0 || cfg.CompactThreshold > 1 {
+		cfg.CompactThreshold = defaults.CompactThreshold
+	}
+	if cfg.ReservedOutputTokens <= 0 {
+		cfg.ReservedOutputTokens = defaults.ReservedOutputTokens
+	}
+	if cfg.MaxAttachmentBytes <= 0 {
+		cfg.MaxAttachmentBytes = defaults.MaxAttachmentBytes
+	}
+	return &Runner{
+		cfg:      cfg,
+		fs:       fsService,
+		threads:  threadStore,
+		registry: registry,
+		gate:     gate,
+		runs:     map[string]*run{},
+		active:   map[string]string{},
+	}
+}
+
+// SetExternalTools offers tools from outside the server to runs started
+// from then on. It must be called before the runner is used concurrently.
+func (r *Runner) SetExternalTools(external ExternalTools) {
+	r.external = external
+}
+
+// Start appends opts.Content as a user message and runs the agent on the
+// thread in the background. Only one run per thread may be active.
+func (r *Runner) Start(opts StartOptions) (RunInfo, error) {
+	content := strings.TrimSpace(opts.Content)
+	if content == "" {
+		return RunInfo{}, ErrEmptyMessage
+	}
+	thread, err := r.threads.Get(opts.ThreadID)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	if _, ok := modeTools[thread.Mode]; !ok {
+		return RunInfo{}, fmt.Errorf("%w: %s", ErrUnsupportedMode, thread.Mode)
+	}
+	workspace := filepath.Clean(thread.Workspace)
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		return RunInfo{}, ErrWorkspaceNotFound
+	}
+	provider, providerConfig, err := r.registry.Get(opts.Provider)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	model := strings.TrimSpace(opts.Model)
+	if model == "" {
+		model = providerConfig.Model
+	}
+	maxSteps := opts.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = r.cfg.MaxSteps
+	}
+	if maxSteps > r.cfg.MaxStepsLimit {
+		maxSteps = r.cfg.MaxStepsLimit
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	current := &run{
+		info: RunInfo{
+			ID:        newRunID(),
+			ThreadID:  thread.ID,
+			Workspace: workspace,
+			Mode:      thread.Mode,
+			Provider:  providerConfig.Name,
+			Model:     model,
+			Status:    StatusRunning,
+			MaxSteps:  maxSteps,
+			StartedAt: time.Now(),
+		},
+		changed:  make(chan struct{}),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		provider: provider,
+		window:   llm.ContextWindow(providerConfig, model),
+		tools:    &toolbox{fs: r.fs, workspace: workspace, mode: thread.Mode, cfg: r.cfg, external: r.external},
+	}
+	attachments, err := current.tools.attach(runCtx, opts.Files)
+	if err != nil {
+		cancel()
+		return RunInfo{}, err
+	}
+
+	r.mu.Lock()
+	if _, busy := r.active[thread.ID]; busy {
+		r.mu.Unlock()
+		cancel()
+		return RunInfo{}, ErrThreadBusy
+	}
+	r.active[thread.ID] = current.info.ID
+	r.mu.Unlock()
+
+	message, err := r.appendMessage(thread.ID, threads.RoleUser, content, messageMeta{RunID: current.info.ID, Attachments: attachments})
+	if err != nil {
+		r.mu.Lock()
+		delete(r.active, thread.ID)
+		r.mu.Unlock()
+		cancel()
+		return RunInfo{}, err
+	}
+
+	r.track(current)
+	info := current.snapshot()
+	current.publish(Event{Type: EventStarted, Run: &info})
+	current.publish(Event{Type: EventMessage, Message: &message})
+	go r.execute(runCtx, current)
+	return info, nil
+}
+
+func (r *Runner) execute(ctx context.Context, current *run) {
+	info := current.snapshot()
+	messages, err := r.prompt(info)
+	if err != nil {
+		r.finish(current, err)
+		return
+	}
+	tools := current.tools.definitions()
+	tokenizer := llm.TokenizerFor(info.Model)
+	// measured is the prompt size the provider reported for the first
+	// measuredLen messages; later messages are counted on top of it
+	measured, measuredLen := 0, 0
+
+	for step := 1; step <= info.MaxSteps; step++ {
+		current.mu.Lock()
+		current.info.Step = step
+		current.mu.Unlock()
+		current.publish(Event{Type: EventStep, Step: step})
+
+		// summarize older history once the prompt nears the window; if
+		// there is nothing left to summarize the call goes ahead as is
+		promptTokens := tokenizer.CountMessages(messages) + tokenizer.CountTools(tools)
+		if measured > 0 {
+			promptTokens = measured
+			for _, message := range messages[measuredLen:] {
+				promptTokens += tokenizer.CountMessage(message)
+			}
+		}
+		if promptTokens >= r.compactAt(current.window) {
+			if result, err := r.compact(ctx, info.ThreadID, info.ID, current.provider, info.Model, current.window); err == nil {
+				current.publish(Event{Type: EventCompaction, Step: step, Compaction: &result})
+				if messages, err = r.prompt(info); err != nil {
+					r.finish(current, err)
+					return
+				}
+				measured, measuredLen = 0, 0
+			}
+		}
+
+		var partial strings.Builder
+		resp, err := current.provider.Chat(ctx, llm.Request{Model: info.Model, Messages: messages, Tools: tools}, func(event llm.Event) {
+			switch event.Type {
+			case llm.EventDelta:
+				partial.WriteString(event.Delta)
+				current.publish(Event{Type: EventDelta, Step: step, Delta: event.Delta})
+			case llm.EventToolCall:
+				current.publish(Event{Type: EventToolCall, Step: step, ToolCall: event.ToolCall})
+			}
+		})
+		if err != nil {
+			if ctx.Err() != nil && partial.Len() > 0 {
+				r.publishMessage(current, threads.RoleAssistant, partial.String(), messageMeta{RunID: info.ID, Canceled: true})
+			}
+			r.finish(current, err)
+			return
+		}
+
+		usage := resp.Usage
+		if usage.PromptTokens > 0 {
+			measured, measuredLen = usage.PromptTokens, len(messages)
+		}
+		current.mu.Lock()
+		current.info.Usage.PromptTokens += usage.PromptTokens
+		current.info.Usage.CompletionTokens += usage.CompletionTokens
+		current.info.Usage.TotalTokens += usage.TotalTokens
+		current.mu.Unlock()
+		current.publish(Event{Type: EventUsage, Step: step, Usage: &usage})
+
+		r.publishMessage(current, threads.RoleAssistant, resp.Message.Content, messageMeta{
+			RunID:     info.ID,
+			ToolCalls: resp.Message.ToolCalls,
+			Usage:     &usage,
+			Model:     info.Model,
+		})
+		messages = append(messages, resp.Message)
+		if len(resp.Message.ToolCalls) == 0 {
+			r.finish(current, nil)
+			return
+		}
+
+		for _, call := range resp.Message.ToolCalls {
+			if ctx.Err() != nil {
+				break
+			}
+			result, err := r.callTool(ctx, current, call)
+			if err != nil {
+				break
+			}
+			current.publish(Event{Type: EventToolResult, Step: step, ToolResult: &result})
+			r.publishMessage(current, threads.RoleTool, result.Content, messageMeta{
+				RunID:      info.ID,
+				ToolCallID: call.ID,
+				Name:       call.Name,
+				IsError:    result.IsError,
+			})
+			messages = append(messages, llm.Message{Role: llm.RoleTool, Content: result.Content, ToolCallID: call.ID, Name: call.Name})
+		}
+		if err := ctx.Err(); err != nil {
+			r.finish(current, err)
+			return
+		}
+	}
+	r.finish(current, errStepBudgetExceeded)
+}
+
+// callTool runs one tool call once the approval gate lets it through. A
+// denied call is reported to the model as a failed tool result; an error
+// means the run was canceled while waiting.
+func (r *Runner) callTool(ctx context.Context, current *run, call llm.ToolCall) (ToolResult, error) {
+	if r.gate != nil {
+		if req, ok := current.tools.approvalRequest(call); ok {
+			req.RunID = current.info.ID
+			req.ThreadID = current.info.ThreadID
+			approval, err := r.gate.Check(ctx, req, func(pending approvals.Approval) {
+				current.mu.Lock()
+				current.info.WaitingApproval = pending.ID
+				current.mu.Unlock()
+				current.publish(Event{Type: EventApproval, Approval: &pending})
+			})
+			if approval.ID != "" && !approval.Automatic {
+				current.mu.Lock()
+				current.info.WaitingApproval = ""
+				current.mu.Unlock()
+				current.publish(Event{Type: EventApproval, Approval: &approval})
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ToolResult{}, err
+				}
+				return ToolResult{CallID: call.ID, Name: call.Name, Content: "error: approval policy failed: " + err.Error(), IsError: true}, nil
+			}
+			if approval.Status == approvals.StatusDenied {
+				return deniedResult(call, approval), nil
+			}
+		}
+	}
+	return current.tools.call(ctx, call), nil
+}
+
+func (r *Runner) publishMessage(current *run, role, content string, meta messageMeta) {
+	message, err := r.appendMessage(current.info.ThreadID, role, content, meta)
+	if err != nil {
+		return
+	}
+	current.publish(Event{Type: EventMessage, Message: &message})
+}
+
+func (r *Runner) appendMessage(threadID, role, content string, meta messageMeta) (threads.Message, error) {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return threads.Message{}, err
+	}
+	return r.threads.Append(threadID, threads.Message{Role: role, Content: content, Meta: raw})
+}
+
+func (r *Runner) finish(current *run, err error) {
+	current.mu.Lock()
+	now := time.Now()
+	current.info.FinishedAt = &now
+	switch {
+	case current.canceled:
+		current.info.Status = StatusCanceled
+	case err == nil:
+		current.info.Status = StatusCompleted
+	case errors.Is(err, errStepBudgetExceeded):
+		current.info.Status = StatusBudgetExhausted
+		current.info.Error = err.Error()
+	default:
+		current.info.Status = StatusFailed
+		current.info.Error = err.Error()
+	}
+	info := current.info
+	current.mu.Unlock()
+
+	r.mu.Lock()
+	if r.active[info.ThreadID] == info.ID {
+		delete(r.active, info.ThreadID)
+	}
+	r.mu.Unlock()
+
+	current.publish(Event{Type: EventDone, Run: &info})
+	close(current.done)
+	current.cancel()
+}
+
+// prompt builds the messages for a run's next model call from its thread.
+func (r *Runner) prompt(info RunInfo) ([]llm.Message, error) {
+	history, err := r.history(info.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: systemPrompt(info.Workspace, info.Mode)}}
+	return append(messages, historyMessages(history)...), nil
+}
+
+// history rebuilds the model conversation from a thread. The latest
+// compaction summary replaces the messages it covers. Tool calls left
+// without a result, for example by a canceled run, get a placeholder result
+// and stray tool messages are dropped, since providers reject both.
+func (r *Runner) history(threadID string) ([]historyEntry, error) {
+	stored, err := r.loadMessages(threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []historyEntry
+	start := 0
+	for i := len(stored) - 1; i >= 0; i-- {
+		if meta := decodeMeta(stored[i]); meta.Summary {
+			out = append(out, historyEntry{
+				message: llm.Message{Role: llm.RoleSystem, Content: "Summary of the earlier conversation:\n\n" + stored[i].Content},
+				summary: true,
+			})
+			start = indexOfMessage(stored, meta.CompactedThrough) + 1
+			break
+		}
+	}
+
+	pending := map[string]bool{}
+	var pendingOrder []llm.ToolCall
+	flush := func() {
+		for _, call := range pendingOrder {
+			if pending[call.ID] {
+				out = append(out, historyEntry{message: llm.Message{Role: llm.RoleTool, ToolCallID: call.ID, Name: call.Name, Content: "error: the tool call did not complete"}})
+			}
+		}
+		pending = map[string]bool{}
+		pendingOrder = nil
+	}
+	for _, message := range stored[start:] {
+		meta := decodeMeta(message)
+		if meta.Summary {
+			continue
+		}
+		switch message.Role {
+		case threads.RoleTool:
+			if !pending[meta.ToolCallID] {
+				continue
+			}
+			delete(pending, meta.ToolCallID)
+			out = append(out, historyEntry{message: llm.Message{Role: llm.RoleTool, Content: message.Content, ToolCallID: meta.ToolCallID, Name: meta.Name}})
+		case threads.RoleAssistant:
+			flush()
+			out = append(out, historyEntry{
+				message: llm.Message{Role: llm.RoleAssistant, Content: message.Content, ToolCalls: meta.ToolCalls},
+				usage:   meta.Usage,
+				model:   meta.Model,
+			})
+			for _, call := range meta.ToolCalls {
+				pending[call.ID] = true
+				pendingOrder = append(pendingOrder, call)
+			}
+		default:
+			flush()
+			files := renderAttachments(meta.Attachments)
+			out = append(out, historyEntry{
+				message:   llm.Message{Role: message.Role, Content: message.Content + files},
+				files:     files,
+				fileCount: len(meta.Attachments),
+			})
+		}
+	}
+	flush()
+	return out, nil
+}
+
+func systemPrompt(workspace, mode string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are a coding assistant working in the workspace at %s. Tool paths are relative to the workspace root.\n", workspace)
+	switch mode {
+	case threads.ModeAsk:
+		b.WriteString("You are in Ask mode: answer the user's questions. You can inspect files but cannot modify them or run commands.")
+	case threads.ModePlan:
+		b.WriteString("You are in Plan mode: investigate the workspace and reply with a concrete, step-by-step plan. You can read and search files but cannot modify them or run commands.")
+	default:
+		b.WriteString("You are in Agent mode: carry out the user's request with the available tools, then summarize what you changed. Verify changes by running the relevant commands when possible.")
+	}
+	return b.String()
+}
+
+func (r *Runner) track(current *run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runs[current.info.ID] = current
+	r.order = append(r.order, current.info.ID)
+
+	// evict the oldest finished runs beyond the limit
+	excess := len(r.order) - r.cfg.MaxRuns
+	if excess <= 0 {
+		return
+	}
+	kept := r.order[:0]
+	for _, id := range r.order {
+		if excess > 0 && r.runs[id].finished() {
+			delete(r.runs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	r.order = kept
+}
+
+func (r *Runner) get(id string) (*run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return current, nil
+}
+
+// List returns tracked runs newest first, limited to threadID when set.
+func (r *Runner) List(threadID string) []RunInfo {
+	r.mu.Lock()
+	runs := make([]*run, 0, len(r.order))
+	for _, id := range r.order {
+		runs = append(runs, r.runs[id])
+	}
+	r.mu.Unlock()
+
+	out := make([]RunInfo, 0, len(runs))
+	for _, current := range runs {
+		info := current.snapshot()
+		if threadID == "" || info.ThreadID == threadID {
+			out = append(out, info)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].StartedAt.After(out[j].StartedAt)
+	})
+	return out
+}
+
+func (r *Runner) Get(id string) (RunInfo, error) {
+	current, err := r.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	return current.snapshot(), nil
+}
+
+// Events returns the retained events with Seq greater than after and a
+// channel closed when more arrive. done reports that the run has finished
+// and every event up to its end has been returned.
+func (r *Runner) Events(id string, after int64) ([]Event, <-chan struct{}, bool, error) {
+	current, err := r.get(id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	start := sort.Search(len(current.events), func(i int) bool {
+		return current.events[i].Seq > after
+	})
+	events := append([]Event(nil), current.events[start:]...)
+	done := len(current.events) > 0 && current.events[len(current.events)-1].Type == EventDone
+	return events, current.changed, done, nil
+}
+
+// Cancel stops a running agent. The current model call and tool are
+// interrupted and the run finishes as canceled.
+func (r *Runner) Cancel(id string) (RunInfo, error) {
+	current, err := r.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+
+	current.mu.Lock()
+	if current.info.Status != StatusRunning {
+		current.mu.Unlock()
+		return RunInfo{}, ErrRunFinished
+	}
+	current.canceled = true
+	current.mu.Unlock()
+
+	current.cancel()
+	return current.snapshot(), nil
+}
+
+// Close cancels every running agent and waits briefly for them to finish.
+func (r *Runner) Close() {
+	r.mu.Lock()
+	runs := make([]*run, 0, len(r.runs))
+	for _, current := range r.runs {
+		runs = append(runs, current)
+	}
+	r.mu.Unlock()
+
+	for _, current := range runs {
+		current.mu.Lock()
+		if current.info.Status == StatusRunning {
+			current.canceled = true
+		}
+		current.mu.Unlock()
+		current.cancel()
+	}
+	for _, current := range runs {
+		select {
+		case <-current.done:
+		case <-time.After(runFinishedWaitPeriod):
+			return
+		}
+	}
+}
+
+func newRunID() string {
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("agent-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}
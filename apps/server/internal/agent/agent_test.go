@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"local/monorepo/internal/approvals"
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/threads"
+)
+
+type testRunner struct {
+	runner    *Runner
+	fake      *llm.Fake
+	gate      *approvals.Gate
+	threads   *threads.Store
+	workspace string
+}
+
+func newTestRunner(t *testing.T) *testRunner {
+	t.Helper()
+	workspace := t.TempDir()
+	threadStore, err := threads.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleStore, err := approvals.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := llm.NewRegistry(llm.Config{
+		Default:   "fake",
+		Providers: []llm.ProviderConfig{{Name: "fake", Type: llm.TypeFake, Model: "echo", ContextWindow: 32_000}},
+	})
+	provider, _, err := registry.Get("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gate := approvals.NewGate(ruleStore)
+	runner := NewRunner(DefaultConfig(), fs.NewService(fs.DefaultConfig()), threadStore, registry, gate)
+	t.Cleanup(runner.Close)
+	return &testRunner{runner: runner, fake: provider.(*llm.Fake), gate: gate, threads: threadStore, workspace: workspace}
+}
+
+func (tr *testRunner) start(t *testing.T, mode, content string) RunInfo {
+	t.Helper()
+	thread, err := tr.threads.Create(threads.CreateOptions{Title: "test", Workspace: tr.workspace, Mode: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := tr.runner.Start(StartOptions{ThreadID: thread.ID, Content: content})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return info
+}
+
+// wait follows the run's events until it is done, calling onEvent for
+// each, and returns the final run info.
+func (tr *testRunner) wait(t *testing.T, id string, onEvent func(Event)) RunInfo {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	var after int64
+	for {
+		events, changed, done, err := tr.runner.Events(id, after)
+		if err != nil {
+			t.Fatalf("Events: %v", err)
+		}
+		for _, event := range events {
+			after = event.Seq
+			if onEvent != nil {
+				onEvent(event)
+			}
+		}
+		if done {
+			info, err := tr.runner.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return info
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("run %s did not finish", id)
+		}
+	}
+}
+
+func toolCall(name, arguments string) llm.Response {
+	return llm.Response{Message: llm.Message{ToolCalls: []llm.ToolCall{{Name: name, Arguments: json.RawMessage(arguments)}}}}
+}
+
+// toolMessage returns the tool result the model was sent on its last call.
+func toolMessage(t *testing.T, fake *llm.Fake) llm.Message {
+	t.Helper()
+	requests := fake.Requests()
+	if len(requests) == 0 {
+		t.Fatal("the model was never called")
+	}
+	messages := requests[len(requests)-1].Messages
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llm.RoleTool {
+			return messages[i]
+		}
+	}
+	t.Fatal("the last request has no tool result")
+	return llm.Message{}
+}
+
+func TestRunToolCallRoundTrip(t *testing.T) {
+	tr := newTestRunner(t)
+	if err := os.WriteFile(filepath.Join(tr.workspace, "notes.txt"), []byte("remember the milk\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tr.fake.Script(
+		toolCall(ToolRead, `{"path":"notes.txt"}`),
+		llm.Response{Message: llm.Message{Content: "The note says to remember the milk."}},
+	)
+
+	run := tr.start(t, threads.ModeAsk, "What does notes.txt say?")
+	var results []*ToolResult
+	info := tr.wait(t, run.ID, func(event Event) {
+		if event.Type == EventToolResult {
+			results = append(results, event.ToolResult)
+		}
+	})
+
+	if info.Status != StatusCompleted {
+		t.Fatalf("status = %q (%s), want %q", info.Status, info.Error, StatusCompleted)
+	}
+	if info.Step != 2 || len(tr.fake.Requests()) != 2 {
+		t.Errorf("step = %d with %d model calls, want 2", info.Step, len(tr.fake.Requests()))
+	}
+	if len(results) != 1 || results[0].IsError {
+		t.Fatalf("tool results = %+v", results)
+	}
+	result := toolMessage(t, tr.fake)
+	if result.Name != ToolRead || !strings.Contains(result.Content, "remember the milk") {
+		t.Errorf("tool message = %+v", result)
+	}
+	first := tr.fake.Requests()[0]
+	if len(first.Tools) != len(modeTools[threads.ModeAsk]) {
+		t.Errorf("offered %d tools in Ask mode, want %d", len(first.Tools), len(modeTools[threads.ModeAsk]))
+	}
+
+	page, err := tr.threads.Messages(info.ThreadID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, message := range page.Messages {
+		roles = append(roles, message.Role)
+	}
+	want := []string{threads.RoleUser, threads.RoleAssistant, threads.RoleTool, threads.RoleAssistant}
+	if strings.Join(roles, ",") != strings.Join(want, ",") {
+		t.Errorf("thread roles = %v, want %v", roles, want)
+	}
+}
+
+func TestRunApprovalDenied(t *testing.T) {
+	tr := newTestRunner(t)
+	tr.fake.Script(
+		toolCall(ToolWrite, `{"path":"out.txt","content":"written"}`),
+		llm.Response{Message: llm.Message{Content: "Understood, nothing was written."}},
+	)
+
+	run := tr.start(t, threads.ModeAgent, "Write out.txt")
+	var approval approvals.Approval
+	info := tr.wait(t, run.ID, func(event Event) {
+		if event.Type != EventApproval || event.Approval.Status != approvals.StatusPending {
+			return
+		}
+		approval = *event.Approval
+		if _, err := tr.gate.Resolve(approval.ID, approvals.Resolution{Decision: approvals.DecisionDeny, Reason: "not now"}); err != nil {
+			t.Errorf("Resolve: %v", err)
+		}
+	})
+
+	if info.Status != StatusCompleted {
+		t.Fatalf("status = %q (%s), want %q", info.Status, info.Error, StatusCompleted)
+	}
+	if approval.Tool != ToolWrite || approval.Category != approvals.CategoryWrite || approval.Subject != "out.txt" {
+		t.Errorf("approval = %+v", approval)
+	}
+	result := toolMessage(t, tr.fake)
+	if !strings.Contains(result.Content, "denied") || !strings.Contains(result.Content, "not now") {
+		t.Errorf("tool message = %q, want a denial with the reason", result.Content)
+	}
+	if _, err := os.Stat(filepath.Join(tr.workspace, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("out.txt was written despite the denial (stat err = %v)", err)
+	}
+}
+
+func TestRunCancelWhileWaitingForApproval(t *testing.T) {
+	tr := newTestRunner(t)
+	tr.fake.Script(toolCall(ToolExec, `{"command":"echo hi"}`))
+
+	run := tr.start(t, threads.ModeAgent, "Say hi")
+	var statuses []string
+	info := tr.wait(t, run.ID, func(event Event) {
+		if event.Type != EventApproval {
+			return
+		}
+		statuses = append(statuses, event.Approval.Status)
+		if event.Approval.Status == approvals.StatusPending {
+			if _, err := tr.runner.Cancel(run.ID); err != nil {
+				t.Errorf("Cancel: %v", err)
+			}
+		}
+	})
+
+	if info.Status != StatusCanceled {
+		t.Fatalf("status = %q (%s), want %q", info.Status, info.Error, StatusCanceled)
+	}
+	if info.WaitingApproval != "" {
+		t.Errorf("run still waits on approval %s", info.WaitingApproval)
+	}
+	if strings.Join(statuses, ",") != approvals.StatusPending+","+approvals.StatusCanceled {
+		t.Errorf("approval statuses = %v, want pending then canceled", statuses)
+	}
+	if len(tr.fake.Requests()) != 1 {
+		t.Errorf("the model was called %d times after cancellation, want 1", len(tr.fake.Requests()))
+	}
+	if pending := tr.gate.Pending(tr.workspace); len(pending) != 0 {
+		t.Errorf("approvals still pending: %+v", pending)
+	}
+	if _, err := tr.runner.Cancel(run.ID); err != ErrRunFinished {
+		t.Errorf("second Cancel = %v, want ErrRunFinished", err)
+	}
+}
@@ -0,0 +1,532 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/threads"
+)
+
+var ErrNothingToCompact = errors.New("thread has no history to compact")
+
+const (
+	ComponentSystem  = "system"
+	ComponentTools   = "tools"
+	ComponentSummary = "summary"
+	ComponentHistory = "history"
+	ComponentFiles   = "files"
+	ComponentDraft   = "draft"
+)
+
+const (
+	// compactKeepRatio is the share of the context window kept verbatim
+	// after compaction; older messages are summarized.
+	compactKeepRatio = 0.2
+	// compactMessageBytes caps each message in the transcript that is sent
+	// to be summarized.
+	compactMessageBytes = 4 * 1024
+	// compactPromptTokens is left for the summarizing instructions and reply.
+	compactPromptTokens = 2_000
+)
+
+const compactInstructions = "You compress a coding assistant's conversation so that it can continue with less context. " +
+	"Write a concise summary that keeps the user's requests and constraints, decisions made, files read or changed with their paths, " +
+	"commands run and their outcomes, errors still open and the work that remains. Reply with the summary only."
+
+// attachment is a file attached to a user message. Its content is captured
+// when the message is sent, so later edits to the file do not rewrite the
+// conversation.
+type attachment struct {
+	Path      string `json:"path"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// attach reads the files at paths, which must lie inside the workspace.
+func (t *toolbox) attach(ctx context.Context, paths []string) ([]attachment, error) {
+	out := make([]attachment, 0, len(paths))
+	seen := map[string]bool{}
+	for _, raw := range paths {
+		path, err := t.resolve(raw)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		result, err := t.fs.ReadText(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("attach %s: %w", raw, err)
+		}
+		item := attachment{Path: t.relative(path), Content: result.Content}
+		if len(item.Content) > t.cfg.MaxAttachmentBytes {
+			item.Content = truncateUTF8(item.Content, t.cfg.MaxAttachmentBytes)
+			item.Truncated = true
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// renderAttachments formats attachments the way they are appended to the
+// message they belong to.
+func renderAttachments(attachments []attachment) string {
+	var b strings.Builder
+	for _, item := range attachments {
+		fmt.Fprintf(&b, "\n\n<file path=%q>\n%s", item.Path, item.Content)
+		if !strings.HasSuffix(item.Content, "\n") {
+			b.WriteByte('\n')
+		}
+		if item.Truncated {
+			b.WriteString("[truncated]\n")
+		}
+		b.WriteString("</file>")
+	}
+	return b.String()
+}
+
+// ContextRequest describes a prospective prompt: a thread, or a workspace
+// and mode for a thread not created yet, plus the draft message and the
+// files attached to it.
+type ContextRequest struct {
+	ThreadID  string
+	Workspace string
+	Mode      string
+	Provider  string
+	Model     string
+	Draft     string
+	Files     []string
+}
+
+type ContextComponent struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+	Items  int    `json:"items"`
+}
+
+// ContextUsage is the token breakdown of a prompt against the model's
+// context window. Counts come from the model family's tokenizer, including
+// per-message framing, and are estimates when Estimated is set. Measured is
+// the prompt the provider reported for the thread's latest call with the
+// model; it replaces the counts of the messages that prompt covered, which
+// are scaled to match. Compaction is recommended once the total reaches
+// CompactAt and there is history to summarize.
+type ContextUsage struct {
+	Provider           string             `json:"provider"`
+	Model              string             `json:"model"`
+	Tokenizer          string             `json:"tokenizer"`
+	Estimated          bool               `json:"estimated"`
+	Measured           int                `json:"measured,omitempty"`
+	ContextWindow      int                `json:"contextWindow"`
+	ReservedOutput     int                `json:"reservedOutput"`
+	Components         []ContextComponent `json:"components"`
+	Total              int                `json:"total"`
+	Available          int                `json:"available"`
+	Percent            float64            `json:"percent"`
+	CompactAt          int                `json:"compactAt"`
+	CompactRecommended bool               `json:"compactRecommended"`
+}
+
+// Estimate tokenizes the prompt the next run would send for req.
+func (r *Runner) Estimate(ctx context.Context, req ContextRequest) (ContextUsage, error) {
+	workspace, mode := req.Workspace, req.Mode
+	var history []historyEntry
+	if req.ThreadID != "" {
+		thread, err := r.threads.Get(req.ThreadID)
+		if err != nil {
+			return ContextUsage{}, err
+		}
+		workspace, mode = thread.Workspace, thread.Mode
+		if history, err = r.history(thread.ID); err != nil {
+			return ContextUsage{}, err
+		}
+	}
+	if strings.TrimSpace(workspace) == "" {
+		return ContextUsage{}, threads.ErrWorkspaceRequired
+	}
+	if mode == "" {
+		mode = threads.ModeAgent
+	}
+	if _, ok := modeTools[mode]; !ok {
+		return ContextUsage{}, fmt.Errorf("%w: %s", ErrUnsupportedMode, mode)
+	}
+	workspace = filepath.Clean(workspace)
+	_, providerConfig, err := r.registry.Get(req.Provider)
+	if err != nil {
+		return ContextUsage{}, err
+	}
+	model := strings.TrimSpace(req.Model)
+	if model == "" {
+		model = providerConfig.Model
+	}
+	tools := &toolbox{fs: r.fs, workspace: workspace, mode: mode, cfg: r.cfg}
+	files, err := tools.attach(ctx, req.Files)
+	if err != nil {
+		return ContextUsage{}, err
+	}
+
+	tokenizer := llm.TokenizerFor(model)
+	window := llm.ContextWindow(providerConfig, model)
+	usage := ContextUsage{
+		Provider:       providerConfig.Name,
+		Model:          model,
+		Tokenizer:      tokenizer.Name(),
+		Estimated:      !tokenizer.Exact(),
+		ContextWindow:  window,
+		ReservedOutput: r.reservedOutput(window),
+	}
+	counts := map[string]*ContextComponent{}
+	for _, name := range []string{ComponentSystem, ComponentTools, ComponentSummary, ComponentHistory, ComponentFiles, ComponentDraft} {
+		usage.Components = append(usage.Components, ContextComponent{Name: name})
+	}
+	for i := range usage.Components {
+		counts[usage.Components[i].Name] = &usage.Components[i]
+	}
+	add := func(name string, tokens, items int) {
+		counts[name].Tokens += tokens
+		counts[name].Items += items
+	}
+
+	add(ComponentSystem, tokenizer.CountMessages([]llm.Message{{Role: llm.RoleSystem, Content: systemPrompt(workspace, mode)}}), 1)
+	definitions := (&toolbox{mode: mode, external: r.external}).definitions()
+	add(ComponentTools, tokenizer.CountTools(definitions), len(definitions))
+	anchor := measuredPrompt(history, model)
+	var covered []int
+	for i, entry := range history {
+		if i == anchor {
+			covered = componentTokens(usage.Components)
+		}
+		tokens := tokenizer.CountMessage(entry.message)
+		if entry.summary {
+			add(ComponentSummary, tokens, 1)
+			continue
+		}
+		if entry.files != "" {
+			fileTokens := tokenizer.Count(entry.files)
+			add(ComponentFiles, fileTokens, entry.fileCount)
+			tokens -= fileTokens
+		}
+		add(ComponentHistory, tokens, 1)
+	}
+	if strings.TrimSpace(req.Draft) != "" || len(files) > 0 {
+		add(ComponentDraft, tokenizer.CountMessage(llm.Message{Role: llm.RoleUser, Content: req.Draft}), 1)
+		add(ComponentFiles, tokenizer.Count(renderAttachments(files)), len(files))
+	}
+
+	if covered != nil {
+		usage.Measured = history[anchor].usage.PromptTokens
+		scaleCovered(usage.Components, covered, usage.Measured)
+	}
+
+	for _, component := range usage.Components {
+		usage.Total += component.Tokens
+	}
+	usage.Available = window - usage.ReservedOutput - usage.Total
+	if usage.Available < 0 {
+		usage.Available = 0
+	}
+	usage.Percent = math.Round(float64(usage.Total)*1000/float64(window)) / 10
+	usage.CompactAt = r.compactAt(window)
+	usage.CompactRecommended = usage.Total >= usage.CompactAt && counts[ComponentHistory].Items > 1
+	return usage, nil
+}
+
+// measuredPrompt returns the index of the latest assistant message in
+// history whose call to model reported its prompt size, or -1. That prompt
+// held everything before the message.
+func measuredPrompt(history []historyEntry, model string) int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if entry := history[i]; entry.usage != nil && entry.usage.PromptTokens > 0 && entry.model == model {
+			return i
+		}
+	}
+	return -1
+}
+
+func componentTokens(components []ContextComponent) []int {
+	out := make([]int, len(components))
+	for i, component := range components {
+		out[i] = component.Tokens
+	}
+	return out
+}
+
+// scaleCovered replaces the covered part of each component's count with
+// its share of the measured prompt; rounding is settled on the first.
+func scaleCovered(components []ContextComponent, covered []int, measured int) {
+	total := 0
+	for _, tokens := range covered {
+		total += tokens
+	}
+	if total == 0 {
+		return
+	}
+	remaining := measured
+	for i := range components {
+		share := covered[i] * measured / total
+		components[i].Tokens += share - covered[i]
+		remaining -= share
+	}
+	components[0].Tokens += remaining
+}
+
+func (r *Runner) reservedOutput(window int) int {
+	if reserved := window / 4; reserved < r.cfg.ReservedOutputTokens {
+		return reserved
+	}
+	return r.cfg.ReservedOutputTokens
+}
+
+// compactAt is the prompt size at which a run compacts its history.
+func (r *Runner) compactAt(window int) int {
+	return int(float64(window-r.reservedOutput(window)) * r.cfg.CompactThreshold)
+}
+
+type CompactOptions struct {
+	ThreadID string
+	// Provider and Model select the model that writes the summary; empty
+	// means the configured default.
+	Provider string
+	Model    string
+}
+
+// CompactResult reports a compaction. Message is the summary appended to
+// the thread; the token counts are the thread history's before and after.
+type CompactResult struct {
+	Message      threads.Message `json:"message"`
+	Summarized   int             `json:"summarized"`
+	TokensBefore int             `json:"tokensBefore"`
+	TokensAfter  int             `json:"tokensAfter"`
+}
+
+// Compact summarizes the older part of a thread's history with the model
+// and appends the summary, which replaces those messages in every later
+// prompt. The thread file keeps every message.
+func (r *Runner) Compact(ctx context.Context, opts CompactOptions) (CompactResult, error) {
+	thread, err := r.threads.Get(opts.ThreadID)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	provider, providerConfig, err := r.registry.Get(opts.Provider)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	model := strings.TrimSpace(opts.Model)
+	if model == "" {
+		model = providerConfig.Model
+	}
+
+	// hold the thread like a run so none starts while the summary is written
+	r.mu.Lock()
+	if _, busy := r.active[thread.ID]; busy {
+		r.mu.Unlock()
+		return CompactResult{}, ErrThreadBusy
+	}
+	r.active[thread.ID] = ""
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		if r.active[thread.ID] == "" {
+			delete(r.active, thread.ID)
+		}
+		r.mu.Unlock()
+	}()
+
+	return r.compact(ctx, thread.ID, "", provider, model, llm.ContextWindow(providerConfig, model))
+}
+
+func (r *Runner) compact(ctx context.Context, threadID, runID string, provider llm.Provider, model string, window int) (CompactResult, error) {
+	tokenizer := llm.TokenizerFor(model)
+	stored, err := r.loadMessages(threadID)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	before, err := r.history(threadID)
+	if err != nil {
+		return CompactResult{}, err
+	}
+
+	// messages up to the latest summary's cut are already summarized
+	start, previous := 0, ""
+	metas := make([]messageMeta, len(stored))
+	for i, message := range stored {
+		metas[i] = decodeMeta(message)
+	}
+	for i := len(stored) - 1; i >= 0; i-- {
+		if metas[i].Summary {
+			previous = stored[i].Content
+			start = indexOfMessage(stored, metas[i].CompactedThrough) + 1
+			break
+		}
+	}
+
+	// keep the newest messages that fit the budget, cutting only before a
+	// user or assistant message so tool results stay with their calls
+	budget := int(float64(window) * compactKeepRatio)
+	cut, tail := -1, 0
+	for i := len(stored) - 1; i >= start; i-- {
+		if metas[i].Summary {
+			continue
+		}
+		tail += tokenizer.Count(stored[i].Content) + tokenizer.Count(renderAttachments(metas[i].Attachments))
+		if stored[i].Role == threads.RoleTool {
+			continue
+		}
+		if tail > budget && cut >= 0 {
+			break
+		}
+		cut = i
+	}
+	var summarized []int
+	for i := start; i < cut; i++ {
+		if !metas[i].Summary {
+			summarized = append(summarized, i)
+		}
+	}
+	if len(summarized) == 0 {
+		return CompactResult{}, ErrNothingToCompact
+	}
+
+	limit := window - r.reservedOutput(window) - compactPromptTokens
+	transcript := compactTranscript(tokenizer, previous, stored, metas, summarized, limit)
+	resp, err := provider.Chat(ctx, llm.Request{Model: model, Messages: []llm.Message{
+		{Role: llm.RoleSystem, Content: compactInstructions},
+		{Role: llm.RoleUser, Content: transcript},
+	}}, nil)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	summary := strings.TrimSpace(resp.Message.Content)
+	if summary == "" {
+		return CompactResult{}, errors.New("model returned an empty summary")
+	}
+
+	usage := resp.Usage
+	message, err := r.appendMessage(threadID, threads.RoleSystem, summary, messageMeta{
+		RunID:            runID,
+		Usage:            &usage,
+		Summary:          true,
+		CompactedThrough: stored[summarized[len(summarized)-1]].ID,
+		Summarized:       len(summarized),
+	})
+	if err != nil {
+		return CompactResult{}, err
+	}
+	after, err := r.history(threadID)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	return CompactResult{
+		Message:      message,
+		Summarized:   len(summarized),
+		TokensBefore: tokenizer.CountMessages(historyMessages(before)),
+		TokensAfter:  tokenizer.CountMessages(historyMessages(after)),
+	}, nil
+}
+
+// compactTranscript renders the messages to summarize as plain text,
+// dropping the oldest ones when the transcript exceeds limit tokens.
+func compactTranscript(tokenizer llm.Tokenizer, previous string, stored []threads.Message, metas []messageMeta, indexes []int, limit int) string {
+	parts := make([]string, 0, len(indexes))
+	total := tokenizer.Count(previous)
+	for _, i := range indexes {
+		var b strings.Builder
+		fmt.Fprintf(&b, "[%s]", stored[i].Role)
+		if metas[i].Name != "" {
+			fmt.Fprintf(&b, " %s result", metas[i].Name)
+		}
+		b.WriteByte('\n')
+		content := stored[i].Content
+		if len(content) > compactMessageBytes {
+			content = truncateUTF8(content, compactMessageBytes) + "\n[truncated]"
+		}
+		b.WriteString(content)
+		for _, item := range metas[i].Attachments {
+			fmt.Fprintf(&b, "\n[attached %s]", item.Path)
+		}
+		for _, call := range metas[i].ToolCalls {
+			fmt.Fprintf(&b, "\n[called %s %s]", call.Name, truncateUTF8(string(call.Arguments), compactMessageBytes))
+		}
+		part := b.String()
+		parts = append(parts, part)
+		total += tokenizer.Count(part)
+	}
+	dropped := 0
+	for len(parts) > 1 && total > limit {
+		total -= tokenizer.Count(parts[0])
+		parts = parts[1:]
+		dropped++
+	}
+
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("Summary of the conversation before these messages:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&b, "[%d earlier messages omitted]\n\n", dropped)
+	}
+	b.WriteString(strings.Join(parts, "\n\n"))
+	return b.String()
+}
+
+// historyEntry is one message of the conversation rebuilt from a thread.
+// files is the part of the content that came from attachments; usage is
+// what the provider reported for the call that wrote an assistant message.
+type historyEntry struct {
+	message   llm.Message
+	files     string
+	fileCount int
+	summary   bool
+	usage     *llm.Usage
+	model     string
+}
+
+func historyMessages(entries []historyEntry) []llm.Message {
+	out := make([]llm.Message, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.message)
+	}
+	return out
+}
+
+func (r *Runner) loadMessages(threadID string) ([]threads.Message, error) {
+	var stored []threads.Message
+	offset := 0
+	for {
+		page, err := r.threads.Messages(threadID, offset, threads.MaxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, page.Messages...)
+		if page.NextOffset == nil {
+			return stored, nil
+		}
+		offset = *page.NextOffset
+	}
+}
+
+func decodeMeta(message threads.Message) messageMeta {
+	var meta messageMeta
+	if len(message.Meta) > 0 {
+		_ = json.Unmarshal(message.Meta, &meta)
+	}
+	return meta
+}
+
+func indexOfMessage(stored []threads.Message, id string) int {
+	for i, message := range stored {
+		if message.ID == id {
+			return i
+		}
+	}
+	return -1
+}
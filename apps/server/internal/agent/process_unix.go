@@ -0,0 +1,10 @@
+//go:build !windows
+
+package agent
+
+import "os/exec"
+
+// shellCommand runs command through the POSIX shell.
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package agent
+
+import "os/exec"
+
+func shellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
@@ -0,0 +1,614 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/monorepo/internal/approvals"
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/procgroup"
+	"local/monorepo/internal/threads"
+)
+
+const (
+	ToolStat   = "stat_path"
+	ToolList   = "list_directory"
+	ToolRead   = "read_file"
+	ToolSearch = "search_files"
+	ToolWrite  = "write_file"
+	ToolCreate = "create_path"
+	ToolDelete = "delete_path"
+	ToolExec   = "run_command"
+)
+
+var (
+	ErrToolNotAllowed   = errors.New("tool is not allowed in this mode")
+	ErrUnknownTool      = errors.New("unknown tool")
+	ErrInvalidArguments = errors.New("invalid tool arguments")
+	ErrOutsideWorkspace = fs.ErrOutsideWorkspace
+)
+
+// modeTools lists the tools each thread mode may call. Ask and Plan only
+// read the workspace, since a command can write anything; Agent has every
+// tool.
+var modeTools = map[string][]string{
+	threads.ModeAsk:   {ToolStat, ToolList, ToolRead, ToolSearch},
+	threads.ModePlan:  {ToolStat, ToolList, ToolRead, ToolSearch},
+	threads.ModeAgent: {ToolStat, ToolList, ToolRead, ToolSearch, ToolWrite, ToolCreate, ToolDelete, ToolExec},
+}
+
+// externalModes lists the modes that may call external tools. Nothing is
+// known about what those do, so only Agent may.
+var externalModes = map[string]bool{
+	threads.ModeAgent: true,
+}
+
+// ToolsForMode returns the names of the tools allowed in mode.
+func ToolsForMode(mode string) []string {
+	return append([]string(nil), modeTools[mode]...)
+}
+
+func toolAllowed(mode, name string) bool {
+	for _, allowed := range modeTools[mode] {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+var toolDefinitions = map[string]llm.Tool{
+	ToolStat: {
+		Name:        ToolStat,
+		Description: "Report whether a path exists and whether it is a file or directory, with its size and modification time.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Path relative to the workspace root."}},"required":["path"]}`),
+	},
+	ToolList: {
+		Name:        ToolList,
+		Description: "List the entries of a directory. Directories end with a slash.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string","description":"Directory relative to the workspace root; \".\" for the root."}},"required":["path"]}`),
+	},
+	ToolRead: {
+		Name:        ToolRead,
+		Description: "Read a text file. Optionally limit the output to a 1-based, inclusive line range.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"startLine":{"type":"integer","minimum":1},"endLine":{"type":"integer","minimum":1}},"required":["path"]}`),
+	},
+	ToolSearch: {
+		Name:        ToolSearch,
+		Description: "Search the text files under a directory for lines matching a literal string or a regular expression. Returns path:line:column: text per match.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string"},"path":{"type":"string","description":"File or directory relative to the workspace root; defaults to the root."},"regex":{"type":"boolean"},"caseSensitive":{"type":"boolean"},"include":{"type":"string","description":"File name glob such as \"*.go\"."},"maxResults":{"type":"integer","minimum":1}},"required":["query"]}`),
+	},
+	ToolWrite: {
+		Name:        ToolWrite,
+		Description: "Replace the full contents of a text file, creating it and its parent directories if needed.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"content":{"type":"string"}},"required":["path","content"]}`),
+	},
+	ToolCreate: {
+		Name:        ToolCreate,
+		Description: "Create an empty file, or a directory when directory is true. Fails if the path exists.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"directory":{"type":"boolean"}},"required":["path"]}`),
+	},
+	ToolDelete: {
+		Name:        ToolDelete,
+		Description: "Delete a file, or a directory when recursive is true.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"path":{"type":"string"},"recursive":{"type":"boolean"}},"required":["path"]}`),
+	},
+	ToolExec: {
+		Name:        ToolExec,
+		Description: "Run a shell command in the workspace root and return its exit code and combined output.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"command":{"type":"string"},"timeoutSeconds":{"type":"integer","minimum":1}},"required":["command"]}`),
+	},
+}
+
+// ExternalTools supplies tools that live outside the server, such as those
+// of connected MCP servers. They are offered in Agent mode only and are
+// approved like commands, by tool name; names that clash with a built-in
+// tool are ignored.
+type ExternalTools interface {
+	Tools() []llm.Tool
+	Call(ctx context.Context, name string, arguments json.RawMessage) (content string, isError bool, err error)
+}
+
+var errExternalToolFailed = errors.New("tool reported an error")
+
+func toolsFor(mode string) []llm.Tool {
+	names := modeTools[mode]
+	out := make([]llm.Tool, 0, len(names))
+	for _, name := range names {
+		out = append(out, toolDefinitions[name])
+	}
+	return out
+}
+
+// ToolResult is the outcome of one tool call as reported to the model.
+type ToolResult struct {
+	CallID     string `json:"callId"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+	IsError    bool   `json:"isError,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// toolbox executes tool calls for one run, confined to its workspace.
+type toolbox struct {
+	fs        *fs.Service
+	workspace string
+	mode      string
+	cfg       Config
+	external  ExternalTools
+}
+
+// definitions returns the built-in tools of the mode followed by the
+// external ones it may call.
+func (t *toolbox) definitions() []llm.Tool {
+	tools := toolsFor(t.mode)
+	if t.external == nil || !externalModes[t.mode] {
+		return tools
+	}
+	for _, tool := range t.external.Tools() {
+		if _, builtin := toolDefinitions[tool.Name]; !builtin {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+func (t *toolbox) isExternal(name string) bool {
+	if t.external == nil || !externalModes[t.mode] {
+		return false
+	}
+	if _, builtin := toolDefinitions[name]; builtin {
+		return false
+	}
+	for _, tool := range t.external.Tools() {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Toolbox runs the tools of one mode against a workspace outside of an
+// agent run, for front ends such as the MCP server. Calls go through the
+// approval gate like a run's, when there is one.
+type Toolbox struct {
+	tools *toolbox
+	gate  *approvals.Gate
+}
+
+// NewToolbox confines tools to workspace, which must be a directory. Zero
+// fields of cfg take their defaults.
+func NewToolbox(cfg Config, fsService *fs.Service, gate *approvals.Gate, workspace, mode string) (*Toolbox, error) {
+	if _, ok := modeTools[mode]; !ok {
+		return nil, ErrUnsupportedMode
+	}
+	workspace = strings.TrimSpace(workspace)
+	if workspace == "" || !filepath.IsAbs(workspace) {
+		return nil, threads.ErrWorkspaceRequired
+	}
+	workspace = filepath.Clean(workspace)
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		return nil, ErrWorkspaceNotFound
+	}
+	defaults := DefaultConfig()
+	if cfg.ExecTimeout <= 0 {
+		cfg.ExecTimeout = defaults.ExecTimeout
+	}
+	if cfg.MaxExecTimeout <= 0 {
+		cfg.MaxExecTimeout = defaults.MaxExecTimeout
+	}
+	if cfg.MaxToolOutputBytes <= 0 {
+		cfg.MaxToolOutputBytes = defaults.MaxToolOutputBytes
+	}
+	return &Toolbox{
+		tools: &toolbox{fs: fsService, workspace: workspace, mode: mode, cfg: cfg},
+		gate:  gate,
+	}, nil
+}
+
+func (t *Toolbox) Workspace() string {
+	return t.tools.workspace
+}
+
+func (t *Toolbox) Mode() string {
+	return t.tools.mode
+}
+
+// Tools returns the definitions of the tools the toolbox may call.
+func (t *Toolbox) Tools() []llm.Tool {
+	return toolsFor(t.tools.mode)
+}
+
+// Resolve maps a path onto the workspace like the tools do, rejecting
+// anything outside it.
+func (t *Toolbox) Resolve(path string) (string, error) {
+	return t.tools.resolve(path)
+}
+
+// Call runs one tool call once the approval gate lets it through. A denied
+// call is a failed result; an error means ctx ended while the call waited
+// for approval.
+func (t *Toolbox) Call(ctx context.Context, call llm.ToolCall) (ToolResult, error) {
+	if t.gate != nil {
+		if req, ok := t.tools.approvalRequest(call); ok {
+			approval, err := t.gate.Check(ctx, req, nil)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ToolResult{}, err
+				}
+				return ToolResult{CallID: call.ID, Name: call.Name, Content: "error: approval policy failed: " + err.Error(), IsError: true}, nil
+			}
+			if approval.Status == approvals.StatusDenied {
+				return deniedResult(call, approval), nil
+			}
+		}
+	}
+	return t.tools.call(ctx, call), nil
+}
+
+func deniedResult(call llm.ToolCall, approval approvals.Approval) ToolResult {
+	content := "error: the user denied this tool call"
+	if approval.Automatic {
+		content = "error: this tool call is denied by the workspace approval rules"
+	}
+	if approval.Reason != "" {
+		content += ": " + approval.Reason
+	}
+	return ToolResult{CallID: call.ID, Name: call.Name, Content: content, IsError: true}
+}
+
+func (t *toolbox) call(ctx context.Context, call llm.ToolCall) ToolResult {
+	started := time.Now()
+	content, err := t.dispatch(ctx, call)
+	result := ToolResult{CallID: call.ID, Name: call.Name, Content: content}
+	if err != nil {
+		result.IsError = true
+		result.Content = "error: " + err.Error()
+		if content != "" {
+			result.Content += "\n" + content
+		}
+	}
+	if len(result.Content) > t.cfg.MaxToolOutputBytes {
+		result.Content = truncateUTF8(result.Content, t.cfg.MaxToolOutputBytes) + "\n[output truncated]"
+		result.Truncated = true
+	}
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result
+}
+
+func (t *toolbox) dispatch(ctx context.Context, call llm.ToolCall) (string, error) {
+	if t.isExternal(call.Name) {
+		content, isError, err := t.external.Call(ctx, call.Name, call.Arguments)
+		if err == nil && isError {
+			err = errExternalToolFailed
+		}
+		return content, err
+	}
+	if _, ok := toolDefinitions[call.Name]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Name)
+	}
+	if !toolAllowed(t.mode, call.Name) {
+		return "", fmt.Errorf("%w: %s in %s mode", ErrToolNotAllowed, call.Name, t.mode)
+	}
+
+	args, err := parseArgs(call)
+	if err != nil {
+		return "", err
+	}
+
+	if call.Name == ToolExec {
+		return t.exec(ctx, args.Command, args.TimeoutSeconds)
+	}
+	if call.Name == ToolSearch && strings.TrimSpace(args.Path) == "" {
+		args.Path = "."
+	}
+	path, err := t.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	switch call.Name {
+	case ToolStat:
+		return t.stat(ctx, path)
+	case ToolList:
+		return t.list(ctx, path)
+	case ToolRead:
+		return t.read(ctx, path, args.StartLine, args.EndLine)
+	case ToolSearch:
+		return t.search(ctx, path, args)
+	case ToolWrite:
+		stat, err := t.fs.WriteText(ctx, path, args.Content)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("wrote %s (%d bytes)", t.relative(stat.Path), stat.Size), nil
+	case ToolCreate:
+		stat, err := t.fs.Create(ctx, path, args.Directory)
+		if err != nil {
+			return "", err
+		}
+		if stat.IsDir {
+			return "created directory " + t.relative(stat.Path), nil
+		}
+		return "created file " + t.relative(stat.Path), nil
+	case ToolDelete:
+		if path == t.workspace {
+			return "", fmt.Errorf("%w: refusing to delete the workspace root", ErrInvalidArguments)
+		}
+		if err := t.fs.Delete(ctx, path, args.Recursive); err != nil {
+			return "", err
+		}
+		return "deleted " + t.relative(path), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownTool, call.Name)
+}
+
+type toolArgs struct {
+	Path           string `json:"path"`
+	Content        string `json:"content"`
+	StartLine      int    `json:"startLine"`
+	EndLine        int    `json:"endLine"`
+	Directory      bool   `json:"directory"`
+	Recursive      bool   `json:"recursive"`
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	Query          string `json:"query"`
+	Regex          bool   `json:"regex"`
+	CaseSensitive  bool   `json:"caseSensitive"`
+	Include        string `json:"include"`
+	MaxResults     int    `json:"maxResults"`
+}
+
+func parseArgs(call llm.ToolCall) (toolArgs, error) {
+	var args toolArgs
+	if err := json.Unmarshal(call.Arguments, &args); err != nil {
+		return toolArgs{}, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	return args, nil
+}
+
+// approvalRequest classifies a call for the approval policy. It reports
+// false for calls that will fail validation anyway.
+func (t *toolbox) approvalRequest(call llm.ToolCall) (approvals.Request, bool) {
+	if t.isExternal(call.Name) {
+		return approvals.Request{
+			Workspace: t.workspace,
+			Tool:      call.Name,
+			Category:  approvals.CategoryExec,
+			Subject:   call.Name,
+			Arguments: call.Arguments,
+		}, true
+	}
+	if !toolAllowed(t.mode, call.Name) {
+		return approvals.Request{}, false
+	}
+	args, err := parseArgs(call)
+	if err != nil {
+		return approvals.Request{}, false
+	}
+	req := approvals.Request{Workspace: t.workspace, Tool: call.Name, Arguments: call.Arguments}
+	if call.Name == ToolExec {
+		req.Subject = strings.TrimSpace(args.Command)
+		req.Category = approvals.CommandCategory(req.Subject)
+		return req, req.Subject != ""
+	}
+	if call.Name == ToolSearch && strings.TrimSpace(args.Path) == "" {
+		args.Path = "."
+	}
+	path, err := t.resolve(args.Path)
+	if err != nil {
+		return approvals.Request{}, false
+	}
+	req.Subject = t.relative(path)
+	switch call.Name {
+	case ToolWrite, ToolCreate:
+		req.Category = approvals.CategoryWrite
+	case ToolDelete:
+		req.Category = approvals.CategoryDelete
+	default:
+		req.Category = approvals.CategoryRead
+	}
+	return req, true
+}
+
+// resolve maps a tool path onto the workspace, rejecting anything that
+// escapes it.
+func (t *toolbox) resolve(raw string) (string, error) {
+	path, err := fs.ResolveInWorkspace(t.workspace, raw)
+	if errors.Is(err, fs.ErrPathRequired) {
+		return "", fmt.Errorf("%w: path is required", ErrInvalidArguments)
+	}
+	return path, err
+}
+
+func (t *toolbox) relative(path string) string {
+	rel, err := filepath.Rel(t.workspace, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (t *toolbox) stat(ctx context.Context, path string) (string, error) {
+	stat, err := t.fs.Stat(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case !stat.Exists:
+		return t.relative(path) + " does not exist", nil
+	case stat.IsDir:
+		return fmt.Sprintf("%s is a directory, modified %s", t.relative(path), stat.ModTime.UTC().Format(time.RFC3339)), nil
+	default:
+		return fmt.Sprintf("%s is a file of %d bytes, modified %s", t.relative(path), stat.Size, stat.ModTime.UTC().Format(time.RFC3339)), nil
+	}
+}
+
+func (t *toolbox) list(ctx context.Context, path string) (string, error) {
+	entries, err := t.fs.List(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return t.relative(path) + " is empty", nil
+	}
+	var out strings.Builder
+	for _, entry := range entries {
+		out.WriteString(entry.Name)
+		if entry.IsDir {
+			out.WriteString("/")
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+func (t *toolbox) read(ctx context.Context, path string, startLine, endLine int) (string, error) {
+	result, err := t.fs.ReadText(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if startLine <= 0 && endLine <= 0 {
+		return result.Content, nil
+	}
+
+	lines := strings.SplitAfter(result.Content, "\n")
+	if startLine <= 0 {
+		startLine = 1
+	}
+	if endLine <= 0 || endLine > len(lines) {
+		endLine = len(lines)
+	}
+	if startLine > endLine {
+		return "", fmt.Errorf("%w: file has %d lines", ErrInvalidArguments, len(lines))
+	}
+	return strings.Join(lines[startLine-1:endLine], ""), nil
+}
+
+func (t *toolbox) search(ctx context.Context, path string, args toolArgs) (string, error) {
+	result, err := t.fs.Search(ctx, path, fs.SearchOptions{
+		Query:         args.Query,
+		Regex:         args.Regex,
+		CaseSensitive: args.CaseSensitive,
+		Include:       args.Include,
+		MaxResults:    args.MaxResults,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Matches) == 0 {
+		return fmt.Sprintf("no matches in %d files", result.FilesSearched), nil
+	}
+	var out strings.Builder
+	for _, match := range result.Matches {
+		fmt.Fprintf(&out, "%s:%d:%d: %s\n", t.relative(match.Path), match.Line, match.Column, match.Text)
+	}
+	if result.Truncated {
+		out.WriteString("[more matches not shown]\n")
+	}
+	return out.String(), nil
+}
+
+func (t *toolbox) exec(ctx context.Context, command string, timeoutSeconds int) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("%w: command is required", ErrInvalidArguments)
+	}
+	timeout := t.cfg.ExecTimeout
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds) * time.Second
+		if timeout > t.cfg.MaxExecTimeout {
+			timeout = t.cfg.MaxExecTimeout
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := shellCommand(command)
+	cmd.Dir = t.workspace
+	cmd.Env = append(os.Environ(), "FORCE_COLOR=0", "NO_COLOR=1", "CI=1", "GIT_TERMINAL_PROMPT=0")
+	var output limitedBuffer
+	output.limit = t.cfg.MaxToolOutputBytes
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Output left open by a backgrounded grandchild must not hold up Wait.
+	cmd.WaitDelay = execOutputWaitDelay
+	procgroup.Configure(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			procgroup.Terminate(cmd, execCancelGrace, done)
+		case <-done:
+		}
+	}()
+	waitErr := cmd.Wait()
+	close(done)
+
+	text := output.String()
+	if output.dropped > 0 {
+		text += fmt.Sprintf("\n[%d bytes of output dropped]", output.dropped)
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return text, fmt.Errorf("command timed out after %s", timeout)
+	case ctx.Err() != nil:
+		return text, ctx.Err()
+	case waitErr == nil, errors.Is(waitErr, exec.ErrWaitDelay):
+		return "exit code 0\n" + text, nil
+	case errors.As(waitErr, &exitErr):
+		return fmt.Sprintf("exit code %d\n%s", exitErr.ExitCode(), text), nil
+	default:
+		return text, waitErr
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written and counts the rest.
+type limitedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	room := b.limit - b.buf.Len()
+	if room < 0 {
+		room = 0
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.dropped += len(p) - room
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+func truncateUTF8(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
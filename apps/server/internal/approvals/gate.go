@@ -0,0 +1,262 @@
+package approvals
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAllowed  = "allowed"
+	StatusDenied   = "denied"
+	StatusCanceled = "canceled"
+)
+
+const subscriptionBuffer = 64
+
+// Request describes a tool call that needs a decision. Subject is what
+// rules match against: the command for exec and network calls, the
+// workspace-relative path otherwise.
+type Request struct {
+	RunID     string          `json:"runId,omitempty"`
+	ThreadID  string          `json:"threadId,omitempty"`
+	Workspace string          `json:"workspace"`
+	Tool      string          `json:"tool"`
+	Category  string          `json:"category"`
+	Subject   string          `json:"subject"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Approval is a decided or pending tool call. Automatic decisions carry
+// the rule that made them, if any.
+type Approval struct {
+	ID string `json:"id"`
+	Request
+	Status     string     `json:"status"`
+	Automatic  bool       `json:"automatic,omitempty"`
+	RuleID     string     `json:"ruleId,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Resolution answers a pending approval. With Remember set, a rule for the
+// workspace is stored so matching calls are decided the same way from then
+// on; Pattern narrows it and defaults to the approval's subject.
+type Resolution struct {
+	Decision string
+	Remember bool
+	Pattern  *string
+	Reason   string
+}
+
+type pending struct {
+	approval Approval
+	decided  chan struct{}
+}
+
+// Gate decides tool calls against the workspace rules and holds the ones
+// that need the user until they are resolved or their run is canceled.
+type Gate struct {
+	store *Store
+
+	mu      sync.Mutex
+	pending map[string]*pending
+	subs    map[*Subscription]struct{}
+}
+
+func NewGate(store *Store) *Gate {
+	return &Gate{
+		store:   store,
+		pending: map[string]*pending{},
+		subs:    map[*Subscription]struct{}{},
+	}
+}
+
+func (g *Gate) Store() *Store {
+	return g.store
+}
+
+// Check decides req. When the rules say to ask, it publishes a pending
+// approval and blocks until the user resolves it or ctx is done; onPending,
+// if set, is called with the pending approval before blocking.
+func (g *Gate) Check(ctx context.Context, req Request, onPending func(Approval)) (Approval, error) {
+	decision, rule, err := g.store.Decide(req.Workspace, req.Category, req.Subject)
+	if err != nil {
+		return Approval{}, err
+	}
+	now := time.Now().UTC()
+	approval := Approval{ID: newID(), Request: req, CreatedAt: now}
+	if decision != DecisionAsk {
+		approval.Automatic = true
+		approval.ResolvedAt = &now
+		approval.Status = StatusAllowed
+		if decision == DecisionDeny {
+			approval.Status = StatusDenied
+		}
+		if rule != nil {
+			approval.RuleID = rule.ID
+		}
+		return approval, nil
+	}
+
+	approval.Status = StatusPending
+	entry := &pending{approval: approval, decided: make(chan struct{})}
+	g.mu.Lock()
+	g.pending[approval.ID] = entry
+	g.publishLocked(approval)
+	g.mu.Unlock()
+	if onPending != nil {
+		onPending(approval)
+	}
+
+	select {
+	case <-entry.decided:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return entry.approval, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if entry.approval.Status != StatusPending {
+			return entry.approval, nil
+		}
+		delete(g.pending, approval.ID)
+		resolved := time.Now().UTC()
+		entry.approval.Status = StatusCanceled
+		entry.approval.ResolvedAt = &resolved
+		g.publishLocked(entry.approval)
+		return entry.approval, ctx.Err()
+	}
+}
+
+// Resolve allows or denies a pending approval.
+func (g *Gate) Resolve(id string, resolution Resolution) (Approval, error) {
+	switch resolution.Decision {
+	case DecisionAllow, DecisionDeny:
+	default:
+		return Approval{}, fmt.Errorf("%w: must be allow or deny", ErrInvalidDecision)
+	}
+
+	g.mu.Lock()
+	entry, ok := g.pending[id]
+	if !ok {
+		g.mu.Unlock()
+		return Approval{}, ErrApprovalNotFound
+	}
+	if entry.approval.Status != StatusPending {
+		g.mu.Unlock()
+		return Approval{}, ErrAlreadyResolved
+	}
+	request := entry.approval.Request
+	g.mu.Unlock()
+
+	var ruleID string
+	if resolution.Remember {
+		pattern := request.Subject
+		if resolution.Pattern != nil {
+			pattern = *resolution.Pattern
+		}
+		rule, err := g.store.AddRule(request.Workspace, Rule{Category: request.Category, Pattern: pattern, Decision: resolution.Decision})
+		if err != nil {
+			return Approval{}, err
+		}
+		ruleID = rule.ID
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if entry.approval.Status != StatusPending {
+		return Approval{}, ErrAlreadyResolved
+	}
+	now := time.Now().UTC()
+	entry.approval.Status = StatusAllowed
+	if resolution.Decision == DecisionDeny {
+		entry.approval.Status = StatusDenied
+	}
+	entry.approval.RuleID = ruleID
+	entry.approval.Reason = strings.TrimSpace(resolution.Reason)
+	entry.approval.ResolvedAt = &now
+	delete(g.pending, id)
+	close(entry.decided)
+	g.publishLocked(entry.approval)
+	return entry.approval, nil
+}
+
+func (g *Gate) Get(id string) (Approval, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.pending[id]
+	if !ok {
+		return Approval{}, ErrApprovalNotFound
+	}
+	return entry.approval, nil
+}
+
+// Pending lists approvals waiting for the user, oldest first, limited to
+// workspace when set.
+func (g *Gate) Pending(workspace string) []Approval {
+	if workspace != "" {
+		workspace = filepath.Clean(workspace)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]Approval, 0, len(g.pending))
+	for _, entry := range g.pending {
+		if workspace == "" || entry.approval.Workspace == workspace {
+			out = append(out, entry.approval)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Subscription receives every approval that becomes pending or is
+// resolved. C is closed when the subscriber falls behind or is closed;
+// callers should then re-list.
+type Subscription struct {
+	C    <-chan Approval
+	ch   chan Approval
+	gate *Gate
+}
+
+func (g *Gate) Subscribe() *Subscription {
+	ch := make(chan Approval, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, gate: g}
+	g.mu.Lock()
+	g.subs[sub] = struct{}{}
+	g.mu.Unlock()
+	return sub
+}
+
+func (sub *Subscription) Close() {
+	sub.gate.mu.Lock()
+	defer sub.gate.mu.Unlock()
+	sub.gate.unsubscribeLocked(sub)
+}
+
+func (g *Gate) unsubscribeLocked(sub *Subscription) {
+	if _, ok := g.subs[sub]; !ok {
+		return
+	}
+	delete(g.subs, sub)
+	close(sub.ch)
+}
+
+func (g *Gate) publishLocked(approval Approval) {
+	for sub := range g.subs {
+		select {
+		case sub.ch <- approval:
+		default:
+			g.unsubscribeLocked(sub)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package approvals
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrApprovalNotFound  = errors.New("approval not found")
+	ErrAlreadyResolved   = errors.New("approval already resolved")
+	ErrRuleNotFound      = errors.New("approval rule not found")
+	ErrInvalidCategory   = errors.New("invalid approval category")
+	ErrInvalidDecision   = errors.New("invalid approval decision")
+	ErrWorkspaceRequired = errors.New("workspace is required")
+)
+
+const (
+	CategoryRead    = "read"
+	CategoryWrite   = "write"
+	CategoryDelete  = "delete"
+	CategoryExec    = "exec"
+	CategoryNetwork = "network"
+)
+
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+	DecisionAsk   = "ask"
+)
+
+// defaultDecisions apply when no rule matches. Reading is always safe;
+// anything that changes the workspace or leaves the machine asks first.
+var defaultDecisions = map[string]string{
+	CategoryRead:    DecisionAllow,
+	CategoryWrite:   DecisionAsk,
+	CategoryDelete:  DecisionAsk,
+	CategoryExec:    DecisionAsk,
+	CategoryNetwork: DecisionAsk,
+}
+
+// networkCommands start commands that reach the network. Running one is
+// classified as CategoryNetwork instead of CategoryExec.
+var networkCommands = map[string]bool{
+	"curl": true, "wget": true, "ssh": true, "scp": true, "rsync": true,
+	"nc": true, "ncat": true, "telnet": true, "ftp": true, "sftp": true,
+}
+
+// networkSubcommands are tool subcommands that download or upload.
+var networkSubcommands = map[string][]string{
+	"git":    {"clone", "fetch", "pull", "push", "ls-remote", "submodule"},
+	"go":     {"get", "install", "mod"},
+	"npm":    {"install", "i", "ci", "add", "publish", "update"},
+	"pnpm":   {"install", "i", "add", "publish", "update"},
+	"yarn":   {"install", "add", "publish", "upgrade"},
+	"pip":    {"install", "download"},
+	"pip3":   {"install", "download"},
+	"cargo":  {"install", "fetch", "publish", "update"},
+	"docker": {"pull", "push", "login"},
+}
+
+// CommandCategory classifies a shell command as CategoryNetwork when any
+// of its pipeline segments starts a known network command, and as
+// CategoryExec otherwise.
+func CommandCategory(command string) string {
+	for _, segment := range splitCommand(command) {
+		fields := strings.Fields(segment)
+		for len(fields) > 0 && (strings.Contains(fields[0], "=") || fields[0] == "sudo" || fields[0] == "env") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		name := filepath.Base(fields[0])
+		if networkCommands[name] {
+			return CategoryNetwork
+		}
+		if len(fields) > 1 {
+			for _, sub := range networkSubcommands[name] {
+				if fields[1] == sub {
+					return CategoryNetwork
+				}
+			}
+		}
+	}
+	return CategoryExec
+}
+
+func splitCommand(command string) []string {
+	return strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n' || r == '(' || r == ')' || r == '`'
+	})
+}
+
+// hasShellControl reports whether a command chains, substitutes or
+// redirects, in which case a prefix rule such as "go test" must not allow
+// it: "go test ./... && rm -rf ~" starts with "go test" too.
+func hasShellControl(command string) bool {
+	return strings.ContainsAny(command, ";&|`$<>\n()")
+}
+
+// Rule decides tool calls of one category whose subject matches Pattern.
+// An empty pattern matches every call of the category. Patterns match a
+// command or workspace-relative path by prefix at a word or path boundary,
+// and "*" matches any run of characters.
+type Rule struct {
+	ID        string    `json:"id"`
+	Category  string    `json:"category"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Decision  string    `json:"decision"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (rule Rule) matches(category, subject string) bool {
+	if rule.Category != category {
+		return false
+	}
+	if rule.Pattern == "" {
+		return true
+	}
+	if rule.Decision != DecisionDeny && (category == CategoryExec || category == CategoryNetwork) && hasShellControl(subject) {
+		return false
+	}
+	return matchPattern(rule.Pattern, subject)
+}
+
+func matchPattern(pattern, subject string) bool {
+	if strings.Contains(pattern, "*") {
+		return matchGlob(pattern, subject)
+	}
+	if !strings.HasPrefix(subject, pattern) {
+		return false
+	}
+	if len(subject) == len(pattern) || strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, " ") {
+		return true
+	}
+	next := subject[len(pattern)]
+	return next == ' ' || next == '/' || next == '\t'
+}
+
+// matchGlob matches subject against pattern where "*" matches any run of
+// characters, including separators.
+func matchGlob(pattern, subject string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(subject, parts[0]) {
+		return false
+	}
+	subject = subject[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(subject, part)
+		if index < 0 {
+			return false
+		}
+		subject = subject[index+len(part):]
+	}
+	return strings.HasSuffix(subject, last)
+}
+
+// decide returns the decision for a call and the rule that made it, if
+// any. Deny rules win over ask rules, which win over allow rules.
+func decide(rules []Rule, category, subject string) (string, *Rule) {
+	var matched [3]*Rule
+	for i := range rules {
+		if !rules[i].matches(category, subject) {
+			continue
+		}
+		switch rules[i].Decision {
+		case DecisionDeny:
+			matched[0] = &rules[i]
+		case DecisionAsk:
+			if matched[1] == nil {
+				matched[1] = &rules[i]
+			}
+		case DecisionAllow:
+			if matched[2] == nil {
+				matched[2] = &rules[i]
+			}
+		}
+		if matched[0] != nil {
+			break
+		}
+	}
+	for _, rule := range matched {
+		if rule != nil {
+			return rule.Decision, rule
+		}
+	}
+	return defaultDecisions[category], nil
+}
+
+// Store persists rules per workspace as one JSON file under dir, named by
+// a hash of the workspace path.
+type Store struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string][]Rule
+}
+
+type rulesFile struct {
+	Workspace string `json:"workspace"`
+	Rules     []Rule `json:"rules"`
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, cache: map[string][]Rule{}}, nil
+}
+
+// Rules returns the rules of a workspace in the order they were added.
+func (s *Store) Rules(workspace string) ([]Rule, error) {
+	workspace, err := cleanWorkspace(workspace)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules, err := s.loadLocked(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Rule{}, rules...), nil
+}
+
+// AddRule stores a rule for workspace. A rule with the same category and
+// pattern is replaced.
+func (s *Store) AddRule(workspace string, rule Rule) (Rule, error) {
+	workspace, err := cleanWorkspace(workspace)
+	if err != nil {
+		return Rule{}, err
+	}
+	if _, ok := defaultDecisions[rule.Category]; !ok {
+		return Rule{}, ErrInvalidCategory
+	}
+	switch rule.Decision {
+	case DecisionAllow, DecisionDeny, DecisionAsk:
+	default:
+		return Rule{}, fmt.Errorf("%w: must be allow, deny or ask", ErrInvalidDecision)
+	}
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.ID = newID()
+	rule.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules, err := s.loadLocked(workspace)
+	if err != nil {
+		return Rule{}, err
+	}
+	next := make([]Rule, 0, len(rules)+1)
+	for _, existing := range rules {
+		if existing.Category != rule.Category || existing.Pattern != rule.Pattern {
+			next = append(next, existing)
+		}
+	}
+	next = append(next, rule)
+	if err := s.saveLocked(workspace, next); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+func (s *Store) DeleteRule(workspace, id string) error {
+	workspace, err := cleanWorkspace(workspace)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules, err := s.loadLocked(workspace)
+	if err != nil {
+		return err
+	}
+	next := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.ID != id {
+			next = append(next, rule)
+		}
+	}
+	if len(next) == len(rules) {
+		return ErrRuleNotFound
+	}
+	return s.saveLocked(workspace, next)
+}
+
+// Decide evaluates a call of category on subject against the workspace's
+// rules and the defaults.
+func (s *Store) Decide(workspace, category, subject string) (string, *Rule, error) {
+	rules, err := s.Rules(workspace)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := defaultDecisions[category]; !ok {
+		return "", nil, ErrInvalidCategory
+	}
+	decision, rule := decide(rules, category, subject)
+	return decision, rule, nil
+}
+
+func (s *Store) loadLocked(workspace string) ([]Rule, error) {
+	if rules, ok := s.cache[workspace]; ok {
+		return rules, nil
+	}
+	raw, err := os.ReadFile(s.path(workspace))
+	if errors.Is(err, os.ErrNotExist) {
+		s.cache[workspace] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file rulesFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse approval rules for %s: %w", workspace, err)
+	}
+	s.cache[workspace] = file.Rules
+	return file.Rules, nil
+}
+
+func (s *Store) saveLocked(workspace string, rules []Rule) error {
+	raw, err := json.MarshalIndent(rulesFile{Workspace: workspace, Rules: rules}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".rules-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, s.path(workspace)); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	s.cache[workspace] = rules
+	return nil
+}
+
+func (s *Store) path(workspace string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+func cleanWorkspace(workspace string) (string, error) {
+	workspace = strings.TrimSpace(workspace)
+	if workspace == "" {
+		return "", ErrWorkspaceRequired
+	}
+	return filepath.Clean(workspace), nil
+}
+
+func newID() string {
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}
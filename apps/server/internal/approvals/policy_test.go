@@ -0,0 +1,142 @@
+package approvals
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"go test", "go test", true},
+		{"go test", "go test ./...", true},
+		{"go test", "go test\t-run X", true},
+		{"go", "go/bin/tool", true},
+		{"git", "gitk", false},
+		{"go test", "go testing", false},
+		{"src/", "src/main.go", true},
+		{"src", "src/main.go", true},
+		{"src", "srcs/main.go", false},
+		{"make ", "make all", true},
+		{"npm run", "npm", false},
+		{"*.go", "src/main.go", true},
+		{"*.go", "src/main.js", false},
+		{"src/*_test.go", "src/a/b_test.go", true},
+		{"src/*_test.go", "lib/b_test.go", false},
+		{"go * ./...", "go test -v ./...", true},
+		{"go * ./...", "go test ./cmd", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"*", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.subject, func(t *testing.T) {
+			if got := matchPattern(tt.pattern, tt.subject); got != tt.want {
+				t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasShellControl(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"go test ./...", false},
+		{"ls -la src/", false},
+		{"grep -r 'foo bar' .", false},
+		{"go test ./...; rm -rf ~", true},
+		{"go test ./... && rm -rf ~", true},
+		{"go test ./... & rm -rf ~", true},
+		{"go test ./... || rm -rf ~", true},
+		{"go test ./... | sh", true},
+		{"go test `rm -rf ~`", true},
+		{"go test $(rm -rf ~)", true},
+		{"echo $HOME", true},
+		{"go test < input", true},
+		{"go test > output", true},
+		{"go test\nrm -rf ~", true},
+		{"(rm -rf ~)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := hasShellControl(tt.command); got != tt.want {
+				t.Errorf("hasShellControl(%q) = %v, want %v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandCategory(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"go test ./...", CategoryExec},
+		{"go get example.com/mod", CategoryNetwork},
+		{"git status", CategoryExec},
+		{"git push origin main", CategoryNetwork},
+		{"curl https://example.com", CategoryNetwork},
+		{"/usr/bin/curl https://example.com", CategoryNetwork},
+		{"sudo wget https://example.com", CategoryNetwork},
+		{"HTTPS_PROXY=x env npm install", CategoryNetwork},
+		{"npm run build", CategoryExec},
+		{"make && git pull", CategoryNetwork},
+		{"echo $(ssh host)", CategoryNetwork},
+		{"echo `ssh host`", CategoryNetwork},
+		{"", CategoryExec},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := CommandCategory(tt.command); got != tt.want {
+				t.Errorf("CommandCategory(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	rules := []Rule{
+		{ID: "allow-go", Category: CategoryExec, Pattern: "go", Decision: DecisionAllow},
+		{ID: "ask-go-generate", Category: CategoryExec, Pattern: "go generate", Decision: DecisionAsk},
+		{ID: "deny-rm", Category: CategoryExec, Pattern: "rm", Decision: DecisionDeny},
+		{ID: "deny-chained-rm", Category: CategoryExec, Pattern: "*rm -rf*", Decision: DecisionDeny},
+		{ID: "allow-writes", Category: CategoryWrite, Decision: DecisionAllow},
+		{ID: "deny-secrets", Category: CategoryWrite, Pattern: "secrets/", Decision: DecisionDeny},
+	}
+	tests := []struct {
+		name     string
+		category string
+		subject  string
+		want     string
+		wantRule string
+	}{
+		{"allow rule", CategoryExec, "go test ./...", DecisionAllow, "allow-go"},
+		{"ask wins over allow", CategoryExec, "go generate ./...", DecisionAsk, "ask-go-generate"},
+		{"deny rule", CategoryExec, "rm file", DecisionDeny, "deny-rm"},
+		{"no rule falls back to the default", CategoryExec, "make", DecisionAsk, ""},
+		{"allow does not cover chained commands", CategoryExec, "go test ./... | tee log", DecisionAsk, ""},
+		{"deny still matches chained commands", CategoryExec, "go test ./... && rm -rf ~", DecisionDeny, "deny-chained-rm"},
+		{"empty pattern matches the category", CategoryWrite, "src/main.go", DecisionAllow, "allow-writes"},
+		{"deny wins over an empty pattern", CategoryWrite, "secrets/key.pem", DecisionDeny, "deny-secrets"},
+		{"rules are per category", CategoryNetwork, "go get example.com/mod", DecisionAsk, ""},
+		{"reading is allowed by default", CategoryRead, "src/main.go", DecisionAllow, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rule := decide(rules, tt.category, tt.subject)
+			gotRule := ""
+			if rule != nil {
+				gotRule = rule.ID
+			}
+			if got != tt.want || gotRule != tt.wantRule {
+				t.Errorf("decide(%q, %q) = %q by %q, want %q by %q", tt.category, tt.subject, got, gotRule, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
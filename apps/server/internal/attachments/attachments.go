@@ -0,0 +1,541 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"local/monorepo/internal/diagnostics"
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/git"
+)
+
+var (
+	ErrWorkspaceRequired = errors.New("workspace is required")
+	ErrWorkspaceNotFound = errors.New("workspace does not exist")
+	ErrNoReferences      = errors.New("no references provided")
+	ErrTooManyReferences = errors.New("too many references")
+	ErrUnknownKind       = errors.New("unknown reference kind")
+	ErrOutsideWorkspace  = fs.ErrOutsideWorkspace
+	ErrInvalidSelection  = errors.New("invalid line selection")
+	ErrUnavailable       = errors.New("reference source is unavailable")
+)
+
+const (
+	KindFile        = "file"
+	KindFolder      = "folder"
+	KindGlob        = "glob"
+	KindGitDiff     = "git_diff"
+	KindTerminal    = "terminal"
+	KindDiagnostics = "diagnostics"
+)
+
+const (
+	defaultMaxBytes      = 256 * 1024
+	defaultMaxBytesLimit = 2 * 1024 * 1024
+	defaultMaxBlockBytes = 64 * 1024
+	defaultMaxReferences = 64
+	defaultMaxGlobFiles  = 50
+	defaultFolderDepth   = 2
+	maxFolderDepth       = 5
+	maxFolderEntries     = 500
+	maxGlobVisitedDirs   = 5_000
+	defaultTerminalLines = 200
+	maxTerminalLines     = 5_000
+	// truncationMarkerBytes is reserved in a cut block for its marker.
+	truncationMarkerBytes = 64
+)
+
+type Config struct {
+	// MaxBytes is the default content budget of one request; MaxBytesLimit
+	// caps what a request may ask for. MaxBlockBytes caps a single block.
+	MaxBytes      int
+	MaxBytesLimit int
+	MaxBlockBytes int
+	MaxReferences int
+	// MaxGlobFiles caps the files one glob expands to.
+	MaxGlobFiles int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxBytes:      defaultMaxBytes,
+		MaxBytesLimit: defaultMaxBytesLimit,
+		MaxBlockBytes: defaultMaxBlockBytes,
+		MaxReferences: defaultMaxReferences,
+		MaxGlobFiles:  defaultMaxGlobFiles,
+	}
+}
+
+// TerminalOutputFunc returns the recent output of a terminal session as
+// plain text.
+type TerminalOutputFunc func(id string) (string, error)
+
+// Reference points at something to attach to a prompt. Which fields apply
+// depends on Kind:
+//   - file: Path, with StartLine and EndLine (1-based, inclusive) to select
+//     lines
+//   - folder: Path and Depth, summarized as a tree
+//   - glob: Pattern relative to the workspace, where "**" matches any number
+//     of directories
+//   - git_diff: unstaged changes, or staged ones with Staged, limited to Path
+//   - terminal: the last Lines lines of terminal Session
+//   - diagnostics: problems under Path, at least as severe as Severity
+type Reference struct {
+	Kind      string `json:"kind"`
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"startLine,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	Depth     int    `json:"depth,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Staged    bool   `json:"staged,omitempty"`
+	Session   string `json:"session,omitempty"`
+	Lines     int    `json:"lines,omitempty"`
+	Severity  string `json:"severity,omitempty"`
+}
+
+// Block is the resolved content of a reference. Paths are relative to the
+// workspace. Bytes is the content size before truncation; a block the
+// budget had no room for is Truncated with no content, and a reference that
+// cannot be resolved yields a block with Error set.
+type Block struct {
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	Path      string `json:"path,omitempty"`
+	StartLine int    `json:"startLine,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Content   string `json:"content"`
+	Bytes     int    `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// tail keeps the end of the content instead of the start when it is
+	// truncated.
+	tail bool
+}
+
+type Request struct {
+	Workspace  string
+	References []Reference
+	// MaxBytes and MaxBlockBytes override the configured budgets; zero
+	// means the default.
+	MaxBytes      int
+	MaxBlockBytes int
+}
+
+// Result holds the blocks in reference order and Prompt, the blocks that
+// resolved rendered as one text ready to include in a message.
+type Result struct {
+	Blocks    []Block `json:"blocks"`
+	Bytes     int     `json:"bytes"`
+	MaxBytes  int     `json:"maxBytes"`
+	Truncated bool    `json:"truncated"`
+	Prompt    string  `json:"prompt"`
+}
+
+// Resolver turns references into size-budgeted content blocks. Files are
+// read through fs.Service, so its size limits and binary detection apply.
+type Resolver struct {
+	cfg         Config
+	fs          *fs.Service
+	git         *git.Service
+	diagnostics *diagnostics.Store
+	terminal    TerminalOutputFunc
+}
+
+// NewResolver returns a resolver. gitService, diagnosticsStore and
+// terminalOutput may be nil, in which case their references fail with
+// ErrUnavailable.
+func NewResolver(cfg Config, fsService *fs.Service, gitService *git.Service, diagnosticsStore *diagnostics.Store, terminalOutput TerminalOutputFunc) *Resolver {
+	defaults := DefaultConfig()
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaults.MaxBytes
+	}
+	if cfg.MaxBytesLimit <= 0 {
+		cfg.MaxBytesLimit = defaults.MaxBytesLimit
+	}
+	if cfg.MaxBlockBytes <= 0 {
+		cfg.MaxBlockBytes = defaults.MaxBlockBytes
+	}
+	if cfg.MaxReferences <= 0 {
+		cfg.MaxReferences = defaults.MaxReferences
+	}
+	if cfg.MaxGlobFiles <= 0 {
+		cfg.MaxGlobFiles = defaults.MaxGlobFiles
+	}
+	return &Resolver{cfg: cfg, fs: fsService, git: gitService, diagnostics: diagnosticsStore, terminal: terminalOutput}
+}
+
+// Resolve resolves every reference in order and fits the blocks into the
+// byte budget: each block gets at most the per-block limit and what is left
+// of the total, and content cut short ends with a truncation marker.
+func (r *Resolver) Resolve(ctx context.Context, req Request) (Result, error) {
+	workspace := strings.TrimSpace(req.Workspace)
+	if workspace == "" {
+		return Result{}, ErrWorkspaceRequired
+	}
+	workspace = filepath.Clean(workspace)
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		return Result{}, ErrWorkspaceNotFound
+	}
+	if len(req.References) == 0 {
+		return Result{}, ErrNoReferences
+	}
+	if len(req.References) > r.cfg.MaxReferences {
+		return Result{}, fmt.Errorf("%w: at most %d", ErrTooManyReferences, r.cfg.MaxReferences)
+	}
+
+	maxBytes := req.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = r.cfg.MaxBytes
+	}
+	if maxBytes > r.cfg.MaxBytesLimit {
+		maxBytes = r.cfg.MaxBytesLimit
+	}
+	maxBlock := req.MaxBlockBytes
+	if maxBlock <= 0 || maxBlock > r.cfg.MaxBlockBytes {
+		maxBlock = r.cfg.MaxBlockBytes
+	}
+
+	result := Result{Blocks: []Block{}, MaxBytes: maxBytes}
+	remaining := maxBytes
+	for _, ref := range req.References {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		blocks, err := r.resolve(ctx, workspace, ref)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Result{}, ctx.Err()
+			}
+			result.Blocks = append(result.Blocks, Block{Kind: ref.Kind, Title: referenceTitle(ref), Path: ref.Path, Error: err.Error()})
+			continue
+		}
+		for _, block := range blocks {
+			block.Bytes = len(block.Content)
+			limit := maxBlock
+			if remaining < limit {
+				limit = remaining
+			}
+			if len(block.Content) > limit {
+				block.Content = truncate(block.Content, limit, block.tail)
+				block.Truncated = true
+				result.Truncated = true
+			}
+			remaining -= len(block.Content)
+			if remaining < 0 {
+				remaining = 0
+			}
+			result.Bytes += len(block.Content)
+			result.Blocks = append(result.Blocks, block)
+		}
+	}
+	result.Prompt = Render(result.Blocks)
+	return result, nil
+}
+
+func (r *Resolver) resolve(ctx context.Context, workspace string, ref Reference) ([]Block, error) {
+	switch ref.Kind {
+	case KindFile:
+		block, err := r.file(ctx, workspace, ref.Path, ref.StartLine, ref.EndLine)
+		if err != nil {
+			return nil, err
+		}
+		return []Block{block}, nil
+	case KindFolder:
+		return r.folder(ctx, workspace, ref)
+	case KindGlob:
+		return r.glob(ctx, workspace, ref.Pattern)
+	case KindGitDiff:
+		return r.gitDiff(ctx, workspace, ref)
+	case KindTerminal:
+		return r.terminalTail(ref)
+	case KindDiagnostics:
+		return r.problems(workspace, ref)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, ref.Kind)
+	}
+}
+
+func (r *Resolver) file(ctx context.Context, workspace, raw string, startLine, endLine int) (Block, error) {
+	path, err := fs.ResolveInWorkspace(workspace, raw)
+	if err != nil {
+		return Block{}, err
+	}
+	read, err := r.fs.ReadText(ctx, path)
+	if err != nil {
+		return Block{}, err
+	}
+	rel := relative(workspace, path)
+	block := Block{Kind: KindFile, Title: rel, Path: rel, Language: languageFor(path), Content: read.Content}
+	if startLine <= 0 && endLine <= 0 {
+		return block, nil
+	}
+
+	lines := strings.SplitAfter(read.Content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if startLine <= 0 {
+		startLine = 1
+	}
+	if endLine <= 0 || endLine > len(lines) {
+		endLine = len(lines)
+	}
+	if startLine > endLine {
+		return Block{}, fmt.Errorf("%w: file has %d lines", ErrInvalidSelection, len(lines))
+	}
+	block.StartLine, block.EndLine = startLine, endLine
+	block.Title = fmt.Sprintf("%s:%d-%d", rel, startLine, endLine)
+	block.Content = strings.Join(lines[startLine-1:endLine], "")
+	return block, nil
+}
+
+// folder summarizes a directory as an indented tree, skipping generated and
+// dependency directories.
+func (r *Resolver) folder(ctx context.Context, workspace string, ref Reference) ([]Block, error) {
+	path, err := fs.ResolveInWorkspace(workspace, firstNonEmpty(ref.Path, "."))
+	if err != nil {
+		return nil, err
+	}
+	depth := ref.Depth
+	if depth <= 0 {
+		depth = defaultFolderDepth
+	}
+	if depth > maxFolderDepth {
+		depth = maxFolderDepth
+	}
+
+	var b strings.Builder
+	files, dirs, entries := 0, 0, 0
+	var walk func(dir string, level int) error
+	walk = func(dir string, level int) error {
+		list, err := r.fs.List(ctx, dir)
+		if err != nil {
+			return err
+		}
+		indent := strings.Repeat("  ", level)
+		for _, entry := range list {
+			if entries >= maxFolderEntries {
+				return nil
+			}
+			entries++
+			if !entry.IsDir {
+				files++
+				fmt.Fprintf(&b, "%s%s\n", indent, entry.Name)
+				continue
+			}
+			dirs++
+			if skippedDirs[entry.Name] {
+				fmt.Fprintf(&b, "%s%s/ (skipped)\n", indent, entry.Name)
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s/\n", indent, entry.Name)
+			if level+1 < depth {
+				if err := walk(entry.Path, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(path, 0); err != nil {
+		return nil, err
+	}
+
+	rel := relative(workspace, path)
+	var header strings.Builder
+	fmt.Fprintf(&header, "%s/ (%d files, %d directories within depth %d", rel, files, dirs, depth)
+	if entries >= maxFolderEntries {
+		fmt.Fprintf(&header, ", listing stopped at %d entries", maxFolderEntries)
+	}
+	header.WriteString(")\n")
+	return []Block{{Kind: KindFolder, Title: rel + "/", Path: rel, Content: header.String() + b.String()}}, nil
+}
+
+func (r *Resolver) gitDiff(ctx context.Context, workspace string, ref Reference) ([]Block, error) {
+	if r.git == nil {
+		return nil, ErrUnavailable
+	}
+	title := "git diff"
+	if ref.Staged {
+		title += " --staged"
+	}
+	var path, rel string
+	if strings.TrimSpace(ref.Path) != "" {
+		var err error
+		if path, err = fs.ResolveInWorkspace(workspace, ref.Path); err != nil {
+			return nil, err
+		}
+		rel = relative(workspace, path)
+		title += " -- " + rel
+	}
+	patch, err := r.git.UnifiedDiff(ctx, workspace, path, ref.Staged)
+	if err != nil {
+		return nil, err
+	}
+	if patch == "" {
+		patch = "(no changes)\n"
+	}
+	return []Block{{Kind: KindGitDiff, Title: title, Path: rel, Language: "diff", Content: patch}}, nil
+}
+
+func (r *Resolver) terminalTail(ref Reference) ([]Block, error) {
+	if r.terminal == nil {
+		return nil, ErrUnavailable
+	}
+	output, err := r.terminal(ref.Session)
+	if err != nil {
+		return nil, err
+	}
+	count := ref.Lines
+	if count <= 0 {
+		count = defaultTerminalLines
+	}
+	if count > maxTerminalLines {
+		count = maxTerminalLines
+	}
+	lines := strings.Split(strings.TrimRight(output, " \t\n"), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return []Block{{
+		Kind:    KindTerminal,
+		Title:   "terminal " + shortID(ref.Session),
+		Content: strings.Join(lines, "\n") + "\n",
+		tail:    true,
+	}}, nil
+}
+
+func (r *Resolver) problems(workspace string, ref Reference) ([]Block, error) {
+	if r.diagnostics == nil {
+		return nil, ErrUnavailable
+	}
+	title := "diagnostics"
+	var path, rel string
+	if strings.TrimSpace(ref.Path) != "" {
+		var err error
+		if path, err = fs.ResolveInWorkspace(workspace, ref.Path); err != nil {
+			return nil, err
+		}
+		rel = relative(workspace, path)
+		title += " in " + rel
+	}
+
+	var b strings.Builder
+	for _, file := range r.diagnostics.Query(diagnostics.Filter{Root: workspace, Path: path, Severity: ref.Severity}) {
+		name := relative(workspace, file.Path)
+		for _, item := range file.Diagnostics {
+			fmt.Fprintf(&b, "%s:%d", name, item.Line)
+			if item.Column > 0 {
+				fmt.Fprintf(&b, ":%d", item.Column)
+			}
+			fmt.Fprintf(&b, ": %s: %s", item.Severity, item.Message)
+			if item.Source != "" {
+				fmt.Fprintf(&b, " (%s", item.Source)
+				if item.Code != "" {
+					fmt.Fprintf(&b, " %s", item.Code)
+				}
+				b.WriteString(")")
+			}
+			b.WriteByte('\n')
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("(no diagnostics)\n")
+	}
+	return []Block{{Kind: KindDiagnostics, Title: title, Path: rel, Content: b.String()}}, nil
+}
+
+// Render formats the blocks that resolved as tagged sections for a prompt,
+// leaving out blocks the budget left empty.
+func Render(blocks []Block) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		if block.Error != "" || block.Content == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "<context kind=%q title=%q>\n%s", block.Kind, block.Title, block.Content)
+		if !strings.HasSuffix(block.Content, "\n") {
+			b.WriteByte('\n')
+		}
+		b.WriteString("</context>")
+	}
+	return b.String()
+}
+
+// truncate cuts content to fit limit bytes, marker included, at a line
+// boundary when one is close. It keeps the start or, with tail, the end.
+// Nothing is kept when the limit leaves no room past the marker.
+func truncate(content string, limit int, tail bool) string {
+	limit -= truncationMarkerBytes
+	if limit <= 0 {
+		return ""
+	}
+	if tail {
+		cut := len(content) - limit
+		if index := strings.IndexByte(content[cut:], '\n'); index >= 0 && index < limit/2 {
+			cut += index + 1
+		}
+		for cut < len(content) && !utf8.RuneStart(content[cut]) {
+			cut++
+		}
+		return fmt.Sprintf("[truncated: first %d of %d bytes omitted]\n", cut, len(content)) + content[cut:]
+	}
+	cut := limit
+	if index := strings.LastIndexByte(content[:cut], '\n'); index >= limit/2 {
+		cut = index + 1
+	}
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	kept := content[:cut]
+	if !strings.HasSuffix(kept, "\n") {
+		kept += "\n"
+	}
+	return kept + fmt.Sprintf("[truncated: showing %d of %d bytes]\n", cut, len(content))
+}
+
+func relative(workspace, path string) string {
+	rel, err := filepath.Rel(workspace, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func referenceTitle(ref Reference) string {
+	switch {
+	case ref.Path != "":
+		return ref.Path
+	case ref.Pattern != "":
+		return ref.Pattern
+	case ref.Session != "":
+		return "terminal " + shortID(ref.Session)
+	default:
+		return ref.Kind
+	}
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var errGlobLimit = errors.New("glob walk limit reached")
+
+// skippedDirs hold dependencies and build output; globs and folder
+// summaries never descend into them.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	".next":        true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// glob expands pattern to the workspace files it matches and resolves each
+// as a file block. Matches beyond the limit are listed in a final block.
+func (r *Resolver) glob(ctx context.Context, workspace, pattern string) ([]Block, error) {
+	pattern = strings.Trim(filepath.ToSlash(strings.TrimSpace(pattern)), "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: pattern is required", ErrInvalidSelection)
+	}
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	segments := strings.Split(pattern, "/")
+
+	var matches []string
+	visited := 0
+	err := filepath.WalkDir(workspace, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if current == workspace {
+				return err
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if entry.IsDir() {
+			if current != workspace && skippedDirs[entry.Name()] {
+				return filepath.SkipDir
+			}
+			visited++
+			if visited > maxGlobVisitedDirs {
+				return errGlobLimit
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if matchSegments(segments, strings.Split(relative(workspace, current), "/")) {
+			matches = append(matches, current)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errGlobLimit) {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %q", pattern)
+	}
+	sort.Strings(matches)
+
+	blocks := make([]Block, 0, len(matches))
+	shown := matches
+	if len(shown) > r.cfg.MaxGlobFiles {
+		shown = shown[:r.cfg.MaxGlobFiles]
+	}
+	for _, match := range shown {
+		block, err := r.file(ctx, workspace, match, 0, 0)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			rel := relative(workspace, match)
+			block = Block{Kind: KindFile, Title: rel, Path: rel, Error: err.Error()}
+		}
+		blocks = append(blocks, block)
+	}
+	if rest := matches[len(shown):]; len(rest) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d more files match %s:\n", len(rest), pattern)
+		for _, match := range rest {
+			fmt.Fprintf(&b, "%s\n", relative(workspace, match))
+		}
+		blocks = append(blocks, Block{Kind: KindGlob, Title: pattern, Content: b.String()})
+	}
+	return blocks, nil
+}
+
+// matchSegments matches slash-separated path segments against pattern
+// segments, where "**" matches zero or more segments and the others use
+// path.Match syntax.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+var languages = map[string]string{
+	".go":    "go",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".py":    "python",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".cs":    "csharp",
+	".sh":    "bash",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".scss":  "scss",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".md":    "markdown",
+	".proto": "protobuf",
+}
+
+func languageFor(name string) string {
+	return languages[strings.ToLower(filepath.Ext(name))]
+}
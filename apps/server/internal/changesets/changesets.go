@@ -0,0 +1,580 @@
+// Package changesets stages agent edits server-side instead of writing them
+// to disk. Each changeset keeps, per file, the on-disk content seen when the
+// file was first staged (the baseline) and the proposed content (the shadow
+// copy). Edits are reviewed as diffs against the baseline and applied or
+// rejected per file or per hunk. Nothing here depends on git.
+package changesets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/diff"
+	fsservice "local/monorepo/internal/fs"
+)
+
+var (
+	ErrChangesetNotFound = errors.New("changeset not found")
+	ErrInvalidID         = errors.New("invalid changeset id")
+	ErrFileNotStaged     = errors.New("file is not part of the changeset")
+	ErrConflict          = errors.New("file changed on disk since it was staged")
+	ErrHunkNotFound      = errors.New("hunk not found")
+	ErrInvalidArgument   = errors.New("invalid argument")
+)
+
+const (
+	StatusAdded    = "added"
+	StatusModified = "modified"
+	StatusDeleted  = "deleted"
+)
+
+const maxIDLength = 64
+
+type Summary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Root      string    `json:"root,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Files     int       `json:"files"`
+	Additions int       `json:"additions"`
+	Deletions int       `json:"deletions"`
+	Conflicts int       `json:"conflicts"`
+}
+
+type FileChange struct {
+	Path      string      `json:"path"`
+	Status    string      `json:"status"`
+	Conflict  bool        `json:"conflict"`
+	Additions int         `json:"additions"`
+	Deletions int         `json:"deletions"`
+	Hunks     []diff.Hunk `json:"hunks"`
+}
+
+type Detail struct {
+	Summary
+	Changes []FileChange `json:"changes"`
+}
+
+type CreateOptions struct {
+	ID    string
+	Title string
+	Root  string
+}
+
+// Selection picks what Apply and Reject act on: every file when Path is
+// empty, one file, or some hunks of one file.
+type Selection struct {
+	Path  string
+	Hunks []int
+	// Force applies whole files even when they changed on disk.
+	Force bool
+}
+
+type Manager struct {
+	files *fsservice.Service
+	store *store
+
+	mu         sync.Mutex
+	changesets map[string]*changeset
+}
+
+// NewManager loads the changesets persisted under dir.
+func NewManager(dir string, files *fsservice.Service) (*Manager, error) {
+	if files == nil {
+		files = fsservice.NewService(fsservice.DefaultConfig())
+	}
+	st := &store{dir: dir}
+	loaded, err := st.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{files: files, store: st, changesets: map[string]*changeset{}}
+	for _, cs := range loaded {
+		m.changesets[cs.ID] = cs
+	}
+	return m, nil
+}
+
+func (m *Manager) Create(opts CreateOptions) (Summary, error) {
+	id := strings.TrimSpace(opts.ID)
+	if id == "" {
+		id = newID()
+	}
+	if !validID(id) {
+		return Summary{}, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cs, ok := m.changesets[id]; ok {
+		return m.summary(context.Background(), cs), nil
+	}
+	cs, err := m.create(id, opts.Title, opts.Root)
+	if err != nil {
+		return Summary{}, err
+	}
+	return m.summary(context.Background(), cs), nil
+}
+
+func (m *Manager) create(id, title, root string) (*changeset, error) {
+	now := time.Now().UTC()
+	cs := &changeset{
+		ID:        id,
+		Title:     strings.TrimSpace(title),
+		Root:      strings.TrimSpace(root),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Files:     map[string]*fileEntry{},
+	}
+	if err := m.store.save(cs); err != nil {
+		return nil, err
+	}
+	m.changesets[id] = cs
+	return cs, nil
+}
+
+func (m *Manager) List(ctx context.Context) []Summary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Summary, 0, len(m.changesets))
+	for _, cs := range m.changesets {
+		out = append(out, m.summary(ctx, cs))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Detail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs, ok := m.changesets[id]
+	if !ok {
+		return Detail{}, ErrChangesetNotFound
+	}
+	return m.detail(ctx, cs)
+}
+
+// Discard drops a changeset and its shadow copies without touching disk.
+func (m *Manager) Discard(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.changesets[id]; !ok {
+		return ErrChangesetNotFound
+	}
+	delete(m.changesets, id)
+	return m.store.remove(id)
+}
+
+// StageWrite records content as the proposed version of path. Unknown but
+// well-formed ids create a changeset on first use.
+func (m *Manager) StageWrite(ctx context.Context, id, path, content string) (FileChange, error) {
+	return m.stage(ctx, id, path, content, false)
+}
+
+// StageDelete records the deletion of path.
+func (m *Manager) StageDelete(ctx context.Context, id, path string) (FileChange, error) {
+	return m.stage(ctx, id, path, "", true)
+}
+
+func (m *Manager) stage(ctx context.Context, id, rawPath, content string, deleted bool) (FileChange, error) {
+	if !validID(id) {
+		return FileChange{}, ErrInvalidID
+	}
+	path, err := absolutePath(rawPath)
+	if err != nil {
+		return FileChange{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs, ok := m.changesets[id]
+	if !ok {
+		if cs, err = m.create(id, "", ""); err != nil {
+			return FileChange{}, err
+		}
+	}
+
+	entry, ok := cs.Files[path]
+	if !ok {
+		baseline, exists, err := m.readDisk(ctx, path)
+		if err != nil {
+			return FileChange{}, err
+		}
+		if deleted && !exists {
+			return FileChange{}, fsservice.ErrPathNotFound
+		}
+		entry = &fileEntry{Path: path, BaseExists: exists}
+		if entry.BaseHash, err = m.store.putBlob(id, baseline); err != nil {
+			return FileChange{}, err
+		}
+	}
+
+	entry.Deleted = deleted
+	if entry.ShadowHash, err = m.store.putBlob(id, content); err != nil {
+		return FileChange{}, err
+	}
+
+	if entry.unchanged() {
+		delete(cs.Files, path)
+	} else {
+		cs.Files[path] = entry
+	}
+	if err := m.touch(cs); err != nil {
+		return FileChange{}, err
+	}
+
+	if !entry.unchanged() {
+		return m.fileChange(ctx, cs, entry)
+	}
+	return FileChange{Path: path, Status: StatusModified, Hunks: []diff.Hunk{}}, nil
+}
+
+// Read returns the staged content of path. ok is false when the changeset
+// does not touch the file; deleted reports a staged deletion.
+func (m *Manager) Read(id, rawPath string) (content string, ok, deleted bool, err error) {
+	path, err := absolutePath(rawPath)
+	if err != nil {
+		return "", false, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs, found := m.changesets[id]
+	if !found {
+		return "", false, false, nil
+	}
+	entry, found := cs.Files[path]
+	if !found {
+		return "", false, false, nil
+	}
+	if entry.Deleted {
+		return "", true, true, nil
+	}
+	content, err = m.store.getBlob(id, entry.ShadowHash)
+	return content, true, false, err
+}
+
+// Apply writes the selected changes to disk.
+func (m *Manager) Apply(ctx context.Context, id string, sel Selection) (Detail, error) {
+	return m.resolve(ctx, id, sel, true)
+}
+
+// Reject drops the selected changes from the changeset.
+func (m *Manager) Reject(ctx context.Context, id string, sel Selection) (Detail, error) {
+	return m.resolve(ctx, id, sel, false)
+}
+
+func (m *Manager) resolve(ctx context.Context, id string, sel Selection, apply bool) (Detail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cs, ok := m.changesets[id]
+	if !ok {
+		return Detail{}, ErrChangesetNotFound
+	}
+
+	var entries []*fileEntry
+	if strings.TrimSpace(sel.Path) == "" {
+		if len(sel.Hunks) > 0 {
+			return Detail{}, fmt.Errorf("%w: hunks require a path", ErrInvalidArgument)
+		}
+		for _, entry := range cs.Files {
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	} else {
+		path, err := absolutePath(sel.Path)
+		if err != nil {
+			return Detail{}, err
+		}
+		entry, ok := cs.Files[path]
+		if !ok {
+			return Detail{}, ErrFileNotStaged
+		}
+		entries = []*fileEntry{entry}
+	}
+
+	var err error
+	for _, entry := range entries {
+		switch {
+		case len(sel.Hunks) > 0 && apply:
+			err = m.applyHunks(ctx, cs, entry, sel.Hunks)
+		case len(sel.Hunks) > 0:
+			err = m.rejectHunks(cs, entry, sel.Hunks)
+		case apply:
+			err = m.applyFile(ctx, cs, entry, sel.Force)
+		default:
+			delete(cs.Files, entry.Path)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if touchErr := m.touch(cs); err == nil {
+		err = touchErr
+	}
+	if err != nil {
+		return Detail{}, err
+	}
+	return m.detail(ctx, cs)
+}
+
+func (m *Manager) applyFile(ctx context.Context, cs *changeset, entry *fileEntry, force bool) error {
+	conflict, err := m.conflicted(ctx, cs, entry)
+	if err != nil {
+		return err
+	}
+	if conflict && !force {
+		return fmt.Errorf("%w: %s", ErrConflict, entry.Path)
+	}
+
+	if entry.Deleted {
+		err = m.files.Delete(ctx, entry.Path, false)
+		if errors.Is(err, fsservice.ErrPathNotFound) {
+			err = nil
+		}
+	} else {
+		var shadow string
+		if shadow, err = m.store.getBlob(cs.ID, entry.ShadowHash); err == nil {
+			_, err = m.files.WriteText(ctx, entry.Path, shadow)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	delete(cs.Files, entry.Path)
+	return nil
+}
+
+// applyHunks writes the baseline plus the selected hunks to disk. The
+// result becomes the new baseline, so applied hunks leave the diff.
+func (m *Manager) applyHunks(ctx context.Context, cs *changeset, entry *fileEntry, indexes []int) error {
+	if entry.Deleted {
+		return fmt.Errorf("%w: deletions are applied per file", ErrInvalidArgument)
+	}
+	conflict, err := m.conflicted(ctx, cs, entry)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		return fmt.Errorf("%w: %s", ErrConflict, entry.Path)
+	}
+
+	baseline, shadow, hunks, err := m.hunks(cs, entry)
+	if err != nil {
+		return err
+	}
+	selected, _, err := splitHunks(hunks, indexes)
+	if err != nil {
+		return err
+	}
+	next, err := diff.Apply(baseline, selected)
+	if err != nil {
+		return err
+	}
+	if _, err := m.files.WriteText(ctx, entry.Path, next); err != nil {
+		return err
+	}
+
+	entry.BaseExists = true
+	if entry.BaseHash, err = m.store.putBlob(cs.ID, next); err != nil {
+		return err
+	}
+	if next == shadow {
+		delete(cs.Files, entry.Path)
+	}
+	return nil
+}
+
+// rejectHunks rebuilds the shadow copy from the baseline and the hunks
+// that were not rejected.
+func (m *Manager) rejectHunks(cs *changeset, entry *fileEntry, indexes []int) error {
+	if entry.Deleted {
+		return fmt.Errorf("%w: deletions are rejected per file", ErrInvalidArgument)
+	}
+	baseline, _, hunks, err := m.hunks(cs, entry)
+	if err != nil {
+		return err
+	}
+	_, kept, err := splitHunks(hunks, indexes)
+	if err != nil {
+		return err
+	}
+	next, err := diff.Apply(baseline, kept)
+	if err != nil {
+		return err
+	}
+
+	if entry.ShadowHash, err = m.store.putBlob(cs.ID, next); err != nil {
+		return err
+	}
+	if entry.unchanged() {
+		delete(cs.Files, entry.Path)
+	}
+	return nil
+}
+
+func splitHunks(hunks []diff.Hunk, indexes []int) (selected, rest []diff.Hunk, err error) {
+	chosen := map[int]bool{}
+	for _, index := range indexes {
+		if index < 0 || index >= len(hunks) {
+			return nil, nil, fmt.Errorf("%w: %d", ErrHunkNotFound, index)
+		}
+		chosen[index] = true
+	}
+	for i, hunk := range hunks {
+		if chosen[i] {
+			selected = append(selected, hunk)
+		} else {
+			rest = append(rest, hunk)
+		}
+	}
+	return selected, rest, nil
+}
+
+func (m *Manager) hunks(cs *changeset, entry *fileEntry) (baseline, shadow string, hunks []diff.Hunk, err error) {
+	if baseline, err = m.store.getBlob(cs.ID, entry.BaseHash); err != nil {
+		return "", "", nil, err
+	}
+	if !entry.Deleted {
+		if shadow, err = m.store.getBlob(cs.ID, entry.ShadowHash); err != nil {
+			return "", "", nil, err
+		}
+	}
+	return baseline, shadow, diff.Compute(baseline, shadow, diff.DefaultContext), nil
+}
+
+func (m *Manager) fileChange(ctx context.Context, cs *changeset, entry *fileEntry) (FileChange, error) {
+	_, _, hunks, err := m.hunks(cs, entry)
+	if err != nil {
+		return FileChange{}, err
+	}
+	conflict, err := m.conflicted(ctx, cs, entry)
+	if err != nil {
+		return FileChange{}, err
+	}
+
+	change := FileChange{Path: entry.Path, Status: entry.status(), Conflict: conflict, Hunks: hunks}
+	for _, hunk := range hunks {
+		added, removed := hunk.Stats()
+		change.Additions += added
+		change.Deletions += removed
+	}
+	return change, nil
+}
+
+// conflicted reports whether the file on disk no longer matches the
+// baseline captured when it was staged.
+func (m *Manager) conflicted(ctx context.Context, cs *changeset, entry *fileEntry) (bool, error) {
+	current, exists, err := m.readDisk(ctx, entry.Path)
+	if err != nil {
+		if errors.Is(err, fsservice.ErrBinaryFile) || errors.Is(err, fsservice.ErrFileTooLarge) {
+			return true, nil
+		}
+		return false, err
+	}
+	if exists != entry.BaseExists {
+		return true, nil
+	}
+	return hashContent(current) != entry.BaseHash, nil
+}
+
+func (m *Manager) readDisk(ctx context.Context, path string) (string, bool, error) {
+	result, err := m.files.ReadText(ctx, path)
+	if errors.Is(err, fsservice.ErrPathNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return result.Content, true, nil
+}
+
+func (m *Manager) detail(ctx context.Context, cs *changeset) (Detail, error) {
+	out := Detail{Summary: m.summary(ctx, cs), Changes: []FileChange{}}
+	for _, entry := range cs.sortedFiles() {
+		change, err := m.fileChange(ctx, cs, entry)
+		if err != nil {
+			return Detail{}, err
+		}
+		out.Changes = append(out.Changes, change)
+	}
+	return out, nil
+}
+
+func (m *Manager) summary(ctx context.Context, cs *changeset) Summary {
+	out := Summary{
+		ID:        cs.ID,
+		Title:     cs.Title,
+		Root:      cs.Root,
+		CreatedAt: cs.CreatedAt,
+		UpdatedAt: cs.UpdatedAt,
+		Files:     len(cs.Files),
+	}
+	for _, entry := range cs.Files {
+		change, err := m.fileChange(ctx, cs, entry)
+		if err != nil {
+			continue
+		}
+		out.Additions += change.Additions
+		out.Deletions += change.Deletions
+		if change.Conflict {
+			out.Conflicts++
+		}
+	}
+	return out
+}
+
+func (m *Manager) touch(cs *changeset) error {
+	cs.UpdatedAt = time.Now().UTC()
+	return m.store.save(cs)
+}
+
+func absolutePath(rawPath string) (string, error) {
+	if strings.TrimSpace(rawPath) == "" {
+		return "", fsservice.ErrPathRequired
+	}
+	absPath, err := filepath.Abs(filepath.Clean(rawPath))
+	if err != nil {
+		return "", fsservice.ErrInvalidPath
+	}
+	return absPath, nil
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("cs-%d", time.Now().UnixNano())
+	}
+	return "cs-" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,395 @@
+package changesets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fsservice "local/monorepo/internal/fs"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(t.TempDir(), fsservice.NewService(fsservice.DefaultConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func numberedLines(n int, sep string, edit map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line := fmt.Sprintf("line %d", i)
+		if replacement, ok := edit[i]; ok {
+			line = replacement
+		}
+		b.WriteString(line + sep)
+	}
+	return b.String()
+}
+
+func TestApplyHunksKeepsCRLFFilesInSync(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	path := filepath.Join(t.TempDir(), "main.txt")
+	if err := os.WriteFile(path, []byte(numberedLines(40, "\r\n", nil)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create(CreateOptions{ID: "crlf"}); err != nil {
+		t.Fatal(err)
+	}
+	// the new lines end in LF, as an agent's edits often do; applying one
+	// hunk leaves the file with mixed line endings
+	staged := numberedLines(40, "\r\n", map[int]string{3: "changed 3\n", 35: "changed 35\n"})
+	staged = strings.ReplaceAll(staged, "\n\r\n", "\n")
+	change, err := m.StageWrite(ctx, "crlf", path, staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Hunks) != 2 {
+		t.Fatalf("staged %d hunks, want 2", len(change.Hunks))
+	}
+
+	detail, err := m.Apply(ctx, "crlf", Selection{Path: path, Hunks: []int{0}})
+	if err != nil {
+		t.Fatalf("apply first hunk: %v", err)
+	}
+	if len(detail.Changes) != 1 || detail.Changes[0].Conflict || len(detail.Changes[0].Hunks) != 1 {
+		t.Fatalf("after the first hunk: %+v", detail.Changes)
+	}
+	if _, err := m.Apply(ctx, "crlf", Selection{Path: path, Hunks: []int{0}}); err != nil {
+		t.Fatalf("apply second hunk: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != staged {
+		t.Errorf("file = %q, want the staged content byte for byte", raw)
+	}
+}
+
+func TestApplyAndReject(t *testing.T) {
+	base := numberedLines(40, "\n", nil)
+	staged := numberedLines(40, "\n", map[int]string{3: "changed 3", 35: "changed 35"})
+	tests := []struct {
+		name string
+		// base is the file on disk when staging; noBase leaves it absent
+		base    string
+		noBase  bool
+		stage   string
+		deleted bool
+		// edit, when set, replaces the file on disk after staging
+		edit    string
+		apply   bool
+		sel     Selection
+		selPath string
+		wantErr error
+		// want is the file on disk afterwards; wantGone means absent
+		want     string
+		wantGone bool
+		// wantHunks counts the hunks still staged; -1 means the file is
+		// no longer part of the changeset
+		wantHunks int
+	}{
+		{
+			name:      "apply the whole file",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			want:      staged,
+			wantHunks: -1,
+		},
+		{
+			name:      "apply every file",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			selPath:   "-",
+			want:      staged,
+			wantHunks: -1,
+		},
+		{
+			name:      "apply one hunk",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			sel:       Selection{Hunks: []int{1}},
+			want:      numberedLines(40, "\n", map[int]string{35: "changed 35"}),
+			wantHunks: 1,
+		},
+		{
+			name:      "apply every hunk",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			sel:       Selection{Hunks: []int{0, 1}},
+			want:      staged,
+			wantHunks: -1,
+		},
+		{
+			name:      "reject one hunk",
+			base:      base,
+			stage:     staged,
+			sel:       Selection{Hunks: []int{0}},
+			want:      base,
+			wantHunks: 1,
+		},
+		{
+			name:      "reject every hunk",
+			base:      base,
+			stage:     staged,
+			sel:       Selection{Hunks: []int{1, 0}},
+			want:      base,
+			wantHunks: -1,
+		},
+		{
+			name:      "reject the whole file",
+			base:      base,
+			stage:     staged,
+			want:      base,
+			wantHunks: -1,
+		},
+		{
+			name:      "apply over a changed file",
+			base:      base,
+			stage:     staged,
+			edit:      "edited\n",
+			apply:     true,
+			wantErr:   ErrConflict,
+			want:      "edited\n",
+			wantHunks: 2,
+		},
+		{
+			name:      "apply a hunk over a changed file",
+			base:      base,
+			stage:     staged,
+			edit:      "edited\n",
+			apply:     true,
+			sel:       Selection{Hunks: []int{0}},
+			wantErr:   ErrConflict,
+			want:      "edited\n",
+			wantHunks: 2,
+		},
+		{
+			name:      "force over a changed file",
+			base:      base,
+			stage:     staged,
+			edit:      "edited\n",
+			apply:     true,
+			sel:       Selection{Force: true},
+			want:      staged,
+			wantHunks: -1,
+		},
+		{
+			name:      "reject over a changed file",
+			base:      base,
+			stage:     staged,
+			edit:      "edited\n",
+			want:      "edited\n",
+			wantHunks: -1,
+		},
+		{
+			name:      "unknown hunk",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			sel:       Selection{Hunks: []int{2}},
+			wantErr:   ErrHunkNotFound,
+			want:      base,
+			wantHunks: 2,
+		},
+		{
+			name:      "hunks without a path",
+			base:      base,
+			stage:     staged,
+			sel:       Selection{Hunks: []int{0}},
+			selPath:   "-",
+			wantErr:   ErrInvalidArgument,
+			want:      base,
+			wantHunks: 2,
+		},
+		{
+			name:      "file not in the changeset",
+			base:      base,
+			stage:     staged,
+			apply:     true,
+			selPath:   "other.txt",
+			wantErr:   ErrFileNotStaged,
+			want:      base,
+			wantHunks: 2,
+		},
+		{
+			name:      "apply a new file",
+			noBase:    true,
+			stage:     "new\n",
+			apply:     true,
+			want:      "new\n",
+			wantHunks: -1,
+		},
+		{
+			name:      "new file created on disk meanwhile",
+			noBase:    true,
+			stage:     "new\n",
+			edit:      "theirs\n",
+			apply:     true,
+			wantErr:   ErrConflict,
+			want:      "theirs\n",
+			wantHunks: 1,
+		},
+		{
+			name:      "apply a deletion",
+			base:      base,
+			deleted:   true,
+			apply:     true,
+			wantGone:  true,
+			wantHunks: -1,
+		},
+		{
+			name:      "apply hunks of a deletion",
+			base:      base,
+			deleted:   true,
+			apply:     true,
+			sel:       Selection{Hunks: []int{0}},
+			wantErr:   ErrInvalidArgument,
+			want:      base,
+			wantHunks: 1,
+		},
+		{
+			name:      "reject a deletion",
+			base:      base,
+			deleted:   true,
+			want:      base,
+			wantHunks: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := newTestManager(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "main.txt")
+			if !tt.noBase {
+				if err := os.WriteFile(path, []byte(tt.base), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var err error
+			if tt.deleted {
+				_, err = m.StageDelete(ctx, "cs", path)
+			} else {
+				_, err = m.StageWrite(ctx, "cs", path, tt.stage)
+			}
+			if err != nil {
+				t.Fatalf("stage: %v", err)
+			}
+			if tt.edit != "" {
+				if err := os.WriteFile(path, []byte(tt.edit), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sel := tt.sel
+			switch tt.selPath {
+			case "":
+				sel.Path = path
+			case "-":
+			default:
+				sel.Path = filepath.Join(dir, tt.selPath)
+			}
+			if tt.apply {
+				_, err = m.Apply(ctx, "cs", sel)
+			} else {
+				_, err = m.Reject(ctx, "cs", sel)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			raw, err := os.ReadFile(path)
+			switch {
+			case tt.wantGone:
+				if !os.IsNotExist(err) {
+					t.Errorf("file exists after the deletion was applied: %v", err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case string(raw) != tt.want:
+				t.Errorf("file = %q, want %q", raw, tt.want)
+			}
+
+			detail, err := m.Get(ctx, "cs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hunks := -1
+			for _, change := range detail.Changes {
+				if change.Path == path {
+					hunks = len(change.Hunks)
+				}
+			}
+			if hunks != tt.wantHunks {
+				t.Errorf("%d hunks staged, want %d", hunks, tt.wantHunks)
+			}
+		})
+	}
+}
+
+func TestRejectRebuildsStagedContent(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	path := filepath.Join(t.TempDir(), "main.txt")
+	if err := os.WriteFile(path, []byte(numberedLines(40, "\n", nil)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.StageWrite(ctx, "cs", path, numberedLines(40, "\n", map[int]string{3: "changed 3", 35: "changed 35"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Reject(ctx, "cs", Selection{Path: path, Hunks: []int{0}}); err != nil {
+		t.Fatal(err)
+	}
+	content, ok, deleted, err := m.Read("cs", path)
+	want := numberedLines(40, "\n", map[int]string{35: "changed 35"})
+	if err != nil || !ok || deleted || content != want {
+		t.Errorf("Read() = %q, %v, %v, %v, want the staged file without the rejected hunk", content, ok, deleted, err)
+	}
+}
+
+func TestStage(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.txt")
+	if err := os.WriteFile(path, []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := m.StageWrite(ctx, "cs", path, "b\n")
+	if err != nil || change.Status != StatusModified || change.Additions != 1 || change.Deletions != 1 {
+		t.Fatalf("StageWrite() = %+v, %v", change, err)
+	}
+	// staging the content on disk again drops the file
+	if _, err := m.StageWrite(ctx, "cs", path, "a\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _, _ := m.Read("cs", path); ok {
+		t.Error("an unchanged file is still staged")
+	}
+	if _, err := m.StageDelete(ctx, "cs", filepath.Join(dir, "missing.txt")); !errors.Is(err, fsservice.ErrPathNotFound) {
+		t.Errorf("StageDelete() of a missing file = %v, want %v", err, fsservice.ErrPathNotFound)
+	}
+	if _, err := m.StageWrite(ctx, "../bad", path, "x"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("StageWrite() with a bad id = %v, want %v", err, ErrInvalidID)
+	}
+	change, err = m.StageWrite(ctx, "cs", filepath.Join(dir, "new.txt"), "x\n")
+	if err != nil || change.Status != StatusAdded {
+		t.Errorf("StageWrite() of a new file = %+v, %v", change, err)
+	}
+}
@@ -0,0 +1,184 @@
+package changesets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	manifestName = "manifest.json"
+	blobDirName  = "blobs"
+)
+
+type changeset struct {
+	ID        string                `json:"id"`
+	Title     string                `json:"title"`
+	Root      string                `json:"root,omitempty"`
+	CreatedAt time.Time             `json:"createdAt"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+	Files     map[string]*fileEntry `json:"files"`
+}
+
+func (cs *changeset) sortedFiles() []*fileEntry {
+	out := make([]*fileEntry, 0, len(cs.Files))
+	for _, entry := range cs.Files {
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// fileEntry points at the baseline and shadow blobs of one staged file.
+type fileEntry struct {
+	Path       string `json:"path"`
+	BaseExists bool   `json:"baseExists"`
+	BaseHash   string `json:"baseHash"`
+	ShadowHash string `json:"shadowHash"`
+	Deleted    bool   `json:"deleted"`
+}
+
+func (e *fileEntry) unchanged() bool {
+	if e.Deleted {
+		return !e.BaseExists
+	}
+	return e.BaseExists && e.BaseHash == e.ShadowHash
+}
+
+func (e *fileEntry) status() string {
+	switch {
+	case e.Deleted:
+		return StatusDeleted
+	case !e.BaseExists:
+		return StatusAdded
+	default:
+		return StatusModified
+	}
+}
+
+// store keeps one directory per changeset holding its manifest and the
+// content-addressed blobs the manifest refers to.
+type store struct {
+	dir string
+}
+
+func (s *store) loadAll() ([]*changeset, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*changeset
+	for _, entry := range entries {
+		if !entry.IsDir() || !validID(entry.Name()) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(s.dir, entry.Name(), manifestName))
+		if err != nil {
+			continue
+		}
+		var cs changeset
+		if err := json.Unmarshal(raw, &cs); err != nil || cs.ID != entry.Name() {
+			continue
+		}
+		if cs.Files == nil {
+			cs.Files = map[string]*fileEntry{}
+		}
+		out = append(out, &cs)
+	}
+	return out, nil
+}
+
+// save writes the manifest atomically and drops blobs it no longer uses.
+func (s *store) save(cs *changeset) error {
+	dir := filepath.Join(s.dir, cs.ID)
+	if err := os.MkdirAll(filepath.Join(dir, blobDirName), 0o700); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(cs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".manifest-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filepath.Join(dir, manifestName)); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	s.collectGarbage(cs)
+	return nil
+}
+
+func (s *store) collectGarbage(cs *changeset) {
+	live := map[string]bool{}
+	for _, entry := range cs.Files {
+		live[entry.BaseHash] = true
+		live[entry.ShadowHash] = true
+	}
+
+	blobDir := filepath.Join(s.dir, cs.ID, blobDirName)
+	entries, err := os.ReadDir(blobDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !live[entry.Name()] {
+			_ = os.Remove(filepath.Join(blobDir, entry.Name()))
+		}
+	}
+}
+
+func (s *store) remove(id string) error {
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+func (s *store) putBlob(id, content string) (string, error) {
+	hash := hashContent(content)
+	dir := filepath.Join(s.dir, id, blobDirName)
+	path := filepath.Join(dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *store) getBlob(id, hash string) (string, error) {
+	raw, err := os.ReadFile(filepath.Join(s.dir, id, blobDirName, hash))
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
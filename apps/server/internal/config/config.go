@@ -2,16 +2,50 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 const defaultAddr = "127.0.0.1:8080"
 const defaultShutdownTimeout = 10 * time.Second
+const dataDirName = "omt"
 
 type Config struct {
 	Addr            string
 	ShutdownTimeout time.Duration
+	// DataDir holds server-managed state such as git worktrees.
+	DataDir string
+	LLM     LLMConfig
+	Index   IndexConfig
+	MCP     MCPConfig
+}
+
+// LLMConfig overrides the model provider from the environment. Providers
+// themselves are configured in llm.json under DataDir; these fields pick the
+// default one or define it inline. Only the name of the variable holding the
+// API key is configured here, never the key.
+type LLMConfig struct {
+	Provider  string
+	Type      string
+	BaseURL   string
+	Model     string
+	APIKeyEnv string
+}
+
+// IndexConfig overrides the embedding endpoint of the codebase index, which
+// is otherwise configured in index.json under DataDir.
+type IndexConfig struct {
+	Embedder  string
+	BaseURL   string
+	Model     string
+	APIKeyEnv string
+}
+
+// MCPConfig picks the agent tools the MCP server exposes, as a thread
+// mode; empty means plan, which only reads and searches.
+type MCPConfig struct {
+	Mode string
 }
 
 func LoadFromEnv() Config {
@@ -23,5 +57,37 @@ func LoadFromEnv() Config {
 	return Config{
 		Addr:            addr,
 		ShutdownTimeout: defaultShutdownTimeout,
+		DataDir:         resolveDataDir(),
+		LLM: LLMConfig{
+			Provider:  strings.TrimSpace(os.Getenv("OMT_LLM_PROVIDER")),
+			Type:      strings.TrimSpace(os.Getenv("OMT_LLM_TYPE")),
+			BaseURL:   strings.TrimSpace(os.Getenv("OMT_LLM_BASE_URL")),
+			Model:     strings.TrimSpace(os.Getenv("OMT_LLM_MODEL")),
+			APIKeyEnv: strings.TrimSpace(os.Getenv("OMT_LLM_API_KEY_ENV")),
+		},
+		Index: IndexConfig{
+			Embedder:  strings.TrimSpace(os.Getenv("OMT_INDEX_EMBEDDER")),
+			BaseURL:   strings.TrimSpace(os.Getenv("OMT_INDEX_BASE_URL")),
+			Model:     strings.TrimSpace(os.Getenv("OMT_INDEX_MODEL")),
+			APIKeyEnv: strings.TrimSpace(os.Getenv("OMT_INDEX_API_KEY_ENV")),
+		},
+		MCP: MCPConfig{
+			Mode: strings.TrimSpace(os.Getenv("OMT_MCP_MODE")),
+		},
+	}
+}
+
+// resolveDataDir prefers OMT_DATA_DIR, then the XDG data home, then
+// ~/.local/share, falling back to the temp dir when no home is known.
+func resolveDataDir() string {
+	if dir := strings.TrimSpace(os.Getenv("OMT_DATA_DIR")); dir != "" {
+		return filepath.Clean(dir)
+	}
+	if xdg := strings.TrimSpace(os.Getenv("XDG_DATA_HOME")); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, dataDirName)
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		return filepath.Join(home, ".local", "share", dataDirName)
 	}
+	return filepath.Join(os.TempDir(), dataDirName)
 }
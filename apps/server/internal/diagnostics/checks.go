@@ -0,0 +1,137 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"local/monorepo/internal/fs"
+	"local/monorepo/internal/tasks"
+)
+
+var (
+	ErrUnknownCheck     = errors.New("unknown diagnostics check")
+	ErrCheckUnavailable = errors.New("diagnostics check tool is not installed")
+	ErrRootRequired     = fs.ErrRootRequired
+	ErrRootNotFound     = fs.ErrRootNotFound
+)
+
+const (
+	CheckGoVet = "go-vet"
+	CheckTSC   = "tsc"
+)
+
+const (
+	checkTimeout        = 2 * time.Minute
+	maxCheckOutputBytes = 256 * 1024
+)
+
+// CheckResult summarises one checker run. Its diagnostics replace whatever
+// the previous run of the same check reported for the workspace.
+type CheckResult struct {
+	Check       string `json:"check"`
+	Root        string `json:"root"`
+	ExitCode    int    `json:"exitCode"`
+	DurationMs  int64  `json:"durationMs"`
+	Diagnostics int    `json:"diagnostics"`
+	Output      string `json:"output,omitempty"`
+}
+
+func Checks() []string {
+	return []string{CheckGoVet, CheckTSC}
+}
+
+// RunCheck runs a whole-workspace checker in root, parses its output with
+// the task problem matchers and stores the result under the check's name.
+func (s *Store) RunCheck(ctx context.Context, check, rawRoot string) (CheckResult, error) {
+	root, err := fs.ResolveRoot(rawRoot)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	command, args, err := checkCommand(check, root)
+	if err != nil {
+		return CheckResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "FORCE_COLOR=0", "NO_COLOR=1", "CI=1")
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	started := time.Now()
+	runErr := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return CheckResult{}, ctxErr
+	}
+	result := CheckResult{Check: check, Root: root, DurationMs: time.Since(started).Milliseconds()}
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+	case errors.As(runErr, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		return CheckResult{}, fmt.Errorf("%w: %v", ErrCheckUnavailable, runErr)
+	}
+
+	found := fromTasks(tasks.MatchProblems(output.String(), root))
+	s.SetWorkspace(root, check, found)
+	result.Diagnostics = len(found)
+	text := output.String()
+	if len(text) > maxCheckOutputBytes {
+		text = text[len(text)-maxCheckOutputBytes:]
+	}
+	result.Output = text
+	return result, nil
+}
+
+func checkCommand(check, root string) (string, []string, error) {
+	switch check {
+	case CheckGoVet:
+		if _, err := exec.LookPath("go"); err != nil {
+			return "", nil, ErrCheckUnavailable
+		}
+		return "go", []string{"vet", "./..."}, nil
+	case CheckTSC:
+		args := []string{"--noEmit", "--pretty", "false"}
+		local := filepath.Join(root, "node_modules", ".bin", "tsc")
+		if info, err := os.Stat(local); err == nil && !info.IsDir() {
+			return local, args, nil
+		}
+		if _, err := exec.LookPath("tsc"); err != nil {
+			return "", nil, ErrCheckUnavailable
+		}
+		return "tsc", args, nil
+	default:
+		return "", nil, ErrUnknownCheck
+	}
+}
+
+// FromTaskRun converts the problems a task's problem matchers found.
+func FromTaskRun(run tasks.RunInfo) []Diagnostic {
+	return fromTasks(run.Diagnostics)
+}
+
+func fromTasks(found []tasks.Diagnostic) []Diagnostic {
+	out := make([]Diagnostic, 0, len(found))
+	for _, diagnostic := range found {
+		out = append(out, Diagnostic{
+			Path:     diagnostic.File,
+			Line:     diagnostic.Line,
+			Column:   diagnostic.Column,
+			Severity: diagnostic.Severity,
+			Message:  diagnostic.Message,
+			Code:     diagnostic.Code,
+			Source:   diagnostic.Source,
+		})
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const PublishDiagnosticsMethod = "textDocument/publishDiagnostics"
+
+type lspPublishParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+type lspDiagnostic struct {
+	Range struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	} `json:"range"`
+	Severity int             `json:"severity"`
+	Code     json.RawMessage `json:"code"`
+	Source   string          `json:"source"`
+	Message  string          `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// FromLSP converts textDocument/publishDiagnostics params into the file
+// path and diagnostics they describe. LSP positions are 0-based; columns
+// keep the server's UTF-16 count.
+func FromLSP(params json.RawMessage, defaultSource string) (string, []Diagnostic, error) {
+	var publish lspPublishParams
+	if err := json.Unmarshal(params, &publish); err != nil {
+		return "", nil, err
+	}
+	path, err := pathFromURI(publish.URI)
+	if err != nil {
+		return "", nil, err
+	}
+
+	out := make([]Diagnostic, 0, len(publish.Diagnostics))
+	for _, item := range publish.Diagnostics {
+		source := item.Source
+		if source == "" {
+			source = defaultSource
+		}
+		out = append(out, Diagnostic{
+			Path:      path,
+			Line:      item.Range.Start.Line + 1,
+			Column:    item.Range.Start.Character + 1,
+			EndLine:   item.Range.End.Line + 1,
+			EndColumn: item.Range.End.Character + 1,
+			Severity:  lspSeverity(item.Severity),
+			Message:   item.Message,
+			Code:      lspCode(item.Code),
+			Source:    source,
+		})
+	}
+	return path, out, nil
+}
+
+func lspSeverity(severity int) string {
+	switch severity {
+	case 2:
+		return SeverityWarning
+	case 3, 4:
+		return SeverityInfo
+	default:
+		return SeverityError
+	}
+}
+
+// lspCode accepts the string or integer forms the protocol allows.
+func lspCode(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func pathFromURI(raw string) (string, error) {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if uri.Scheme != "file" {
+		return "", fmt.Errorf("unsupported document URI %q", raw)
+	}
+	path := uri.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path), nil
+}
@@ -0,0 +1,354 @@
+package diagnostics
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+const (
+	maxProducerFileDiagnostics = 1_000
+	subscriptionBuffer         = 256
+)
+
+// Diagnostic is a problem at a file position. Lines and columns are 1-based;
+// zero means unknown.
+type Diagnostic struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Code      string `json:"code,omitempty"`
+	Source    string `json:"source"`
+}
+
+// FileDiagnostics is the merged view of one file. It is also the event sent
+// to subscribers when a file changes; an empty Diagnostics list means the
+// file is clean again.
+type FileDiagnostics struct {
+	Root        string       `json:"root"`
+	Path        string       `json:"path"`
+	Errors      int          `json:"errors"`
+	Warnings    int          `json:"warnings"`
+	Infos       int          `json:"infos"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type Filter struct {
+	Root string
+	Path string
+	// Severity keeps diagnostics at least this severe.
+	Severity string
+}
+
+// Store collects diagnostics per workspace and file. Each producer, such as
+// a language server or a task, owns its own set and replaces it wholesale;
+// reads merge the sets and drop duplicates reported by several producers.
+type Store struct {
+	mu sync.Mutex
+	// files maps root, then path, then producer to that producer's set.
+	files map[string]map[string]map[string][]Diagnostic
+	subs  map[*Subscription]struct{}
+}
+
+func NewStore() *Store {
+	return &Store{
+		files: map[string]map[string]map[string][]Diagnostic{},
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+// SetFile replaces the diagnostics producer reported for one file.
+func (s *Store) SetFile(root, producer, path string, diagnostics []Diagnostic) {
+	root = cleanPath(root)
+	path = cleanPath(path)
+	if root == "" || path == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.setLocked(root, producer, path, diagnostics) {
+		s.publishLocked(root, path)
+	}
+}
+
+// SetWorkspace replaces everything producer reported for root, such as the
+// output of a whole-project build.
+func (s *Store) SetWorkspace(root, producer string, diagnostics []Diagnostic) {
+	root = cleanPath(root)
+	if root == "" {
+		return
+	}
+	byPath := map[string][]Diagnostic{}
+	for _, diagnostic := range diagnostics {
+		path := cleanPath(diagnostic.Path)
+		if path != "" {
+			byPath[path] = append(byPath[path], diagnostic)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, producers := range s.files[root] {
+		if _, ok := producers[producer]; ok {
+			if _, keep := byPath[path]; !keep {
+				byPath[path] = nil
+			}
+		}
+	}
+	for path, set := range byPath {
+		if s.setLocked(root, producer, path, set) {
+			s.publishLocked(root, path)
+		}
+	}
+}
+
+// ClearProducer drops every diagnostic producer reported for root.
+func (s *Store) ClearProducer(root, producer string) {
+	s.SetWorkspace(root, producer, nil)
+}
+
+func (s *Store) setLocked(root, producer, path string, diagnostics []Diagnostic) bool {
+	files := s.files[root]
+	if len(diagnostics) == 0 {
+		producers := files[path]
+		if _, ok := producers[producer]; !ok {
+			return false
+		}
+		delete(producers, producer)
+		if len(producers) == 0 {
+			delete(files, path)
+		}
+		if len(files) == 0 {
+			delete(s.files, root)
+		}
+		return true
+	}
+
+	if len(diagnostics) > maxProducerFileDiagnostics {
+		diagnostics = diagnostics[:maxProducerFileDiagnostics]
+	}
+	set := make([]Diagnostic, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		diagnostic.Path = path
+		diagnostic.Severity = normalizeSeverity(diagnostic.Severity)
+		diagnostic.Message = strings.TrimSpace(diagnostic.Message)
+		set = append(set, diagnostic)
+	}
+	if files == nil {
+		files = map[string]map[string][]Diagnostic{}
+		s.files[root] = files
+	}
+	if files[path] == nil {
+		files[path] = map[string][]Diagnostic{}
+	}
+	files[path][producer] = set
+	return true
+}
+
+// Query returns the merged diagnostics of every matching file, sorted by
+// root and path.
+func (s *Store) Query(filter Filter) []FileDiagnostics {
+	root := cleanPath(filter.Root)
+	path := cleanPath(filter.Path)
+	minRank := severityRank(normalizeSeverity(filter.Severity))
+	if filter.Severity == "" {
+		minRank = severityRank(SeverityInfo)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []FileDiagnostics{}
+	for fileRoot, files := range s.files {
+		for filePath := range files {
+			if root != "" && !isWithin(filePath, root) {
+				continue
+			}
+			if path != "" && filePath != path && !isWithin(filePath, path) {
+				continue
+			}
+			merged := s.mergedLocked(fileRoot, filePath)
+			kept := merged.Diagnostics[:0]
+			for _, diagnostic := range merged.Diagnostics {
+				if severityRank(diagnostic.Severity) >= minRank {
+					kept = append(kept, diagnostic)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			merged.Diagnostics = kept
+			merged.Errors, merged.Warnings, merged.Infos = count(kept)
+			out = append(out, merged)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Root != out[j].Root {
+			return out[i].Root < out[j].Root
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+func (s *Store) mergedLocked(root, path string) FileDiagnostics {
+	producers := s.files[root][path]
+	names := make([]string, 0, len(producers))
+	for name := range producers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type key struct {
+		line, column int
+		severity     string
+		message      string
+	}
+	seen := map[key]bool{}
+	merged := []Diagnostic{}
+	for _, name := range names {
+		for _, diagnostic := range producers[name] {
+			k := key{diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Message}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			merged = append(merged, diagnostic)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Line != merged[j].Line {
+			return merged[i].Line < merged[j].Line
+		}
+		return merged[i].Column < merged[j].Column
+	})
+
+	errors, warnings, infos := count(merged)
+	return FileDiagnostics{
+		Root:        root,
+		Path:        path,
+		Errors:      errors,
+		Warnings:    warnings,
+		Infos:       infos,
+		Diagnostics: merged,
+	}
+}
+
+// Subscription receives a FileDiagnostics event whenever a file's merged
+// diagnostics may have changed. C is closed when the subscriber falls behind
+// or is closed; callers should then re-query.
+type Subscription struct {
+	C     <-chan FileDiagnostics
+	ch    chan FileDiagnostics
+	root  string
+	store *Store
+}
+
+// Subscribe streams changes for files under root, or for every file when
+// root is empty.
+func (s *Store) Subscribe(root string) *Subscription {
+	ch := make(chan FileDiagnostics, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, root: cleanPath(root), store: s}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	return sub
+}
+
+func (sub *Subscription) Close() {
+	sub.store.mu.Lock()
+	defer sub.store.mu.Unlock()
+	sub.store.unsubscribeLocked(sub)
+}
+
+func (s *Store) unsubscribeLocked(sub *Subscription) {
+	if _, ok := s.subs[sub]; !ok {
+		return
+	}
+	delete(s.subs, sub)
+	close(sub.ch)
+}
+
+func (s *Store) publishLocked(root, path string) {
+	if len(s.subs) == 0 {
+		return
+	}
+	event := s.mergedLocked(root, path)
+	for sub := range s.subs {
+		if sub.root != "" && !isWithin(path, sub.root) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			s.unsubscribeLocked(sub)
+		}
+	}
+}
+
+func count(diagnostics []Diagnostic) (errors, warnings, infos int) {
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Severity {
+		case SeverityError:
+			errors++
+		case SeverityWarning:
+			warnings++
+		default:
+			infos++
+		}
+	}
+	return errors, warnings, infos
+}
+
+func normalizeSeverity(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "warning", "warn":
+		return SeverityWarning
+	case "info", "information", "note", "hint":
+		return SeverityInfo
+	default:
+		return SeverityError
+	}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityError:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func cleanPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
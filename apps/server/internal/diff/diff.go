@@ -0,0 +1,432 @@
+// Package diff computes line diffs between two texts and applies the
+// resulting hunks. Hunk lines use unified diff notation: a one-character
+// prefix (' ', '-', '+') followed by the line without its newline, and a
+// "\ No newline at end of file" marker after a line that lacks one.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NoNewlineMarker follows a hunk line whose text has no trailing newline.
+const NoNewlineMarker = `\ No newline at end of file`
+
+// DefaultContext is the number of unchanged lines kept around each change.
+const DefaultContext = 3
+
+// maxEditDistance bounds the Myers search; larger differences are reported
+// as one replacement of the differing middle section.
+const maxEditDistance = 4096
+
+var ErrMismatch = errors.New("hunk does not match the text")
+
+type Hunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+// Header renders the "@@ -a,b +c,d @@" line of the hunk.
+func (h Hunk) Header() string {
+	return "@@ -" + formatRange(h.OldStart, h.OldLines) + " +" + formatRange(h.NewStart, h.NewLines) + " @@"
+}
+
+// Stats counts added and removed lines.
+func (h Hunk) Stats() (added, removed int) {
+	for _, line := range h.Lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func formatRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+// SplitLines splits text into lines that keep their trailing newline.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	// text is the line including its newline, if any.
+	text string
+	// oldPos and newPos count the old and new lines before this op.
+	oldPos int
+	newPos int
+}
+
+// Compute returns the hunks that turn oldText into newText.
+func Compute(oldText, newText string, context int) []Hunk {
+	if context < 0 {
+		context = DefaultContext
+	}
+	ops := lineOps(SplitLines(oldText), SplitLines(newText))
+	return buildHunks(ops, context)
+}
+
+// Unified renders hunks as a unified diff with file headers.
+func Unified(oldName, newName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("--- " + oldName + "\n")
+	b.WriteString("+++ " + newName + "\n")
+	for _, hunk := range hunks {
+		b.WriteString(hunk.Header())
+		b.WriteByte('\n')
+		for _, line := range hunk.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Apply applies hunks, which must be sorted and non-overlapping, to text.
+// Every context and removed line has to match exactly.
+func Apply(text string, hunks []Hunk) (string, error) {
+	lines := SplitLines(text)
+	var b strings.Builder
+	next := 0
+	for i, hunk := range hunks {
+		oldLines, newLines := hunkSides(hunk)
+		start := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			start = hunk.OldStart
+		}
+		if start < next || start+len(oldLines) > len(lines) || !linesEqual(lines[start:start+len(oldLines)], oldLines) {
+			return "", fmt.Errorf("%w: hunk %d (%s)", ErrMismatch, i, hunk.Header())
+		}
+		for ; next < start; next++ {
+			b.WriteString(lines[next])
+		}
+		for _, line := range newLines {
+			b.WriteString(line)
+		}
+		next = start + len(oldLines)
+	}
+	for ; next < len(lines); next++ {
+		b.WriteString(lines[next])
+	}
+	return b.String(), nil
+}
+
+// hunkSides rebuilds the old and new lines of a hunk, newlines included.
+func hunkSides(hunk Hunk) (oldLines, newLines []string) {
+	for i, line := range hunk.Lines {
+		if line == "" || strings.HasPrefix(line, `\`) {
+			continue
+		}
+		text := line[1:]
+		if i+1 >= len(hunk.Lines) || !strings.HasPrefix(hunk.Lines[i+1], `\`) {
+			text += "\n"
+		}
+		switch line[0] {
+		case ' ':
+			oldLines = append(oldLines, text)
+			newLines = append(newLines, text)
+		case '-':
+			oldLines = append(oldLines, text)
+		case '+':
+			newLines = append(newLines, text)
+		}
+	}
+	return oldLines, newLines
+}
+
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func buildHunks(ops []op, context int) []Hunk {
+	hunks := []Hunk{}
+	lastEnd := 0
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		if start < lastEnd {
+			start = lastEnd
+		}
+
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != opEqual {
+				end++
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				tail := run - end
+				if tail > context {
+					tail = context
+				}
+				end += tail
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, newHunk(ops[start:end]))
+		i, lastEnd = end, end
+	}
+	return hunks
+}
+
+func newHunk(ops []op) Hunk {
+	hunk := Hunk{Lines: make([]string, 0, len(ops))}
+	first := ops[0]
+	for _, o := range ops {
+		prefix := " "
+		switch o.kind {
+		case opEqual:
+			hunk.OldLines++
+			hunk.NewLines++
+		case opDelete:
+			prefix = "-"
+			hunk.OldLines++
+		case opInsert:
+			prefix = "+"
+			hunk.NewLines++
+		}
+		hunk.Lines = append(hunk.Lines, prefix+strings.TrimSuffix(o.text, "\n"))
+		if !strings.HasSuffix(o.text, "\n") {
+			hunk.Lines = append(hunk.Lines, NoNewlineMarker)
+		}
+	}
+	hunk.OldStart = first.oldPos
+	if hunk.OldLines > 0 {
+		hunk.OldStart++
+	}
+	hunk.NewStart = first.newPos
+	if hunk.NewLines > 0 {
+		hunk.NewStart++
+	}
+	return hunk
+}
+
+// lineOps produces the edit script from a to b, trimming the common prefix
+// and suffix before running Myers on the middle.
+func lineOps(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	oldPos, newPos := 0, 0
+	emit := func(kind opKind, text string) {
+		ops = append(ops, op{kind: kind, text: text, oldPos: oldPos, newPos: newPos})
+		switch kind {
+		case opEqual:
+			oldPos++
+			newPos++
+		case opDelete:
+			oldPos++
+		case opInsert:
+			newPos++
+		}
+	}
+
+	for i := 0; i < prefix; i++ {
+		emit(opEqual, a[i])
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	for _, edit := range myers(midA, midB) {
+		switch edit.kind {
+		case opEqual:
+			emit(opEqual, midA[edit.index])
+		case opDelete:
+			emit(opDelete, midA[edit.index])
+		case opInsert:
+			emit(opInsert, midB[edit.index])
+		}
+	}
+	for i := len(a) - suffix; i < len(a); i++ {
+		emit(opEqual, a[i])
+	}
+	return ops
+}
+
+type edit struct {
+	kind  opKind
+	index int
+}
+
+// myers returns a shortest edit script from a to b. Deletions are ordered
+// before insertions within a change.
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(n, m)
+	}
+
+	limit := n + m
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	trace := make([][]int, 0, 16)
+
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(n, m)
+	}
+
+	// walk the trace backwards from (n, m)
+	edits := make([]edit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[offset+k-1] < prev[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{kind: opEqual, index: x})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{kind: opInsert, index: y})
+		} else {
+			x--
+			edits = append(edits, edit{kind: opDelete, index: x})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{kind: opEqual, index: x})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return reorderChanges(edits)
+}
+
+// reorderChanges moves deletions ahead of insertions inside each run of
+// changes so hunks read as "-old +new".
+func reorderChanges(edits []edit) []edit {
+	out := make([]edit, 0, len(edits))
+	for i := 0; i < len(edits); {
+		if edits[i].kind == opEqual {
+			out = append(out, edits[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(edits) && edits[j].kind != opEqual {
+			j++
+		}
+		for _, e := range edits[i:j] {
+			if e.kind == opDelete {
+				out = append(out, e)
+			}
+		}
+		for _, e := range edits[i:j] {
+			if e.kind == opInsert {
+				out = append(out, e)
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+func replaceAll(n, m int) []edit {
+	edits := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{kind: opDelete, index: i})
+	}
+	for j := 0; j < m; j++ {
+		edits = append(edits, edit{kind: opInsert, index: j})
+	}
+	return edits
+}
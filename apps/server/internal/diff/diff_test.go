@@ -0,0 +1,99 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     []Hunk
+	}{
+		{name: "equal", old: "a\nb\n", new: "a\nb\n", context: 3},
+		{
+			name: "replace with context",
+			old:  "a\nb\nc\n", new: "a\nB\nc\n", context: 1,
+			want: []Hunk{{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []string{" a", "-b", "+B", " c"}}},
+		},
+		{
+			name: "changes far apart make two hunks",
+			old:  lines(20, nil), new: lines(20, map[int]string{2: "two", 18: "eighteen"}), context: 1,
+			want: []Hunk{
+				{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []string{" line 1", "-line 2", "+two", " line 3"}},
+				{OldStart: 17, OldLines: 3, NewStart: 17, NewLines: 3, Lines: []string{" line 17", "-line 18", "+eighteen", " line 19"}},
+			},
+		},
+		{
+			name: "new file",
+			old:  "", new: "a\nb\n", context: 3,
+			want: []Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2, Lines: []string{"+a", "+b"}}},
+		},
+		{
+			name: "deleted content",
+			old:  "a\n", new: "", context: 3,
+			want: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 0, NewLines: 0, Lines: []string{"-a"}}},
+		},
+		{
+			name: "final newline added",
+			old:  "a", new: "a\n", context: 3,
+			want: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-a", NoNewlineMarker, "+a"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compute(tt.old, tt.new, tt.context)
+			if len(got) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Compute() = %+v\nwant        %+v", got, tt.want)
+				}
+			}
+			applied, err := Apply(tt.old, got)
+			if err != nil || applied != tt.new {
+				t.Errorf("Apply(Compute()) = %q, %v, want %q", applied, err, tt.new)
+			}
+		})
+	}
+}
+
+func TestApplyRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"a",
+		"a\n",
+		lines(30, nil),
+		lines(30, map[int]string{1: "first", 15: "middle", 30: "last"}),
+		strings.Repeat("same\n", 10),
+		strings.Repeat("same\n", 7) + "x\n" + strings.Repeat("same\n", 3),
+		"no newline\nat the end",
+		"a\r\nb\r\n",
+	}
+	for _, oldText := range texts {
+		for _, newText := range texts {
+			hunks := Compute(oldText, newText, DefaultContext)
+			got, err := Apply(oldText, hunks)
+			if err != nil || got != newText {
+				t.Errorf("%q -> %q: Apply() = %q, %v", oldText, newText, got, err)
+			}
+			// applying in fuzzy mode at the stated positions gives the same
+			if fuzzy, results := ApplyFuzzy(oldText, hunks, 0); fuzzy != newText {
+				t.Errorf("%q -> %q: ApplyFuzzy() = %q, %+v", oldText, newText, fuzzy, results)
+			}
+		}
+	}
+}
+
+func TestApplyMismatch(t *testing.T) {
+	hunks := Compute(lines(10, nil), lines(10, map[int]string{5: "five"}), DefaultContext)
+	if _, err := Apply(lines(10, map[int]string{5: "other"}), hunks); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Apply() to changed text = %v, want %v", err, ErrMismatch)
+	}
+	if _, err := Apply(lines(3, nil), hunks); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Apply() to shorter text = %v, want %v", err, ErrMismatch)
+	}
+}
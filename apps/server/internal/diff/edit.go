@@ -0,0 +1,132 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+var (
+	ErrEditOutOfRange = errors.New("edit range is outside the text")
+	ErrEditOverlap    = errors.New("edits overlap")
+	ErrEditMismatch   = errors.New("text at edit range does not match")
+)
+
+// Position is a 1-based line and column. Columns count characters, not
+// bytes, the way editors display them.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Edit replaces a range of text. The range is given either by Start and End
+// positions or by byte offsets; OldText, when set, must match the current
+// text of the range for the edit to apply.
+type Edit struct {
+	Start       *Position
+	End         *Position
+	StartOffset *int
+	EndOffset   *int
+	OldText     *string
+	NewText     string
+}
+
+// ApplyEdits applies non-overlapping edits to text. All ranges refer to the
+// original text; insertions at the same point keep their order.
+func ApplyEdits(text string, edits []Edit) (string, error) {
+	type span struct {
+		start, end int
+		index      int
+		newText    string
+	}
+	lineStarts := lineOffsets(text)
+	spans := make([]span, 0, len(edits))
+	for i, edit := range edits {
+		start, end, err := editRange(text, lineStarts, edit)
+		if err != nil {
+			return "", fmt.Errorf("edit %d: %w", i, err)
+		}
+		if edit.OldText != nil && text[start:end] != *edit.OldText {
+			return "", fmt.Errorf("%w: edit %d", ErrEditMismatch, i)
+		}
+		spans = append(spans, span{start: start, end: end, index: i, newText: edit.NewText})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return "", fmt.Errorf("%w: edits %d and %d", ErrEditOverlap, spans[i-1].index, spans[i].index)
+		}
+	}
+
+	out := make([]byte, 0, len(text))
+	next := 0
+	for _, s := range spans {
+		out = append(out, text[next:s.start]...)
+		out = append(out, s.newText...)
+		next = s.end
+	}
+	out = append(out, text[next:]...)
+	return string(out), nil
+}
+
+func editRange(text string, lineStarts []int, edit Edit) (int, int, error) {
+	var start, end int
+	switch {
+	case edit.StartOffset != nil || edit.EndOffset != nil:
+		if edit.StartOffset == nil || edit.EndOffset == nil {
+			return 0, 0, fmt.Errorf("%w: both offsets are required", ErrEditOutOfRange)
+		}
+		start, end = *edit.StartOffset, *edit.EndOffset
+		if start < 0 || end > len(text) {
+			return 0, 0, ErrEditOutOfRange
+		}
+	case edit.Start != nil && edit.End != nil:
+		var err error
+		if start, err = positionOffset(text, lineStarts, *edit.Start); err != nil {
+			return 0, 0, err
+		}
+		if end, err = positionOffset(text, lineStarts, *edit.End); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("%w: range is required", ErrEditOutOfRange)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: start is after end", ErrEditOutOfRange)
+	}
+	return start, end, nil
+}
+
+// lineOffsets returns the byte offset at which each line starts. A text
+// ending in a newline has a final, empty line.
+func lineOffsets(text string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+func positionOffset(text string, lineStarts []int, pos Position) (int, error) {
+	if pos.Line < 1 || pos.Line > len(lineStarts) || pos.Column < 1 {
+		return 0, fmt.Errorf("%w: line %d column %d", ErrEditOutOfRange, pos.Line, pos.Column)
+	}
+	offset := lineStarts[pos.Line-1]
+	lineEnd := len(text)
+	if pos.Line < len(lineStarts) {
+		// the newline itself is addressable as the column after the last character
+		lineEnd = lineStarts[pos.Line] - 1
+	}
+	for col := 1; col < pos.Column; col++ {
+		if offset >= lineEnd {
+			return 0, fmt.Errorf("%w: line %d column %d", ErrEditOutOfRange, pos.Line, pos.Column)
+		}
+		_, size := utf8.DecodeRuneInString(text[offset:lineEnd])
+		offset += size
+	}
+	return offset, nil
+}
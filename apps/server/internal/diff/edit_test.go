@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyEdits(t *testing.T) {
+	const text = "héllo\nworld\n"
+	at := func(line, column int) *Position { return &Position{Line: line, Column: column} }
+	offset := func(n int) *int { return &n }
+	old := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		edits   []Edit
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "columns count characters",
+			edits: []Edit{{Start: at(1, 2), End: at(1, 3), NewText: "e"}},
+			want:  "hello\nworld\n",
+		},
+		{
+			name:  "the newline is the column after the last character",
+			edits: []Edit{{Start: at(1, 6), End: at(2, 1), NewText: " "}},
+			want:  "héllo world\n",
+		},
+		{
+			name:  "append after the final newline",
+			edits: []Edit{{Start: at(3, 1), End: at(3, 1), NewText: "!"}},
+			want:  text + "!",
+		},
+		{
+			name:  "byte offsets",
+			edits: []Edit{{StartOffset: offset(7), EndOffset: offset(12), NewText: "there"}},
+			want:  "héllo\nthere\n",
+		},
+		{
+			name:  "matching old text",
+			edits: []Edit{{Start: at(2, 1), End: at(2, 6), OldText: old("world"), NewText: "earth"}},
+			want:  "héllo\nearth\n",
+		},
+		{
+			name: "insertions at one point keep their order",
+			edits: []Edit{
+				{StartOffset: offset(0), EndOffset: offset(0), NewText: "a"},
+				{StartOffset: offset(0), EndOffset: offset(0), NewText: "b"},
+			},
+			want: "ab" + text,
+		},
+		{
+			name: "edits in any order",
+			edits: []Edit{
+				{Start: at(2, 1), End: at(2, 2), NewText: "W"},
+				{Start: at(1, 1), End: at(1, 2), NewText: "H"},
+			},
+			want: "Héllo\nWorld\n",
+		},
+		{
+			name:    "old text differs",
+			edits:   []Edit{{Start: at(2, 1), End: at(2, 6), OldText: old("earth"), NewText: "x"}},
+			wantErr: ErrEditMismatch,
+		},
+		{
+			name: "overlapping edits",
+			edits: []Edit{
+				{Start: at(1, 1), End: at(1, 4), NewText: "x"},
+				{Start: at(1, 3), End: at(1, 5), NewText: "y"},
+			},
+			wantErr: ErrEditOverlap,
+		},
+		{
+			name:    "column past the end of the line",
+			edits:   []Edit{{Start: at(2, 7), End: at(2, 7)}},
+			wantErr: ErrEditOutOfRange,
+		},
+		{
+			name:    "line past the end of the text",
+			edits:   []Edit{{Start: at(4, 1), End: at(4, 1)}},
+			wantErr: ErrEditOutOfRange,
+		},
+		{
+			name:    "start after end",
+			edits:   []Edit{{Start: at(2, 1), End: at(1, 1)}},
+			wantErr: ErrEditOutOfRange,
+		},
+		{
+			name:    "offset past the end",
+			edits:   []Edit{{StartOffset: offset(0), EndOffset: offset(len(text) + 1)}},
+			wantErr: ErrEditOutOfRange,
+		},
+		{
+			name:    "only one offset",
+			edits:   []Edit{{StartOffset: offset(0)}},
+			wantErr: ErrEditOutOfRange,
+		},
+		{
+			name:    "no range",
+			edits:   []Edit{{NewText: "x"}},
+			wantErr: ErrEditOutOfRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyEdits(text, tt.edits)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ApplyEdits() = %q, %v, want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyEdits(): %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyEdits() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the file name a unified diff uses for a missing side.
+const DevNull = "/dev/null"
+
+var ErrMalformed = errors.New("malformed diff")
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// FilePatch is the part of a unified diff that touches one file.
+type FilePatch struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+// HunkResult reports where a hunk landed. Offset is the distance in lines
+// from the position in its header; Fuzz is how many context lines at each
+// end had to be ignored.
+type HunkResult struct {
+	Index   int  `json:"index"`
+	Applied bool `json:"applied"`
+	Offset  int  `json:"offset"`
+	Fuzz    int  `json:"fuzz"`
+}
+
+// Parse reads a unified diff that may span several files. Lines outside the
+// file sections, such as "diff --git" and "index" headers, are skipped.
+func Parse(text string) ([]FilePatch, error) {
+	lines := splitPatchLines(text)
+	var out []FilePatch
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			patch := FilePatch{
+				OldName: parseFileName(line[4:]),
+				NewName: parseFileName(lines[i+1][4:]),
+			}
+			i += 2
+			for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+				hunk, next, err := parseHunk(lines, i)
+				if err != nil {
+					return nil, err
+				}
+				patch.Hunks = append(patch.Hunks, hunk)
+				i = next
+			}
+			out = append(out, patch)
+		case strings.HasPrefix(line, "@@"):
+			return nil, fmt.Errorf("%w: hunk without file header at line %d", ErrMalformed, i+1)
+		default:
+			i++
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no file sections", ErrMalformed)
+	}
+	return out, nil
+}
+
+// ParseHunks reads the hunks of a diff for a single file. File headers are
+// optional.
+func ParseHunks(text string) ([]Hunk, error) {
+	lines := splitPatchLines(text)
+	var out []Hunk
+	for i := 0; i < len(lines); {
+		if !strings.HasPrefix(lines[i], "@@") {
+			i++
+			continue
+		}
+		hunk, next, err := parseHunk(lines, i)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, hunk)
+		i = next
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no hunks", ErrMalformed)
+	}
+	return out, nil
+}
+
+func splitPatchLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// parseFileName drops the timestamp some tools append after a tab and
+// unquotes C-style quoted names.
+func parseFileName(raw string) string {
+	raw = strings.TrimRight(raw, "\r")
+	if name, _, ok := strings.Cut(raw, "\t"); ok {
+		raw = name
+	}
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, `"`) {
+		if unquoted, err := strconv.Unquote(raw); err == nil {
+			return unquoted
+		}
+	}
+	return raw
+}
+
+func parseHunk(lines []string, at int) (Hunk, int, error) {
+	match := hunkHeaderPattern.FindStringSubmatch(lines[at])
+	if match == nil {
+		return Hunk{}, 0, fmt.Errorf("%w: bad hunk header at line %d", ErrMalformed, at+1)
+	}
+	hunk := Hunk{
+		OldStart: atoiDefault(match[1], 0),
+		OldLines: atoiDefault(match[2], 1),
+		NewStart: atoiDefault(match[3], 0),
+		NewLines: atoiDefault(match[4], 1),
+	}
+
+	oldSeen, newSeen := 0, 0
+	i := at + 1
+	for ; i < len(lines) && (oldSeen < hunk.OldLines || newSeen < hunk.NewLines); i++ {
+		line := lines[i]
+		switch {
+		case line == "":
+			// editors often strip the space of an empty context line
+			hunk.Lines = append(hunk.Lines, " ")
+			oldSeen++
+			newSeen++
+		case line[0] == ' ':
+			hunk.Lines = append(hunk.Lines, line)
+			oldSeen++
+			newSeen++
+		case line[0] == '-':
+			hunk.Lines = append(hunk.Lines, line)
+			oldSeen++
+		case line[0] == '+':
+			hunk.Lines = append(hunk.Lines, line)
+			newSeen++
+		case line[0] == '\\':
+			hunk.Lines = append(hunk.Lines, NoNewlineMarker)
+		default:
+			return Hunk{}, 0, fmt.Errorf("%w: unexpected line %d in hunk", ErrMalformed, i+1)
+		}
+	}
+	if oldSeen != hunk.OldLines || newSeen != hunk.NewLines {
+		return Hunk{}, 0, fmt.Errorf("%w: hunk at line %d is truncated", ErrMalformed, at+1)
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		hunk.Lines = append(hunk.Lines, NoNewlineMarker)
+		i++
+	}
+	return hunk, i, nil
+}
+
+func atoiDefault(raw string, fallback int) int {
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// ApplyFuzzy applies hunks the way patch(1) does: each hunk is looked for at
+// its stated position shifted by the offset of the previous hunk, then at
+// increasing distances from there, and finally with up to maxFuzz context
+// lines ignored at either end. Hunks that cannot be placed are skipped and
+// reported as not applied.
+func ApplyFuzzy(text string, hunks []Hunk, maxFuzz int) (string, []HunkResult) {
+	lines := SplitLines(text)
+	type placement struct {
+		start, end int
+		lines      []string
+	}
+	placements := make([]placement, 0, len(hunks))
+	results := make([]HunkResult, len(hunks))
+
+	minStart, delta := 0, 0
+	for i, hunk := range hunks {
+		results[i] = HunkResult{Index: i}
+		oldLines, newLines := hunkSides(hunk)
+		lead, trail := contextRuns(hunk)
+		stated := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			stated = hunk.OldStart
+		}
+
+		for fuzz := 0; fuzz <= maxFuzz; fuzz++ {
+			cutLead, cutTrail := fuzz, fuzz
+			if cutLead > lead {
+				cutLead = lead
+			}
+			if cutTrail > trail {
+				cutTrail = trail
+			}
+			if fuzz > 0 && cutLead < fuzz && cutTrail < fuzz {
+				// no more context left to ignore
+				break
+			}
+			if len(oldLines) > 0 && cutLead+cutTrail >= len(oldLines) {
+				break
+			}
+			want := oldLines[cutLead : len(oldLines)-cutTrail]
+			start, ok := locate(lines, want, stated+delta+cutLead, minStart)
+			if !ok {
+				continue
+			}
+			placements = append(placements, placement{
+				start: start,
+				end:   start + len(want),
+				lines: newLines[cutLead : len(newLines)-cutTrail],
+			})
+			minStart = start + len(want)
+			delta = start - cutLead - stated
+			results[i] = HunkResult{Index: i, Applied: true, Offset: delta, Fuzz: fuzz}
+			break
+		}
+	}
+
+	var b strings.Builder
+	next := 0
+	for _, p := range placements {
+		for ; next < p.start; next++ {
+			b.WriteString(lines[next])
+		}
+		for _, line := range p.lines {
+			b.WriteString(line)
+		}
+		next = p.end
+	}
+	for ; next < len(lines); next++ {
+		b.WriteString(lines[next])
+	}
+	return b.String(), results
+}
+
+// contextRuns counts the context lines at the start and end of a hunk.
+func contextRuns(hunk Hunk) (lead, trail int) {
+	var kinds []byte
+	for _, line := range hunk.Lines {
+		if line == "" || line[0] == '\\' {
+			continue
+		}
+		kinds = append(kinds, line[0])
+	}
+	for lead < len(kinds) && kinds[lead] == ' ' {
+		lead++
+	}
+	for trail < len(kinds)-lead && kinds[len(kinds)-1-trail] == ' ' {
+		trail++
+	}
+	return lead, trail
+}
+
+// locate finds want in lines at or after minStart, preferring the position
+// closest to expected.
+func locate(lines, want []string, expected, minStart int) (int, bool) {
+	last := len(lines) - len(want)
+	if last < minStart {
+		return 0, false
+	}
+	if expected < minStart {
+		expected = minStart
+	}
+	if expected > last {
+		expected = last
+	}
+	if len(want) == 0 {
+		return expected, true
+	}
+	for d := 0; expected-d >= minStart || expected+d <= last; d++ {
+		if pos := expected - d; pos >= minStart && linesEqual(lines[pos:pos+len(want)], want) {
+			return pos, true
+		}
+		if pos := expected + d; d > 0 && pos <= last && linesEqual(lines[pos:pos+len(want)], want) {
+			return pos, true
+		}
+	}
+	return 0, false
+}
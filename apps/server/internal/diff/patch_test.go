@@ -0,0 +1,241 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []FilePatch
+		wantErr error
+	}{
+		{
+			name: "git diff of two files",
+			patch: "diff --git a/a.txt b/a.txt\n" +
+				"index 1111111..2222222 100644\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1 +1 @@\n" +
+				"-old\n" +
+				"+new\n" +
+				"diff --git a/b.txt b/b.txt\n" +
+				"new file mode 100644\n" +
+				"--- /dev/null\n" +
+				"+++ b/b.txt\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+x\n" +
+				"+y\n",
+			want: []FilePatch{
+				{OldName: "a/a.txt", NewName: "b/a.txt", Hunks: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-old", "+new"}}}},
+				{OldName: DevNull, NewName: "b/b.txt", Hunks: []Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2, Lines: []string{"+x", "+y"}}}},
+			},
+		},
+		{
+			name: "timestamps and quoted names",
+			patch: "--- \"a/with space.txt\"\t2024-01-01 10:00:00\n" +
+				"+++ b/plain.txt\t2024-01-02 10:00:00\n" +
+				"@@ -1 +1 @@\n" +
+				"-a\n" +
+				"+b\n",
+			want: []FilePatch{
+				{OldName: "a/with space.txt", NewName: "b/plain.txt", Hunks: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-a", "+b"}}}},
+			},
+		},
+		{
+			name:  "stripped empty context line",
+			patch: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			want: []FilePatch{
+				{OldName: "a", NewName: "b", Hunks: []Hunk{{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []string{" a", " ", "-b", "+c"}}}},
+			},
+		},
+		{
+			name:  "missing newline markers",
+			patch: "--- a\n+++ b\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			want: []FilePatch{
+				{OldName: "a", NewName: "b", Hunks: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-a", NoNewlineMarker, "+b", NoNewlineMarker}}}},
+			},
+		},
+		{
+			name:    "hunk without a file header",
+			patch:   "@@ -1 +1 @@\n-a\n+b\n",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "no file sections",
+			patch:   "just some text\n",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "truncated hunk",
+			patch:   "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "unexpected line in a hunk",
+			patch:   "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n*b\n",
+			wantErr: ErrMalformed,
+		},
+		{
+			name:    "bad hunk header",
+			patch:   "--- a\n+++ b\n@@ one two @@\n a\n",
+			wantErr: ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.patch)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v\nwant      %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHunks(t *testing.T) {
+	hunks, err := ParseHunks("@@ -2 +2,2 @@\n-b\n+b1\n+b2\n@@ -5,0 +7 @@\n+f\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Hunk{
+		{OldStart: 2, OldLines: 1, NewStart: 2, NewLines: 2, Lines: []string{"-b", "+b1", "+b2"}},
+		{OldStart: 5, OldLines: 0, NewStart: 7, NewLines: 1, Lines: []string{"+f"}},
+	}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("ParseHunks() = %+v, want %+v", hunks, want)
+	}
+	if _, err := ParseHunks("--- a\n+++ b\n"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ParseHunks() without hunks = %v, want %v", err, ErrMalformed)
+	}
+}
+
+// lines returns "line 1\n" through "line n\n", with replace substituting
+// some of them.
+func lines(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line := fmt.Sprintf("line %d", i)
+		if replacement, ok := replace[i]; ok {
+			line = replacement
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func TestApplyFuzzy(t *testing.T) {
+	const fifth = "@@ -4,3 +4,3 @@\n line 4\n-line 5\n+five\n line 6\n"
+	const ninth = "@@ -8,3 +8,3 @@\n line 8\n-line 9\n+nine\n line 10\n"
+	tests := []struct {
+		name    string
+		text    string
+		patch   string
+		maxFuzz int
+		want    string
+		results []HunkResult
+	}{
+		{
+			name:    "at the stated position",
+			text:    lines(10, nil),
+			patch:   fifth,
+			want:    lines(10, map[int]string{5: "five"}),
+			results: []HunkResult{{Index: 0, Applied: true}},
+		},
+		{
+			name:    "shifted by inserted lines",
+			text:    "x\ny\n" + lines(10, nil),
+			patch:   fifth,
+			want:    "x\ny\n" + lines(10, map[int]string{5: "five"}),
+			results: []HunkResult{{Index: 0, Applied: true, Offset: 2}},
+		},
+		{
+			name:    "later hunks follow the offset of earlier ones",
+			text:    "x\ny\n" + lines(10, nil),
+			patch:   fifth + ninth,
+			want:    "x\ny\n" + lines(10, map[int]string{5: "five", 9: "nine"}),
+			results: []HunkResult{{Index: 0, Applied: true, Offset: 2}, {Index: 1, Applied: true, Offset: 2}},
+		},
+		{
+			name:    "shifted by removed lines",
+			text:    strings.TrimPrefix(lines(10, nil), "line 1\nline 2\n"),
+			patch:   ninth,
+			want:    strings.TrimPrefix(lines(10, map[int]string{9: "nine"}), "line 1\nline 2\n"),
+			results: []HunkResult{{Index: 0, Applied: true, Offset: -2}},
+		},
+		{
+			name:    "changed context with fuzz",
+			text:    lines(10, map[int]string{4: "LINE 4"}),
+			patch:   fifth,
+			maxFuzz: 2,
+			want:    lines(10, map[int]string{4: "LINE 4", 5: "five"}),
+			results: []HunkResult{{Index: 0, Applied: true, Fuzz: 1}},
+		},
+		{
+			name:    "changed context without fuzz",
+			text:    lines(10, map[int]string{4: "LINE 4"}),
+			patch:   fifth,
+			want:    lines(10, map[int]string{4: "LINE 4"}),
+			results: []HunkResult{{Index: 0}},
+		},
+		{
+			name:    "changed removed line",
+			text:    lines(10, map[int]string{5: "other"}),
+			patch:   fifth + ninth,
+			maxFuzz: 2,
+			want:    lines(10, map[int]string{5: "other", 9: "nine"}),
+			results: []HunkResult{{Index: 0}, {Index: 1, Applied: true}},
+		},
+		{
+			name:    "insertion into an empty file",
+			text:    "",
+			patch:   "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want:    "a\nb\n",
+			results: []HunkResult{{Index: 0, Applied: true}},
+		},
+		{
+			name:    "missing final newline",
+			text:    "line 1\nline 2",
+			patch:   "@@ -1,2 +1,2 @@\n line 1\n-line 2\n\\ No newline at end of file\n+line two\n\\ No newline at end of file\n",
+			want:    "line 1\nline two",
+			results: []HunkResult{{Index: 0, Applied: true}},
+		},
+		{
+			name:    "adding the final newline",
+			text:    "line 1\nline 2",
+			patch:   "@@ -1,2 +1,2 @@\n line 1\n-line 2\n\\ No newline at end of file\n+line 2\n",
+			want:    "line 1\nline 2\n",
+			results: []HunkResult{{Index: 0, Applied: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := ParseHunks(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, results := ApplyFuzzy(tt.text, hunks, tt.maxFuzz)
+			if got != tt.want {
+				t.Errorf("text = %q\nwant   %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(results, tt.results) {
+				t.Errorf("results = %+v, want %+v", results, tt.results)
+			}
+		})
+	}
+}
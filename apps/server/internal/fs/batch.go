@@ -0,0 +1,540 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var (
+	ErrEmptyBatch       = errors.New("batch has no operations")
+	ErrTooManyBatchOps  = errors.New("too many batch operations")
+	ErrInvalidBatchOp   = errors.New("invalid batch operation")
+	ErrRenameIntoItself = errors.New("cannot move a directory into itself")
+)
+
+const (
+	BatchOpCreate = "create"
+	BatchOpWrite  = "write"
+	BatchOpRename = "rename"
+	BatchOpDelete = "delete"
+)
+
+const (
+	BatchStatusApplied    = "applied"
+	BatchStatusFailed     = "failed"
+	BatchStatusRolledBack = "rolled_back"
+	BatchStatusSkipped    = "skipped"
+)
+
+const (
+	defaultMaxBatchOps   = 512
+	defaultMaxBatchBytes = 32 * 1024 * 1024 // 32 MiB of content across all writes
+)
+
+// BatchOp is one step of a batch. NewPath is the rename target; Overwrite
+// lets a rename replace an existing file.
+type BatchOp struct {
+	Op        string
+	Path      string
+	NewPath   string
+	Content   string
+	IsDir     bool
+	Recursive bool
+	Overwrite bool
+}
+
+type BatchResult struct {
+	Op      string
+	Path    string
+	NewPath string
+	Status  string
+	Stat    StatResult
+	Err     error
+}
+
+// BatchError reports the operation that stopped a batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batch validates every operation against the workspace as it will look when
+// the preceding operations have run, then executes them in order. When an
+// operation fails, everything already done is undone: overwritten and
+// deleted paths are moved aside to backups next to them until the batch
+// commits, so restoring them is a rename.
+func (s *Service) Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(ops) > defaultMaxBatchOps {
+		return nil, ErrTooManyBatchOps
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = BatchResult{Op: op.Op, Path: op.Path, NewPath: op.NewPath, Status: BatchStatusSkipped}
+	}
+
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	resolved, index, err := s.validateBatch(ops)
+	if err != nil {
+		results[index].Status = BatchStatusFailed
+		results[index].Err = err
+		return results, &BatchError{Index: index, Err: err}
+	}
+
+	tx := &batchTx{}
+	for i, op := range resolved {
+		err := ctx.Err()
+		if err == nil {
+			err = s.execBatchOp(ctx, tx, op)
+		}
+		if err == nil {
+			results[i].Status = BatchStatusApplied
+			results[i].Path = op.Path
+			results[i].NewPath = op.NewPath
+			continue
+		}
+
+		results[i].Status = BatchStatusFailed
+		results[i].Err = err
+		for j := 0; j < i; j++ {
+			results[j].Status = BatchStatusRolledBack
+		}
+		if rollbackErr := tx.rollback(); rollbackErr != nil {
+			err = errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+		}
+		return results, &BatchError{Index: i, Err: err}
+	}
+	tx.commit()
+
+	for i, op := range resolved {
+		target := op.Path
+		if op.Op == BatchOpRename {
+			target = op.NewPath
+			s.notifyChange(op.Path)
+		}
+		s.notifyChange(target)
+		if info, err := os.Stat(target); err == nil {
+			results[i].Stat = statFromFileInfo(target, info)
+		} else {
+			results[i].Stat = StatResult{Path: target}
+		}
+	}
+	return results, nil
+}
+
+type batchEntryKind int
+
+const (
+	batchAbsent batchEntryKind = iota
+	batchFile
+	batchDir
+	batchOther
+)
+
+// batchView answers "what is at this path" for validation, layering the
+// effects of earlier operations over the disk. Entries under an overlaid
+// directory are looked up on disk below its source: the directory itself
+// when it was there all along, the old path when it was renamed, and
+// nowhere when the batch created it.
+type batchView struct {
+	overlay map[string]batchEntry
+}
+
+type batchEntry struct {
+	kind   batchEntryKind
+	source string
+}
+
+func (v *batchView) lookup(path string) (batchEntryKind, error) {
+	kind, _, err := v.resolve(path)
+	return kind, err
+}
+
+// resolve returns what is at path and, for a directory, where its
+// children are found on disk ("" when nowhere).
+func (v *batchView) resolve(path string) (batchEntryKind, string, error) {
+	diskPath := path
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if entry, ok := v.overlay[dir]; ok {
+			if dir == path {
+				return entry.kind, entry.source, nil
+			}
+			if entry.kind != batchDir || entry.source == "" {
+				return batchAbsent, "", nil
+			}
+			diskPath = entry.source + path[len(dir):]
+			break
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	info, err := os.Lstat(diskPath)
+	// a path below a regular file does not exist; ensureParents reports it
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return batchAbsent, "", nil
+	}
+	if err != nil {
+		return batchAbsent, "", err
+	}
+	switch {
+	case info.Mode().IsRegular():
+		return batchFile, "", nil
+	case info.IsDir():
+		return batchDir, diskPath, nil
+	default:
+		return batchOther, "", nil
+	}
+}
+
+func (v *batchView) set(path string, kind batchEntryKind) {
+	v.overlay[path] = batchEntry{kind: kind}
+}
+
+// remove forgets path and everything below it.
+func (v *batchView) remove(path string) {
+	for entry := range v.overlay {
+		if isWithin(path, entry) {
+			delete(v.overlay, entry)
+		}
+	}
+}
+
+// move records a rename: what was below from is now below to.
+func (v *batchView) move(from, to string, kind batchEntryKind, source string) {
+	v.remove(to)
+	moved := map[string]batchEntry{}
+	for path, entry := range v.overlay {
+		if path != from && isWithin(from, path) {
+			moved[to+path[len(from):]] = entry
+		}
+	}
+	v.remove(from)
+	for path, entry := range moved {
+		v.overlay[path] = entry
+	}
+	v.overlay[from] = batchEntry{kind: batchAbsent}
+	v.overlay[to] = batchEntry{kind: kind, source: source}
+}
+
+// ensureParents checks that the parents of path are, or can become,
+// directories and records them as directories.
+func (v *batchView) ensureParents(path string) error {
+	var missing []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		kind, err := v.lookup(dir)
+		if err != nil {
+			return err
+		}
+		if kind == batchDir {
+			break
+		}
+		if kind != batchAbsent {
+			return ErrPathNotDirectory
+		}
+		missing = append(missing, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for _, dir := range missing {
+		v.set(dir, batchDir)
+	}
+	return nil
+}
+
+func (s *Service) validateBatch(ops []BatchOp) ([]BatchOp, int, error) {
+	view := &batchView{overlay: map[string]batchEntry{}}
+	resolved := make([]BatchOp, len(ops))
+	var totalBytes int64
+
+	for i, op := range ops {
+		absPath, err := resolveAbsolutePath(op.Path)
+		if err != nil {
+			return nil, i, err
+		}
+		if isFilesystemRoot(absPath) {
+			return nil, i, ErrRefuseFilesystemRoot
+		}
+		op.Path = absPath
+
+		kind, source, err := view.resolve(absPath)
+		if err != nil {
+			return nil, i, err
+		}
+
+		switch op.Op {
+		case BatchOpCreate:
+			if op.IsDir {
+				if kind != batchAbsent && kind != batchDir {
+					return nil, i, ErrFileAlreadyExists
+				}
+			} else if kind != batchAbsent {
+				return nil, i, ErrFileAlreadyExists
+			}
+			if err := view.ensureParents(absPath); err != nil {
+				return nil, i, err
+			}
+			if !op.IsDir {
+				view.set(absPath, batchFile)
+			} else if kind == batchAbsent {
+				view.set(absPath, batchDir)
+			}
+
+		case BatchOpWrite:
+			totalBytes += int64(len(op.Content))
+			if int64(len(op.Content)) > s.cfg.MaxWriteFileBytes || totalBytes > defaultMaxBatchBytes {
+				return nil, i, ErrContentTooLarge
+			}
+			switch kind {
+			case batchDir:
+				return nil, i, ErrPathIsDirectory
+			case batchOther:
+				return nil, i, ErrUnsupportedFileType
+			}
+			if err := view.ensureParents(absPath); err != nil {
+				return nil, i, err
+			}
+			view.set(absPath, batchFile)
+
+		case BatchOpDelete:
+			switch {
+			case kind == batchAbsent:
+				return nil, i, ErrPathNotFound
+			case kind == batchDir && !op.Recursive:
+				return nil, i, ErrDirectoryNeedsRecursive
+			}
+			view.remove(absPath)
+			view.set(absPath, batchAbsent)
+
+		case BatchOpRename:
+			newPath, err := resolveAbsolutePath(op.NewPath)
+			if err != nil {
+				return nil, i, err
+			}
+			if isFilesystemRoot(newPath) {
+				return nil, i, ErrRefuseFilesystemRoot
+			}
+			op.NewPath = newPath
+			if kind == batchAbsent {
+				return nil, i, ErrPathNotFound
+			}
+			if newPath == absPath {
+				return nil, i, fmt.Errorf("%w: rename target is the source", ErrInvalidBatchOp)
+			}
+			if kind == batchDir && isWithin(absPath, newPath) {
+				return nil, i, ErrRenameIntoItself
+			}
+			targetKind, err := view.lookup(newPath)
+			if err != nil {
+				return nil, i, err
+			}
+			switch {
+			case targetKind == batchDir:
+				return nil, i, ErrPathIsDirectory
+			case targetKind != batchAbsent && (!op.Overwrite || kind == batchDir):
+				return nil, i, ErrFileAlreadyExists
+			}
+			if err := view.ensureParents(newPath); err != nil {
+				return nil, i, err
+			}
+			view.move(absPath, newPath, kind, source)
+
+		default:
+			return nil, i, fmt.Errorf("%w: unknown op %q", ErrInvalidBatchOp, op.Op)
+		}
+		resolved[i] = op
+	}
+	return resolved, 0, nil
+}
+
+// batchTx records how to undo each applied step and which backups to drop
+// once the whole batch has succeeded.
+type batchTx struct {
+	undo    []func() error
+	backups []string
+}
+
+func (tx *batchTx) rollback() error {
+	var errs []error
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (tx *batchTx) commit() {
+	for _, backup := range tx.backups {
+		_ = os.RemoveAll(backup)
+	}
+}
+
+// moveAside renames path to a hidden backup in the same directory and
+// registers the undo that moves it back.
+func (tx *batchTx) moveAside(path string) error {
+	backup, err := batchBackupPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	tx.backups = append(tx.backups, backup)
+	tx.undo = append(tx.undo, func() error {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		return os.Rename(backup, path)
+	})
+	return nil
+}
+
+// mkdirAll creates dir and any missing parents, registering their removal.
+func (tx *batchTx) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, func() error {
+		for _, d := range missing {
+			_ = os.Remove(d)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (s *Service) execBatchOp(ctx context.Context, tx *batchTx, op BatchOp) error {
+	switch op.Op {
+	case BatchOpCreate:
+		if op.IsDir {
+			return tx.mkdirAll(op.Path)
+		}
+		if err := tx.mkdirAll(filepath.Dir(op.Path)); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(op.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				return ErrFileAlreadyExists
+			}
+			return err
+		}
+		_ = f.Close()
+		tx.undo = append(tx.undo, func() error { return os.Remove(op.Path) })
+		return nil
+
+	case BatchOpWrite:
+		data, err := s.encodeForWrite(op.Path, op.Content, WriteOptions{})
+		if err != nil {
+			return err
+		}
+		if err := tx.mkdirAll(filepath.Dir(op.Path)); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(op.Path); err == nil {
+			if !info.Mode().IsRegular() {
+				return ErrUnsupportedFileType
+			}
+			s.snapshotFile(op.Path, HistoryReasonWrite)
+			if err := tx.moveAside(op.Path); err != nil {
+				return err
+			}
+		}
+		if err := writeFileAtomic(op.Path, data, 0o644); err != nil {
+			return err
+		}
+		tx.undo = append(tx.undo, func() error { return removeIfExists(op.Path) })
+		return nil
+
+	case BatchOpDelete:
+		info, err := os.Lstat(op.Path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return ErrPathNotFound
+			}
+			return err
+		}
+		if info.IsDir() {
+			if !op.Recursive {
+				return ErrDirectoryNeedsRecursive
+			}
+			s.snapshotTree(ctx, op.Path)
+		} else {
+			s.snapshotFile(op.Path, HistoryReasonDelete)
+		}
+		return tx.moveAside(op.Path)
+
+	case BatchOpRename:
+		if err := tx.mkdirAll(filepath.Dir(op.NewPath)); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(op.NewPath); err == nil {
+			if !op.Overwrite {
+				return ErrFileAlreadyExists
+			}
+			s.snapshotFile(op.NewPath, HistoryReasonDelete)
+			if err := tx.moveAside(op.NewPath); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(op.Path, op.NewPath); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return ErrPathNotFound
+			}
+			return err
+		}
+		tx.undo = append(tx.undo, func() error { return os.Rename(op.NewPath, op.Path) })
+		return nil
+	}
+	return ErrInvalidBatchOp
+}
+
+func batchBackupPath(path string) (string, error) {
+	var buf [6]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), ".omt-batch-"+hex.EncodeToString(buf[:])+"-"+filepath.Base(path)), nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
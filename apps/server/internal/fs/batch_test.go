@@ -0,0 +1,282 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files (path → content) and directories (path ending
+// in "/") under root.
+func writeTree(t *testing.T, root string, entries map[string]string) {
+	t.Helper()
+	for rel, content := range entries {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if strings.HasSuffix(rel, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns every file under root as path → content, with
+// directories listed as "path/".
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		if entry.IsDir() {
+			out[rel+"/"] = ""
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		out[rel] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func treeKeys(tree map[string]string) string {
+	keys := make([]string, 0, len(tree))
+	for key, content := range tree {
+		if !strings.HasSuffix(key, "/") {
+			key += "=" + content
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     map[string]string
+		ops       []BatchOp
+		wantIndex int
+		wantErr   error
+		want      map[string]string
+	}{
+		{
+			name:  "write an existing file of a renamed directory",
+			setup: map[string]string{"a/x.go": "old"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpWrite, Path: "b/x.go", Content: "new"},
+			},
+			want: map[string]string{"b/": "", "b/x.go": "new"},
+		},
+		{
+			name:  "delete a file of a renamed directory",
+			setup: map[string]string{"a/x.go": "x", "a/y.go": "y"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpDelete, Path: "b/x.go"},
+			},
+			want: map[string]string{"b/": "", "b/y.go": "y"},
+		},
+		{
+			name:  "rename a file of a renamed directory",
+			setup: map[string]string{"a/x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpRename, Path: "b/x.go", NewPath: "b/y.go"},
+			},
+			want: map[string]string{"b/": "", "b/y.go": "x"},
+		},
+		{
+			name:  "nested directory renames",
+			setup: map[string]string{"a/sub/z.go": "z"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpRename, Path: "b/sub", NewPath: "c"},
+				{Op: BatchOpWrite, Path: "c/z.go", Content: "zz"},
+			},
+			want: map[string]string{"b/": "", "c/": "", "c/z.go": "zz"},
+		},
+		{
+			name:  "files written before a rename move with it",
+			setup: map[string]string{"a/": ""},
+			ops: []BatchOp{
+				{Op: BatchOpWrite, Path: "a/new.go", Content: "n"},
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpDelete, Path: "b/new.go"},
+			},
+			want: map[string]string{"b/": ""},
+		},
+		{
+			name:  "the old directory is recreated empty",
+			setup: map[string]string{"a/x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpCreate, Path: "a/x.go"},
+			},
+			want: map[string]string{"a/": "", "a/x.go": "", "b/": "", "b/x.go": "x"},
+		},
+		{
+			name:  "children of a renamed directory are gone from the old path",
+			setup: map[string]string{"a/x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpDelete, Path: "a/x.go"},
+			},
+			wantIndex: 1,
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:  "files written before a rename are gone from the old path",
+			setup: map[string]string{"a/": ""},
+			ops: []BatchOp{
+				{Op: BatchOpWrite, Path: "a/new.go", Content: "n"},
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpDelete, Path: "a/new.go"},
+			},
+			wantIndex: 2,
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:  "children of a deleted directory are gone",
+			setup: map[string]string{"a/x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpDelete, Path: "a", Recursive: true},
+				{Op: BatchOpDelete, Path: "a/x.go"},
+			},
+			wantIndex: 1,
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:  "a directory recreated after a delete starts empty",
+			setup: map[string]string{"a/x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpDelete, Path: "a", Recursive: true},
+				{Op: BatchOpWrite, Path: "a/y.go", Content: "y"},
+				{Op: BatchOpDelete, Path: "a/x.go"},
+			},
+			wantIndex: 2,
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "write over a directory",
+			setup:     map[string]string{"a/": ""},
+			ops:       []BatchOp{{Op: BatchOpWrite, Path: "a", Content: "x"}},
+			wantIndex: 0,
+			wantErr:   ErrPathIsDirectory,
+		},
+		{
+			name:  "create a file created earlier",
+			setup: map[string]string{},
+			ops: []BatchOp{
+				{Op: BatchOpCreate, Path: "new.go"},
+				{Op: BatchOpCreate, Path: "new.go"},
+			},
+			wantIndex: 1,
+			wantErr:   ErrFileAlreadyExists,
+		},
+		{
+			name:      "delete a directory without recursive",
+			setup:     map[string]string{"a/x.go": "x"},
+			ops:       []BatchOp{{Op: BatchOpDelete, Path: "a"}},
+			wantIndex: 0,
+			wantErr:   ErrDirectoryNeedsRecursive,
+		},
+		{
+			name:      "rename a directory into itself",
+			setup:     map[string]string{"a/x.go": "x"},
+			ops:       []BatchOp{{Op: BatchOpRename, Path: "a", NewPath: "a/b"}},
+			wantIndex: 0,
+			wantErr:   ErrRenameIntoItself,
+		},
+		{
+			name:      "rename onto a file without overwrite",
+			setup:     map[string]string{"x.go": "x", "y.go": "y"},
+			ops:       []BatchOp{{Op: BatchOpRename, Path: "x.go", NewPath: "y.go"}},
+			wantIndex: 0,
+			wantErr:   ErrFileAlreadyExists,
+		},
+		{
+			name:  "write below a file",
+			setup: map[string]string{"x.go": "x"},
+			ops: []BatchOp{
+				{Op: BatchOpWrite, Path: "x.go/y.go", Content: "y"},
+			},
+			wantIndex: 0,
+			wantErr:   ErrPathNotDirectory,
+		},
+		{
+			name:  "rollback after a renamed directory was written",
+			setup: map[string]string{"a/x.go": "old", "a/latin1.txt": "caf\xe9"},
+			ops: []BatchOp{
+				{Op: BatchOpRename, Path: "a", NewPath: "b"},
+				{Op: BatchOpWrite, Path: "b/x.go", Content: "new"},
+				{Op: BatchOpDelete, Path: "b/x.go"},
+				{Op: BatchOpCreate, Path: "c/d/e.go"},
+				// passes validation but cannot be encoded as Latin-1
+				{Op: BatchOpWrite, Path: "b/latin1.txt", Content: "日本"},
+			},
+			wantIndex: 4,
+			wantErr:   ErrUnencodable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tt.setup)
+			before := readTree(t, root)
+			ops := make([]BatchOp, len(tt.ops))
+			for i, op := range tt.ops {
+				op.Path = filepath.Join(root, filepath.FromSlash(op.Path))
+				if op.NewPath != "" {
+					op.NewPath = filepath.Join(root, filepath.FromSlash(op.NewPath))
+				}
+				ops[i] = op
+			}
+
+			results, err := NewService(DefaultConfig()).Batch(context.Background(), ops)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Batch: %v", err)
+				}
+				for i, result := range results {
+					if result.Status != BatchStatusApplied {
+						t.Errorf("op %d status = %q", i, result.Status)
+					}
+				}
+				if got := readTree(t, root); treeKeys(got) != treeKeys(tt.want) {
+					t.Errorf("tree = %s\nwant   %s", treeKeys(got), treeKeys(tt.want))
+				}
+				return
+			}
+
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) || batchErr.Index != tt.wantIndex || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Batch error = %v, want %v at operation %d", err, tt.wantErr, tt.wantIndex)
+			}
+			if results[tt.wantIndex].Status != BatchStatusFailed {
+				t.Errorf("failed op status = %q", results[tt.wantIndex].Status)
+			}
+			if got := readTree(t, root); treeKeys(got) != treeKeys(before) {
+				t.Errorf("tree after failure = %s\nwant unchanged %s", treeKeys(got), treeKeys(before))
+			}
+		})
+	}
+}
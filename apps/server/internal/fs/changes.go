@@ -0,0 +1,27 @@
+package fs
+
+// ChangeHandler is told the absolute path of every file or directory the
+// service wrote, created, deleted or renamed, once the change is on disk. A
+// rename reports both the old and the new path; a recursive delete reports
+// only the directory itself.
+type ChangeHandler func(path string)
+
+// OnChange registers handler for every later change made through the
+// service. Handlers run on the goroutine that made the change, so they must
+// not block.
+func (s *Service) OnChange(handler ChangeHandler) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	s.onChange = append(s.onChange, handler)
+}
+
+func (s *Service) notifyChange(paths ...string) {
+	s.changeMu.RLock()
+	handlers := s.onChange
+	s.changeMu.RUnlock()
+	for _, path := range paths {
+		for _, handler := range handlers {
+			handler(path)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknownEncoding   = errors.New("unknown encoding")
+	ErrUnknownLineEnding = errors.New("unknown line ending")
+	ErrUnencodable       = errors.New("content cannot be represented in the target encoding")
+)
+
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF8BOM = "utf-8-bom"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin1"
+)
+
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+	LineEndingCR   = "cr"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// TextFormat describes how a text file is stored on disk. LineEnding is the
+// dominant style and is empty for text without line breaks.
+type TextFormat struct {
+	Encoding         string
+	LineEnding       string
+	MixedLineEndings bool
+	TrailingNewline  bool
+}
+
+// WriteOptions converts content on write. An empty Encoding keeps the
+// encoding of the file being replaced; line endings are only converted when
+// LineEnding is set, and a nil TrailingNewline leaves content as given.
+type WriteOptions struct {
+	Encoding        string
+	LineEnding      string
+	TrailingNewline *bool
+}
+
+// decodeBytes detects the encoding of content and returns it as UTF-8.
+// UTF-16 without a BOM is recognised by its pattern of zero bytes; other
+// content with NULs is treated as binary.
+func decodeBytes(content []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		rest := content[len(bomUTF8):]
+		if !utf8.Valid(rest) {
+			return "", "", ErrBinaryFile
+		}
+		return string(rest), EncodingUTF8BOM, nil
+	case bytes.HasPrefix(content, bomUTF16LE):
+		text, err := decodeUTF16(content[2:], false)
+		return text, EncodingUTF16LE, err
+	case bytes.HasPrefix(content, bomUTF16BE):
+		text, err := decodeUTF16(content[2:], true)
+		return text, EncodingUTF16BE, err
+	}
+
+	if bytes.IndexByte(content, 0x00) >= 0 {
+		switch guessUTF16(content) {
+		case EncodingUTF16LE:
+			text, err := decodeUTF16(content, false)
+			return text, EncodingUTF16LE, err
+		case EncodingUTF16BE:
+			text, err := decodeUTF16(content, true)
+			return text, EncodingUTF16BE, err
+		}
+		return "", "", ErrBinaryFile
+	}
+
+	if utf8.Valid(content) {
+		return string(content), EncodingUTF8, nil
+	}
+	// every byte is a valid Latin-1 character
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return string(runes), EncodingLatin1, nil
+}
+
+// guessUTF16 looks for BOM-less UTF-16 text, where mostly-ASCII content has
+// a zero in every other byte.
+func guessUTF16(content []byte) string {
+	if len(content) < 2 || len(content)%2 != 0 {
+		return ""
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(content); i += 2 {
+		if content[i] == 0 {
+			evenZeros++
+		}
+		if content[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	units := len(content) / 2
+	switch {
+	case oddZeros*10 >= units*7 && evenZeros*10 <= units:
+		return EncodingUTF16LE
+	case evenZeros*10 >= units*7 && oddZeros*10 <= units:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+func decodeUTF16(content []byte, bigEndian bool) (string, error) {
+	if len(content)%2 != 0 {
+		return "", ErrBinaryFile
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(content[2*i])<<8 | uint16(content[2*i+1])
+		} else {
+			units[i] = uint16(content[2*i+1])<<8 | uint16(content[2*i])
+		}
+	}
+	text := string(utf16.Decode(units))
+	if strings.ContainsRune(text, 0) {
+		return "", ErrBinaryFile
+	}
+	return text, nil
+}
+
+// encodeText converts UTF-8 text to encoding. UTF-16 is always written with
+// a BOM so it can be read back without guessing.
+func encodeText(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		return []byte(text), nil
+	case EncodingUTF8BOM:
+		return append(append([]byte{}, bomUTF8...), text...), nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := utf16.Encode([]rune(text))
+		out := make([]byte, 2, 2+2*len(units))
+		if encoding == EncodingUTF16LE {
+			copy(out, bomUTF16LE)
+			for _, u := range units {
+				out = append(out, byte(u), byte(u>>8))
+			}
+		} else {
+			copy(out, bomUTF16BE)
+			for _, u := range units {
+				out = append(out, byte(u>>8), byte(u))
+			}
+		}
+		return out, nil
+	case EncodingLatin1:
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("%w: %q in %s", ErrUnencodable, r, encoding)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownEncoding, encoding)
+}
+
+func detectTextFormat(text, encoding string) TextFormat {
+	format := TextFormat{Encoding: encoding}
+	lf, crlf, cr := 0, 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		}
+	}
+
+	switch {
+	case crlf >= lf && crlf >= cr && crlf > 0:
+		format.LineEnding = LineEndingCRLF
+	case lf >= cr && lf > 0:
+		format.LineEnding = LineEndingLF
+	case cr > 0:
+		format.LineEnding = LineEndingCR
+	}
+	kinds := 0
+	for _, n := range []int{lf, crlf, cr} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	format.MixedLineEndings = kinds > 1
+	format.TrailingNewline = strings.HasSuffix(text, "\n") || strings.HasSuffix(text, "\r")
+	return format
+}
+
+// convertLineEndings rewrites every line break in text to the given style.
+func convertLineEndings(text, lineEnding string) (string, error) {
+	var sep string
+	switch lineEnding {
+	case LineEndingLF:
+		sep = "\n"
+	case LineEndingCRLF:
+		sep = "\r\n"
+	case LineEndingCR:
+		sep = "\r"
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownLineEnding, lineEnding)
+	}
+	normalized := strings.ReplaceAll(text, "\r\n", "\n")
+	normalized = strings.ReplaceAll(normalized, "\r", "\n")
+	if sep == "\n" {
+		return normalized, nil
+	}
+	return strings.ReplaceAll(normalized, "\n", sep), nil
+}
+
+// encodeForWrite turns content into the bytes written to absPath. Unless
+// opts say otherwise, the existing file's encoding and BOM are kept. Line
+// breaks are written as given unless opts.LineEnding asks for a style, so
+// callers that hash what they write see the same text when reading back.
+func (s *Service) encodeForWrite(absPath, content string, opts WriteOptions) ([]byte, error) {
+	var existing TextFormat
+	if info, err := os.Lstat(absPath); err == nil && info.Mode().IsRegular() && info.Size() <= s.cfg.MaxReadFileBytes {
+		if raw, err := os.ReadFile(absPath); err == nil {
+			if text, encoding, err := decodeBytes(raw); err == nil {
+				existing = detectTextFormat(text, encoding)
+			}
+		}
+	}
+
+	encoding := opts.Encoding
+	if encoding == "" {
+		encoding = existing.Encoding
+	}
+	if opts.LineEnding != "" {
+		converted, err := convertLineEndings(content, opts.LineEnding)
+		if err != nil {
+			return nil, err
+		}
+		content = converted
+	}
+	if opts.TrailingNewline != nil {
+		// an added final break follows the requested style, else the file's
+		lineEnding := opts.LineEnding
+		if lineEnding == "" && !existing.MixedLineEndings {
+			lineEnding = existing.LineEnding
+		}
+		content = setTrailingNewline(content, *opts.TrailingNewline, lineEnding)
+	}
+	return encodeText(content, encoding)
+}
+
+// setTrailingNewline adds or removes a single final line break.
+func setTrailingNewline(content string, want bool, lineEnding string) string {
+	has := strings.HasSuffix(content, "\n") || strings.HasSuffix(content, "\r")
+	switch {
+	case want && !has && content != "":
+		switch lineEnding {
+		case LineEndingCRLF:
+			return content + "\r\n"
+		case LineEndingCR:
+			return content + "\r"
+		}
+		return content + "\n"
+	case !want && has:
+		if strings.HasSuffix(content, "\r\n") {
+			return content[:len(content)-2]
+		}
+		return content[:len(content)-1]
+	}
+	return content
+}
@@ -0,0 +1,262 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeBytes(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      []byte
+		wantText     string
+		wantEncoding string
+		wantErr      error
+	}{
+		{name: "utf-8", content: []byte("héllo\n"), wantText: "héllo\n", wantEncoding: EncodingUTF8},
+		{name: "empty", content: nil, wantText: "", wantEncoding: EncodingUTF8},
+		{name: "utf-8 with BOM", content: []byte("\xEF\xBB\xBFhi"), wantText: "hi", wantEncoding: EncodingUTF8BOM},
+		{name: "utf-16le with BOM", content: []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, wantText: "hi", wantEncoding: EncodingUTF16LE},
+		{name: "utf-16be with BOM", content: []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, wantText: "hi", wantEncoding: EncodingUTF16BE},
+		{name: "utf-16le without BOM", content: []byte{'a', 0, 'b', 0, 'c', 0, '\n', 0}, wantText: "abc\n", wantEncoding: EncodingUTF16LE},
+		{name: "utf-16be without BOM", content: []byte{0, 'a', 0, 'b', 0, 'c', 0, '\n'}, wantText: "abc\n", wantEncoding: EncodingUTF16BE},
+		{name: "utf-16 surrogate pair", content: []byte{0xFF, 0xFE, 0x3D, 0xD8, 0x00, 0xDE}, wantText: "😀", wantEncoding: EncodingUTF16LE},
+		{name: "latin1", content: []byte("caf\xE9\n"), wantText: "café\n", wantEncoding: EncodingLatin1},
+		{name: "NULs without a UTF-16 pattern", content: []byte{0x7F, 'E', 'L', 'F', 0, 0, 1, 2, 3}, wantErr: ErrBinaryFile},
+		{name: "invalid utf-8 after a BOM", content: []byte("\xEF\xBB\xBF\xFF\xFE"), wantErr: ErrBinaryFile},
+		{name: "odd-length utf-16", content: []byte{0xFF, 0xFE, 'h', 0, 'i'}, wantErr: ErrBinaryFile},
+		{name: "NUL inside utf-16", content: []byte{0xFF, 0xFE, 'h', 0, 0, 0}, wantErr: ErrBinaryFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, encoding, err := decodeBytes(tt.content)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("decodeBytes() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeBytes(): %v", err)
+			}
+			if text != tt.wantText || encoding != tt.wantEncoding {
+				t.Errorf("decodeBytes() = %q, %q, want %q, %q", text, encoding, tt.wantText, tt.wantEncoding)
+			}
+		})
+	}
+}
+
+func TestEncodeTextRoundTrip(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		// decoded is the encoding the bytes are detected as, when it
+		// differs: pure ASCII is indistinguishable from UTF-8.
+		decoded string
+		wantErr error
+	}{
+		{encoding: EncodingUTF8, text: "héllo 😀\r\n"},
+		{encoding: EncodingUTF8BOM, text: "héllo\n"},
+		{encoding: EncodingUTF8BOM, text: ""},
+		{encoding: EncodingUTF16LE, text: "héllo 😀\n"},
+		{encoding: EncodingUTF16BE, text: "héllo 😀\n"},
+		{encoding: EncodingLatin1, text: "café ÿ\n"},
+		{encoding: EncodingLatin1, text: "plain\n", decoded: EncodingUTF8},
+		{encoding: "", text: "plain\n", decoded: EncodingUTF8},
+		{encoding: EncodingLatin1, text: "日本", wantErr: ErrUnencodable},
+		{encoding: "ebcdic", text: "x", wantErr: ErrUnknownEncoding},
+	}
+
+	for _, tt := range tests {
+		raw, err := encodeText(tt.text, tt.encoding)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("encodeText(%q, %q) error = %v, want %v", tt.text, tt.encoding, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("encodeText(%q, %q): %v", tt.text, tt.encoding, err)
+			continue
+		}
+		want := tt.decoded
+		if want == "" {
+			want = tt.encoding
+		}
+		text, encoding, err := decodeBytes(raw)
+		if err != nil || text != tt.text || encoding != want {
+			t.Errorf("round trip of %q as %q = %q, %q, %v, want %q, %q", tt.text, tt.encoding, text, encoding, err, tt.text, want)
+		}
+	}
+}
+
+func TestDetectTextFormat(t *testing.T) {
+	tests := []struct {
+		text string
+		want TextFormat
+	}{
+		{text: "", want: TextFormat{}},
+		{text: "one line", want: TextFormat{}},
+		{text: "a\nb\n", want: TextFormat{LineEnding: LineEndingLF, TrailingNewline: true}},
+		{text: "a\r\nb", want: TextFormat{LineEnding: LineEndingCRLF}},
+		{text: "a\rb\r", want: TextFormat{LineEnding: LineEndingCR, TrailingNewline: true}},
+		{text: "a\r\nb\r\nc\n", want: TextFormat{LineEnding: LineEndingCRLF, MixedLineEndings: true, TrailingNewline: true}},
+		{text: "a\nb\nc\r\n", want: TextFormat{LineEnding: LineEndingLF, MixedLineEndings: true, TrailingNewline: true}},
+		// a tie goes to CRLF
+		{text: "a\r\nb\n", want: TextFormat{LineEnding: LineEndingCRLF, MixedLineEndings: true, TrailingNewline: true}},
+	}
+	for _, tt := range tests {
+		tt.want.Encoding = EncodingUTF8
+		if got := detectTextFormat(tt.text, EncodingUTF8); got != tt.want {
+			t.Errorf("detectTextFormat(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestConvertLineEndings(t *testing.T) {
+	const mixed = "a\r\nb\nc\rd"
+	tests := []struct {
+		lineEnding string
+		want       string
+		wantErr    error
+	}{
+		{lineEnding: LineEndingLF, want: "a\nb\nc\nd"},
+		{lineEnding: LineEndingCRLF, want: "a\r\nb\r\nc\r\nd"},
+		{lineEnding: LineEndingCR, want: "a\rb\rc\rd"},
+		{lineEnding: "auto", wantErr: ErrUnknownLineEnding},
+	}
+	for _, tt := range tests {
+		got, err := convertLineEndings(mixed, tt.lineEnding)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("convertLineEndings(%q) = %q, %v, want %q, %v", tt.lineEnding, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteTextWith(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		existing []byte
+		content  string
+		opts     WriteOptions
+		want     []byte
+		wantErr  error
+	}{
+		{
+			name:    "new file as given",
+			content: "a\r\nb",
+			want:    []byte("a\r\nb"),
+		},
+		{
+			name:     "line endings are kept as given",
+			existing: []byte("a\r\nb\r\n"),
+			content:  "a\nb\nc\n",
+			want:     []byte("a\nb\nc\n"),
+		},
+		{
+			name:     "requested line endings",
+			existing: []byte("a\nb\n"),
+			content:  "a\nb\r\nc",
+			opts:     WriteOptions{LineEnding: LineEndingCRLF},
+			want:     []byte("a\r\nb\r\nc"),
+		},
+		{
+			name:     "encoding and BOM are kept",
+			existing: []byte{0xFF, 0xFE, 'a', 0, '\n', 0},
+			content:  "é\n",
+			want:     []byte{0xFF, 0xFE, 0xE9, 0, '\n', 0},
+		},
+		{
+			name:     "utf-8 BOM is kept",
+			existing: []byte("\xEF\xBB\xBFold"),
+			content:  "new",
+			want:     []byte("\xEF\xBB\xBFnew"),
+		},
+		{
+			name:     "latin1 is kept",
+			existing: []byte("caf\xE9"),
+			content:  "thé",
+			want:     []byte("th\xE9"),
+		},
+		{
+			name:     "requested encoding",
+			existing: []byte("caf\xE9"),
+			content:  "thé",
+			opts:     WriteOptions{Encoding: EncodingUTF8},
+			want:     []byte("thé"),
+		},
+		{
+			name:     "unencodable content",
+			existing: []byte("caf\xE9"),
+			content:  "日本",
+			wantErr:  ErrUnencodable,
+		},
+		{
+			name:     "added final break follows the file",
+			existing: []byte("a\r\nb\r\n"),
+			content:  "a\r\nb",
+			opts:     WriteOptions{TrailingNewline: &yes},
+			want:     []byte("a\r\nb\r\n"),
+		},
+		{
+			name:     "added final break of a mixed file",
+			existing: []byte("a\r\nb\nc\r\n"),
+			content:  "a\r\nb",
+			opts:     WriteOptions{TrailingNewline: &yes},
+			want:     []byte("a\r\nb\n"),
+		},
+		{
+			name:     "added final break follows the requested style",
+			existing: []byte("a\nb\n"),
+			content:  "a\nb",
+			opts:     WriteOptions{LineEnding: LineEndingCRLF, TrailingNewline: &yes},
+			want:     []byte("a\r\nb\r\n"),
+		},
+		{
+			name:    "removed final break",
+			content: "a\r\nb\r\n",
+			opts:    WriteOptions{TrailingNewline: &no},
+			want:    []byte("a\r\nb"),
+		},
+		{
+			name:     "unknown line ending",
+			existing: []byte("a\n"),
+			content:  "b\n",
+			opts:     WriteOptions{LineEnding: "auto"},
+			wantErr:  ErrUnknownLineEnding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if tt.existing != nil {
+				if err := os.WriteFile(path, tt.existing, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := NewService(DefaultConfig()).WriteTextWith(context.Background(), path, tt.content, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("WriteTextWith() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteTextWith(): %v", err)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != string(tt.want) {
+				t.Errorf("file = %q, want %q", raw, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrHistoryDisabled        = errors.New("local history is disabled")
+	ErrHistoryVersionNotFound = errors.New("history version not found")
+)
+
+const (
+	HistoryReasonWrite   = "write"
+	HistoryReasonDelete  = "delete"
+	HistoryReasonRestore = "restore"
+)
+
+const (
+	defaultMaxHistoryBytes = 256 * 1024 * 1024 // 256 MiB per workspace
+	defaultMaxHistoryAge   = 30 * 24 * time.Hour
+	// maxHistoryTreeFiles bounds how many files a recursive delete snapshots.
+	maxHistoryTreeFiles = 256
+	historyIndexName    = "index.json"
+	historyLockName     = "index.lock"
+	historyBlobDirName  = "blobs"
+	historyGlobalBucket = "global"
+)
+
+// HistoryVersion is a previous version of a file kept in local history.
+type HistoryVersion struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// history keeps the content that writes and deletes replace. Every workspace
+// root gets its own bucket of content-addressed blobs plus an index, so
+// pruning one workspace never touches another. The server and the stdio MCP
+// server share the directory, so indexes are read afresh for every call and
+// a bucket is changed only while its lock file is held.
+type history struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu sync.Mutex
+}
+
+type historyBucket struct {
+	dir string
+
+	Root string `json:"root,omitempty"`
+	// Versions are ordered oldest first.
+	Versions []HistoryVersion `json:"versions"`
+}
+
+func newHistory(dir string, maxBytes int64, maxAge time.Duration) *history {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxHistoryBytes
+	}
+	if maxAge <= 0 {
+		maxAge = defaultMaxHistoryAge
+	}
+	return &history{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+}
+
+// snapshotFile records the current content of absPath before it is replaced.
+// History is best effort: a failure here must never block the write itself.
+func (s *Service) snapshotFile(absPath, reason string) {
+	if s.history == nil {
+		return
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > s.cfg.MaxWriteFileBytes {
+		return
+	}
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return
+	}
+	_ = s.history.record(s.historyRoot(absPath), absPath, content, reason)
+}
+
+// snapshotTree records the files under dir ahead of a recursive delete.
+func (s *Service) snapshotTree(ctx context.Context, dir string) {
+	if s.history == nil {
+		return
+	}
+	count := 0
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || ctx.Err() != nil {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			s.snapshotFile(path, HistoryReasonDelete)
+			count++
+			if count >= maxHistoryTreeFiles {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Service) historyRoot(absPath string) string {
+	if root, ok := s.WorkspaceRootFor(absPath); ok {
+		return root.Path
+	}
+	return ""
+}
+
+// History lists the saved versions of a file, newest first.
+func (s *Service) History(ctx context.Context, rawPath string) ([]HistoryVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	absPath, err := resolveAbsolutePath(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.history.list(s.historyRoot(absPath), absPath)
+}
+
+// RestoreHistory writes a saved version back to the file. The content being
+// replaced is itself snapshotted, so a restore can be undone.
+func (s *Service) RestoreHistory(ctx context.Context, rawPath, id string) (StatResult, error) {
+	if err := ctx.Err(); err != nil {
+		return StatResult{}, err
+	}
+	if s.history == nil {
+		return StatResult{}, ErrHistoryDisabled
+	}
+
+	absPath, err := resolveAbsolutePath(rawPath)
+	if err != nil {
+		return StatResult{}, err
+	}
+	content, err := s.history.content(s.historyRoot(absPath), absPath, id)
+	if err != nil {
+		return StatResult{}, err
+	}
+	return s.writeBytes(ctx, absPath, content, HistoryReasonRestore)
+}
+
+func (h *history) record(root, absPath string, content []byte, reason string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	unlock, err := lockHistoryBucket(filepath.Join(h.dir, bucketName(root)))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	bucket, err := h.bucket(root)
+	if err != nil {
+		return err
+	}
+
+	hash := hashBytes(content)
+	for i := len(bucket.Versions) - 1; i >= 0; i-- {
+		if bucket.Versions[i].Path != absPath {
+			continue
+		}
+		if bucket.Versions[i].Hash == hash {
+			// unchanged since the last snapshot
+			return nil
+		}
+		break
+	}
+
+	if err := bucket.putBlob(hash, content); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	bucket.Versions = append(bucket.Versions, HistoryVersion{
+		ID:        strconv.FormatInt(now.UnixNano(), 36) + "-" + hash[:8],
+		Path:      absPath,
+		Hash:      hash,
+		Size:      int64(len(content)),
+		Reason:    reason,
+		CreatedAt: now,
+	})
+	bucket.prune(now, h.maxAge, h.maxBytes)
+	return bucket.save()
+}
+
+func (h *history) list(root, absPath string) ([]HistoryVersion, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets, err := h.bucketsFor(root, absPath)
+	if err != nil {
+		return nil, err
+	}
+	out := []HistoryVersion{}
+	seen := map[string]bool{}
+	for _, bucket := range buckets {
+		for _, version := range bucket.Versions {
+			if version.Path == absPath && !seen[version.ID] {
+				seen[version.ID] = true
+				out = append(out, version)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (h *history) content(root, absPath, id string) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets, err := h.bucketsFor(root, absPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		for _, version := range bucket.Versions {
+			if version.ID != id || version.Path != absPath {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(bucket.dir, historyBlobDirName, version.Hash))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, ErrHistoryVersionNotFound
+			}
+			return content, err
+		}
+	}
+	return nil, ErrHistoryVersionNotFound
+}
+
+// bucketsFor returns every bucket that may hold versions of absPath: the
+// one for root, then those of each directory above the file that was a
+// workspace root when a version was recorded, then the global bucket.
+// Versions recorded before the workspace was opened, or under another
+// root, are found this way too. Callers hold h.mu.
+func (h *history) bucketsFor(root, absPath string) ([]*historyBucket, error) {
+	roots := []string{root}
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		if dir != root {
+			roots = append(roots, dir)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	if root != "" {
+		roots = append(roots, "")
+	}
+
+	var buckets []*historyBucket
+	for _, candidate := range roots {
+		if candidate != root {
+			if _, err := os.Stat(filepath.Join(h.dir, bucketName(candidate))); err != nil {
+				continue
+			}
+		}
+		bucket, err := h.bucket(candidate)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// bucket loads the index for root. Callers hold h.mu, and the bucket's
+// lock when they change it.
+func (h *history) bucket(root string) (*historyBucket, error) {
+	bucket := &historyBucket{dir: filepath.Join(h.dir, bucketName(root)), Root: root}
+
+	raw, err := os.ReadFile(filepath.Join(bucket.dir, historyIndexName))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(raw, bucket); err != nil {
+			// a corrupt index only loses history, not the blobs on disk
+			bucket.Versions = nil
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	return bucket, nil
+}
+
+func bucketName(root string) string {
+	if root == "" {
+		return historyGlobalBucket
+	}
+	return hashBytes([]byte(root))[:16]
+}
+
+// prune drops versions older than maxAge, then the oldest versions until the
+// distinct blobs fit in maxBytes, and finally removes unreferenced blobs.
+func (b *historyBucket) prune(now time.Time, maxAge time.Duration, maxBytes int64) {
+	sort.SliceStable(b.Versions, func(i, j int) bool {
+		return b.Versions[i].CreatedAt.Before(b.Versions[j].CreatedAt)
+	})
+
+	refs := make(map[string]int, len(b.Versions))
+	var total int64
+	for _, version := range b.Versions {
+		if refs[version.Hash] == 0 {
+			total += version.Size
+		}
+		refs[version.Hash]++
+	}
+
+	cutoff := now.Add(-maxAge)
+	first := 0
+	for ; first < len(b.Versions); first++ {
+		version := b.Versions[first]
+		expired := version.CreatedAt.Before(cutoff)
+		if !expired && (total <= maxBytes || first == len(b.Versions)-1) {
+			break
+		}
+		refs[version.Hash]--
+		if refs[version.Hash] == 0 {
+			delete(refs, version.Hash)
+			total -= version.Size
+		}
+	}
+	b.Versions = append([]HistoryVersion(nil), b.Versions[first:]...)
+
+	blobDir := filepath.Join(b.dir, historyBlobDirName)
+	entries, err := os.ReadDir(blobDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if refs[entry.Name()] == 0 {
+			_ = os.Remove(filepath.Join(blobDir, entry.Name()))
+		}
+	}
+}
+
+func (b *historyBucket) putBlob(hash string, content []byte) error {
+	dir := filepath.Join(b.dir, historyBlobDirName)
+	path := filepath.Join(dir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content, 0o600)
+}
+
+// lockHistoryBucket takes the lock that serializes changes to the bucket in
+// dir across processes.
+func lockHistoryBucket(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, historyLockName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+func (b *historyBucket) save() error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(b.dir, historyIndexName), raw, 0o600)
+}
+
+func hashBytes(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
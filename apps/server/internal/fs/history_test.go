@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestHistorySharedDir writes through two services sharing one history
+// directory, as the server and the stdio MCP server do; neither may drop
+// versions the other recorded.
+func TestHistorySharedDir(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.HistoryDir = t.TempDir()
+	services := []*Service{NewService(config), NewService(config)}
+	root := t.TempDir()
+	for _, s := range services {
+		s.RegisterWorkspaceRoot(root, WorkspaceRootFolder)
+	}
+
+	const writes = 20
+	paths := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")}
+	var wg sync.WaitGroup
+	for i, s := range services {
+		wg.Add(1)
+		go func(s *Service, path string) {
+			defer wg.Done()
+			for n := 0; n <= writes; n++ {
+				if _, err := s.WriteText(ctx, path, fmt.Sprintf("version %d\n", n)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(s, paths[i])
+	}
+	wg.Wait()
+
+	for _, path := range paths {
+		for i, s := range services {
+			versions, err := s.History(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != writes {
+				t.Errorf("service %d lists %d versions of %s, want %d", i, len(versions), filepath.Base(path), writes)
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"local/monorepo/internal/diff"
+)
+
+var (
+	ErrInvalidPatch  = errors.New("invalid patch")
+	ErrPatchRejected = errors.New("patch does not apply")
+)
+
+const (
+	PatchStatusCreated  = "created"
+	PatchStatusModified = "modified"
+	PatchStatusDeleted  = "deleted"
+)
+
+// PatchRequest changes files without sending their whole content. Diff is a
+// unified diff that may cover several files; Files carries per-file hunks or
+// range edits. Relative paths are resolved against Root.
+type PatchRequest struct {
+	Root    string
+	Diff    string
+	Files   []PatchFile
+	MaxFuzz int
+	DryRun  bool
+}
+
+type PatchFile struct {
+	Path  string
+	Diff  string
+	Edits []diff.Edit
+}
+
+type PatchedFile struct {
+	Path     string
+	Status   string
+	Content  string
+	Hunks    []diff.HunkResult
+	Rejected []diff.Hunk
+	Err      error
+}
+
+type PatchResult struct {
+	Applied bool
+	Files   []PatchedFile
+}
+
+type patchTarget struct {
+	path     string
+	existed  bool
+	original string
+	content  string
+	deleted  bool
+	result   PatchedFile
+}
+
+// Patch applies every hunk and edit in memory first. Nothing is written
+// unless all of them apply; the writes then go through Batch so a failure
+// part way leaves the files untouched.
+func (s *Service) Patch(ctx context.Context, req PatchRequest) (PatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return PatchResult{}, err
+	}
+	if strings.TrimSpace(req.Diff) == "" && len(req.Files) == 0 {
+		return PatchResult{}, fmt.Errorf("%w: nothing to apply", ErrInvalidPatch)
+	}
+
+	var order []*patchTarget
+	targets := map[string]*patchTarget{}
+	load := func(rawPath string) (*patchTarget, error) {
+		absPath, err := resolvePatchPath(req.Root, rawPath)
+		if err != nil {
+			return nil, err
+		}
+		if target, ok := targets[absPath]; ok {
+			return target, nil
+		}
+		target := &patchTarget{path: absPath}
+		current, err := s.ReadText(ctx, absPath)
+		switch {
+		case err == nil:
+			target.existed = true
+			target.original = current.Content
+			target.content = current.Content
+		case !errors.Is(err, ErrPathNotFound):
+			return nil, err
+		}
+		target.result.Path = absPath
+		targets[absPath] = target
+		order = append(order, target)
+		return target, nil
+	}
+	applyHunks := func(target *patchTarget, hunks []diff.Hunk) {
+		content, results := diff.ApplyFuzzy(target.content, hunks, req.MaxFuzz)
+		target.content = content
+		target.deleted = false
+		target.result.Hunks = append(target.result.Hunks, results...)
+		for i, result := range results {
+			if !result.Applied {
+				target.result.Rejected = append(target.result.Rejected, hunks[i])
+			}
+		}
+	}
+
+	if strings.TrimSpace(req.Diff) != "" {
+		patches, err := diff.Parse(req.Diff)
+		if err != nil {
+			return PatchResult{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		for _, patch := range patches {
+			oldName, newName := stripGitPrefixes(patch.OldName, patch.NewName)
+			switch {
+			case oldName == diff.DevNull && newName == diff.DevNull:
+				return PatchResult{}, fmt.Errorf("%w: file section without a name", ErrInvalidPatch)
+			case newName == diff.DevNull:
+				target, err := load(oldName)
+				if err != nil {
+					return PatchResult{}, err
+				}
+				applyHunks(target, patch.Hunks)
+				if target.content != "" && len(target.result.Rejected) == 0 {
+					target.result.Err = fmt.Errorf("%w: file is not empty after removing its lines", ErrPatchRejected)
+				}
+				target.deleted = true
+			case oldName == diff.DevNull || oldName == newName:
+				target, err := load(newName)
+				if err != nil {
+					return PatchResult{}, err
+				}
+				applyHunks(target, patch.Hunks)
+			default:
+				// a rename: patch the old content into the new path
+				source, err := load(oldName)
+				if err != nil {
+					return PatchResult{}, err
+				}
+				target, err := load(newName)
+				if err != nil {
+					return PatchResult{}, err
+				}
+				if target.existed && !target.deleted {
+					target.result.Err = ErrFileAlreadyExists
+				}
+				target.content = source.content
+				applyHunks(target, patch.Hunks)
+				source.deleted = true
+			}
+		}
+	}
+
+	for _, file := range req.Files {
+		target, err := load(file.Path)
+		if err != nil {
+			return PatchResult{}, err
+		}
+		if strings.TrimSpace(file.Diff) != "" {
+			hunks, err := diff.ParseHunks(file.Diff)
+			if err != nil {
+				return PatchResult{}, fmt.Errorf("%w: %s: %v", ErrInvalidPatch, target.path, err)
+			}
+			applyHunks(target, hunks)
+		}
+		if len(file.Edits) > 0 {
+			content, err := diff.ApplyEdits(target.content, file.Edits)
+			switch {
+			case errors.Is(err, diff.ErrEditMismatch):
+				target.result.Err = fmt.Errorf("%w: %v", ErrPatchRejected, err)
+			case err != nil:
+				return PatchResult{}, fmt.Errorf("%w: %s: %v", ErrInvalidPatch, target.path, err)
+			default:
+				target.content = content
+				target.deleted = false
+			}
+		}
+	}
+
+	result := PatchResult{Applied: true, Files: make([]PatchedFile, 0, len(order))}
+	ops := make([]BatchOp, 0, len(order))
+	for _, target := range order {
+		file := target.result
+		switch {
+		case target.deleted:
+			file.Status = PatchStatusDeleted
+			if target.existed {
+				ops = append(ops, BatchOp{Op: BatchOpDelete, Path: target.path})
+			}
+		case !target.existed:
+			file.Status = PatchStatusCreated
+			file.Content = target.content
+			ops = append(ops, BatchOp{Op: BatchOpWrite, Path: target.path, Content: target.content})
+		default:
+			file.Status = PatchStatusModified
+			file.Content = target.content
+			if target.content != target.original {
+				ops = append(ops, BatchOp{Op: BatchOpWrite, Path: target.path, Content: target.content})
+			}
+		}
+		if len(file.Rejected) > 0 && file.Err == nil {
+			file.Err = fmt.Errorf("%w: %d of %d hunks rejected", ErrPatchRejected, len(file.Rejected), len(file.Hunks))
+		}
+		if file.Err != nil {
+			result.Applied = false
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if !result.Applied {
+		return result, ErrPatchRejected
+	}
+	if req.DryRun || len(ops) == 0 {
+		return result, nil
+	}
+	if _, err := s.Batch(ctx, ops); err != nil {
+		result.Applied = false
+		return result, err
+	}
+	return result, nil
+}
+
+func resolvePatchPath(root, rawPath string) (string, error) {
+	if strings.TrimSpace(rawPath) == "" {
+		return "", ErrPathRequired
+	}
+	if !filepath.IsAbs(rawPath) {
+		if strings.TrimSpace(root) == "" {
+			return "", fmt.Errorf("%w: relative path %q needs a root", ErrInvalidPatch, rawPath)
+		}
+		rawPath = filepath.Join(root, rawPath)
+	}
+	return resolveAbsolutePath(rawPath)
+}
+
+// stripGitPrefixes removes the a/ and b/ prefixes git puts on diff names.
+func stripGitPrefixes(oldName, newName string) (string, string) {
+	oldOK := oldName == diff.DevNull || strings.HasPrefix(oldName, "a/")
+	newOK := newName == diff.DevNull || strings.HasPrefix(newName, "b/")
+	if !oldOK || !newOK || (oldName == diff.DevNull && newName == diff.DevNull) {
+		return oldName, newName
+	}
+	if oldName != diff.DevNull {
+		oldName = oldName[2:]
+	}
+	if newName != diff.DevNull {
+		newName = newName[2:]
+	}
+	return oldName, newName
+}
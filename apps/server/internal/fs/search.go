@@ -0,0 +1,221 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrSearchQueryRequired = errors.New("search query is required")
+	ErrInvalidSearchQuery  = errors.New("invalid search query")
+)
+
+const (
+	defaultMaxSearchResults = 200
+	maxSearchResultsLimit   = 2_000
+	maxSearchFiles          = 20_000
+	// maxSearchLineBytes bounds the line text returned per match; longer
+	// lines are cut around the match.
+	maxSearchLineBytes = 240
+)
+
+var errSearchLimit = errors.New("search limit reached")
+
+// searchSkippedDirs hold dependencies and build output, which searches
+// never descend into.
+var searchSkippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	".next":        true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// SearchOptions controls Search. Query is a literal unless Regex is set;
+// Include, when set, is a file name glob such as "*.go".
+type SearchOptions struct {
+	Query         string
+	Regex         bool
+	CaseSensitive bool
+	Include       string
+	MaxResults    int
+}
+
+// SearchMatch is one matching line. Line and Column are 1-based; Column
+// counts runes of the full line, while Text may be cut around the match.
+type SearchMatch struct {
+	Path   string
+	Line   int
+	Column int
+	Text   string
+}
+
+type SearchResult struct {
+	Matches       []SearchMatch
+	FilesSearched int
+	// Truncated is set when MaxResults or the file limit stopped the search.
+	Truncated bool
+}
+
+// Search finds lines matching opts.Query in the text files under rawPath,
+// or in rawPath itself when it is a file. Binary files, files larger than
+// the read limit and dependency directories are skipped.
+func (s *Service) Search(ctx context.Context, rawPath string, opts SearchOptions) (SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return SearchResult{}, err
+	}
+	if opts.Query == "" {
+		return SearchResult{}, ErrSearchQueryRequired
+	}
+	absPath, err := resolveAbsolutePath(rawPath)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("%w: %v", ErrInvalidSearchQuery, err)
+	}
+	if opts.Include != "" {
+		if _, err := filepath.Match(opts.Include, ""); err != nil {
+			return SearchResult{}, fmt.Errorf("%w: bad include pattern %q", ErrInvalidSearchQuery, opts.Include)
+		}
+	}
+	limit := opts.MaxResults
+	if limit <= 0 {
+		limit = defaultMaxSearchResults
+	}
+	if limit > maxSearchResultsLimit {
+		limit = maxSearchResultsLimit
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return SearchResult{}, ErrPathNotFound
+		}
+		return SearchResult{}, err
+	}
+
+	result := SearchResult{Matches: []SearchMatch{}}
+	searchFile := func(path string, size int64) error {
+		if size > s.cfg.MaxReadFileBytes {
+			return nil
+		}
+		if result.FilesSearched >= maxSearchFiles {
+			result.Truncated = true
+			return errSearchLimit
+		}
+		result.FilesSearched++
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		decoded, err := s.DecodeText(path, content)
+		if err != nil {
+			return nil
+		}
+		for number, line := range strings.Split(decoded.Content, "\n") {
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if len(result.Matches) >= limit {
+				result.Truncated = true
+				return errSearchLimit
+			}
+			line = strings.TrimRight(line, "\r")
+			result.Matches = append(result.Matches, SearchMatch{
+				Path:   path,
+				Line:   number + 1,
+				Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+				Text:   searchExcerpt(line, loc[0]),
+			})
+		}
+		return nil
+	}
+
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return SearchResult{}, ErrUnsupportedFileType
+		}
+		_ = searchFile(absPath, info.Size())
+		return result, nil
+	}
+
+	err = filepath.WalkDir(absPath, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == absPath {
+				return walkErr
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != absPath && searchSkippedDirs[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if opts.Include != "" {
+			if ok, _ := filepath.Match(opts.Include, entry.Name()); !ok {
+				return nil
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		return searchFile(path, info.Size())
+	})
+	if err != nil && !errors.Is(err, errSearchLimit) {
+		return SearchResult{}, err
+	}
+	return result, nil
+}
+
+// searchExcerpt returns line, or the part of it around offset when the
+// line is too long to return whole.
+func searchExcerpt(line string, offset int) string {
+	if len(line) <= maxSearchLineBytes {
+		return line
+	}
+	start := offset - maxSearchLineBytes/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + maxSearchLineBytes
+	if end > len(line) {
+		end = len(line)
+		start = end - maxSearchLineBytes
+	}
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start++
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[start:end]
+}
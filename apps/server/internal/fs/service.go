@@ -1,7 +1,6 @@
 package fs
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -9,6 +8,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -42,6 +42,10 @@ type Config struct {
 	MaxWriteFileBytes    int64
 	MaxListEntries       int
 	MaxWorkspaceOpenPath int
+	// HistoryDir stores local history snapshots; empty disables history.
+	HistoryDir      string
+	MaxHistoryBytes int64
+	MaxHistoryAge   time.Duration
 }
 
 func DefaultConfig() Config {
@@ -50,11 +54,23 @@ func DefaultConfig() Config {
 		MaxWriteFileBytes:    defaultMaxWriteFileBytes,
 		MaxListEntries:       defaultMaxListEntries,
 		MaxWorkspaceOpenPath: defaultMaxWorkspaceOpenPath,
+		MaxHistoryBytes:      defaultMaxHistoryBytes,
+		MaxHistoryAge:        defaultMaxHistoryAge,
 	}
 }
 
 type Service struct {
 	cfg Config
+
+	mu    sync.RWMutex
+	roots map[string]WorkspaceRoot
+
+	history *history
+	// batchMu keeps batches from interleaving with each other.
+	batchMu sync.Mutex
+
+	changeMu sync.RWMutex
+	onChange []ChangeHandler
 }
 
 func NewService(cfg Config) *Service {
@@ -71,7 +87,11 @@ func NewService(cfg Config) *Service {
 		cfg.MaxWorkspaceOpenPath = defaultMaxWorkspaceOpenPath
 	}
 
-	return &Service{cfg: cfg}
+	s := &Service{cfg: cfg, roots: map[string]WorkspaceRoot{}}
+	if cfg.HistoryDir != "" {
+		s.history = newHistory(cfg.HistoryDir, cfg.MaxHistoryBytes, cfg.MaxHistoryAge)
+	}
+	return s
 }
 
 type StatResult struct {
@@ -90,9 +110,11 @@ type ListEntry struct {
 }
 
 type ReadResult struct {
-	Path    string
+	Path string
+	// Size is the size on disk; Content is decoded to UTF-8.
 	Size    int64
 	Content string
+	Format  TextFormat
 }
 
 func (s *Service) Stat(ctx context.Context, rawPath string) (StatResult, error) {
@@ -218,21 +240,41 @@ func (s *Service) ReadText(ctx context.Context, rawPath string) (ReadResult, err
 	if err != nil {
 		return ReadResult{}, err
 	}
+	return s.DecodeText(absPath, content)
+}
+
+// DecodeText applies the ReadText size, binary and encoding rules to content
+// that did not come from disk, such as a file at a git revision.
+func (s *Service) DecodeText(path string, content []byte) (ReadResult, error) {
 	if int64(len(content)) > s.cfg.MaxReadFileBytes {
 		return ReadResult{}, ErrFileTooLarge
 	}
-	if bytes.IndexByte(content, 0x00) >= 0 {
-		return ReadResult{}, ErrBinaryFile
+	text, encoding, err := decodeBytes(content)
+	if err != nil {
+		return ReadResult{}, err
 	}
 
 	return ReadResult{
-		Path:    absPath,
+		Path:    path,
 		Size:    int64(len(content)),
-		Content: string(content),
+		Content: text,
+		Format:  detectTextFormat(text, encoding),
 	}, nil
 }
 
+// MaxReadFileBytes reports the largest file ReadText and DecodeText accept.
+func (s *Service) MaxReadFileBytes() int64 {
+	return s.cfg.MaxReadFileBytes
+}
+
+// WriteText replaces a file with content, keeping the encoding of the file
+// it replaces. Line endings are written as given.
 func (s *Service) WriteText(ctx context.Context, rawPath, content string) (StatResult, error) {
+	return s.WriteTextWith(ctx, rawPath, content, WriteOptions{})
+}
+
+// WriteTextWith is WriteText with explicit format conversions.
+func (s *Service) WriteTextWith(ctx context.Context, rawPath, content string, opts WriteOptions) (StatResult, error) {
 	if err := ctx.Err(); err != nil {
 		return StatResult{}, err
 	}
@@ -244,6 +286,20 @@ func (s *Service) WriteText(ctx context.Context, rawPath, content string) (StatR
 	if err != nil {
 		return StatResult{}, err
 	}
+	data, err := s.encodeForWrite(absPath, content, opts)
+	if err != nil {
+		return StatResult{}, err
+	}
+	return s.writeBytes(ctx, absPath, data, HistoryReasonWrite)
+}
+
+func (s *Service) writeBytes(ctx context.Context, absPath string, content []byte, reason string) (StatResult, error) {
+	if err := ctx.Err(); err != nil {
+		return StatResult{}, err
+	}
+	if int64(len(content)) > s.cfg.MaxWriteFileBytes {
+		return StatResult{}, ErrContentTooLarge
+	}
 	if isFilesystemRoot(absPath) {
 		return StatResult{}, ErrRefuseFilesystemRoot
 	}
@@ -258,6 +314,7 @@ func (s *Service) WriteText(ctx context.Context, rawPath, content string) (StatR
 		if !existing.Mode().IsRegular() {
 			return StatResult{}, ErrUnsupportedFileType
 		}
+		s.snapshotFile(absPath, reason)
 	} else if !errors.Is(statErr, os.ErrNotExist) {
 		return StatResult{}, statErr
 	}
@@ -265,10 +322,12 @@ func (s *Service) WriteText(ctx context.Context, rawPath, content string) (StatR
 	if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
 		return StatResult{}, err
 	}
-	if err := writeFileAtomic(absPath, []byte(content), 0o644); err != nil {
+	if err := writeFileAtomic(absPath, content, 0o644); err != nil {
 		return StatResult{}, err
 	}
 
+	s.notifyChange(absPath)
+
 	info, err := os.Stat(absPath)
 	if err != nil {
 		return StatResult{}, err
@@ -306,6 +365,7 @@ func (s *Service) Create(ctx context.Context, rawPath string, isDir bool) (StatR
 		}
 		_ = f.Close()
 	}
+	s.notifyChange(absPath)
 
 	info, err := os.Stat(absPath)
 	if err != nil {
@@ -336,13 +396,27 @@ func (s *Service) Delete(ctx context.Context, rawPath string, recursive bool) er
 	}
 
 	if recursive {
-		return os.RemoveAll(absPath)
+		if info.IsDir() {
+			s.snapshotTree(ctx, absPath)
+		} else {
+			s.snapshotFile(absPath, HistoryReasonDelete)
+		}
+		if err := os.RemoveAll(absPath); err != nil {
+			return err
+		}
+		s.notifyChange(absPath)
+		return nil
 	}
 
 	if info.IsDir() {
 		return ErrDirectoryNeedsRecursive
 	}
-	return os.Remove(absPath)
+	s.snapshotFile(absPath, HistoryReasonDelete)
+	if err := os.Remove(absPath); err != nil {
+		return err
+	}
+	s.notifyChange(absPath)
+	return nil
 }
 
 func (s *Service) WorkspaceOpen(ctx context.Context, paths []string) ([]StatResult, error) {
@@ -373,6 +447,9 @@ func (s *Service) WorkspaceOpen(ctx context.Context, paths []string) ([]StatResu
 			out = append(out, StatResult{Path: absPath, Exists: false})
 			continue
 		}
+		if info.IsDir() {
+			s.RegisterWorkspaceRoot(absPath, WorkspaceRootFolder)
+		}
 		out = append(out, statFromFileInfo(absPath, info))
 	}
 
@@ -0,0 +1,203 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	WorkspaceRootFolder   = "folder"
+	WorkspaceRootWorktree = "worktree"
+)
+
+// WorkspaceRoot is a directory the server treats as an open workspace.
+type WorkspaceRoot struct {
+	Path     string
+	Name     string
+	Kind     string
+	OpenedAt time.Time
+}
+
+// RegisterWorkspaceRoot records dir as a workspace root. Registering an
+// existing root only updates its kind.
+func (s *Service) RegisterWorkspaceRoot(dir, kind string) WorkspaceRoot {
+	dir = filepath.Clean(dir)
+	if kind == "" {
+		kind = WorkspaceRootFolder
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root, ok := s.roots[dir]
+	if !ok {
+		root = WorkspaceRoot{Path: dir, Name: filepath.Base(dir), OpenedAt: time.Now().UTC()}
+	}
+	root.Kind = kind
+	s.roots[dir] = root
+	return root
+}
+
+func (s *Service) UnregisterWorkspaceRoot(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.roots, filepath.Clean(dir))
+}
+
+// WorkspaceRoots lists registered roots in the order they were opened.
+func (s *Service) WorkspaceRoots() []WorkspaceRoot {
+	s.mu.RLock()
+	out := make([]WorkspaceRoot, 0, len(s.roots))
+	for _, root := range s.roots {
+		out = append(out, root)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].OpenedAt.Equal(out[j].OpenedAt) {
+			return out[i].OpenedAt.Before(out[j].OpenedAt)
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// WorkspaceRootFor returns the most specific registered root containing path.
+func (s *Service) WorkspaceRootFor(path string) (WorkspaceRoot, bool) {
+	path = filepath.Clean(path)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var best WorkspaceRoot
+	found := false
+	for dir, root := range s.roots {
+		if !isWithin(dir, path) {
+			continue
+		}
+		if !found || len(dir) > len(best.Path) {
+			best, found = root, true
+		}
+	}
+	return best, found
+}
+
+// maxSymlinkHops bounds how many symlinks ResolveSymlinks follows, as the
+// kernel does, so a cycle of dangling links cannot loop forever.
+const maxSymlinkHops = 40
+
+var (
+	ErrSymlinkLoop      = errors.New("too many levels of symbolic links")
+	ErrRootRequired     = errors.New("workspace root is required")
+	ErrRootNotFound     = errors.New("workspace root does not exist")
+	ErrOutsideWorkspace = errors.New("path is outside the workspace")
+)
+
+// ResolveRoot returns the absolute form of a workspace root given by a
+// client, which must be an existing directory.
+func ResolveRoot(rawRoot string) (string, error) {
+	if strings.TrimSpace(rawRoot) == "" {
+		return "", ErrRootRequired
+	}
+	root, err := filepath.Abs(filepath.Clean(rawRoot))
+	if err != nil {
+		return "", ErrRootNotFound
+	}
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		return "", ErrRootNotFound
+	}
+	return root, nil
+}
+
+// WithinRoot reports whether path still lies in root once symlinks in both
+// are resolved. Lexical checks alone let a link inside root reach any
+// directory; a path that does not exist yet is judged by its deepest
+// existing ancestor.
+func WithinRoot(root, path string) (bool, error) {
+	realRoot, err := ResolveSymlinks(root)
+	if err != nil {
+		return false, err
+	}
+	realPath, err := ResolveSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	return isWithin(realRoot, realPath), nil
+}
+
+// ResolveInWorkspace maps a path given relative to workspace, or absolute,
+// onto it. Paths that leave workspace, lexically or through a symlink, are
+// rejected with ErrOutsideWorkspace.
+func ResolveInWorkspace(workspace, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrPathRequired
+	}
+	path := raw
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	path = filepath.Clean(path)
+	if !isWithin(workspace, path) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorkspace, raw)
+	}
+	if within, err := WithinRoot(workspace, path); err != nil || !within {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorkspace, raw)
+	}
+	return path, nil
+}
+
+// ResolveSymlinks returns where path really leads: symlinks are resolved
+// in its deepest existing ancestor and the missing rest is appended, so a
+// dangling link is followed to where a write through it would land.
+func ResolveSymlinks(path string) (string, error) {
+	return resolveSymlinks(filepath.Clean(path), 0)
+}
+
+func resolveSymlinks(path string, hops int) (string, error) {
+	if hops > maxSymlinkHops {
+		return "", ErrSymlinkLoop
+	}
+	existing := path
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			for i := len(rest) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, rest[i])
+			}
+			return resolved, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if target, linkErr := os.Readlink(existing); linkErr == nil {
+			// a dangling link: follow it by hand
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(existing), target)
+			}
+			for i := len(rest) - 1; i >= 0; i-- {
+				target = filepath.Join(target, rest[i])
+			}
+			return resolveSymlinks(filepath.Clean(target), hops+1)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+		rest = append(rest, filepath.Base(existing))
+		existing = parent
+	}
+}
+
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,60 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveInWorkspace(t *testing.T) {
+	workspace := filepath.Join(t.TempDir(), "ws")
+	outside := t.TempDir()
+	writeTree(t, workspace, map[string]string{"src/main.go": "package main"})
+	links := map[string]string{
+		"escape":      outside,
+		"dangling":    filepath.Join(outside, "missing"),
+		"inside":      filepath.Join(workspace, "src"),
+		"src/up":      "..",
+		"src/parent2": "../..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(workspace, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{raw: "src/main.go", want: "src/main.go"},
+		{raw: " src/new.go ", want: "src/new.go"},
+		{raw: ".", want: "."},
+		{raw: filepath.Join(workspace, "src"), want: "src"},
+		{raw: "src/../src/main.go", want: "src/main.go"},
+		{raw: "inside/main.go", want: "inside/main.go"},
+		{raw: "src/up/src", want: "src/up/src"},
+		{raw: "", wantErr: ErrPathRequired},
+		{raw: "..", wantErr: ErrOutsideWorkspace},
+		{raw: "../ws-other/x", wantErr: ErrOutsideWorkspace},
+		{raw: outside, wantErr: ErrOutsideWorkspace},
+		{raw: "escape/secret", wantErr: ErrOutsideWorkspace},
+		{raw: "dangling", wantErr: ErrOutsideWorkspace},
+		{raw: "src/parent2/x", wantErr: ErrOutsideWorkspace},
+	}
+	for _, tt := range tests {
+		got, err := ResolveInWorkspace(workspace, tt.raw)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ResolveInWorkspace(%q) = %q, %v, want %v", tt.raw, got, err, tt.wantErr)
+			}
+			continue
+		}
+		want := filepath.Join(workspace, filepath.FromSlash(tt.want))
+		if err != nil || got != want {
+			t.Errorf("ResolveInWorkspace(%q) = %q, %v, want %q", tt.raw, got, err, want)
+		}
+	}
+}
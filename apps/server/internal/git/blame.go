@@ -0,0 +1,238 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxBlameCacheEntries = 64
+
+type BlameLine struct {
+	Line        int       `json:"line"`
+	OrigLine    int       `json:"origLine"`
+	Commit      string    `json:"commit"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"authorEmail"`
+	Date        time.Time `json:"date"`
+	Summary     string    `json:"summary"`
+	OrigPath    string    `json:"origPath,omitempty"`
+	Uncommitted bool      `json:"uncommitted"`
+}
+
+type Blame struct {
+	Path     string      `json:"path"`
+	Revision string      `json:"revision,omitempty"`
+	Blob     string      `json:"blob"`
+	Lines    []BlameLine `json:"lines"`
+}
+
+type FileAtRevision struct {
+	Path     string `json:"path"`
+	Revision string `json:"revision"`
+	Blob     string `json:"blob"`
+	Size     int64  `json:"size"`
+	Content  []byte `json:"-"`
+}
+
+// blameCache keeps recent blame results. Keys combine the commit blame
+// starts from with the blob being blamed, so an edit or a new commit misses.
+type blameCache struct {
+	mu      sync.Mutex
+	order   []string
+	entries map[string]Blame
+}
+
+func (c *blameCache) get(key string) (Blame, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blame, ok := c.entries[key]
+	return blame, ok
+}
+
+func (c *blameCache) put(key string, blame Blame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]Blame{}
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = blame
+	for len(c.order) > maxBlameCacheEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Blame attributes each line of a file. With an empty revision the working
+// tree content is blamed and uncommitted lines are flagged.
+func (s *Service) Blame(ctx context.Context, path, revision string) (Blame, error) {
+	var out Blame
+	err := s.withRepo(ctx, path, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		revision = strings.TrimSpace(revision)
+		if err := validateRevision(revision); err != nil {
+			return err
+		}
+
+		var commit, blob string
+		if revision == "" {
+			if s.hasHead(ctx, repo) {
+				if commit, err = s.resolveCommit(ctx, repo, "HEAD"); err != nil {
+					return err
+				}
+			}
+			raw, err := s.run(ctx, repo, nil, "hash-object", "--", rel)
+			if err != nil {
+				return err
+			}
+			blob = strings.TrimSpace(raw)
+		} else {
+			if commit, err = s.resolveCommit(ctx, repo, revision); err != nil {
+				return err
+			}
+			raw, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", commit+":"+rel)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrPathNotTracked, rel)
+			}
+			blob = strings.TrimSpace(raw)
+		}
+
+		key := repo + "\x00" + rel + "\x00" + commit + "\x00" + blob
+		if cached, ok := s.blames.get(key); ok {
+			out = cached
+			return nil
+		}
+
+		args := []string{"blame", "--porcelain"}
+		if revision != "" {
+			args = append(args, commit)
+		}
+		args = append(args, "--", rel)
+		raw, err := s.run(ctx, repo, nil, args...)
+		if err != nil {
+			return err
+		}
+
+		out = Blame{Path: rel, Revision: revision, Blob: blob, Lines: parseBlame(raw)}
+		s.blames.put(key, out)
+		return nil
+	})
+	return out, err
+}
+
+// parseBlame reads `git blame --porcelain`, where commit details are only
+// printed the first time a commit appears.
+func parseBlame(raw string) []BlameLine {
+	out := []BlameLine{}
+	commits := map[string]*BlameLine{}
+	var current *BlameLine
+	var origLine, finalLine int
+
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if current != nil {
+				entry := *current
+				entry.OrigLine, entry.Line = origLine, finalLine
+				out = append(out, entry)
+				current = nil
+			}
+			continue
+		}
+
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				continue
+			}
+			info, ok := commits[fields[0]]
+			if !ok {
+				info = &BlameLine{Commit: fields[0], Uncommitted: strings.Trim(fields[0], "0") == ""}
+				commits[fields[0]] = info
+			}
+			current = info
+			origLine, _ = strconv.Atoi(fields[1])
+			finalLine, _ = strconv.Atoi(fields[2])
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.AuthorEmail = strings.Trim(value, "<>")
+		case "author-time":
+			current.Date = parseUnixTime(value)
+		case "summary":
+			current.Summary = value
+		case "filename":
+			current.OrigPath = value
+		}
+	}
+	return out
+}
+
+// Show returns a file's content at revision. Objects larger than maxBytes
+// are refused before they are read.
+func (s *Service) Show(ctx context.Context, path, revision string, maxBytes int64) (FileAtRevision, error) {
+	var out FileAtRevision
+	err := s.withRepo(ctx, path, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		revision = strings.TrimSpace(revision)
+		if revision == "" {
+			revision = "HEAD"
+		}
+		if err := validateRevision(revision); err != nil {
+			return err
+		}
+
+		out, err = s.showObject(ctx, repo, revision+":"+rel, maxBytes)
+		out.Path, out.Revision = rel, revision
+		return err
+	})
+	return out, err
+}
+
+// showObject reads a blob by object spec, e.g. "HEAD:path" or ":2:path".
+func (s *Service) showObject(ctx context.Context, repo, spec string, maxBytes int64) (FileAtRevision, error) {
+	blob, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", spec)
+	if err != nil {
+		return FileAtRevision{}, fmt.Errorf("%w: %s", ErrPathNotTracked, spec)
+	}
+	blob = strings.TrimSpace(blob)
+
+	rawSize, err := s.run(ctx, repo, nil, "cat-file", "-s", blob)
+	if err != nil {
+		return FileAtRevision{}, err
+	}
+	size, _ := strconv.ParseInt(strings.TrimSpace(rawSize), 10, 64)
+	if maxBytes > 0 && size > maxBytes {
+		return FileAtRevision{}, ErrObjectTooLarge
+	}
+
+	content, err := s.run(ctx, repo, nil, "cat-file", "blob", blob)
+	if err != nil {
+		return FileAtRevision{}, err
+	}
+	return FileAtRevision{Blob: blob, Size: size, Content: []byte(content)}, nil
+}
+
+func (s *Service) resolveCommit(ctx context.Context, repo, revision string) (string, error) {
+	out, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRevisionNotFound, revision)
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,149 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Branch struct {
+	Name     string    `json:"name"`
+	Ref      string    `json:"ref"`
+	Remote   bool      `json:"remote"`
+	Current  bool      `json:"current"`
+	Commit   string    `json:"commit"`
+	Upstream string    `json:"upstream,omitempty"`
+	Date     time.Time `json:"date"`
+	Subject  string    `json:"subject"`
+}
+
+type BranchList struct {
+	Current  string   `json:"current,omitempty"`
+	Detached bool     `json:"detached"`
+	Branches []Branch `json:"branches"`
+}
+
+type CreateBranchOptions struct {
+	Name       string
+	StartPoint string
+	Checkout   bool
+}
+
+type SwitchOptions struct {
+	Branch string
+	// Detach checks out Branch (any revision) without a branch.
+	Detach bool
+}
+
+const branchFormat = "%(refname)%00%(refname:short)%00%(objectname)%00%(upstream:short)%00%(HEAD)%00%(committerdate:unix)%00%(contents:subject)"
+
+func (s *Service) Branches(ctx context.Context, root string) (BranchList, error) {
+	out := BranchList{Branches: []Branch{}}
+	err := s.withRepo(ctx, root, func(repo string) error {
+		raw, err := s.run(ctx, repo, nil, "for-each-ref", "--format="+branchFormat, "refs/heads", "refs/remotes")
+		if err != nil {
+			return err
+		}
+
+		for _, line := range splitNonEmpty(raw, "\n") {
+			fields := strings.Split(line, "\x00")
+			if len(fields) != 7 || strings.HasSuffix(fields[0], "/HEAD") {
+				continue
+			}
+			branch := Branch{
+				Ref:      fields[0],
+				Name:     fields[1],
+				Remote:   strings.HasPrefix(fields[0], "refs/remotes/"),
+				Commit:   fields[2],
+				Upstream: fields[3],
+				Current:  fields[4] == "*",
+				Date:     parseUnixTime(fields[5]),
+				Subject:  fields[6],
+			}
+			if branch.Current {
+				out.Current = branch.Name
+			}
+			out.Branches = append(out.Branches, branch)
+		}
+
+		out.Detached = s.hasHead(ctx, repo) && s.isDetached(ctx, repo)
+		return nil
+	})
+	return out, err
+}
+
+func (s *Service) CreateBranch(ctx context.Context, root string, opts CreateBranchOptions) (Branch, error) {
+	var created Branch
+	err := s.withRepo(ctx, root, func(repo string) error {
+		if err := s.validateRefName(ctx, repo, opts.Name); err != nil {
+			return err
+		}
+		if err := validateRevision(opts.StartPoint); err != nil {
+			return err
+		}
+		if _, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+opts.Name); err == nil {
+			return fmt.Errorf("%w: %s", ErrBranchExists, opts.Name)
+		}
+
+		args := []string{"branch", opts.Name}
+		if opts.Checkout {
+			args = []string{"switch", "--create", opts.Name}
+		}
+		if start := strings.TrimSpace(opts.StartPoint); start != "" {
+			args = append(args, start)
+		}
+		if _, err := s.run(ctx, repo, nil, args...); err != nil {
+			return err
+		}
+
+		commit, err := s.run(ctx, repo, nil, "rev-parse", "refs/heads/"+opts.Name)
+		if err != nil {
+			return err
+		}
+		created = Branch{
+			Name:    opts.Name,
+			Ref:     "refs/heads/" + opts.Name,
+			Commit:  strings.TrimSpace(commit),
+			Current: opts.Checkout,
+		}
+		return nil
+	})
+	return created, err
+}
+
+// Switch checks out a branch. Local changes that would be overwritten and
+// unresolved conflicts are reported as ErrDirtyTree and ErrConflict.
+func (s *Service) Switch(ctx context.Context, root string, opts SwitchOptions) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, root, func(repo string) error {
+		target := strings.TrimSpace(opts.Branch)
+		if target == "" {
+			return fmt.Errorf("%w: branch is required", ErrInvalidArgument)
+		}
+		if err := validateRevision(target); err != nil {
+			return err
+		}
+
+		current, err := s.status(ctx, repo)
+		if err != nil {
+			return err
+		}
+		if current.hasConflicts() {
+			return ErrConflict
+		}
+
+		args := []string{"switch"}
+		if opts.Detach {
+			args = append(args, "--detach")
+		}
+		args = append(args, target)
+		if _, err := s.run(ctx, repo, nil, args...); err != nil {
+			return err
+		}
+
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,307 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLogLimit = 50
+	maxLogLimit     = 500
+)
+
+const (
+	StashPush  = "push"
+	StashPop   = "pop"
+	StashApply = "apply"
+	StashDrop  = "drop"
+	StashList  = "list"
+)
+
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type Commit struct {
+	Hash        string    `json:"hash"`
+	Parents     []string  `json:"parents"`
+	AuthorName  string    `json:"authorName"`
+	AuthorEmail string    `json:"authorEmail"`
+	Date        time.Time `json:"date"`
+	Subject     string    `json:"subject"`
+	// Path is the file's name at this commit when the log follows a path.
+	Path string `json:"path,omitempty"`
+}
+
+type CommitOptions struct {
+	Message    string
+	Author     *Author
+	Amend      bool
+	AllowEmpty bool
+	// AllowDetached permits committing on a detached HEAD.
+	AllowDetached bool
+	// NoVerify skips the pre-commit and commit-msg hooks.
+	NoVerify bool
+}
+
+type LogOptions struct {
+	Revision string
+	// Path limits history to one file and follows it across renames.
+	Path  string
+	Skip  int
+	Limit int
+}
+
+type LogPage struct {
+	Commits []Commit `json:"commits"`
+	Skip    int      `json:"skip"`
+	Limit   int      `json:"limit"`
+	HasMore bool     `json:"hasMore"`
+}
+
+type Stash struct {
+	Index   int       `json:"index"`
+	Ref     string    `json:"ref"`
+	Hash    string    `json:"hash"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+type StashOptions struct {
+	Action           string
+	Message          string
+	IncludeUntracked bool
+	Index            int
+}
+
+// commitFormat separates fields with NUL and starts records with RS so
+// subjects cannot break parsing; --name-only output lands in the last field.
+const commitFormat = "--format=%x1e%H%x00%P%x00%an%x00%ae%x00%at%x00%s%x00"
+
+func (s *Service) Commit(ctx context.Context, root string, opts CommitOptions) (Commit, error) {
+	var out Commit
+	err := s.withRepo(ctx, root, func(repo string) error {
+		message := strings.TrimSpace(opts.Message)
+		if message == "" && !opts.Amend {
+			return fmt.Errorf("%w: commit message is required", ErrInvalidArgument)
+		}
+
+		status, err := s.status(ctx, repo)
+		if err != nil {
+			return err
+		}
+		if status.hasConflicts() {
+			return ErrConflict
+		}
+		if status.Detached && !opts.AllowDetached {
+			return ErrDetachedHead
+		}
+
+		args := []string{"commit", "--no-edit"}
+		if opts.NoVerify {
+			args = append(args, "--no-verify")
+		}
+		if message != "" {
+			args = append(args, "--message", message)
+		}
+		if opts.Author != nil {
+			name := strings.TrimSpace(opts.Author.Name)
+			email := strings.TrimSpace(opts.Author.Email)
+			if name == "" || email == "" || strings.ContainsAny(name+email, "<>\n") {
+				return fmt.Errorf("%w: author requires a name and email", ErrInvalidArgument)
+			}
+			args = append(args, "--author", fmt.Sprintf("%s <%s>", name, email))
+		}
+		if opts.Amend {
+			args = append(args, "--amend")
+		}
+		if opts.AllowEmpty {
+			args = append(args, "--allow-empty")
+		}
+		if _, err := s.run(ctx, repo, nil, args...); err != nil {
+			return err
+		}
+
+		commits, err := s.log(ctx, repo, "HEAD", "", 0, 1)
+		if err != nil {
+			return err
+		}
+		if len(commits) > 0 {
+			out = commits[0]
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Log pages through history. HasMore reports whether another page exists.
+func (s *Service) Log(ctx context.Context, root string, opts LogOptions) (LogPage, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultLogLimit
+	}
+	if limit > maxLogLimit {
+		limit = maxLogLimit
+	}
+	skip := opts.Skip
+	if skip < 0 {
+		skip = 0
+	}
+
+	page := LogPage{Commits: []Commit{}, Skip: skip, Limit: limit}
+	err := s.withRepo(ctx, root, func(repo string) error {
+		revision := strings.TrimSpace(opts.Revision)
+		if err := validateRevision(revision); err != nil {
+			return err
+		}
+		if revision == "" {
+			if !s.hasHead(ctx, repo) {
+				return nil
+			}
+			revision = "HEAD"
+		}
+		rel := ""
+		if strings.TrimSpace(opts.Path) != "" {
+			var err error
+			if rel, err = relativePath(repo, opts.Path); err != nil {
+				return err
+			}
+		}
+
+		commits, err := s.log(ctx, repo, revision, rel, skip, limit+1)
+		if err != nil {
+			return err
+		}
+		if len(commits) > limit {
+			page.HasMore = true
+			commits = commits[:limit]
+		}
+		page.Commits = commits
+		return nil
+	})
+	return page, err
+}
+
+// log lists commits reachable from revision. A non-empty rel restricts the
+// log to that file, following renames.
+func (s *Service) log(ctx context.Context, repo, revision, rel string, skip, limit int) ([]Commit, error) {
+	args := []string{"log", commitFormat, "--skip=" + strconv.Itoa(skip), "--max-count=" + strconv.Itoa(limit)}
+	if rel != "" {
+		args = append(args, "--follow", "--name-only")
+	}
+	args = append(args, revision, "--")
+	if rel != "" {
+		args = append(args, rel)
+	}
+	raw, err := s.run(ctx, repo, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommits(raw), nil
+}
+
+func parseCommits(raw string) []Commit {
+	out := []Commit{}
+	for _, record := range splitNonEmpty(raw, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x00")
+		if len(fields) < 6 {
+			continue
+		}
+		commit := Commit{
+			Hash:        fields[0],
+			Parents:     strings.Fields(fields[1]),
+			AuthorName:  fields[2],
+			AuthorEmail: fields[3],
+			Date:        parseUnixTime(fields[4]),
+			Subject:     fields[5],
+		}
+		if len(fields) > 6 {
+			commit.Path = strings.TrimSpace(fields[6])
+		}
+		out = append(out, commit)
+	}
+	return out
+}
+
+// Stash runs a stash action and returns the resulting stash list.
+func (s *Service) Stash(ctx context.Context, root string, opts StashOptions) ([]Stash, error) {
+	var out []Stash
+	err := s.withRepo(ctx, root, func(repo string) error {
+		ref := "stash@{" + strconv.Itoa(opts.Index) + "}"
+		if opts.Index < 0 {
+			return fmt.Errorf("%w: invalid stash index", ErrInvalidArgument)
+		}
+
+		var args []string
+		switch opts.Action {
+		case StashPush:
+			args = []string{"stash", "push"}
+			if opts.IncludeUntracked {
+				args = append(args, "--include-untracked")
+			}
+			if message := strings.TrimSpace(opts.Message); message != "" {
+				args = append(args, "--message", message)
+			}
+		case StashPop, StashApply, StashDrop:
+			args = []string{"stash", opts.Action, "--quiet", ref}
+		case StashList, "":
+		default:
+			return fmt.Errorf("%w: unknown stash action %q", ErrInvalidArgument, opts.Action)
+		}
+
+		if opts.Action == StashPush {
+			status, err := s.status(ctx, repo)
+			if err != nil {
+				return err
+			}
+			if status.Clean || (!opts.IncludeUntracked && !status.hasTrackedChanges()) {
+				return ErrNothingToCommit
+			}
+		}
+		if args != nil {
+			if _, err := s.run(ctx, repo, nil, args...); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		out, err = s.stashList(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+func (s *Service) stashList(ctx context.Context, repo string) ([]Stash, error) {
+	raw, err := s.run(ctx, repo, nil, "stash", "list", "--format=%gd%x00%H%x00%ct%x00%gs")
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Stash{}
+	for i, line := range splitNonEmpty(raw, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		out = append(out, Stash{
+			Index:   i,
+			Ref:     fields[0],
+			Hash:    fields[1],
+			Date:    parseUnixTime(fields[2]),
+			Message: fields[3],
+		})
+	}
+	return out, nil
+}
+
+func parseUnixTime(value string) time.Time {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
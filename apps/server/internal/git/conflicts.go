@@ -0,0 +1,423 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	SideOurs   = "ours"
+	SideTheirs = "theirs"
+	SideBase   = "base"
+	// SideBoth keeps ours followed by theirs.
+	SideBoth = "both"
+)
+
+const (
+	markerOurs   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSplit  = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+const maxConflictFileBytes = 5 * 1024 * 1024
+
+type ConflictFile struct {
+	Path string `json:"path"`
+	// Stages lists which index stages exist: 1 base, 2 ours, 3 theirs.
+	Stages []int  `json:"stages"`
+	Kind   string `json:"kind"`
+}
+
+type Conflicts struct {
+	Root      string         `json:"root"`
+	Operation string         `json:"operation,omitempty"`
+	Files     []ConflictFile `json:"files"`
+}
+
+type ConflictVersion struct {
+	Blob    string `json:"blob"`
+	Binary  bool   `json:"binary"`
+	Content string `json:"content"`
+}
+
+type ConflictRegion struct {
+	Index int `json:"index"`
+	// StartLine and EndLine are 1-based and include the marker lines.
+	StartLine   int    `json:"startLine"`
+	EndLine     int    `json:"endLine"`
+	OursLabel   string `json:"oursLabel"`
+	TheirsLabel string `json:"theirsLabel"`
+	Ours        string `json:"ours"`
+	Base        string `json:"base,omitempty"`
+	HasBase     bool   `json:"hasBase"`
+	Theirs      string `json:"theirs"`
+}
+
+type ConflictDetail struct {
+	Path    string           `json:"path"`
+	Kind    string           `json:"kind"`
+	Base    *ConflictVersion `json:"base"`
+	Ours    *ConflictVersion `json:"ours"`
+	Theirs  *ConflictVersion `json:"theirs"`
+	Working string           `json:"working"`
+	Regions []ConflictRegion `json:"regions"`
+}
+
+type HunkChoice struct {
+	Index int    `json:"index"`
+	Side  string `json:"side"`
+}
+
+type ConflictResolution struct {
+	// Content replaces the whole file when set.
+	Content *string
+	// Side takes one version of the whole file; a missing version deletes it.
+	Side string
+	// Hunks picks a side for every conflict region of the working file.
+	Hunks []HunkChoice
+}
+
+// WriteFunc writes resolved content to an absolute path. The handler passes
+// the filesystem service so resolutions use its atomic write path.
+type WriteFunc func(ctx context.Context, path, content string) error
+
+// Conflicts lists unmerged paths and the operation that produced them.
+func (s *Service) Conflicts(ctx context.Context, root string) (Conflicts, error) {
+	out := Conflicts{Files: []ConflictFile{}}
+	err := s.withRepo(ctx, root, func(repo string) error {
+		out.Root = repo
+		out.Operation = s.pendingOperation(ctx, repo)
+
+		stages, err := s.unmergedStages(ctx, repo, "")
+		if err != nil {
+			return err
+		}
+		for path, present := range stages {
+			out.Files = append(out.Files, ConflictFile{Path: path, Stages: present, Kind: conflictKind(present)})
+		}
+		sort.Slice(out.Files, func(i, j int) bool { return out.Files[i].Path < out.Files[j].Path })
+		return nil
+	})
+	return out, err
+}
+
+// Conflict returns the three index versions of a conflicted file together
+// with the conflict regions parsed from its working tree copy.
+func (s *Service) Conflict(ctx context.Context, path string) (ConflictDetail, error) {
+	var out ConflictDetail
+	err := s.withRepo(ctx, path, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		out, err = s.conflictDetail(ctx, repo, rel)
+		return err
+	})
+	return out, err
+}
+
+func (s *Service) conflictDetail(ctx context.Context, repo, rel string) (ConflictDetail, error) {
+	stages, err := s.unmergedStages(ctx, repo, rel)
+	if err != nil {
+		return ConflictDetail{}, err
+	}
+	present, ok := stages[rel]
+	if !ok {
+		return ConflictDetail{}, fmt.Errorf("%w: %s has no conflicts", ErrInvalidArgument, rel)
+	}
+
+	detail := ConflictDetail{Path: rel, Kind: conflictKind(present), Regions: []ConflictRegion{}}
+	for _, stage := range present {
+		version, err := s.conflictVersion(ctx, repo, stage, rel)
+		if err != nil {
+			return ConflictDetail{}, err
+		}
+		switch stage {
+		case 1:
+			detail.Base = version
+		case 2:
+			detail.Ours = version
+		case 3:
+			detail.Theirs = version
+		}
+	}
+
+	working, err := os.ReadFile(filepath.Join(repo, filepath.FromSlash(rel)))
+	if err != nil && !os.IsNotExist(err) {
+		return ConflictDetail{}, err
+	}
+	if len(working) <= maxConflictFileBytes && bytes.IndexByte(working, 0) < 0 {
+		detail.Working = string(working)
+		detail.Regions = parseConflictRegions(detail.Working)
+	}
+	return detail, nil
+}
+
+func (s *Service) conflictVersion(ctx context.Context, repo string, stage int, rel string) (*ConflictVersion, error) {
+	file, err := s.showObject(ctx, repo, fmt.Sprintf(":%d:%s", stage, rel), maxConflictFileBytes)
+	if errors.Is(err, ErrObjectTooLarge) {
+		return &ConflictVersion{Binary: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	version := &ConflictVersion{Blob: file.Blob}
+	if bytes.IndexByte(file.Content, 0) >= 0 {
+		version.Binary = true
+	} else {
+		version.Content = string(file.Content)
+	}
+	return version, nil
+}
+
+// ResolveConflict writes the resolved file through write and marks it
+// resolved in the index.
+func (s *Service) ResolveConflict(ctx context.Context, path string, resolution ConflictResolution, write WriteFunc) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, path, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		detail, err := s.conflictDetail(ctx, repo, rel)
+		if err != nil {
+			return err
+		}
+
+		content, remove, err := resolvedContent(detail, resolution)
+		if err != nil {
+			return err
+		}
+
+		absPath := filepath.Join(repo, filepath.FromSlash(rel))
+		if remove {
+			if _, err := s.run(ctx, repo, nil, "rm", "--quiet", "--force", "--ignore-unmatch", "--", rel); err != nil {
+				return err
+			}
+		} else {
+			if err := write(ctx, absPath, content); err != nil {
+				return err
+			}
+			if _, err := s.run(ctx, repo, nil, "add", "--", rel); err != nil {
+				return err
+			}
+		}
+
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+func resolvedContent(detail ConflictDetail, resolution ConflictResolution) (string, bool, error) {
+	switch {
+	case resolution.Content != nil:
+		return *resolution.Content, false, nil
+	case resolution.Side != "":
+		var version *ConflictVersion
+		switch resolution.Side {
+		case SideOurs:
+			version = detail.Ours
+		case SideTheirs:
+			version = detail.Theirs
+		case SideBase:
+			version = detail.Base
+		default:
+			return "", false, fmt.Errorf("%w: unknown side %q", ErrInvalidArgument, resolution.Side)
+		}
+		if version == nil {
+			return "", true, nil
+		}
+		if version.Binary {
+			return "", false, fmt.Errorf("%w: binary files must be resolved with git", ErrInvalidArgument)
+		}
+		return version.Content, false, nil
+	case len(resolution.Hunks) > 0:
+		content, err := applyConflictChoices(detail.Working, detail.Regions, resolution.Hunks)
+		return content, false, err
+	default:
+		return "", false, fmt.Errorf("%w: resolution requires content, a side or hunk choices", ErrInvalidArgument)
+	}
+}
+
+// parseConflictRegions finds merge markers in text, including the diff3
+// base section when present.
+func parseConflictRegions(text string) []ConflictRegion {
+	regions := []ConflictRegion{}
+	lines := strings.SplitAfter(text, "\n")
+
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+	state := outside
+	var region ConflictRegion
+	var ours, base, theirs strings.Builder
+
+	for i, line := range lines {
+		switch {
+		case state == outside && isMarker(line, markerOurs):
+			state = inOurs
+			region = ConflictRegion{StartLine: i + 1, OursLabel: markerLabel(line, markerOurs)}
+			ours.Reset()
+			base.Reset()
+			theirs.Reset()
+		case state == inOurs && isMarker(line, markerBase):
+			state = inBase
+			region.HasBase = true
+		case (state == inOurs || state == inBase) && isMarker(line, markerSplit):
+			state = inTheirs
+		case state == inTheirs && isMarker(line, markerTheirs):
+			region.EndLine = i + 1
+			region.TheirsLabel = markerLabel(line, markerTheirs)
+			region.Ours, region.Base, region.Theirs = ours.String(), base.String(), theirs.String()
+			region.Index = len(regions)
+			regions = append(regions, region)
+			state = outside
+		case state == inOurs:
+			ours.WriteString(line)
+		case state == inBase:
+			base.WriteString(line)
+		case state == inTheirs:
+			theirs.WriteString(line)
+		}
+	}
+	return regions
+}
+
+// applyConflictChoices replaces each region of text with the chosen side.
+// Every region must have a choice.
+func applyConflictChoices(text string, regions []ConflictRegion, choices []HunkChoice) (string, error) {
+	chosen := make(map[int]string, len(choices))
+	for _, choice := range choices {
+		if choice.Index < 0 || choice.Index >= len(regions) {
+			return "", fmt.Errorf("%w: %d", ErrHunkNotFound, choice.Index)
+		}
+		chosen[choice.Index] = choice.Side
+	}
+	if len(chosen) != len(regions) {
+		return "", fmt.Errorf("%w: %d of %d conflict regions have no choice", ErrInvalidArgument, len(regions)-len(chosen), len(regions))
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	var b strings.Builder
+	next := 0
+	for _, region := range regions {
+		for ; next < region.StartLine-1; next++ {
+			b.WriteString(lines[next])
+		}
+		switch chosen[region.Index] {
+		case SideOurs:
+			b.WriteString(region.Ours)
+		case SideTheirs:
+			b.WriteString(region.Theirs)
+		case SideBase:
+			if !region.HasBase {
+				return "", fmt.Errorf("%w: region %d has no base section", ErrInvalidArgument, region.Index)
+			}
+			b.WriteString(region.Base)
+		case SideBoth:
+			b.WriteString(region.Ours)
+			b.WriteString(region.Theirs)
+		default:
+			return "", fmt.Errorf("%w: unknown side %q", ErrInvalidArgument, chosen[region.Index])
+		}
+		next = region.EndLine
+	}
+	for ; next < len(lines); next++ {
+		b.WriteString(lines[next])
+	}
+	return b.String(), nil
+}
+
+func isMarker(line, marker string) bool {
+	if !strings.HasPrefix(line, marker) {
+		return false
+	}
+	rest := line[len(marker):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+func markerLabel(line, marker string) string {
+	return strings.TrimSpace(strings.TrimPrefix(line, marker))
+}
+
+// unmergedStages maps conflicted paths to their index stages. A non-empty
+// rel limits the lookup to that path.
+func (s *Service) unmergedStages(ctx context.Context, repo, rel string) (map[string][]int, error) {
+	args := []string{"ls-files", "--unmerged", "-z"}
+	if rel != "" {
+		args = append(args, "--", rel)
+	}
+	raw, err := s.run(ctx, repo, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]int{}
+	for _, record := range splitNonEmpty(raw, "\x00") {
+		meta, path, ok := strings.Cut(record, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || len(fields[2]) != 1 {
+			continue
+		}
+		out[path] = append(out[path], int(fields[2][0]-'0'))
+	}
+	return out, nil
+}
+
+// conflictKind names the conflict the way `git status` does.
+func conflictKind(stages []int) string {
+	has := map[int]bool{}
+	for _, stage := range stages {
+		has[stage] = true
+	}
+	switch {
+	case has[1] && has[2] && has[3]:
+		return "both modified"
+	case !has[1] && has[2] && has[3]:
+		return "both added"
+	case has[1] && has[2]:
+		return "deleted by them"
+	case has[1] && has[3]:
+		return "deleted by us"
+	case has[2]:
+		return "added by us"
+	case has[3]:
+		return "added by them"
+	default:
+		return "both deleted"
+	}
+}
+
+func (s *Service) pendingOperation(ctx context.Context, repo string) string {
+	operations := []struct{ file, name string }{
+		{"MERGE_HEAD", "merge"},
+		{"REBASE_HEAD", "rebase"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+	}
+	for _, op := range operations {
+		raw, err := s.run(ctx, repo, nil, "rev-parse", "--git-path", op.file)
+		if err != nil {
+			continue
+		}
+		path := strings.TrimSpace(raw)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(repo, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return op.name
+		}
+	}
+	return ""
+}
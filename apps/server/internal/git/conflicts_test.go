@@ -0,0 +1,206 @@
+package git
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const twoConflicts = "head\n" +
+	"<<<<<<< HEAD\n" +
+	"ours 1\n" +
+	"=======\n" +
+	"theirs 1\n" +
+	">>>>>>> feature\n" +
+	"middle\n" +
+	"<<<<<<< HEAD\n" +
+	"ours 2\n" +
+	"||||||| merged common ancestors\n" +
+	"base 2\n" +
+	"=======\n" +
+	">>>>>>> feature\n" +
+	"tail\n"
+
+func TestParseConflictRegions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []ConflictRegion
+	}{
+		{
+			name: "no markers",
+			text: "plain\ntext\n",
+			want: []ConflictRegion{},
+		},
+		{
+			name: "merge and diff3 regions",
+			text: twoConflicts,
+			want: []ConflictRegion{
+				{Index: 0, StartLine: 2, EndLine: 6, OursLabel: "HEAD", TheirsLabel: "feature", Ours: "ours 1\n", Theirs: "theirs 1\n"},
+				{Index: 1, StartLine: 8, EndLine: 13, OursLabel: "HEAD", TheirsLabel: "feature", Ours: "ours 2\n", Base: "base 2\n", HasBase: true},
+			},
+		},
+		{
+			name: "CRLF lines and no labels",
+			text: "<<<<<<<\r\na\r\n=======\r\nb\r\n>>>>>>>\r\n",
+			want: []ConflictRegion{
+				{Index: 0, StartLine: 1, EndLine: 5, Ours: "a\r\n", Theirs: "b\r\n"},
+			},
+		},
+		{
+			name: "last line without a newline",
+			text: "<<<<<<< ours\na\n=======\nb\n>>>>>>> theirs",
+			want: []ConflictRegion{
+				{Index: 0, StartLine: 1, EndLine: 5, OursLabel: "ours", TheirsLabel: "theirs", Ours: "a\n", Theirs: "b\n"},
+			},
+		},
+		{
+			name: "longer runs are not markers",
+			text: "<<<<<<<< x\n========\n>>>>>>>> y\n",
+			want: []ConflictRegion{},
+		},
+		{
+			name: "unterminated region",
+			text: "<<<<<<< HEAD\na\n=======\nb\n",
+			want: []ConflictRegion{},
+		},
+		{
+			name: "markers out of order",
+			text: "=======\n>>>>>>> x\n<<<<<<< HEAD\na\n>>>>>>> x\n=======\nb\n>>>>>>> y\n",
+			want: []ConflictRegion{
+				{Index: 0, StartLine: 3, EndLine: 8, OursLabel: "HEAD", TheirsLabel: "y", Ours: "a\n>>>>>>> x\n", Theirs: "b\n"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseConflictRegions(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConflictRegions() = %+v\nwant                       %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConflictChoices(t *testing.T) {
+	regions := parseConflictRegions(twoConflicts)
+	tests := []struct {
+		name    string
+		choices []HunkChoice
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "ours and base",
+			choices: []HunkChoice{{Index: 0, Side: SideOurs}, {Index: 1, Side: SideBase}},
+			want:    "head\nours 1\nmiddle\nbase 2\ntail\n",
+		},
+		{
+			name:    "theirs, in any order",
+			choices: []HunkChoice{{Index: 1, Side: SideTheirs}, {Index: 0, Side: SideTheirs}},
+			want:    "head\ntheirs 1\nmiddle\ntail\n",
+		},
+		{
+			name:    "both",
+			choices: []HunkChoice{{Index: 0, Side: SideBoth}, {Index: 1, Side: SideBoth}},
+			want:    "head\nours 1\ntheirs 1\nmiddle\nours 2\ntail\n",
+		},
+		{
+			name:    "a region without a choice",
+			choices: []HunkChoice{{Index: 0, Side: SideOurs}},
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "unknown region",
+			choices: []HunkChoice{{Index: 0, Side: SideOurs}, {Index: 2, Side: SideOurs}},
+			wantErr: ErrHunkNotFound,
+		},
+		{
+			name:    "base of a region without one",
+			choices: []HunkChoice{{Index: 0, Side: SideBase}, {Index: 1, Side: SideOurs}},
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "unknown side",
+			choices: []HunkChoice{{Index: 0, Side: "mine"}, {Index: 1, Side: SideOurs}},
+			wantErr: ErrInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyConflictChoices(twoConflicts, regions, tt.choices)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyConflictChoices() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("applyConflictChoices() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvedContent(t *testing.T) {
+	detail := ConflictDetail{
+		Ours:    &ConflictVersion{Content: "ours\n"},
+		Theirs:  &ConflictVersion{Binary: true},
+		Working: twoConflicts,
+		Regions: parseConflictRegions(twoConflicts),
+	}
+	content := "mine\n"
+	tests := []struct {
+		name        string
+		resolution  ConflictResolution
+		want        string
+		wantDeleted bool
+		wantErr     error
+	}{
+		{name: "content", resolution: ConflictResolution{Content: &content}, want: "mine\n"},
+		{name: "ours", resolution: ConflictResolution{Side: SideOurs}, want: "ours\n"},
+		{name: "missing base deletes", resolution: ConflictResolution{Side: SideBase}, wantDeleted: true},
+		{name: "binary side", resolution: ConflictResolution{Side: SideTheirs}, wantErr: ErrInvalidArgument},
+		{name: "both is per region", resolution: ConflictResolution{Side: SideBoth}, wantErr: ErrInvalidArgument},
+		{
+			name:       "hunks",
+			resolution: ConflictResolution{Hunks: []HunkChoice{{Index: 0, Side: SideOurs}, {Index: 1, Side: SideOurs}}},
+			want:       "head\nours 1\nmiddle\nours 2\ntail\n",
+		},
+		{name: "nothing", wantErr: ErrInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, deleted, err := resolvedContent(detail, tt.resolution)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolvedContent() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want || deleted != tt.wantDeleted {
+				t.Errorf("resolvedContent() = %q, %v, want %q, %v", got, deleted, tt.want, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestConflictKind(t *testing.T) {
+	tests := []struct {
+		stages []int
+		want   string
+	}{
+		{stages: []int{1, 2, 3}, want: "both modified"},
+		{stages: []int{2, 3}, want: "both added"},
+		{stages: []int{1, 2}, want: "deleted by them"},
+		{stages: []int{1, 3}, want: "deleted by us"},
+		{stages: []int{2}, want: "added by us"},
+		{stages: []int{3}, want: "added by them"},
+		{stages: []int{1}, want: "both deleted"},
+	}
+	for _, tt := range tests {
+		if got := conflictKind(tt.stages); got != tt.want {
+			t.Errorf("conflictKind(%v) = %q, want %q", tt.stages, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Package git drives the local git binary on behalf of the workspace APIs.
+// Every operation resolves the repository top level first and holds a
+// per-repository lock while git runs, so concurrent requests never race on
+// the index.
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrGitUnavailable   = errors.New("git executable not found")
+	ErrRootRequired     = errors.New("repository path is required")
+	ErrNotRepository    = errors.New("not a git repository")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrPathOutsideRepo  = errors.New("path is outside the repository")
+	ErrConflict         = errors.New("unresolved merge conflicts")
+	ErrDirtyTree        = errors.New("working tree has uncommitted changes")
+	ErrDetachedHead     = errors.New("HEAD is detached")
+	ErrBranchExists     = errors.New("branch already exists")
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrNothingToCommit  = errors.New("nothing to commit")
+	ErrHunkNotFound     = errors.New("hunk not found")
+	ErrWorktreeNotFound = errors.New("worktree not found")
+	ErrWorktreeExists   = errors.New("worktree already exists")
+	ErrPathNotTracked   = errors.New("path is not tracked at this revision")
+	ErrObjectTooLarge   = errors.New("file too large")
+)
+
+const defaultBinary = "git"
+
+// CommandError describes a failed git invocation. Kind is one of the
+// sentinel errors above when the failure was recognised.
+type CommandError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Kind     error
+}
+
+func (e *CommandError) Error() string {
+	message := strings.TrimSpace(e.Stderr)
+	if message == "" {
+		message = fmt.Sprintf("exit status %d", e.ExitCode)
+	}
+	if e.Kind != nil {
+		return e.Kind.Error() + ": " + message
+	}
+	return "git " + strings.Join(e.Args, " ") + ": " + message
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Kind
+}
+
+type Config struct {
+	Binary string
+	// WorktreeDir is where managed worktrees are created.
+	WorktreeDir string
+}
+
+func DefaultConfig() Config {
+	binary := strings.TrimSpace(os.Getenv("OMT_GIT_BINARY"))
+	if binary == "" {
+		binary = defaultBinary
+	}
+	return Config{Binary: binary}
+}
+
+type Service struct {
+	cfg    Config
+	mu     sync.Mutex
+	locks  map[string]*sync.Mutex
+	blames blameCache
+}
+
+func NewService(cfg Config) *Service {
+	if strings.TrimSpace(cfg.Binary) == "" {
+		cfg.Binary = defaultBinary
+	}
+	if strings.TrimSpace(cfg.WorktreeDir) == "" {
+		cfg.WorktreeDir = filepath.Join(os.TempDir(), "omt", "worktrees")
+	}
+	return &Service{cfg: cfg, locks: map[string]*sync.Mutex{}}
+}
+
+func (s *Service) repoLock(repo string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.locks[repo]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[repo] = lock
+	}
+	return lock
+}
+
+// withRepo resolves the repository containing rawPath and runs fn while
+// holding that repository's lock.
+func (s *Service) withRepo(ctx context.Context, rawPath string, fn func(repo string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	repo, err := s.TopLevel(ctx, rawPath)
+	if err != nil {
+		return err
+	}
+
+	lock := s.repoLock(repo)
+	lock.Lock()
+	defer lock.Unlock()
+	return fn(repo)
+}
+
+// TopLevel returns the absolute working tree root containing rawPath.
+func (s *Service) TopLevel(ctx context.Context, rawPath string) (string, error) {
+	if strings.TrimSpace(rawPath) == "" {
+		return "", ErrRootRequired
+	}
+	absPath, err := filepath.Abs(filepath.Clean(rawPath))
+	if err != nil {
+		return "", ErrInvalidArgument
+	}
+
+	dir := absPath
+	if info, statErr := os.Stat(absPath); statErr != nil || !info.IsDir() {
+		dir = filepath.Dir(absPath)
+	}
+	if _, statErr := os.Stat(dir); statErr != nil {
+		return "", ErrNotRepository
+	}
+
+	out, err := s.run(ctx, dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(strings.TrimSpace(out)), nil
+}
+
+// run executes git in dir and returns stdout. Failures are returned as
+// *CommandError.
+func (s *Service) run(ctx context.Context, dir string, stdin []byte, args ...string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	fullArgs := append([]string{"-C", dir, "-c", "core.quotepath=off", "-c", "color.ui=false"}, args...)
+	cmd := exec.CommandContext(ctx, s.cfg.Binary, fullArgs...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_OPTIONAL_LOCKS=0",
+		"LC_ALL=C",
+	)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", ErrGitUnavailable
+		}
+
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		// some porcelain commands report their failure on stdout
+		combined := stderr.String()
+		if strings.TrimSpace(combined) == "" {
+			combined = stdout.String()
+		}
+		return stdout.String(), &CommandError{
+			Args:     args,
+			ExitCode: exitCode,
+			Stderr:   combined,
+			Kind:     classifyFailure(stdout.String() + "\n" + stderr.String()),
+		}
+	}
+	return stdout.String(), nil
+}
+
+func classifyFailure(output string) error {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "not a git repository"):
+		return ErrNotRepository
+	case strings.Contains(lower, "would be overwritten by"),
+		strings.Contains(lower, "please commit your changes or stash them"),
+		strings.Contains(lower, "your local changes"):
+		return ErrDirtyTree
+	case strings.Contains(lower, "conflict"),
+		strings.Contains(lower, "needs merge"),
+		strings.Contains(lower, "unmerged"),
+		strings.Contains(lower, "resolve your current index first"):
+		return ErrConflict
+	case strings.Contains(lower, "nothing to commit"),
+		strings.Contains(lower, "no changes added to commit"):
+		return ErrNothingToCommit
+	case strings.Contains(lower, "already exists"):
+		return ErrBranchExists
+	case strings.Contains(lower, "not currently on a branch"),
+		strings.Contains(lower, "head detached"):
+		return ErrDetachedHead
+	case strings.Contains(lower, "no such path"),
+		strings.Contains(lower, "does not exist in"),
+		strings.Contains(lower, "exists on disk, but not in"):
+		return ErrPathNotTracked
+	case strings.Contains(lower, "invalid reference"),
+		strings.Contains(lower, "unknown revision"),
+		strings.Contains(lower, "not a valid object name"),
+		strings.Contains(lower, "bad revision"),
+		strings.Contains(lower, "did not match any"),
+		strings.Contains(lower, "not a commit"),
+		strings.Contains(lower, "no such ref"):
+		return ErrRevisionNotFound
+	default:
+		return nil
+	}
+}
+
+// relativePaths converts absolute or repo-relative paths into clean
+// repo-relative paths, refusing anything that escapes the repository.
+func relativePaths(repo string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: at least one path is required", ErrInvalidArgument)
+	}
+
+	out := make([]string, 0, len(paths))
+	for _, raw := range paths {
+		rel, err := relativePath(repo, raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rel)
+	}
+	return out, nil
+}
+
+func relativePath(repo, raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", fmt.Errorf("%w: empty path", ErrInvalidArgument)
+	}
+
+	absPath := raw
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(repo, absPath)
+	}
+	rel, err := filepath.Rel(repo, filepath.Clean(absPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathOutsideRepo
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// validateRefName rejects names git would refuse or could mistake for flags.
+func (s *Service) validateRefName(ctx context.Context, repo, name string) error {
+	if strings.TrimSpace(name) == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("%w: invalid branch name %q", ErrInvalidArgument, name)
+	}
+	if _, err := s.run(ctx, repo, nil, "check-ref-format", "--branch", name); err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			return fmt.Errorf("%w: invalid branch name %q", ErrInvalidArgument, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// validateRevision rejects revisions that could be parsed as options.
+func validateRevision(rev string) error {
+	if strings.HasPrefix(strings.TrimSpace(rev), "-") {
+		return fmt.Errorf("%w: invalid revision %q", ErrInvalidArgument, rev)
+	}
+	return nil
+}
+
+func (s *Service) hasHead(ctx context.Context, repo string) bool {
+	_, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+func (s *Service) isDetached(ctx context.Context, repo string) bool {
+	_, err := s.run(ctx, repo, nil, "symbolic-ref", "--quiet", "HEAD")
+	return err != nil
+}
+
+func splitNonEmpty(out, sep string) []string {
+	parts := strings.Split(out, sep)
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,247 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Hunk struct {
+	Index    int      `json:"index"`
+	Header   string   `json:"header"`
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+type FileDiff struct {
+	Path   string `json:"path"`
+	Staged bool   `json:"staged"`
+	Binary bool   `json:"binary"`
+	// header holds the "diff --git" preamble needed to rebuild a patch.
+	header []string
+	Hunks  []Hunk `json:"hunks"`
+}
+
+// Diff returns the hunks of one file, either unstaged (worktree vs index) or
+// staged (index vs HEAD).
+func (s *Service) Diff(ctx context.Context, root, path string, staged bool) (FileDiff, error) {
+	var out FileDiff
+	err := s.withRepo(ctx, root, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		out, err = s.fileDiff(ctx, repo, rel, staged)
+		return err
+	})
+	return out, err
+}
+
+// UnifiedDiff returns the patch text of unstaged changes, or of staged
+// changes when staged is set, under path or the whole repository when path
+// is empty. Untracked files are not included.
+func (s *Service) UnifiedDiff(ctx context.Context, root, path string, staged bool) (string, error) {
+	var out string
+	err := s.withRepo(ctx, root, func(repo string) error {
+		args := []string{"diff", "--no-ext-diff", "--no-color", "--unified=3"}
+		if staged {
+			args = append(args, "--cached")
+		}
+		if strings.TrimSpace(path) != "" {
+			rel, err := relativePath(repo, path)
+			if err != nil {
+				return err
+			}
+			args = append(args, "--", rel)
+		}
+		var err error
+		out, err = s.run(ctx, repo, nil, args...)
+		return err
+	})
+	return out, err
+}
+
+func (s *Service) fileDiff(ctx context.Context, repo, rel string, staged bool) (FileDiff, error) {
+	args := []string{"diff", "--no-ext-diff", "--no-color", "--unified=3"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	args = append(args, "--", rel)
+
+	raw, err := s.run(ctx, repo, nil, args...)
+	if err != nil {
+		return FileDiff{}, err
+	}
+	diff := parseFileDiff(raw)
+	diff.Path = rel
+	diff.Staged = staged
+	return diff, nil
+}
+
+func parseFileDiff(raw string) FileDiff {
+	diff := FileDiff{Hunks: []Hunk{}}
+	var current *Hunk
+	for _, line := range strings.SplitAfter(raw, "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "@@") {
+			hunk := parseHunkHeader(strings.TrimRight(line, "\n"))
+			hunk.Index = len(diff.Hunks)
+			diff.Hunks = append(diff.Hunks, hunk)
+			current = &diff.Hunks[len(diff.Hunks)-1]
+			continue
+		}
+		if current == nil {
+			if strings.HasPrefix(line, "Binary files ") {
+				diff.Binary = true
+			}
+			diff.header = append(diff.header, line)
+			continue
+		}
+		current.Lines = append(current.Lines, strings.TrimSuffix(line, "\n"))
+	}
+	return diff
+}
+
+// parseHunkHeader reads "@@ -a,b +c,d @@ section".
+func parseHunkHeader(header string) Hunk {
+	hunk := Hunk{Header: header, Lines: []string{}}
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return hunk
+	}
+	hunk.OldStart, hunk.OldLines = parseRange(strings.TrimPrefix(fields[1], "-"))
+	hunk.NewStart, hunk.NewLines = parseRange(strings.TrimPrefix(fields[2], "+"))
+	return hunk
+}
+
+func parseRange(value string) (int, int) {
+	startRaw, countRaw, hasCount := strings.Cut(value, ",")
+	start, _ := strconv.Atoi(startRaw)
+	count := 1
+	if hasCount {
+		count, _ = strconv.Atoi(countRaw)
+	}
+	return start, count
+}
+
+// patch rebuilds a patch containing only the selected hunks.
+func (d FileDiff) patch(indexes []int) (string, error) {
+	if len(indexes) == 0 {
+		return "", fmt.Errorf("%w: at least one hunk is required", ErrInvalidArgument)
+	}
+	if d.Binary {
+		return "", fmt.Errorf("%w: binary files cannot be staged by hunk", ErrInvalidArgument)
+	}
+
+	selected := append([]int(nil), indexes...)
+	sort.Ints(selected)
+
+	var b strings.Builder
+	for _, line := range d.header {
+		b.WriteString(line)
+	}
+	previous := -1
+	for _, index := range selected {
+		if index == previous {
+			continue
+		}
+		previous = index
+		if index < 0 || index >= len(d.Hunks) {
+			return "", fmt.Errorf("%w: %d", ErrHunkNotFound, index)
+		}
+		hunk := d.Hunks[index]
+		b.WriteString(hunk.Header)
+		b.WriteByte('\n')
+		for _, line := range hunk.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), nil
+}
+
+// Stage adds whole files to the index.
+func (s *Service) Stage(ctx context.Context, root string, paths []string) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, root, func(repo string) error {
+		rels, err := relativePaths(repo, paths)
+		if err != nil {
+			return err
+		}
+		if _, err := s.run(ctx, repo, nil, append([]string{"add", "--all", "--"}, rels...)...); err != nil {
+			return err
+		}
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+// Unstage removes whole files from the index, keeping worktree content.
+func (s *Service) Unstage(ctx context.Context, root string, paths []string) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, root, func(repo string) error {
+		rels, err := relativePaths(repo, paths)
+		if err != nil {
+			return err
+		}
+
+		args := append([]string{"reset", "--quiet", "HEAD", "--"}, rels...)
+		if !s.hasHead(ctx, repo) {
+			args = append([]string{"rm", "--cached", "--quiet", "-r", "--"}, rels...)
+		}
+		if _, err := s.run(ctx, repo, nil, args...); err != nil {
+			return err
+		}
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+// StageHunks stages the selected unstaged hunks of one file.
+func (s *Service) StageHunks(ctx context.Context, root, path string, hunks []int) (Status, error) {
+	return s.applyHunks(ctx, root, path, hunks, false)
+}
+
+// UnstageHunks removes the selected staged hunks of one file from the index.
+func (s *Service) UnstageHunks(ctx context.Context, root, path string, hunks []int) (Status, error) {
+	return s.applyHunks(ctx, root, path, hunks, true)
+}
+
+func (s *Service) applyHunks(ctx context.Context, root, path string, hunks []int, unstage bool) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, root, func(repo string) error {
+		rel, err := relativePath(repo, path)
+		if err != nil {
+			return err
+		}
+		diff, err := s.fileDiff(ctx, repo, rel, unstage)
+		if err != nil {
+			return err
+		}
+		patch, err := diff.patch(hunks)
+		if err != nil {
+			return err
+		}
+
+		args := []string{"apply", "--cached", "--recount", "--whitespace=nowarn"}
+		if unstage {
+			args = append(args, "--reverse")
+		}
+		args = append(args, "-")
+		if _, err := s.run(ctx, repo, []byte(patch), args...); err != nil {
+			return err
+		}
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+type FileStatus struct {
+	Path       string `json:"path"`
+	OrigPath   string `json:"origPath,omitempty"`
+	Index      string `json:"index"`
+	Worktree   string `json:"worktree"`
+	Staged     bool   `json:"staged"`
+	Unstaged   bool   `json:"unstaged"`
+	Untracked  bool   `json:"untracked"`
+	Conflicted bool   `json:"conflicted"`
+}
+
+type Status struct {
+	Root     string       `json:"root"`
+	Branch   string       `json:"branch,omitempty"`
+	Head     string       `json:"head,omitempty"`
+	Detached bool         `json:"detached"`
+	Upstream string       `json:"upstream,omitempty"`
+	Ahead    int          `json:"ahead"`
+	Behind   int          `json:"behind"`
+	Clean    bool         `json:"clean"`
+	Files    []FileStatus `json:"files"`
+}
+
+func (s *Service) Status(ctx context.Context, root string) (Status, error) {
+	var out Status
+	err := s.withRepo(ctx, root, func(repo string) error {
+		var err error
+		out, err = s.status(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+func (s *Service) status(ctx context.Context, repo string) (Status, error) {
+	raw, err := s.run(ctx, repo, nil, "status", "--porcelain=v2", "--branch", "--untracked-files=all", "-z")
+	if err != nil {
+		return Status{}, err
+	}
+	status := parseStatus(raw)
+	status.Root = repo
+	return status, nil
+}
+
+// parseStatus reads `git status --porcelain=v2 --branch -z` output.
+func parseStatus(raw string) Status {
+	status := Status{Files: []FileStatus{}}
+	records := strings.Split(raw, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record == "" {
+			continue
+		}
+
+		switch record[0] {
+		case '#':
+			parseBranchHeader(&status, record)
+		case '1':
+			fields := strings.SplitN(record, " ", 9)
+			if len(fields) == 9 {
+				status.Files = append(status.Files, newFileStatus(fields[1], fields[8], ""))
+			}
+		case '2':
+			fields := strings.SplitN(record, " ", 10)
+			if len(fields) == 10 {
+				orig := ""
+				if i+1 < len(records) {
+					orig = records[i+1]
+					i++
+				}
+				status.Files = append(status.Files, newFileStatus(fields[1], fields[9], orig))
+			}
+		case 'u':
+			fields := strings.SplitN(record, " ", 11)
+			if len(fields) == 11 {
+				file := newFileStatus(fields[1], fields[10], "")
+				file.Conflicted = true
+				status.Files = append(status.Files, file)
+			}
+		case '?':
+			status.Files = append(status.Files, FileStatus{
+				Path:      strings.TrimPrefix(record, "? "),
+				Index:     "?",
+				Worktree:  "?",
+				Untracked: true,
+				Unstaged:  true,
+			})
+		}
+	}
+	status.Clean = len(status.Files) == 0
+	return status
+}
+
+func parseBranchHeader(status *Status, record string) {
+	fields := strings.Fields(record)
+	if len(fields) < 3 {
+		return
+	}
+
+	switch fields[1] {
+	case "branch.oid":
+		if fields[2] != "(initial)" {
+			status.Head = fields[2]
+		}
+	case "branch.head":
+		if fields[2] == "(detached)" {
+			status.Detached = true
+		} else {
+			status.Branch = fields[2]
+		}
+	case "branch.upstream":
+		status.Upstream = fields[2]
+	case "branch.ab":
+		if len(fields) >= 4 {
+			status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+			status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+		}
+	}
+}
+
+func newFileStatus(xy, path, orig string) FileStatus {
+	index, worktree := ".", "."
+	if len(xy) == 2 {
+		index, worktree = xy[:1], xy[1:]
+	}
+	return FileStatus{
+		Path:     path,
+		OrigPath: orig,
+		Index:    index,
+		Worktree: worktree,
+		Staged:   index != ".",
+		Unstaged: worktree != ".",
+	}
+}
+
+func (st Status) hasConflicts() bool {
+	for _, file := range st.Files {
+		if file.Conflicted {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTrackedChanges ignores untracked files, which never block a checkout
+// unless they would be overwritten.
+func (st Status) hasTrackedChanges() bool {
+	for _, file := range st.Files {
+		if !file.Untracked {
+			return true
+		}
+	}
+	return false
+}
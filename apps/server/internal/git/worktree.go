@@ -0,0 +1,667 @@
+package git
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// worktreeBaseFile lives in the worktree's private git dir and records
+	// the commit the worktree was created from.
+	worktreeBaseFile     = "omt-base"
+	maxWorktreePatch     = 1 << 20
+	maxWorktreeCommits   = 100
+	defaultMergeMessage  = "Merge worktree changes"
+	defaultCommitMessage = "Worktree changes"
+	// maxUntrackedPatches bounds the git processes one diff starts for
+	// untracked files; the rest are listed without a patch or line counts.
+	maxUntrackedPatches = 200
+)
+
+type Worktree struct {
+	Path     string `json:"path"`
+	Head     string `json:"head"`
+	Branch   string `json:"branch,omitempty"`
+	Detached bool   `json:"detached"`
+	Base     string `json:"base,omitempty"`
+	Main     bool   `json:"main"`
+	Managed  bool   `json:"managed"`
+	Locked   bool   `json:"locked"`
+	Prunable bool   `json:"prunable"`
+}
+
+type CreateWorktreeOptions struct {
+	// Name is the directory name under the managed dir; it defaults to the
+	// branch name or a random id.
+	Name string
+	// Branch is checked out in the worktree. It is created from StartPoint
+	// when it does not exist yet; when empty the worktree is detached.
+	Branch     string
+	StartPoint string
+}
+
+type RemoveWorktreeOptions struct {
+	Force        bool
+	DeleteBranch bool
+}
+
+type MergeWorktreeOptions struct {
+	Message      string
+	Squash       bool
+	Remove       bool
+	DeleteBranch bool
+	// NoVerify skips the commit hooks of the worktree and merge commits.
+	NoVerify bool
+}
+
+type WorktreeChange struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+	Untracked bool   `json:"untracked"`
+}
+
+type WorktreeDiff struct {
+	Path      string           `json:"path"`
+	Base      string           `json:"base"`
+	Head      string           `json:"head"`
+	Commits   []Commit         `json:"commits"`
+	Files     []WorktreeChange `json:"files"`
+	Patch     string           `json:"patch"`
+	Truncated bool             `json:"truncated"`
+}
+
+type MergeResult struct {
+	Commit  Commit `json:"commit"`
+	Removed bool   `json:"removed"`
+}
+
+func (s *Service) Worktrees(ctx context.Context, root string) ([]Worktree, error) {
+	var out []Worktree
+	err := s.withRepo(ctx, root, func(repo string) error {
+		var err error
+		out, err = s.listWorktrees(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+// CreateWorktree adds a worktree under the managed directory.
+func (s *Service) CreateWorktree(ctx context.Context, root string, opts CreateWorktreeOptions) (Worktree, error) {
+	var created Worktree
+	err := s.withRepo(ctx, root, func(repo string) error {
+		branch := strings.TrimSpace(opts.Branch)
+		startPoint := strings.TrimSpace(opts.StartPoint)
+		if err := validateRevision(startPoint); err != nil {
+			return err
+		}
+		if branch != "" {
+			if err := s.validateRefName(ctx, repo, branch); err != nil {
+				return err
+			}
+		}
+
+		name := sanitizeWorktreeName(opts.Name)
+		if name == "" {
+			name = sanitizeWorktreeName(branch)
+		}
+		if name == "" {
+			name = "wt-" + randomHex(4)
+		}
+		path := filepath.Join(s.cfg.WorktreeDir, repoKey(repo), name)
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%w: %s", ErrWorktreeExists, path)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+
+		branchExists := false
+		if branch != "" {
+			_, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+			branchExists = err == nil
+			if branchExists && startPoint != "" {
+				return fmt.Errorf("%w: %s", ErrBranchExists, branch)
+			}
+		}
+
+		baseRev := startPoint
+		if baseRev == "" {
+			baseRev = "HEAD"
+			if branchExists {
+				baseRev = "refs/heads/" + branch
+			}
+		}
+		base, err := s.run(ctx, repo, nil, "rev-parse", "--verify", "--quiet", baseRev+"^{commit}")
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrRevisionNotFound, baseRev)
+		}
+		base = strings.TrimSpace(base)
+
+		args := []string{"worktree", "add"}
+		switch {
+		case branch == "":
+			args = append(args, "--detach", path, base)
+		case branchExists:
+			args = append(args, path, branch)
+		default:
+			args = append(args, "-b", branch, path, base)
+		}
+		if _, err := s.run(ctx, repo, nil, args...); err != nil {
+			return err
+		}
+		if err := s.writeWorktreeBase(ctx, path, base); err != nil {
+			return err
+		}
+
+		worktrees, err := s.listWorktrees(ctx, repo)
+		if err != nil {
+			return err
+		}
+		for _, worktree := range worktrees {
+			if worktree.Path == path {
+				created = worktree
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrWorktreeNotFound, path)
+	})
+	return created, err
+}
+
+// RemoveWorktree deletes a linked worktree. Without Force, uncommitted work
+// is reported as ErrDirtyTree.
+func (s *Service) RemoveWorktree(ctx context.Context, root, path string, opts RemoveWorktreeOptions) error {
+	return s.withRepo(ctx, root, func(repo string) error {
+		return s.removeWorktree(ctx, repo, path, opts)
+	})
+}
+
+func (s *Service) removeWorktree(ctx context.Context, repo, path string, opts RemoveWorktreeOptions) error {
+	worktree, err := s.findWorktree(ctx, repo, path)
+	if err != nil {
+		return err
+	}
+	if worktree.Main {
+		return fmt.Errorf("%w: cannot remove the main worktree", ErrInvalidArgument)
+	}
+
+	args := []string{"worktree", "remove"}
+	if opts.Force {
+		args = append(args, "--force", "--force")
+	}
+	args = append(args, worktree.Path)
+	if _, err := s.run(ctx, repo, nil, args...); err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, "modified or untracked files") {
+			cmdErr.Kind = ErrDirtyTree
+		}
+		return err
+	}
+
+	if opts.DeleteBranch && worktree.Branch != "" {
+		if _, err := s.run(ctx, repo, nil, "branch", "-D", worktree.Branch); err != nil {
+			return err
+		}
+	}
+	if worktree.Managed {
+		// drops the per-repository directory once its last worktree is gone
+		_ = os.Remove(filepath.Dir(worktree.Path))
+	}
+	return nil
+}
+
+// PruneWorktrees drops administrative data for worktrees whose directories
+// no longer exist and returns the remaining worktrees.
+func (s *Service) PruneWorktrees(ctx context.Context, root string) ([]Worktree, error) {
+	var out []Worktree
+	err := s.withRepo(ctx, root, func(repo string) error {
+		if _, err := s.run(ctx, repo, nil, "worktree", "prune"); err != nil {
+			return err
+		}
+		var err error
+		out, err = s.listWorktrees(ctx, repo)
+		return err
+	})
+	return out, err
+}
+
+// OwnsWorktree reports whether path is, or was, a worktree of the
+// repository containing root: it lies under the repository's managed
+// directory, which still works once the directory is gone, or git resolves
+// both to the same common git directory.
+func (s *Service) OwnsWorktree(ctx context.Context, root, path string) (bool, error) {
+	repo, err := s.TopLevel(ctx, root)
+	if err != nil {
+		return false, err
+	}
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return false, ErrInvalidArgument
+	}
+	common, err := s.commonDir(ctx, repo)
+	if err != nil {
+		return false, err
+	}
+	for _, owner := range []string{repo, filepath.Dir(common)} {
+		if isWithinDir(filepath.Join(s.cfg.WorktreeDir, repoKey(owner)), absPath) {
+			return true, nil
+		}
+	}
+
+	if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+		return false, nil
+	}
+	pathCommon, err := s.commonDir(ctx, absPath)
+	if err != nil {
+		// no longer a repository, so not one of ours
+		return false, nil
+	}
+	return pathCommon == common, nil
+}
+
+// commonDir returns the git directory shared by every worktree of the
+// repository containing dir.
+func (s *Service) commonDir(ctx context.Context, dir string) (string, error) {
+	out, err := s.run(ctx, dir, nil, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	common := strings.TrimSpace(out)
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(dir, common)
+	}
+	if resolved, err := filepath.EvalSymlinks(common); err == nil {
+		common = resolved
+	}
+	return filepath.Clean(common), nil
+}
+
+// WorktreeDiff reports everything that changed in a worktree since its base:
+// commits, committed and uncommitted file changes, and untracked files.
+func (s *Service) WorktreeDiff(ctx context.Context, path string) (WorktreeDiff, error) {
+	var out WorktreeDiff
+	err := s.withRepo(ctx, path, func(repo string) error {
+		base, err := s.worktreeBase(ctx, repo)
+		if err != nil {
+			return err
+		}
+		head, err := s.run(ctx, repo, nil, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+
+		out = WorktreeDiff{Path: repo, Base: base, Head: strings.TrimSpace(head), Files: []WorktreeChange{}}
+		if out.Commits, err = s.log(ctx, repo, base+"..HEAD", "", 0, maxWorktreeCommits); err != nil {
+			return err
+		}
+
+		return s.collectWorktreeChanges(ctx, repo, base, &out)
+	})
+	return out, err
+}
+
+func (s *Service) collectWorktreeChanges(ctx context.Context, repo, base string, out *WorktreeDiff) error {
+	nameStatus, err := s.run(ctx, repo, nil, "diff", "--no-renames", "--name-status", "-z", base)
+	if err != nil {
+		return err
+	}
+	numstat, err := s.run(ctx, repo, nil, "diff", "--no-renames", "--numstat", "-z", base)
+	if err != nil {
+		return err
+	}
+
+	counts := parseNumstat(numstat)
+	fields := splitNonEmpty(nameStatus, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		change := WorktreeChange{Status: fields[i][:1], Path: fields[i+1]}
+		if count, ok := counts[change.Path]; ok {
+			change.Additions, change.Deletions, change.Binary = count.Additions, count.Deletions, count.Binary
+		}
+		out.Files = append(out.Files, change)
+	}
+
+	patch, err := s.run(ctx, repo, nil, "diff", "--no-renames", "--no-ext-diff", base)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(patch)
+
+	untracked, err := s.run(ctx, repo, nil, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return err
+	}
+	for i, rel := range splitNonEmpty(untracked, "\x00") {
+		change := WorktreeChange{Path: rel, Status: "A", Untracked: true}
+		if i >= maxUntrackedPatches || b.Len() >= maxWorktreePatch {
+			out.Truncated = true
+			out.Files = append(out.Files, change)
+			continue
+		}
+		// --no-index exits 1 whenever the files differ, which they always do
+		filePatch, err := s.run(ctx, repo, nil, "diff", "--no-index", "--no-ext-diff", "--", os.DevNull, rel)
+		var cmdErr *CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.ExitCode == 1) {
+			return err
+		}
+		if strings.Contains(filePatch, "\nBinary files ") {
+			change.Binary = true
+		} else {
+			// the "+++ b/path" header also starts with a plus
+			if added := strings.Count(filePatch, "\n+") - 1; added > 0 {
+				change.Additions = added
+			}
+		}
+		b.WriteString(filePatch)
+		out.Files = append(out.Files, change)
+	}
+
+	out.Patch = b.String()
+	if len(out.Patch) > maxWorktreePatch {
+		out.Patch = out.Patch[:maxWorktreePatch]
+		out.Truncated = true
+	}
+	return nil
+}
+
+// MergeWorktree commits any pending work in the worktree and merges it into
+// the branch checked out at root. Conflicts are left in place for the
+// conflict resolution API and reported as ErrConflict.
+func (s *Service) MergeWorktree(ctx context.Context, root, path string, opts MergeWorktreeOptions) (MergeResult, error) {
+	var result MergeResult
+	message := strings.TrimSpace(opts.Message)
+
+	mainRepo, err := s.TopLevel(ctx, root)
+	if err != nil {
+		return result, err
+	}
+	worktree, err := s.findWorktree(ctx, mainRepo, path)
+	if err != nil {
+		return result, err
+	}
+	if worktree.Main || worktree.Path == mainRepo {
+		return result, fmt.Errorf("%w: cannot merge a worktree into itself", ErrInvalidArgument)
+	}
+
+	target := worktree.Branch
+	err = s.withRepo(ctx, worktree.Path, func(repo string) error {
+		status, err := s.status(ctx, repo)
+		if err != nil {
+			return err
+		}
+		if status.hasConflicts() {
+			return ErrConflict
+		}
+		if !status.Clean {
+			commitMessage := message
+			if commitMessage == "" {
+				commitMessage = defaultCommitMessage
+			}
+			if _, err := s.run(ctx, repo, nil, "add", "--all"); err != nil {
+				return err
+			}
+			if _, err := s.run(ctx, repo, nil, commitArgs(opts.NoVerify, "commit", "--message", commitMessage)...); err != nil {
+				return err
+			}
+		}
+		if target == "" {
+			head, err := s.run(ctx, repo, nil, "rev-parse", "HEAD")
+			if err != nil {
+				return err
+			}
+			target = strings.TrimSpace(head)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = s.withRepo(ctx, mainRepo, func(repo string) error {
+		status, err := s.status(ctx, repo)
+		if err != nil {
+			return err
+		}
+		if status.hasConflicts() {
+			return ErrConflict
+		}
+		if status.hasTrackedChanges() {
+			return ErrDirtyTree
+		}
+		if status.Detached {
+			return ErrDetachedHead
+		}
+
+		if message == "" {
+			message = defaultMergeMessage
+		}
+		if opts.Squash {
+			if _, err := s.run(ctx, repo, nil, "merge", "--squash", target); err != nil {
+				return err
+			}
+			if _, err := s.run(ctx, repo, nil, commitArgs(opts.NoVerify, "commit", "--message", message)...); err != nil {
+				return err
+			}
+		} else if _, err := s.run(ctx, repo, nil, commitArgs(opts.NoVerify, "merge", "--no-ff", "--no-edit", "--message", message, target)...); err != nil {
+			return err
+		}
+
+		commits, err := s.log(ctx, repo, "HEAD", "", 0, 1)
+		if err != nil {
+			return err
+		}
+		if len(commits) > 0 {
+			result.Commit = commits[0]
+		}
+
+		if opts.Remove {
+			if err := s.removeWorktree(ctx, repo, worktree.Path, RemoveWorktreeOptions{DeleteBranch: opts.DeleteBranch}); err != nil {
+				return err
+			}
+			result.Removed = true
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *Service) listWorktrees(ctx context.Context, repo string) ([]Worktree, error) {
+	raw, err := s.run(ctx, repo, nil, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Worktree{}
+	for _, block := range strings.Split(strings.TrimSpace(raw), "\n\n") {
+		worktree := Worktree{}
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				worktree.Path = filepath.Clean(value)
+			case "HEAD":
+				worktree.Head = value
+			case "branch":
+				worktree.Branch = strings.TrimPrefix(value, "refs/heads/")
+			case "detached":
+				worktree.Detached = true
+			case "locked":
+				worktree.Locked = true
+			case "prunable":
+				worktree.Prunable = true
+			}
+		}
+		if worktree.Path == "" {
+			continue
+		}
+		worktree.Main = len(out) == 0
+		worktree.Managed = isWithinDir(s.cfg.WorktreeDir, worktree.Path)
+		if !worktree.Main && !worktree.Prunable {
+			worktree.Base = s.readWorktreeBase(ctx, worktree.Path)
+		}
+		out = append(out, worktree)
+	}
+	return out, nil
+}
+
+func (s *Service) findWorktree(ctx context.Context, repo, path string) (Worktree, error) {
+	if strings.TrimSpace(path) == "" {
+		return Worktree{}, fmt.Errorf("%w: worktree path is required", ErrInvalidArgument)
+	}
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return Worktree{}, ErrInvalidArgument
+	}
+
+	worktrees, err := s.listWorktrees(ctx, repo)
+	if err != nil {
+		return Worktree{}, err
+	}
+	for _, worktree := range worktrees {
+		if worktree.Path == absPath {
+			return worktree, nil
+		}
+	}
+	return Worktree{}, fmt.Errorf("%w: %s", ErrWorktreeNotFound, absPath)
+}
+
+// worktreeBase returns the recorded base commit, falling back to the merge
+// base with the main worktree for worktrees created outside the server.
+func (s *Service) worktreeBase(ctx context.Context, repo string) (string, error) {
+	if base := s.readWorktreeBase(ctx, repo); base != "" {
+		return base, nil
+	}
+
+	worktrees, err := s.listWorktrees(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+	if len(worktrees) == 0 || worktrees[0].Path == repo {
+		return "", fmt.Errorf("%w: %s is not a linked worktree", ErrWorktreeNotFound, repo)
+	}
+	base, err := s.run(ctx, repo, nil, "merge-base", "HEAD", worktrees[0].Head)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(base), nil
+}
+
+func (s *Service) worktreeBasePath(ctx context.Context, worktree string) (string, error) {
+	out, err := s.run(ctx, worktree, nil, "rev-parse", "--git-path", worktreeBaseFile)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(out)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(worktree, path)
+	}
+	return path, nil
+}
+
+func (s *Service) writeWorktreeBase(ctx context.Context, worktree, base string) error {
+	path, err := s.worktreeBasePath(ctx, worktree)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(base+"\n"), 0o644)
+}
+
+func (s *Service) readWorktreeBase(ctx context.Context, worktree string) string {
+	path, err := s.worktreeBasePath(ctx, worktree)
+	if err != nil {
+		return ""
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+type lineCount struct {
+	Additions int
+	Deletions int
+	Binary    bool
+}
+
+// parseNumstat reads `git diff --numstat -z --no-renames` output.
+func parseNumstat(raw string) map[string]lineCount {
+	out := map[string]lineCount{}
+	for _, record := range splitNonEmpty(raw, "\x00") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		count := lineCount{}
+		if fields[0] == "-" {
+			count.Binary = true
+		} else {
+			count.Additions, _ = strconv.Atoi(fields[0])
+			count.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		out[fields[2]] = count
+	}
+	return out
+}
+
+// commitArgs adds --no-verify to a commit or merge when hooks are skipped.
+func commitArgs(noVerify bool, args ...string) []string {
+	if noVerify {
+		return append(args[:1:1], append([]string{"--no-verify"}, args[1:]...)...)
+	}
+	return args
+}
+
+// repoKey names the managed directory of a repository: its base name plus a
+// short hash of its path so same-named repositories do not collide.
+func repoKey(repo string) string {
+	sum := sha1.Sum([]byte(repo))
+	name := sanitizeWorktreeName(filepath.Base(repo))
+	if name == "" {
+		name = "repo"
+	}
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+func sanitizeWorktreeName(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+		if b.Len() >= 64 {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "-.")
+}
+
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(int64(os.Getpid()), 16)
+	}
+	return hex.EncodeToString(buf)
+}
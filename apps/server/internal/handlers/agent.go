@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local/monorepo/internal/agent"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/threads"
+)
+
+const agentHeartbeatInterval = 20 * time.Second
+
+type AgentRunRequest struct {
+	ThreadID string `json:"threadId"`
+	Content  string `json:"content"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	MaxSteps int    `json:"maxSteps,omitempty"`
+	// Files are workspace paths attached to the message.
+	Files []string `json:"files,omitempty"`
+}
+
+type AgentRunIDRequest struct {
+	ID string `json:"id"`
+}
+
+type AgentHandler struct {
+	runner *agent.Runner
+}
+
+func NewAgentHandler(runner *agent.Runner) *AgentHandler {
+	return &AgentHandler{runner: runner}
+}
+
+// Run appends the message to the thread and starts the agent on it. The
+// reply arrives through Stream.
+func (h *AgentHandler) Run(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "agent run") {
+		return
+	}
+
+	var req AgentRunRequest
+	if !decodeJSONBody(w, r, &req, maxThreadMessageBodyBytes) {
+		return
+	}
+
+	run, err := h.runner.Start(agent.StartOptions{
+		ThreadID: req.ThreadID,
+		Content:  req.Content,
+		Provider: req.Provider,
+		Model:    req.Model,
+		MaxSteps: req.MaxSteps,
+		Files:    req.Files,
+	})
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+func (h *AgentHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "agent runs") {
+		return
+	}
+	writeJSON(w, h.runner.List(r.URL.Query().Get("thread")))
+}
+
+func (h *AgentHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "agent status") {
+		return
+	}
+
+	run, err := h.runner.Get(r.URL.Query().Get("id"))
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+func (h *AgentHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "agent cancel") {
+		return
+	}
+
+	var req AgentRunIDRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	run, err := h.runner.Cancel(req.ID)
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+// Stream sends a run's events as server-sent events named by their type,
+// replaying those after ?after= (or Last-Event-ID) first, and ends after the
+// done event.
+func (h *AgentHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "agent stream") {
+		return
+	}
+
+	query := r.URL.Query()
+	var after int64
+	raw := strings.TrimSpace(query.Get("after"))
+	if raw == "" {
+		raw = strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	}
+	if raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		after = parsed
+	}
+	id := query.Get("id")
+	if _, err := h.runner.Get(id); err != nil {
+		writeAgentError(w, err)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(agentHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		events, changed, done, err := h.runner.Events(id, after)
+		if err != nil {
+			return
+		}
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "id: %d\n", event.Seq); err != nil {
+				return
+			}
+			if err := writeSSE(w, controller, event.Type, event); err != nil {
+				return
+			}
+			after = event.Seq
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeAgentError(w http.ResponseWriter, err error) {
+	var providerErr *llm.ProviderError
+	switch {
+	case errors.Is(err, agent.ErrRunNotFound):
+		http.Error(w, "agent run not found", http.StatusNotFound)
+	case errors.Is(err, agent.ErrRunFinished):
+		http.Error(w, "agent run already finished", http.StatusConflict)
+	case errors.Is(err, agent.ErrThreadBusy):
+		http.Error(w, "thread already has a running agent", http.StatusConflict)
+	case errors.Is(err, agent.ErrEmptyMessage):
+		http.Error(w, "message content is required", http.StatusBadRequest)
+	case errors.Is(err, agent.ErrWorkspaceNotFound):
+		http.Error(w, "thread workspace does not exist", http.StatusNotFound)
+	case errors.Is(err, agent.ErrUnsupportedMode), errors.Is(err, agent.ErrOutsideWorkspace), errors.Is(err, agent.ErrInvalidArguments):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, agent.ErrNothingToCompact):
+		http.Error(w, "thread has no history to compact", http.StatusConflict)
+	case errors.Is(err, threads.ErrWorkspaceRequired):
+		http.Error(w, "workspace is required", http.StatusBadRequest)
+	case errors.Is(err, threads.ErrThreadNotFound):
+		http.Error(w, "thread not found", http.StatusNotFound)
+	case errors.Is(err, llm.ErrProviderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, llm.ErrMissingKey):
+		http.Error(w, "llm provider has no API key", http.StatusUnprocessableEntity)
+	case errors.Is(err, llm.ErrUnknownType):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.As(err, &providerErr):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		// attachments surface filesystem errors
+		status, message := fsErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			message = "agent operation failed"
+		}
+		http.Error(w, message, status)
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"local/monorepo/internal/approvals"
+)
+
+type ApprovalResolveRequest struct {
+	Decision string  `json:"decision"`
+	Remember bool    `json:"remember,omitempty"`
+	Pattern  *string `json:"pattern,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+type ApprovalRuleAddRequest struct {
+	Workspace string `json:"workspace"`
+	Category  string `json:"category"`
+	Pattern   string `json:"pattern,omitempty"`
+	Decision  string `json:"decision"`
+}
+
+type ApprovalRuleDeleteRequest struct {
+	Workspace string `json:"workspace"`
+	ID        string `json:"id"`
+}
+
+type ApprovalsHandler struct {
+	gate *approvals.Gate
+}
+
+func NewApprovalsHandler(gate *approvals.Gate) *ApprovalsHandler {
+	return &ApprovalsHandler{gate: gate}
+}
+
+// List returns approvals waiting for the user, optionally for ?workspace=.
+func (h *ApprovalsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "approvals list") {
+		return
+	}
+	writeJSON(w, h.gate.Pending(r.URL.Query().Get("workspace")))
+}
+
+// Approval serves /v1/approvals/{id}: GET returns the pending approval and
+// POST resolves it.
+func (h *ApprovalsHandler) Approval(w http.ResponseWriter, r *http.Request) {
+	method := http.MethodGet
+	if r.Method == http.MethodPost {
+		method = http.MethodPost
+	}
+	if !requireFSAccess(w, r, method, "approval") {
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/approvals/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if method == http.MethodGet {
+		approval, err := h.gate.Get(id)
+		if err != nil {
+			writeApprovalError(w, err)
+			return
+		}
+		writeJSON(w, approval)
+		return
+	}
+
+	var req ApprovalResolveRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	approval, err := h.gate.Resolve(id, approvals.Resolution{
+		Decision: strings.TrimSpace(req.Decision),
+		Remember: req.Remember,
+		Pattern:  req.Pattern,
+		Reason:   req.Reason,
+	})
+	if err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	writeJSON(w, approval)
+}
+
+// Stream pushes approvals as they become pending or are resolved, after a
+// snapshot of those already pending.
+func (h *ApprovalsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "approvals stream") {
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	workspace := strings.TrimSpace(r.URL.Query().Get("workspace"))
+	if workspace != "" {
+		workspace = filepath.Clean(workspace)
+	}
+	sub := h.gate.Subscribe()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeSSE(w, controller, "snapshot", h.gate.Pending(workspace)); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(agentHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case approval, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if workspace != "" && approval.Workspace != workspace {
+				continue
+			}
+			if err := writeSSE(w, controller, "update", approval); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *ApprovalsHandler) Rules(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "approval rules") {
+		return
+	}
+
+	rules, err := h.gate.Store().Rules(r.URL.Query().Get("workspace"))
+	if err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	writeJSON(w, rules)
+}
+
+func (h *ApprovalsHandler) AddRule(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "approval rule add") {
+		return
+	}
+
+	var req ApprovalRuleAddRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	rule, err := h.gate.Store().AddRule(req.Workspace, approvals.Rule{
+		Category: strings.TrimSpace(req.Category),
+		Pattern:  req.Pattern,
+		Decision: strings.TrimSpace(req.Decision),
+	})
+	if err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	writeJSON(w, rule)
+}
+
+func (h *ApprovalsHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "approval rule delete") {
+		return
+	}
+
+	var req ApprovalRuleDeleteRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	if err := h.gate.Store().DeleteRule(req.Workspace, req.ID); err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeApprovalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, approvals.ErrApprovalNotFound):
+		http.Error(w, "approval not found", http.StatusNotFound)
+	case errors.Is(err, approvals.ErrAlreadyResolved):
+		http.Error(w, "approval already resolved", http.StatusConflict)
+	case errors.Is(err, approvals.ErrRuleNotFound):
+		http.Error(w, "approval rule not found", http.StatusNotFound)
+	case errors.Is(err, approvals.ErrInvalidCategory):
+		http.Error(w, "category must be read, write, delete, exec or network", http.StatusBadRequest)
+	case errors.Is(err, approvals.ErrInvalidDecision):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, approvals.ErrWorkspaceRequired):
+		http.Error(w, "workspace is required", http.StatusBadRequest)
+	default:
+		http.Error(w, "approval operation failed", http.StatusInternalServerError)
+	}
+}
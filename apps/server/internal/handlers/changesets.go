@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"local/monorepo/internal/changesets"
+	"local/monorepo/internal/diff"
+)
+
+type ChangesetCreateRequest struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Root  string `json:"root"`
+}
+
+type ChangesetSelectionRequest struct {
+	ID    string `json:"id"`
+	Path  string `json:"path"`
+	Hunks []int  `json:"hunks,omitempty"`
+	Force bool   `json:"force"`
+}
+
+type ChangesetIDRequest struct {
+	ID string `json:"id"`
+}
+
+type ChangesetsHandler struct {
+	manager *changesets.Manager
+}
+
+func NewChangesetsHandler(manager *changesets.Manager) *ChangesetsHandler {
+	return &ChangesetsHandler{manager: manager}
+}
+
+func (h *ChangesetsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "changesets list") {
+		return
+	}
+	writeJSON(w, h.manager.List(r.Context()))
+}
+
+func (h *ChangesetsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "changeset create") {
+		return
+	}
+
+	var req ChangesetCreateRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	summary, err := h.manager.Create(changesets.CreateOptions{ID: req.ID, Title: req.Title, Root: req.Root})
+	if err != nil {
+		writeChangesetError(w, err)
+		return
+	}
+	writeJSON(w, summary)
+}
+
+func (h *ChangesetsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "changeset get") {
+		return
+	}
+
+	detail, err := h.manager.Get(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		writeChangesetError(w, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (h *ChangesetsHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	h.handleSelection(w, r, "changeset apply", h.manager.Apply)
+}
+
+func (h *ChangesetsHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.handleSelection(w, r, "changeset reject", h.manager.Reject)
+}
+
+func (h *ChangesetsHandler) handleSelection(
+	w http.ResponseWriter,
+	r *http.Request,
+	operation string,
+	fn func(context.Context, string, changesets.Selection) (changesets.Detail, error),
+) {
+	if !requireFSAccess(w, r, http.MethodPost, operation) {
+		return
+	}
+
+	var req ChangesetSelectionRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	detail, err := fn(r.Context(), req.ID, changesets.Selection{Path: req.Path, Hunks: req.Hunks, Force: req.Force})
+	if err != nil {
+		writeChangesetError(w, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (h *ChangesetsHandler) Discard(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "changeset discard") {
+		return
+	}
+
+	var req ChangesetIDRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	if err := h.manager.Discard(req.ID); err != nil {
+		writeChangesetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeChangesetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, changesets.ErrChangesetNotFound):
+		http.Error(w, "changeset not found", http.StatusNotFound)
+	case errors.Is(err, changesets.ErrInvalidID):
+		http.Error(w, "invalid changeset id", http.StatusBadRequest)
+	case errors.Is(err, changesets.ErrFileNotStaged):
+		http.Error(w, "file is not part of the changeset", http.StatusNotFound)
+	case errors.Is(err, changesets.ErrHunkNotFound):
+		http.Error(w, "hunk not found", http.StatusNotFound)
+	case errors.Is(err, changesets.ErrInvalidArgument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, changesets.ErrConflict), errors.Is(err, diff.ErrMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeFSError(w, err)
+	}
+}
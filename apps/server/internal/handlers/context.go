@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"local/monorepo/internal/agent"
+	"local/monorepo/internal/attachments"
+)
+
+type ContextUsageRequest struct {
+	ThreadID  string   `json:"threadId,omitempty"`
+	Workspace string   `json:"workspace,omitempty"`
+	Mode      string   `json:"mode,omitempty"`
+	Provider  string   `json:"provider,omitempty"`
+	Model     string   `json:"model,omitempty"`
+	Draft     string   `json:"draft,omitempty"`
+	Files     []string `json:"files,omitempty"`
+}
+
+type ContextCompactRequest struct {
+	ThreadID string `json:"threadId"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+type ContextResolveRequest struct {
+	Workspace     string                  `json:"workspace"`
+	References    []attachments.Reference `json:"references"`
+	MaxBytes      int                     `json:"maxBytes,omitempty"`
+	MaxBlockBytes int                     `json:"maxBlockBytes,omitempty"`
+}
+
+type ContextHandler struct {
+	runner   *agent.Runner
+	resolver *attachments.Resolver
+}
+
+// NewContextHandler returns the context handler. runner may be nil when the
+// agent is unavailable; Usage and Compact are then not registered.
+func NewContextHandler(runner *agent.Runner, resolver *attachments.Resolver) *ContextHandler {
+	return &ContextHandler{runner: runner, resolver: resolver}
+}
+
+// Resolve turns file, selection, folder, glob, git diff, terminal and
+// diagnostics references into content blocks that fit the byte budget.
+// References that cannot be resolved come back as blocks with an error.
+func (h *ContextHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "context resolve") {
+		return
+	}
+
+	var req ContextResolveRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	result, err := h.resolver.Resolve(r.Context(), attachments.Request{
+		Workspace:     req.Workspace,
+		References:    req.References,
+		MaxBytes:      req.MaxBytes,
+		MaxBlockBytes: req.MaxBlockBytes,
+	})
+	if err != nil {
+		writeContextError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// Usage returns the token breakdown of the prompt the next agent run would
+// send: the thread's history, or a workspace and mode for a new thread,
+// plus the draft and its attached files.
+func (h *ContextHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "context usage") {
+		return
+	}
+
+	var req ContextUsageRequest
+	if !decodeJSONBody(w, r, &req, maxThreadMessageBodyBytes) {
+		return
+	}
+
+	usage, err := h.runner.Estimate(r.Context(), agent.ContextRequest{
+		ThreadID:  req.ThreadID,
+		Workspace: req.Workspace,
+		Mode:      req.Mode,
+		Provider:  req.Provider,
+		Model:     req.Model,
+		Draft:     req.Draft,
+		Files:     req.Files,
+	})
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+	writeJSON(w, usage)
+}
+
+// Compact summarizes the older history of a thread with the model so that
+// later prompts carry the summary instead.
+func (h *ContextHandler) Compact(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "context compact") {
+		return
+	}
+
+	var req ContextCompactRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	result, err := h.runner.Compact(r.Context(), agent.CompactOptions{
+		ThreadID: req.ThreadID,
+		Provider: req.Provider,
+		Model:    req.Model,
+	})
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func writeContextError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, attachments.ErrWorkspaceRequired), errors.Is(err, attachments.ErrNoReferences):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, attachments.ErrTooManyReferences):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, attachments.ErrWorkspaceNotFound):
+		http.Error(w, "workspace does not exist", http.StatusNotFound)
+	default:
+		status, message := fsErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			message = "context operation failed"
+		}
+		http.Error(w, message, status)
+	}
+}
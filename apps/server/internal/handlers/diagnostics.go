@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local/monorepo/internal/diagnostics"
+)
+
+const diagnosticsHeartbeatInterval = 20 * time.Second
+
+type DiagnosticsCheckRequest struct {
+	Root  string `json:"root"`
+	Check string `json:"check"`
+}
+
+type DiagnosticsResponse struct {
+	Files    []diagnostics.FileDiagnostics `json:"files"`
+	Errors   int                           `json:"errors"`
+	Warnings int                           `json:"warnings"`
+	Infos    int                           `json:"infos"`
+}
+
+type DiagnosticsHandler struct {
+	store *diagnostics.Store
+}
+
+func NewDiagnosticsHandler(store *diagnostics.Store) *DiagnosticsHandler {
+	if store == nil {
+		store = diagnostics.NewStore()
+	}
+	return &DiagnosticsHandler{store: store}
+}
+
+// List returns the merged diagnostics under ?root= and ?path=, at least as
+// severe as ?severity=. With ?summary=1 only per-file counts are returned,
+// which is all the file tree needs for badges.
+func (h *DiagnosticsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "diagnostics") {
+		return
+	}
+
+	query := r.URL.Query()
+	files := h.store.Query(diagnostics.Filter{
+		Root:     query.Get("root"),
+		Path:     query.Get("path"),
+		Severity: query.Get("severity"),
+	})
+	summary, _ := strconv.ParseBool(query.Get("summary"))
+	out := DiagnosticsResponse{Files: files}
+	for i := range files {
+		out.Errors += files[i].Errors
+		out.Warnings += files[i].Warnings
+		out.Infos += files[i].Infos
+		if summary {
+			files[i].Diagnostics = []diagnostics.Diagnostic{}
+		}
+	}
+	writeJSON(w, out)
+}
+
+func (h *DiagnosticsHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "diagnostics check") {
+		return
+	}
+
+	var req DiagnosticsCheckRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	// Checks can outlast the server's write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(3 * time.Minute))
+	result, err := h.store.RunCheck(r.Context(), strings.TrimSpace(req.Check), req.Root)
+	if err != nil {
+		writeDiagnosticsError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// Stream pushes a "snapshot" event with the current diagnostics under
+// ?root=, then an "update" event per changed file, as server-sent events.
+// The stream ends if the client falls behind; EventSource reconnects and
+// receives a fresh snapshot.
+func (h *DiagnosticsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "diagnostics stream") {
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	root := r.URL.Query().Get("root")
+	sub := h.store.Subscribe(root)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	snapshot := h.store.Query(diagnostics.Filter{Root: root})
+	if err := writeSSE(w, controller, "snapshot", snapshot); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(diagnosticsHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, controller, "update", event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, controller *http.ResponseController, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return controller.Flush()
+}
+
+func writeDiagnosticsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		http.Error(w, "request canceled", http.StatusRequestTimeout)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "diagnostics check timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, diagnostics.ErrRootRequired):
+		http.Error(w, "workspace root is required", http.StatusBadRequest)
+	case errors.Is(err, diagnostics.ErrRootNotFound):
+		http.Error(w, "workspace root does not exist", http.StatusNotFound)
+	case errors.Is(err, diagnostics.ErrUnknownCheck):
+		http.Error(w, "unknown diagnostics check", http.StatusBadRequest)
+	case errors.Is(err, diagnostics.ErrCheckUnavailable):
+		http.Error(w, "diagnostics check tool is not installed", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "diagnostics operation failed", http.StatusInternalServerError)
+	}
+}
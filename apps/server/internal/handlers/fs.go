@@ -8,9 +8,12 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"local/monorepo/internal/changesets"
+	"local/monorepo/internal/diff"
 	fsservice "local/monorepo/internal/fs"
 )
 
@@ -18,6 +21,9 @@ const (
 	maxWriteRequestBodyBytes = 6 * 1024 * 1024
 	maxPathRequestBodyBytes  = 128 * 1024
 	maxWorkspaceRequestBytes = 256 * 1024
+	maxBatchRequestBodyBytes = 40 * 1024 * 1024
+	// defaultPatchFuzz matches the default fuzz factor of patch(1).
+	defaultPatchFuzz = 2
 )
 
 type FSStatResponse struct {
@@ -26,6 +32,8 @@ type FSStatResponse struct {
 	Size    int64     `json:"size,omitempty"`
 	IsDir   bool      `json:"isDir"`
 	ModTime time.Time `json:"modTime,omitempty"`
+	// ChangesetID is set when the write was staged instead of applied.
+	ChangesetID string `json:"changesetId,omitempty"`
 }
 
 type FSListEntry struct {
@@ -36,9 +44,14 @@ type FSListEntry struct {
 }
 
 type FSReadResponse struct {
-	Path    string `json:"path"`
-	Size    int64  `json:"size"`
-	Content string `json:"content"`
+	Path             string `json:"path"`
+	Size             int64  `json:"size"`
+	Content          string `json:"content"`
+	Encoding         string `json:"encoding,omitempty"`
+	LineEnding       string `json:"lineEnding,omitempty"`
+	MixedLineEndings bool   `json:"mixedLineEndings,omitempty"`
+	TrailingNewline  bool   `json:"trailingNewline"`
+	ChangesetID      string `json:"changesetId,omitempty"`
 }
 
 type WorkspaceOpenRequest struct {
@@ -49,15 +62,99 @@ type WorkspaceOpenResponse struct {
 	Paths []FSStatResponse `json:"paths"`
 }
 
+type WorkspaceRootResponse struct {
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	OpenedAt time.Time `json:"openedAt"`
+}
+
+type FSHistoryVersionResponse struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type FSBatchOp struct {
+	Op        string `json:"op"`
+	Path      string `json:"path"`
+	NewPath   string `json:"newPath,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsDir     bool   `json:"isDir,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+type FSBatchRequest struct {
+	Ops []FSBatchOp `json:"ops"`
+}
+
+type FSBatchResult struct {
+	Op      string          `json:"op"`
+	Path    string          `json:"path"`
+	NewPath string          `json:"newPath,omitempty"`
+	Status  string          `json:"status"`
+	Stat    *FSStatResponse `json:"stat,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type FSBatchResponse struct {
+	Applied bool            `json:"applied"`
+	Results []FSBatchResult `json:"results"`
+}
+
+type FSPatchEdit struct {
+	Start       *diff.Position `json:"start,omitempty"`
+	End         *diff.Position `json:"end,omitempty"`
+	StartOffset *int           `json:"startOffset,omitempty"`
+	EndOffset   *int           `json:"endOffset,omitempty"`
+	OldText     *string        `json:"oldText,omitempty"`
+	NewText     string         `json:"newText"`
+}
+
+type FSPatchFile struct {
+	Path  string        `json:"path"`
+	Diff  string        `json:"diff,omitempty"`
+	Edits []FSPatchEdit `json:"edits,omitempty"`
+}
+
+type FSPatchRequest struct {
+	Root   string        `json:"root"`
+	Diff   string        `json:"diff"`
+	Files  []FSPatchFile `json:"files"`
+	Fuzz   *int          `json:"fuzz,omitempty"`
+	DryRun bool          `json:"dryRun"`
+}
+
+type FSPatchedFile struct {
+	Path     string            `json:"path"`
+	Status   string            `json:"status"`
+	Content  string            `json:"content"`
+	Hunks    []diff.HunkResult `json:"hunks,omitempty"`
+	Rejected []diff.Hunk       `json:"rejected,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type FSPatchResponse struct {
+	Applied bool            `json:"applied"`
+	DryRun  bool            `json:"dryRun,omitempty"`
+	Files   []FSPatchedFile `json:"files"`
+}
+
 type FSHandler struct {
 	service *fsservice.Service
+	// changesets stages writes and deletes that carry a changesetId.
+	changesets *changesets.Manager
 }
 
-func NewFSHandler(service *fsservice.Service) *FSHandler {
+func NewFSHandler(service *fsservice.Service, changesetManager *changesets.Manager) *FSHandler {
 	if service == nil {
 		service = fsservice.NewService(fsservice.DefaultConfig())
 	}
-	return &FSHandler{service: service}
+	return &FSHandler{service: service, changesets: changesetManager}
 }
 
 func (h *FSHandler) Stat(w http.ResponseWriter, r *http.Request) {
@@ -102,16 +199,42 @@ func (h *FSHandler) Read(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.service.ReadText(r.Context(), r.URL.Query().Get("path"))
+	path := r.URL.Query().Get("path")
+	if changesetID := strings.TrimSpace(r.URL.Query().Get("changesetId")); changesetID != "" && h.changesets != nil {
+		content, staged, deleted, err := h.changesets.Read(changesetID, path)
+		if err != nil {
+			writeChangesetError(w, err)
+			return
+		}
+		if deleted {
+			writeFSError(w, fsservice.ErrPathNotFound)
+			return
+		}
+		if staged {
+			writeJSON(w, FSReadResponse{
+				Path:        filepath.Clean(path),
+				Size:        int64(len(content)),
+				Content:     content,
+				ChangesetID: changesetID,
+			})
+			return
+		}
+	}
+
+	result, err := h.service.ReadText(r.Context(), path)
 	if err != nil {
 		writeFSError(w, err)
 		return
 	}
 
 	writeJSON(w, FSReadResponse{
-		Path:    result.Path,
-		Size:    result.Size,
-		Content: result.Content,
+		Path:             result.Path,
+		Size:             result.Size,
+		Content:          result.Content,
+		Encoding:         result.Format.Encoding,
+		LineEnding:       result.Format.LineEnding,
+		MixedLineEndings: result.Format.MixedLineEndings,
+		TrailingNewline:  result.Format.TrailingNewline,
 	})
 }
 
@@ -121,14 +244,43 @@ func (h *FSHandler) Write(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path        string `json:"path"`
+		Content     string `json:"content"`
+		ChangesetID string `json:"changesetId"`
+		// Encoding, LineEnding and TrailingNewline convert the file on
+		// write; when omitted the existing file's format is kept.
+		Encoding        string `json:"encoding"`
+		LineEnding      string `json:"lineEnding"`
+		TrailingNewline *bool  `json:"trailingNewline"`
 	}
 	if !decodeJSONBody(w, r, &req, maxWriteRequestBodyBytes) {
 		return
 	}
 
-	result, err := h.service.WriteText(r.Context(), req.Path, req.Content)
+	if changesetID := strings.TrimSpace(req.ChangesetID); changesetID != "" {
+		if h.changesets == nil {
+			http.Error(w, "changesets are not available", http.StatusServiceUnavailable)
+			return
+		}
+		change, err := h.changesets.StageWrite(r.Context(), changesetID, req.Path, req.Content)
+		if err != nil {
+			writeChangesetError(w, err)
+			return
+		}
+		writeJSON(w, FSStatResponse{
+			Path:        change.Path,
+			Exists:      true,
+			Size:        int64(len(req.Content)),
+			ChangesetID: changesetID,
+		})
+		return
+	}
+
+	result, err := h.service.WriteTextWith(r.Context(), req.Path, req.Content, fsservice.WriteOptions{
+		Encoding:        req.Encoding,
+		LineEnding:      req.LineEnding,
+		TrailingNewline: req.TrailingNewline,
+	})
 	if err != nil {
 		writeFSError(w, err)
 		return
@@ -165,13 +317,27 @@ func (h *FSHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Path      string `json:"path"`
-		Recursive bool   `json:"recursive"`
+		Path        string `json:"path"`
+		Recursive   bool   `json:"recursive"`
+		ChangesetID string `json:"changesetId"`
 	}
 	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
 		return
 	}
 
+	if changesetID := strings.TrimSpace(req.ChangesetID); changesetID != "" {
+		if h.changesets == nil {
+			http.Error(w, "changesets are not available", http.StatusServiceUnavailable)
+			return
+		}
+		if _, err := h.changesets.StageDelete(r.Context(), changesetID, req.Path); err != nil {
+			writeChangesetError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	if err := h.service.Delete(r.Context(), req.Path, req.Recursive); err != nil {
 		writeFSError(w, err)
 		return
@@ -180,6 +346,170 @@ func (h *FSHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *FSHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "fs batch") {
+		return
+	}
+
+	var req FSBatchRequest
+	if !decodeJSONBody(w, r, &req, maxBatchRequestBodyBytes) {
+		return
+	}
+
+	ops := make([]fsservice.BatchOp, 0, len(req.Ops))
+	for _, op := range req.Ops {
+		ops = append(ops, fsservice.BatchOp{
+			Op:        op.Op,
+			Path:      op.Path,
+			NewPath:   op.NewPath,
+			Content:   op.Content,
+			IsDir:     op.IsDir,
+			Recursive: op.Recursive,
+			Overwrite: op.Overwrite,
+		})
+	}
+
+	results, err := h.service.Batch(r.Context(), ops)
+	if results == nil {
+		writeFSError(w, err)
+		return
+	}
+
+	out := FSBatchResponse{Applied: err == nil, Results: make([]FSBatchResult, 0, len(results))}
+	for _, result := range results {
+		item := FSBatchResult{
+			Op:      result.Op,
+			Path:    result.Path,
+			NewPath: result.NewPath,
+			Status:  result.Status,
+		}
+		if result.Status == fsservice.BatchStatusApplied {
+			stat := toFSStatResponse(result.Stat)
+			item.Stat = &stat
+		}
+		if result.Err != nil {
+			_, item.Error = fsErrorStatus(result.Err)
+		}
+		out.Results = append(out.Results, item)
+	}
+
+	if err != nil {
+		status, _ := fsErrorStatus(err)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (h *FSHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "fs patch") {
+		return
+	}
+
+	var req FSPatchRequest
+	if !decodeJSONBody(w, r, &req, maxWriteRequestBodyBytes) {
+		return
+	}
+
+	patch := fsservice.PatchRequest{Root: req.Root, Diff: req.Diff, MaxFuzz: defaultPatchFuzz, DryRun: req.DryRun}
+	if req.Fuzz != nil {
+		patch.MaxFuzz = *req.Fuzz
+	}
+	for _, file := range req.Files {
+		edits := make([]diff.Edit, 0, len(file.Edits))
+		for _, edit := range file.Edits {
+			edits = append(edits, diff.Edit{
+				Start:       edit.Start,
+				End:         edit.End,
+				StartOffset: edit.StartOffset,
+				EndOffset:   edit.EndOffset,
+				OldText:     edit.OldText,
+				NewText:     edit.NewText,
+			})
+		}
+		patch.Files = append(patch.Files, fsservice.PatchFile{Path: file.Path, Diff: file.Diff, Edits: edits})
+	}
+
+	result, err := h.service.Patch(r.Context(), patch)
+	if err != nil && result.Files == nil {
+		writeFSError(w, err)
+		return
+	}
+
+	out := FSPatchResponse{Applied: err == nil, DryRun: req.DryRun, Files: make([]FSPatchedFile, 0, len(result.Files))}
+	for _, file := range result.Files {
+		item := FSPatchedFile{
+			Path:     file.Path,
+			Status:   file.Status,
+			Content:  file.Content,
+			Hunks:    file.Hunks,
+			Rejected: file.Rejected,
+		}
+		if file.Err != nil {
+			item.Error = file.Err.Error()
+		}
+		out.Files = append(out.Files, item)
+	}
+
+	if err != nil {
+		status, _ := fsErrorStatus(err)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (h *FSHandler) History(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "fs history") {
+		return
+	}
+
+	versions, err := h.service.History(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	out := make([]FSHistoryVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		out = append(out, FSHistoryVersionResponse{
+			ID:        version.ID,
+			Path:      version.Path,
+			Hash:      version.Hash,
+			Size:      version.Size,
+			Reason:    version.Reason,
+			CreatedAt: version.CreatedAt,
+		})
+	}
+	writeJSON(w, out)
+}
+
+func (h *FSHandler) RestoreHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "fs history restore") {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+		ID   string `json:"id"`
+	}
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	result, err := h.service.RestoreHistory(r.Context(), req.Path, req.ID)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	writeJSON(w, toFSStatResponse(result))
+}
+
 func (h *FSHandler) WorkspaceOpen(w http.ResponseWriter, r *http.Request) {
 	if !requireFSAccess(w, r, http.MethodPost, "workspace open") {
 		return
@@ -203,6 +533,24 @@ func (h *FSHandler) WorkspaceOpen(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, WorkspaceOpenResponse{Paths: out})
 }
 
+func (h *FSHandler) Workspaces(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "workspace list") {
+		return
+	}
+
+	roots := h.service.WorkspaceRoots()
+	out := make([]WorkspaceRootResponse, 0, len(roots))
+	for _, root := range roots {
+		out = append(out, WorkspaceRootResponse{
+			Path:     root.Path,
+			Name:     root.Name,
+			Kind:     root.Kind,
+			OpenedAt: root.OpenedAt,
+		})
+	}
+	writeJSON(w, out)
+}
+
 func toFSStatResponse(stat fsservice.StatResult) FSStatResponse {
 	return FSStatResponse{
 		Path:    stat.Path,
@@ -268,37 +616,61 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, into interface{}, ma
 }
 
 func writeFSError(w http.ResponseWriter, err error) {
+	status, message := fsErrorStatus(err)
+	http.Error(w, message, status)
+}
+
+// fsErrorStatus maps a filesystem error to an HTTP status and a message that
+// is safe to show to the client.
+func fsErrorStatus(err error) (int, string) {
 	switch {
 	case errors.Is(err, context.Canceled):
-		http.Error(w, "request canceled", http.StatusRequestTimeout)
+		return http.StatusRequestTimeout, "request canceled"
 	case errors.Is(err, context.DeadlineExceeded):
-		http.Error(w, "request timed out", http.StatusRequestTimeout)
+		return http.StatusRequestTimeout, "request timed out"
 	case errors.Is(err, fsservice.ErrPathRequired), errors.Is(err, fsservice.ErrInvalidPath):
-		http.Error(w, "invalid path", http.StatusBadRequest)
+		return http.StatusBadRequest, "invalid path"
 	case errors.Is(err, fsservice.ErrPathNotFound):
-		http.Error(w, "path does not exist", http.StatusNotFound)
+		return http.StatusNotFound, "path does not exist"
 	case errors.Is(err, fsservice.ErrPathNotDirectory):
-		http.Error(w, "path is not a directory", http.StatusBadRequest)
+		return http.StatusBadRequest, "path is not a directory"
 	case errors.Is(err, fsservice.ErrPathIsDirectory):
-		http.Error(w, "path is a directory", http.StatusBadRequest)
+		return http.StatusBadRequest, "path is a directory"
 	case errors.Is(err, fsservice.ErrDirectoryNeedsRecursive):
-		http.Error(w, "directory delete requires recursive=true", http.StatusConflict)
+		return http.StatusConflict, "directory delete requires recursive=true"
 	case errors.Is(err, fsservice.ErrFileTooLarge):
-		http.Error(w, "file too large to read", http.StatusRequestEntityTooLarge)
+		return http.StatusRequestEntityTooLarge, "file too large to read"
 	case errors.Is(err, fsservice.ErrContentTooLarge):
-		http.Error(w, "content too large", http.StatusRequestEntityTooLarge)
+		return http.StatusRequestEntityTooLarge, "content too large"
 	case errors.Is(err, fsservice.ErrBinaryFile), errors.Is(err, fsservice.ErrUnsupportedFileType):
-		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+		return http.StatusUnsupportedMediaType, "unsupported file type"
 	case errors.Is(err, fsservice.ErrRefuseFilesystemRoot):
-		http.Error(w, "refusing to mutate filesystem root", http.StatusBadRequest)
+		return http.StatusBadRequest, "refusing to mutate filesystem root"
 	case errors.Is(err, fsservice.ErrFileAlreadyExists):
-		http.Error(w, "file already exists", http.StatusConflict)
+		return http.StatusConflict, "file already exists"
 	case errors.Is(err, fsservice.ErrNoWorkspacePaths):
-		http.Error(w, "no paths provided", http.StatusBadRequest)
+		return http.StatusBadRequest, "no paths provided"
 	case errors.Is(err, fsservice.ErrTooManyWorkspacePaths):
-		http.Error(w, "too many paths provided", http.StatusBadRequest)
+		return http.StatusBadRequest, "too many paths provided"
+	case errors.Is(err, fsservice.ErrHistoryVersionNotFound):
+		return http.StatusNotFound, "history version not found"
+	case errors.Is(err, fsservice.ErrEmptyBatch), errors.Is(err, fsservice.ErrTooManyBatchOps),
+		errors.Is(err, fsservice.ErrInvalidBatchOp), errors.Is(err, fsservice.ErrRenameIntoItself):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, fsservice.ErrUnknownEncoding), errors.Is(err, fsservice.ErrUnknownLineEnding):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, fsservice.ErrUnencodable):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, fsservice.ErrInvalidPatch):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, fsservice.ErrSearchQueryRequired), errors.Is(err, fsservice.ErrInvalidSearchQuery):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, fsservice.ErrPatchRejected):
+		return http.StatusConflict, "patch does not apply"
+	case errors.Is(err, fsservice.ErrHistoryDisabled):
+		return http.StatusServiceUnavailable, "local history is disabled"
 	default:
-		http.Error(w, "filesystem operation failed", http.StatusInternalServerError)
+		return http.StatusInternalServerError, "filesystem operation failed"
 	}
 }
 
@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	fsservice "local/monorepo/internal/fs"
+	"local/monorepo/internal/git"
+)
+
+type GitBranchCreateRequest struct {
+	Root       string `json:"root"`
+	Name       string `json:"name"`
+	StartPoint string `json:"startPoint"`
+	Checkout   bool   `json:"checkout"`
+}
+
+type GitSwitchRequest struct {
+	Root   string `json:"root"`
+	Branch string `json:"branch"`
+	Detach bool   `json:"detach"`
+}
+
+type GitStageRequest struct {
+	Root  string   `json:"root"`
+	Paths []string `json:"paths"`
+	// Hunks selects hunk indexes from /v1/git/diff; it requires exactly one path.
+	Hunks []int `json:"hunks,omitempty"`
+}
+
+type GitCommitRequest struct {
+	Root          string      `json:"root"`
+	Message       string      `json:"message"`
+	Author        *git.Author `json:"author,omitempty"`
+	Amend         bool        `json:"amend"`
+	AllowEmpty    bool        `json:"allowEmpty"`
+	AllowDetached bool        `json:"allowDetached"`
+	NoVerify      bool        `json:"noVerify"`
+}
+
+type GitStashRequest struct {
+	Root             string `json:"root"`
+	Action           string `json:"action"`
+	Message          string `json:"message"`
+	IncludeUntracked bool   `json:"includeUntracked"`
+	Index            int    `json:"index"`
+}
+
+type GitWorktreeCreateRequest struct {
+	Root       string `json:"root"`
+	Name       string `json:"name"`
+	Branch     string `json:"branch"`
+	StartPoint string `json:"startPoint"`
+}
+
+type GitWorktreeRemoveRequest struct {
+	Root         string `json:"root"`
+	Path         string `json:"path"`
+	Force        bool   `json:"force"`
+	DeleteBranch bool   `json:"deleteBranch"`
+}
+
+type GitWorktreeMergeRequest struct {
+	Root         string `json:"root"`
+	Path         string `json:"path"`
+	Message      string `json:"message"`
+	Squash       bool   `json:"squash"`
+	Remove       bool   `json:"remove"`
+	DeleteBranch bool   `json:"deleteBranch"`
+	NoVerify     bool   `json:"noVerify"`
+}
+
+type GitRootRequest struct {
+	Root string `json:"root"`
+}
+
+type GitShowResponse struct {
+	Path     string `json:"path"`
+	Revision string `json:"revision"`
+	Blob     string `json:"blob"`
+	Size     int64  `json:"size"`
+	Content  string `json:"content"`
+}
+
+type GitConflictResolveRequest struct {
+	Path    string           `json:"path"`
+	Content *string          `json:"content,omitempty"`
+	Side    string           `json:"side,omitempty"`
+	Hunks   []git.HunkChoice `json:"hunks,omitempty"`
+}
+
+type GitErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+type GitHandler struct {
+	service *git.Service
+	// workspaces registers worktrees as workspace roots.
+	workspaces *fsservice.Service
+}
+
+func NewGitHandler(service *git.Service, workspaces *fsservice.Service) *GitHandler {
+	if service == nil {
+		service = git.NewService(git.DefaultConfig())
+	}
+	if workspaces == nil {
+		workspaces = fsservice.NewService(fsservice.DefaultConfig())
+	}
+	return &GitHandler{service: service, workspaces: workspaces}
+}
+
+func (h *GitHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git status") {
+		return
+	}
+
+	status, err := h.service.Status(r.Context(), r.URL.Query().Get("root"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (h *GitHandler) Branches(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git branches") {
+		return
+	}
+
+	branches, err := h.service.Branches(r.Context(), r.URL.Query().Get("root"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, branches)
+}
+
+func (h *GitHandler) CreateBranch(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git branch create") {
+		return
+	}
+
+	var req GitBranchCreateRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	branch, err := h.service.CreateBranch(r.Context(), req.Root, git.CreateBranchOptions{
+		Name:       strings.TrimSpace(req.Name),
+		StartPoint: req.StartPoint,
+		Checkout:   req.Checkout,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, branch)
+}
+
+func (h *GitHandler) Switch(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git switch") {
+		return
+	}
+
+	var req GitSwitchRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	status, err := h.service.Switch(r.Context(), req.Root, git.SwitchOptions{
+		Branch: req.Branch,
+		Detach: req.Detach,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (h *GitHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git diff") {
+		return
+	}
+
+	query := r.URL.Query()
+	staged, _ := strconv.ParseBool(query.Get("staged"))
+	diff, err := h.service.Diff(r.Context(), query.Get("root"), query.Get("path"), staged)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, diff)
+}
+
+func (h *GitHandler) Stage(w http.ResponseWriter, r *http.Request) {
+	h.handleStage(w, r, "git stage", false)
+}
+
+func (h *GitHandler) Unstage(w http.ResponseWriter, r *http.Request) {
+	h.handleStage(w, r, "git unstage", true)
+}
+
+func (h *GitHandler) handleStage(w http.ResponseWriter, r *http.Request, operation string, unstage bool) {
+	if !requireFSAccess(w, r, http.MethodPost, operation) {
+		return
+	}
+
+	var req GitStageRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	var (
+		status git.Status
+		err    error
+	)
+	switch {
+	case len(req.Hunks) > 0 && len(req.Paths) != 1:
+		writeGitError(w, git.ErrInvalidArgument)
+		return
+	case len(req.Hunks) > 0 && unstage:
+		status, err = h.service.UnstageHunks(r.Context(), req.Root, req.Paths[0], req.Hunks)
+	case len(req.Hunks) > 0:
+		status, err = h.service.StageHunks(r.Context(), req.Root, req.Paths[0], req.Hunks)
+	case unstage:
+		status, err = h.service.Unstage(r.Context(), req.Root, req.Paths)
+	default:
+		status, err = h.service.Stage(r.Context(), req.Root, req.Paths)
+	}
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (h *GitHandler) Commit(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git commit") {
+		return
+	}
+
+	var req GitCommitRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	commit, err := h.service.Commit(r.Context(), req.Root, git.CommitOptions{
+		Message:       req.Message,
+		Author:        req.Author,
+		Amend:         req.Amend,
+		AllowEmpty:    req.AllowEmpty,
+		AllowDetached: req.AllowDetached,
+		NoVerify:      req.NoVerify,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, commit)
+}
+
+func (h *GitHandler) Stash(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git stash") {
+		return
+	}
+
+	var req GitStashRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	stashes, err := h.service.Stash(r.Context(), req.Root, git.StashOptions{
+		Action:           strings.TrimSpace(req.Action),
+		Message:          req.Message,
+		IncludeUntracked: req.IncludeUntracked,
+		Index:            req.Index,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, stashes)
+}
+
+func (h *GitHandler) Log(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git log") {
+		return
+	}
+
+	query := r.URL.Query()
+	skip, ok := parseOptionalInt(query.Get("skip"))
+	if !ok {
+		http.Error(w, "invalid skip", http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseOptionalInt(query.Get("limit"))
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	root := query.Get("root")
+	if strings.TrimSpace(root) == "" {
+		root = query.Get("path")
+	}
+	page, err := h.service.Log(r.Context(), root, git.LogOptions{
+		Revision: query.Get("rev"),
+		Path:     query.Get("path"),
+		Skip:     skip,
+		Limit:    limit,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, page)
+}
+
+func (h *GitHandler) Blame(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git blame") {
+		return
+	}
+
+	query := r.URL.Query()
+	blame, err := h.service.Blame(r.Context(), query.Get("path"), query.Get("rev"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, blame)
+}
+
+// Show returns a file at a revision, decoded with the same rules as
+// /v1/fs/read so binary and oversized files fail the same way.
+func (h *GitHandler) Show(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git show") {
+		return
+	}
+
+	query := r.URL.Query()
+	file, err := h.service.Show(r.Context(), query.Get("path"), query.Get("rev"), h.workspaces.MaxReadFileBytes())
+	if err != nil {
+		if errors.Is(err, git.ErrObjectTooLarge) {
+			writeFSError(w, fsservice.ErrFileTooLarge)
+			return
+		}
+		writeGitError(w, err)
+		return
+	}
+
+	text, err := h.workspaces.DecodeText(file.Path, file.Content)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	writeJSON(w, GitShowResponse{
+		Path:     text.Path,
+		Revision: file.Revision,
+		Blob:     file.Blob,
+		Size:     text.Size,
+		Content:  text.Content,
+	})
+}
+
+func (h *GitHandler) Conflicts(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git conflicts") {
+		return
+	}
+
+	conflicts, err := h.service.Conflicts(r.Context(), r.URL.Query().Get("root"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, conflicts)
+}
+
+func (h *GitHandler) Conflict(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git conflict") {
+		return
+	}
+
+	detail, err := h.service.Conflict(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (h *GitHandler) ResolveConflict(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git conflict resolve") {
+		return
+	}
+
+	var req GitConflictResolveRequest
+	if !decodeJSONBody(w, r, &req, maxWriteRequestBodyBytes) {
+		return
+	}
+
+	var writeErr error
+	write := func(ctx context.Context, path, content string) error {
+		_, writeErr = h.workspaces.WriteText(ctx, path, content)
+		return writeErr
+	}
+	status, err := h.service.ResolveConflict(r.Context(), req.Path, git.ConflictResolution{
+		Content: req.Content,
+		Side:    strings.TrimSpace(req.Side),
+		Hunks:   req.Hunks,
+	}, write)
+	if err != nil {
+		if writeErr != nil {
+			writeFSError(w, writeErr)
+			return
+		}
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (h *GitHandler) Worktrees(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git worktrees") {
+		return
+	}
+
+	worktrees, err := h.service.Worktrees(r.Context(), r.URL.Query().Get("root"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, worktrees)
+}
+
+func (h *GitHandler) CreateWorktree(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git worktree create") {
+		return
+	}
+
+	var req GitWorktreeCreateRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	worktree, err := h.service.CreateWorktree(r.Context(), req.Root, git.CreateWorktreeOptions{
+		Name:       req.Name,
+		Branch:     req.Branch,
+		StartPoint: req.StartPoint,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	h.workspaces.RegisterWorkspaceRoot(worktree.Path, fsservice.WorkspaceRootWorktree)
+	writeJSON(w, worktree)
+}
+
+func (h *GitHandler) RemoveWorktree(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git worktree remove") {
+		return
+	}
+
+	var req GitWorktreeRemoveRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	err := h.service.RemoveWorktree(r.Context(), req.Root, req.Path, git.RemoveWorktreeOptions{
+		Force:        req.Force,
+		DeleteBranch: req.DeleteBranch,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	if path, err := filepath.Abs(filepath.Clean(req.Path)); err == nil {
+		h.workspaces.UnregisterWorkspaceRoot(path)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GitHandler) PruneWorktrees(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git worktree prune") {
+		return
+	}
+
+	var req GitRootRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	worktrees, err := h.service.PruneWorktrees(r.Context(), req.Root)
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+
+	live := map[string]bool{}
+	for _, worktree := range worktrees {
+		live[worktree.Path] = true
+	}
+	// only roots of this repository; other repositories' worktrees are not
+	// in its list
+	for _, root := range h.workspaces.WorkspaceRoots() {
+		if root.Kind != fsservice.WorkspaceRootWorktree || live[root.Path] {
+			continue
+		}
+		if owned, err := h.service.OwnsWorktree(r.Context(), req.Root, root.Path); err == nil && owned {
+			h.workspaces.UnregisterWorkspaceRoot(root.Path)
+		}
+	}
+	writeJSON(w, worktrees)
+}
+
+func (h *GitHandler) WorktreeDiff(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "git worktree diff") {
+		return
+	}
+
+	diff, err := h.service.WorktreeDiff(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, diff)
+}
+
+func (h *GitHandler) MergeWorktree(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "git worktree merge") {
+		return
+	}
+
+	var req GitWorktreeMergeRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	result, err := h.service.MergeWorktree(r.Context(), req.Root, req.Path, git.MergeWorktreeOptions{
+		Message:      req.Message,
+		Squash:       req.Squash,
+		Remove:       req.Remove,
+		DeleteBranch: req.DeleteBranch,
+		NoVerify:     req.NoVerify,
+	})
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	if result.Removed {
+		if path, err := filepath.Abs(filepath.Clean(req.Path)); err == nil {
+			h.workspaces.UnregisterWorkspaceRoot(path)
+		}
+	}
+	writeJSON(w, result)
+}
+
+func parseOptionalInt(raw string) (int, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return value, true
+}
+
+// writeGitError reports failures as JSON so the renderer can branch on code
+// (for example to offer a stash when a switch hits a dirty tree).
+func writeGitError(w http.ResponseWriter, err error) {
+	status, code := http.StatusInternalServerError, "git_failed"
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		status, code = http.StatusRequestTimeout, "canceled"
+	case errors.Is(err, git.ErrGitUnavailable):
+		status, code = http.StatusServiceUnavailable, "git_unavailable"
+	case errors.Is(err, git.ErrRootRequired), errors.Is(err, git.ErrInvalidArgument):
+		status, code = http.StatusBadRequest, "invalid_argument"
+	case errors.Is(err, git.ErrPathOutsideRepo):
+		status, code = http.StatusBadRequest, "path_outside_repo"
+	case errors.Is(err, git.ErrNotRepository):
+		status, code = http.StatusNotFound, "not_repository"
+	case errors.Is(err, git.ErrRevisionNotFound):
+		status, code = http.StatusNotFound, "revision_not_found"
+	case errors.Is(err, git.ErrHunkNotFound):
+		status, code = http.StatusNotFound, "hunk_not_found"
+	case errors.Is(err, git.ErrPathNotTracked):
+		status, code = http.StatusNotFound, "path_not_tracked"
+	case errors.Is(err, git.ErrWorktreeNotFound):
+		status, code = http.StatusNotFound, "worktree_not_found"
+	case errors.Is(err, git.ErrWorktreeExists):
+		status, code = http.StatusConflict, "worktree_exists"
+	case errors.Is(err, git.ErrConflict):
+		status, code = http.StatusConflict, "conflict"
+	case errors.Is(err, git.ErrDirtyTree):
+		status, code = http.StatusConflict, "dirty_tree"
+	case errors.Is(err, git.ErrDetachedHead):
+		status, code = http.StatusConflict, "detached_head"
+	case errors.Is(err, git.ErrBranchExists):
+		status, code = http.StatusConflict, "branch_exists"
+	case errors.Is(err, git.ErrNothingToCommit):
+		status, code = http.StatusConflict, "nothing_to_commit"
+	}
+
+	response := GitErrorResponse{Code: code, Message: err.Error()}
+	var cmdErr *git.CommandError
+	if errors.As(err, &cmdErr) {
+		response.Details = strings.TrimSpace(cmdErr.Stderr)
+		if cmdErr.Kind != nil {
+			response.Message = cmdErr.Kind.Error()
+		}
+	}
+	if status == http.StatusInternalServerError && response.Details == "" {
+		response.Message = "git operation failed"
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"local/monorepo/internal/index"
+)
+
+type IndexQueryRequest struct {
+	Workspace string   `json:"workspace"`
+	Query     string   `json:"query"`
+	Limit     int      `json:"limit,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+}
+
+type IndexRefreshRequest struct {
+	Workspace string `json:"workspace"`
+	Rebuild   bool   `json:"rebuild,omitempty"`
+}
+
+type IndexHandler struct {
+	index *index.Index
+}
+
+func NewIndexHandler(ix *index.Index) *IndexHandler {
+	return &IndexHandler{index: ix}
+}
+
+// Query returns the workspace chunks most similar to a natural-language or
+// code query, with their paths, line ranges and current content. The first
+// query of a workspace starts indexing it.
+func (h *IndexHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "index query") {
+		return
+	}
+
+	var req IndexQueryRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	result, err := h.index.Query(r.Context(), index.QueryRequest{
+		Workspace: req.Workspace,
+		Query:     req.Query,
+		Limit:     req.Limit,
+		Paths:     req.Paths,
+	})
+	if err != nil {
+		writeIndexError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// Status reports how much of a workspace is indexed and whether an update
+// is running.
+func (h *IndexHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "index status") {
+		return
+	}
+
+	status, err := h.index.Status(r.URL.Query().Get("workspace"))
+	if err != nil {
+		writeIndexError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// Refresh starts a rescan of a workspace, or a rebuild from scratch, and
+// returns without waiting for it.
+func (h *IndexHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "index refresh") {
+		return
+	}
+
+	var req IndexRefreshRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	status, err := h.index.Refresh(req.Workspace, req.Rebuild)
+	if err != nil {
+		writeIndexError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func writeIndexError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		http.Error(w, "request canceled", http.StatusRequestTimeout)
+	case errors.Is(err, index.ErrWorkspaceRequired), errors.Is(err, index.ErrQueryRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, index.ErrWorkspaceNotFound):
+		http.Error(w, "workspace does not exist", http.StatusNotFound)
+	case errors.Is(err, index.ErrEmbedderConfig):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, index.ErrEmbedFailed):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		status, message := fsErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			message = "index operation failed"
+		}
+		http.Error(w, message, status)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"local/monorepo/internal/llm"
+)
+
+type LLMHandler struct {
+	registry *llm.Registry
+}
+
+func NewLLMHandler(registry *llm.Registry) *LLMHandler {
+	if registry == nil {
+		registry = llm.NewRegistry(llm.DefaultConfig())
+	}
+	return &LLMHandler{registry: registry}
+}
+
+// Providers lists configured model providers. Keys stay on the server; the
+// renderer only learns whether one is available and where it came from.
+func (h *LLMHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "llm providers") {
+		return
+	}
+	writeJSON(w, h.registry.List())
+}
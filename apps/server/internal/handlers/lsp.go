@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"local/monorepo/internal/lsp"
+)
+
+const lspReadLimit = 64 * 1024 * 1024
+
+var lspUpgrader = websocket.Upgrader{
+	ReadBufferSize:    64 * 1024,
+	WriteBufferSize:   64 * 1024,
+	EnableCompression: true,
+	CheckOrigin: func(r *http.Request) bool {
+		return isAllowedTerminalOrigin(r.Header.Get("Origin"))
+	},
+}
+
+type LSPHandler struct {
+	manager *lsp.Manager
+}
+
+func NewLSPHandler(manager *lsp.Manager) *LSPHandler {
+	if manager == nil {
+		manager = lsp.NewManager(lsp.DefaultServers())
+	}
+	return &LSPHandler{manager: manager}
+}
+
+func (h *LSPHandler) Servers(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "lsp servers") {
+		return
+	}
+	writeJSON(w, h.manager.Status())
+}
+
+type lspSocketWriter struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (w *lspSocketWriter) writeMessage(messageType int, payload []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(terminalWriteTimeout)); err != nil {
+		return err
+	}
+	return w.conn.WriteMessage(messageType, payload)
+}
+
+// WebSocket bridges one editor tab to the shared language server for
+// ?lang= (a language ID or file extension) and ?root=. Every text frame
+// carries exactly one JSON-RPC message in each direction.
+func (h *LSPHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "lsp websocket") {
+		return
+	}
+
+	query := r.URL.Query()
+	client, err := h.manager.Attach(query.Get("lang"), query.Get("root"))
+	if err != nil {
+		writeLSPError(w, err)
+		return
+	}
+	defer client.Close()
+
+	conn, err := lspUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(lspReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+	conn.SetPongHandler(func(_ string) error {
+		return conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+	})
+
+	writer := &lspSocketWriter{conn: conn}
+	readErrCh := make(chan error, 1)
+	go func() {
+		for {
+			messageType, payload, err := conn.ReadMessage()
+			if err != nil {
+				readErrCh <- err
+				return
+			}
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			if err := client.Send(payload); err != nil {
+				readErrCh <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(terminalPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case payload := <-client.Messages():
+			if err := writer.writeMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := writer.writeMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-readErrCh:
+			return
+		case <-client.Done():
+			// Flush what the server said last, usually why it stopped.
+			for {
+				select {
+				case payload := <-client.Messages():
+					if err := writer.writeMessage(websocket.TextMessage, payload); err != nil {
+						return
+					}
+					continue
+				default:
+				}
+				break
+			}
+			_ = writer.writeMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "language server stopped"))
+			return
+		}
+	}
+}
+
+func writeLSPError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, lsp.ErrUnknownLanguage):
+		http.Error(w, "no language server configured for language", http.StatusNotFound)
+	case errors.Is(err, lsp.ErrRootRequired):
+		http.Error(w, "workspace root is required", http.StatusBadRequest)
+	case errors.Is(err, lsp.ErrRootNotFound):
+		http.Error(w, "workspace root does not exist", http.StatusNotFound)
+	case errors.Is(err, lsp.ErrServerUnavailable):
+		http.Error(w, "language server is not installed", http.StatusServiceUnavailable)
+	case errors.Is(err, lsp.ErrStartFailed):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, lsp.ErrClosed):
+		http.Error(w, "language server is shutting down", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "language server operation failed", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"local/monorepo/internal/agent"
+	"local/monorepo/internal/mcp"
+)
+
+const mcpSessionHeader = "Mcp-Session-Id"
+
+type MCPHandler struct {
+	server *mcp.Server
+}
+
+func NewMCPHandler(server *mcp.Server) *MCPHandler {
+	return &MCPHandler{server: server}
+}
+
+// Endpoint is the streamable HTTP transport of the MCP server. A POST
+// carries one JSON-RPC message or a batch and is answered with JSON; an
+// initialize request starts a session on the workspace query parameter,
+// or the only open workspace, and later requests name it in the
+// Mcp-Session-Id header. DELETE ends the session. The server sends no
+// requests of its own, so there is no GET stream.
+func (h *MCPHandler) Endpoint(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.post(w, r)
+	case http.MethodDelete:
+		if !requireFSAccess(w, r, http.MethodDelete, "mcp") {
+			return
+		}
+		if err := h.server.CloseSession(r.Header.Get(mcpSessionHeader)); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *MCPHandler) post(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "mcp") {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	msgs, batch, err := mcp.ParseMessages(body)
+	if err != nil {
+		writeMCP(w, http.StatusBadRequest, mcp.ParseErrorResponse(err))
+		return
+	}
+
+	var session *mcp.Session
+	initialize := false
+	for _, msg := range msgs {
+		if msg.Method == mcp.MethodInitialize {
+			initialize = true
+		}
+	}
+	if initialize {
+		if len(msgs) != 1 {
+			http.Error(w, "initialize must be sent on its own", http.StatusBadRequest)
+			return
+		}
+		session, err = h.server.OpenSession(r.URL.Query().Get("workspace"))
+		if err != nil {
+			writeMCPSessionError(w, err)
+			return
+		}
+		w.Header().Set(mcpSessionHeader, session.ID)
+	} else {
+		id := strings.TrimSpace(r.Header.Get(mcpSessionHeader))
+		if id == "" {
+			http.Error(w, "missing "+mcpSessionHeader+" header", http.StatusBadRequest)
+			return
+		}
+		session, err = h.server.Session(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	// Tool calls can wait on an approval and then run a long command, well
+	// past the server's write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	responses := h.server.HandleBatch(r.Context(), session, msgs)
+	switch {
+	case len(responses) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeMCP(w, http.StatusOK, responses)
+	default:
+		writeMCP(w, http.StatusOK, responses[0])
+	}
+}
+
+func writeMCP(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeMCPSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mcp.ErrWorkspaceRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, mcp.ErrWorkspaceNotOpen):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, agent.ErrWorkspaceNotFound):
+		http.Error(w, "workspace does not exist", http.StatusNotFound)
+	case errors.Is(err, agent.ErrUnsupportedMode):
+		http.Error(w, "mcp mode has no tools", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "mcp session failed", http.StatusInternalServerError)
+	}
+}
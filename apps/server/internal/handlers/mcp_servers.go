@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"local/monorepo/internal/mcp"
+)
+
+type MCPServerRequest struct {
+	Name string `json:"name"`
+}
+
+// MCPServersHandler reports and restarts the external MCP servers whose
+// tools the agent uses.
+type MCPServersHandler struct {
+	manager *mcp.Manager
+}
+
+func NewMCPServersHandler(manager *mcp.Manager) *MCPServersHandler {
+	return &MCPServersHandler{manager: manager}
+}
+
+func (h *MCPServersHandler) Servers(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "mcp servers") {
+		return
+	}
+	writeJSON(w, h.manager.Status())
+}
+
+func (h *MCPServersHandler) Restart(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "mcp server restart") {
+		return
+	}
+
+	var req MCPServerRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	if err := h.manager.Restart(strings.TrimSpace(req.Name)); err != nil {
+		switch {
+		case errors.Is(err, mcp.ErrServerNotFound):
+			http.Error(w, "mcp server not found", http.StatusNotFound)
+		case errors.Is(err, mcp.ErrServerDisabled):
+			http.Error(w, "mcp server is disabled", http.StatusConflict)
+		default:
+			http.Error(w, "mcp server restart failed", http.StatusServiceUnavailable)
+		}
+		return
+	}
+	writeJSON(w, h.manager.Status())
+}
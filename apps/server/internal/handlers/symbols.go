@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"local/monorepo/internal/symbols"
+)
+
+type SymbolsHandler struct {
+	table *symbols.Table
+}
+
+func NewSymbolsHandler(table *symbols.Table) *SymbolsHandler {
+	return &SymbolsHandler{table: table}
+}
+
+// Document returns the nested outline of one file.
+func (h *SymbolsHandler) Document(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "symbols document") {
+		return
+	}
+
+	outline, err := h.table.Document(r.Context(), r.URL.Query().Get("path"))
+	if err != nil {
+		writeSymbolsError(w, err)
+		return
+	}
+	writeJSON(w, outline)
+}
+
+// Workspace fuzzy-matches q against the names of every symbol in a
+// workspace. An empty q lists symbols in path order up to the limit.
+func (h *SymbolsHandler) Workspace(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "symbols workspace") {
+		return
+	}
+
+	query := r.URL.Query()
+	limit, ok := parseOptionalInt(query.Get("limit"))
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.table.Search(r.Context(), query.Get("workspace"), query.Get("q"), limit)
+	if err != nil {
+		writeSymbolsError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func writeSymbolsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		http.Error(w, "request canceled", http.StatusRequestTimeout)
+	case errors.Is(err, symbols.ErrPathRequired), errors.Is(err, symbols.ErrWorkspaceRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, symbols.ErrWorkspaceNotFound):
+		http.Error(w, "workspace does not exist", http.StatusNotFound)
+	case errors.Is(err, symbols.ErrUnsupportedLanguage):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	default:
+		status, message := fsErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			message = "symbol lookup failed"
+		}
+		http.Error(w, message, status)
+	}
+}
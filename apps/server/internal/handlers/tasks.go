@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"local/monorepo/internal/tasks"
+)
+
+type TaskRunRequest struct {
+	Root string `json:"root"`
+	ID   string `json:"id"`
+}
+
+type TaskRunIDRequest struct {
+	ID string `json:"id"`
+}
+
+type TasksHandler struct {
+	manager *tasks.Manager
+}
+
+func NewTasksHandler(manager *tasks.Manager) *TasksHandler {
+	if manager == nil {
+		manager = tasks.NewManager(tasks.DefaultConfig())
+	}
+	return &TasksHandler{manager: manager}
+}
+
+func (h *TasksHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "tasks list") {
+		return
+	}
+
+	found, err := tasks.Discover(r.Context(), r.URL.Query().Get("root"))
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, found)
+}
+
+func (h *TasksHandler) Run(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "tasks run") {
+		return
+	}
+
+	var req TaskRunRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	run, err := h.manager.Start(r.Context(), req.Root, strings.TrimSpace(req.ID))
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+func (h *TasksHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "tasks runs") {
+		return
+	}
+
+	writeJSON(w, h.manager.List())
+}
+
+func (h *TasksHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "tasks status") {
+		return
+	}
+
+	run, err := h.manager.Get(r.URL.Query().Get("id"))
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+func (h *TasksHandler) Logs(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "tasks logs") {
+		return
+	}
+
+	var offset int64
+	if raw := strings.TrimSpace(r.URL.Query().Get("offset")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	chunk, err := h.manager.Logs(r.URL.Query().Get("id"), offset)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, chunk)
+}
+
+func (h *TasksHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "tasks cancel") {
+		return
+	}
+
+	var req TaskRunIDRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	run, err := h.manager.Cancel(req.ID)
+	if err != nil {
+		writeTaskError(w, err)
+		return
+	}
+	writeJSON(w, run)
+}
+
+func writeTaskError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		http.Error(w, "request canceled", http.StatusRequestTimeout)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "request timed out", http.StatusRequestTimeout)
+	case errors.Is(err, tasks.ErrRootRequired):
+		http.Error(w, "workspace root is required", http.StatusBadRequest)
+	case errors.Is(err, tasks.ErrRootNotFound):
+		http.Error(w, "workspace root does not exist", http.StatusNotFound)
+	case errors.Is(err, tasks.ErrTaskNotFound):
+		http.Error(w, "task not found", http.StatusNotFound)
+	case errors.Is(err, tasks.ErrRunNotFound):
+		http.Error(w, "task run not found", http.StatusNotFound)
+	case errors.Is(err, tasks.ErrRunFinished):
+		http.Error(w, "task run already finished", http.StatusConflict)
+	case errors.Is(err, tasks.ErrStartFailed):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, "task operation failed", http.StatusInternalServerError)
+	}
+}
@@ -20,6 +20,8 @@ import (
 
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
+
+	"local/monorepo/internal/terminal"
 )
 
 const terminalWriteTimeout = 5 * time.Second
@@ -27,34 +29,24 @@ const terminalPongWait = 60 * time.Second
 const terminalPingInterval = 20 * time.Second
 
 var terminalUpgrader = websocket.Upgrader{
-	ReadBufferSize:  32 * 1024,
-	WriteBufferSize: 32 * 1024,
+	ReadBufferSize:    32 * 1024,
+	WriteBufferSize:   32 * 1024,
+	EnableCompression: true,
+	Subprotocols:      terminal.Subprotocols,
 	CheckOrigin: func(r *http.Request) bool {
 		return isAllowedTerminalOrigin(r.Header.Get("Origin"))
 	},
 }
 
-type terminalControlMessage struct {
-	Type string `json:"type"`
-	Cols uint16 `json:"cols"`
-	Rows uint16 `json:"rows"`
-}
-
-type terminalEventMessage struct {
-	Type    string `json:"type"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code,omitempty"`
-	Shell   string `json:"shell,omitempty"`
-}
-
 type inboundTerminalMessage struct {
 	messageType int
 	payload     []byte
 }
 
 type terminalSocketWriter struct {
-	conn *websocket.Conn
-	mu   sync.Mutex
+	conn     *websocket.Conn
+	compress bool
+	mu       sync.Mutex
 }
 
 func (w *terminalSocketWriter) writeMessage(messageType int, payload []byte) error {
@@ -65,10 +57,12 @@ func (w *terminalSocketWriter) writeMessage(messageType int, payload []byte) err
 		return err
 	}
 
+	// Small frames (keystroke echo) do not benefit from deflate.
+	w.conn.EnableWriteCompression(w.compress && len(payload) >= terminalCompressMinBytes)
 	return w.conn.WriteMessage(messageType, payload)
 }
 
-func (w *terminalSocketWriter) writeJSON(message terminalEventMessage) error {
+func (w *terminalSocketWriter) writeJSON(message terminal.ServerMessage) error {
 	payload, err := json.Marshal(message)
 	if err != nil {
 		return err
@@ -128,21 +122,38 @@ func TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return conn.SetReadDeadline(time.Now().Add(terminalPongWait))
 	})
 
-	writer := &terminalSocketWriter{conn: conn}
+	protocolVersion := terminal.VersionOf(conn.Subprotocol())
+	compress := isTerminalCompressionEnabled()
+	writer := &terminalSocketWriter{conn: conn, compress: compress}
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
+	// v2 clients always acknowledge output; v1 clients opt in with ?flow=ack.
+	flowEnabled := protocolVersion >= 2 || strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("flow")), "ack")
+	flow := newTerminalFlowController(flowEnabled)
+	defer flow.close()
+
 	cmd, shellPath := buildShellCommand()
 	ptyFile, err := pty.Start(cmd)
 	if err != nil {
-		_ = writer.writeJSON(terminalEventMessage{
-			Type:    "error",
+		_ = writer.writeJSON(terminal.ServerMessage{
+			Type:    terminal.TypeError,
 			Message: fmt.Sprintf("failed to start terminal shell: %v", err),
 		})
 		return
 	}
 	defer ptyFile.Close()
 
+	session := &terminalSession{
+		id:        newTerminalSessionID(),
+		shell:     shellPath,
+		cmd:       cmd,
+		ptyFile:   ptyFile,
+		createdAt: time.Now(),
+	}
+	terminalSessions.add(session)
+	defer terminalSessions.remove(session.id)
+
 	waitCh := make(chan error, 1)
 	go func() {
 		waitCh <- cmd.Wait()
@@ -160,13 +171,22 @@ func TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	if err := setPTYSize(ptyFile, 120, 32); err != nil {
-		_ = writer.writeJSON(terminalEventMessage{
-			Type:    "error",
+		_ = writer.writeJSON(terminal.ServerMessage{
+			Type:    terminal.TypeError,
 			Message: fmt.Sprintf("failed to set initial terminal size: %v", err),
 		})
 	}
 
-	_ = writer.writeJSON(terminalEventMessage{Type: "ready", Shell: shellPath})
+	readyEvent := terminal.ServerMessage{Type: terminal.TypeReady, Shell: shellPath, SessionID: session.id}
+	if flowEnabled {
+		readyEvent.Flow = "ack"
+	}
+	if protocolVersion >= 2 {
+		readyEvent.Protocol = terminal.ProtocolV2
+		readyEvent.Version = protocolVersion
+		readyEvent.Capabilities = terminalCapabilities(compress && offersPerMessageDeflate(r))
+	}
+	_ = writer.writeJSON(readyEvent)
 
 	inboundCh := make(chan inboundTerminalMessage, 64)
 	readErrCh := make(chan error, 1)
@@ -215,28 +235,29 @@ func TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	ptyErrCh := make(chan error, 1)
+	outputCh := make(chan []byte, 16)
+	outputReadErrCh := make(chan error, 1)
 	go func() {
-		buffer := make([]byte, 32*1024)
-		for {
-			readBytes, err := ptyFile.Read(buffer)
-			if readBytes > 0 {
-				chunk := make([]byte, readBytes)
-				copy(chunk, buffer[:readBytes])
-				if writeErr := writer.writeMessage(websocket.BinaryMessage, chunk); writeErr != nil {
-					select {
-					case ptyErrCh <- writeErr:
-					default:
-					}
-					return
-				}
-			}
+		outputReadErrCh <- readTerminalOutput(ptyFile, flow, outputCh, doneCh)
+	}()
 
-			if err != nil {
-				select {
-				case ptyErrCh <- err:
-				default:
-				}
-				return
+	inspectOutput := session.output.write
+	if protocolVersion >= 2 {
+		inspectOSC := newTerminalOutputInspector(writer)
+		inspectOutput = func(frame []byte) {
+			session.output.write(frame)
+			inspectOSC(frame)
+		}
+	}
+	go func() {
+		err := forwardTerminalOutput(writer, flow, outputCh, inspectOutput)
+		if err == nil {
+			err = <-outputReadErrCh
+		}
+		if err != nil {
+			select {
+			case ptyErrCh <- err:
+			default:
 			}
 		}
 	}()
@@ -250,12 +271,20 @@ func TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 					continue
 				}
 				if _, err := ptyFile.Write(message.payload); err != nil {
-					_ = writer.writeJSON(terminalEventMessage{Type: "error", Message: err.Error()})
+					_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeError, Message: err.Error()})
 					return
 				}
 			case websocket.TextMessage:
-				if err := handleTerminalControlMessage(ptyFile, message.payload); err != nil {
-					_ = writer.writeJSON(terminalEventMessage{Type: "error", Message: err.Error()})
+				reply, err := handleTerminalControlMessage(session, flow, protocolVersion, message.payload)
+				if err != nil {
+					_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeError, Message: err.Error()})
+					continue
+				}
+				if reply != nil {
+					if reply.Type == terminal.TypeHeartbeat {
+						_ = conn.SetReadDeadline(time.Now().Add(terminalPongWait))
+					}
+					_ = writer.writeJSON(*reply)
 				}
 			case websocket.CloseMessage:
 				return
@@ -264,41 +293,109 @@ func TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				return
 			}
-			_ = writer.writeJSON(terminalEventMessage{Type: "error", Message: err.Error()})
+			_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeError, Message: err.Error()})
 			return
 		case err := <-ptyErrCh:
 			if shouldTreatPTYErrorAsProcessExit(err) {
 				select {
 				case waitErr := <-waitCh:
-					_ = writer.writeJSON(terminalEventMessage{Type: "exit", Code: extractExitCode(waitErr)})
+					_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeExit, Code: extractExitCode(waitErr)})
 				case <-time.After(terminalWriteTimeout):
 				}
 				return
 			}
-			_ = writer.writeJSON(terminalEventMessage{Type: "error", Message: err.Error()})
+			_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeError, Message: err.Error()})
 			return
 		case err := <-waitCh:
-			_ = writer.writeJSON(terminalEventMessage{Type: "exit", Code: extractExitCode(err)})
+			_ = writer.writeJSON(terminal.ServerMessage{Type: terminal.TypeExit, Code: extractExitCode(err)})
 			return
 		}
 	}
 }
 
-func handleTerminalControlMessage(ptyFile *os.File, payload []byte) error {
-	var message terminalControlMessage
+func handleTerminalControlMessage(session *terminalSession, flow *terminalFlowController, protocolVersion int, payload []byte) (*terminal.ServerMessage, error) {
+	var message terminal.ClientMessage
 	if err := json.Unmarshal(payload, &message); err != nil {
-		return fmt.Errorf("invalid terminal control payload: %w", err)
+		return nil, fmt.Errorf("invalid terminal control payload: %w", err)
+	}
+	if message.Type == terminal.TypeHeartbeat && protocolVersion < 2 {
+		return nil, fmt.Errorf("%w: %s", terminal.ErrUnsupportedMessage, message.Type)
+	}
+	if err := message.Validate(); err != nil {
+		return nil, err
 	}
 
 	switch message.Type {
-	case "resize":
-		if message.Cols == 0 || message.Rows == 0 {
-			return errors.New("terminal resize requires cols and rows")
-		}
-		return setPTYSize(ptyFile, message.Cols, message.Rows)
+	case terminal.TypeResize:
+		return nil, setPTYSize(session.ptyFile, message.Cols, message.Rows)
+	case terminal.TypeAck:
+		flow.ack(message.Bytes)
+		return nil, nil
+	case terminal.TypeProcess:
+		info := session.describe(true)
+		return &terminal.ServerMessage{Type: terminal.TypeProcess, SessionID: session.id, Process: &info}, nil
+	case terminal.TypeSignal:
+		return nil, session.signal(message.Signal, message.Target)
+	case terminal.TypeHeartbeat:
+		now := time.Now().UTC()
+		return &terminal.ServerMessage{Type: terminal.TypeHeartbeat, ID: message.ID, Time: &now}, nil
 	default:
-		return fmt.Errorf("unsupported terminal control message: %s", message.Type)
+		return nil, fmt.Errorf("%w: %s", terminal.ErrUnsupportedMessage, message.Type)
+	}
+}
+
+// newTerminalOutputInspector turns OSC title/cwd sequences and bells in PTY
+// output into v2 events. Repeated titles and cwds are suppressed.
+func newTerminalOutputInspector(writer *terminalSocketWriter) func([]byte) {
+	var scanner terminal.OSCScanner
+	lastTitle := ""
+	lastCwd := ""
+
+	return func(frame []byte) {
+		for _, event := range scanner.Scan(frame) {
+			message := terminal.ServerMessage{Type: event.Type}
+			switch event.Type {
+			case terminal.TypeTitle:
+				if event.Value == lastTitle {
+					continue
+				}
+				lastTitle = event.Value
+				message.Title = event.Value
+			case terminal.TypeCwd:
+				if event.Value == lastCwd {
+					continue
+				}
+				lastCwd = event.Value
+				message.Cwd = event.Value
+			}
+			_ = writer.writeJSON(message)
+		}
+	}
+}
+
+func terminalCapabilities(compression bool) []string {
+	capabilities := []string{
+		terminal.CapabilityFlowControl,
+		terminal.CapabilitySignal,
+		terminal.CapabilityProcess,
+		terminal.CapabilityTitle,
+		terminal.CapabilityCwd,
+		terminal.CapabilityBell,
+		terminal.CapabilityHeartbeat,
 	}
+	if compression {
+		capabilities = append(capabilities, terminal.CapabilityCompression)
+	}
+	return capabilities
+}
+
+func offersPerMessageDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-Websocket-Extensions") {
+		if strings.Contains(strings.ToLower(header), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
 }
 
 func setPTYSize(ptyFile *os.File, cols uint16, rows uint16) error {
@@ -363,6 +460,24 @@ func shouldTreatPTYErrorAsProcessExit(err error) bool {
 	return false
 }
 
+func TerminalProtocolHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "terminal protocol") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, _ = w.Write(terminal.ProtocolSchema)
+}
+
+func isTerminalCompressionEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("OMT_TERMINAL_COMPRESSION"))) {
+	case "0", "false", "off", "no":
+		return false
+	default:
+		return true
+	}
+}
+
 func isValidTerminalToken(r *http.Request) bool {
 	expectedToken := strings.TrimSpace(os.Getenv("OMT_TERMINAL_AUTH_TOKEN"))
 	if expectedToken == "" {
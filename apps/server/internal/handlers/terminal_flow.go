@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	terminalReadBufferBytes  = 32 * 1024
+	terminalMaxFrameBytes    = 64 * 1024
+	terminalCoalesceDelay    = 4 * time.Millisecond
+	terminalFlowHighWater    = 1024 * 1024
+	terminalFlowLowWater     = 256 * 1024
+	terminalCompressMinBytes = 1024
+)
+
+// terminalFlowController applies ack-based backpressure to PTY output. Once
+// the client holds more than terminalFlowHighWater unacknowledged bytes, PTY
+// reads pause until acks bring the backlog under terminalFlowLowWater.
+type terminalFlowController struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	enabled bool
+	paused  bool
+	closed  bool
+	unacked int64
+}
+
+func newTerminalFlowController(enabled bool) *terminalFlowController {
+	flow := &terminalFlowController{enabled: enabled}
+	flow.cond = sync.NewCond(&flow.mu)
+	return flow
+}
+
+func (f *terminalFlowController) sent(n int) {
+	if !f.enabled || n <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unacked += int64(n)
+	if f.unacked >= terminalFlowHighWater {
+		f.paused = true
+	}
+}
+
+func (f *terminalFlowController) ack(n int64) {
+	if !f.enabled || n <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unacked -= n
+	if f.unacked < 0 {
+		f.unacked = 0
+	}
+	if f.paused && f.unacked <= terminalFlowLowWater {
+		f.paused = false
+		f.cond.Broadcast()
+	}
+}
+
+// wait blocks while output is paused. It reports false once the controller
+// has been closed.
+func (f *terminalFlowController) wait() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.paused && !f.closed {
+		f.cond.Wait()
+	}
+	return !f.closed
+}
+
+func (f *terminalFlowController) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+// readTerminalOutput copies PTY output into chunks until the PTY fails or
+// done is closed. chunks is closed on return.
+func readTerminalOutput(src io.Reader, flow *terminalFlowController, chunks chan<- []byte, done <-chan struct{}) error {
+	defer close(chunks)
+
+	buffer := make([]byte, terminalReadBufferBytes)
+	for {
+		if !flow.wait() {
+			return nil
+		}
+
+		readBytes, err := src.Read(buffer)
+		if readBytes > 0 {
+			chunk := make([]byte, readBytes)
+			copy(chunk, buffer[:readBytes])
+			select {
+			case chunks <- chunk:
+			case <-done:
+				return nil
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// forwardTerminalOutput coalesces chunks arriving within terminalCoalesceDelay
+// of each other into a single binary frame, capped at terminalMaxFrameBytes.
+// inspect, when set, sees each frame after it is sent. It returns after chunks
+// is closed and the remaining output is flushed.
+func forwardTerminalOutput(writer *terminalSocketWriter, flow *terminalFlowController, chunks <-chan []byte, inspect func([]byte)) error {
+	pending := make([]byte, 0, terminalMaxFrameBytes)
+	var timer *time.Timer
+	var timerC <-chan time.Time
+
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = nil
+		timerC = nil
+	}
+	defer stopTimer()
+
+	flush := func() error {
+		stopTimer()
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := writer.writeMessage(websocket.BinaryMessage, pending); err != nil {
+			return err
+		}
+		flow.sent(len(pending))
+		if inspect != nil {
+			inspect(pending)
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return flush()
+			}
+			for len(chunk) > 0 {
+				n := terminalMaxFrameBytes - len(pending)
+				if n > len(chunk) {
+					n = len(chunk)
+				}
+				pending = append(pending, chunk[:n]...)
+				chunk = chunk[n:]
+				if len(pending) == terminalMaxFrameBytes {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+			if len(pending) > 0 && timerC == nil {
+				timer = time.NewTimer(terminalCoalesceDelay)
+				timerC = timer.C
+			}
+		case <-timerC:
+			timer = nil
+			timerC = nil
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
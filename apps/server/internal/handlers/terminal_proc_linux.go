@@ -0,0 +1,172 @@
+//go:build linux
+
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"local/monorepo/internal/terminal"
+)
+
+var terminalSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGTSTP": syscall.SIGTSTP,
+}
+
+type procStat struct {
+	pid   int
+	name  string
+	ppid  int
+	pgrp  int
+	tpgid int
+}
+
+// readProcStat parses /proc/<pid>/stat. The command name is wrapped in
+// parentheses and may itself contain spaces or parentheses, so the fixed
+// fields are located relative to the last ')'.
+func readProcStat(pid int) (procStat, error) {
+	raw, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	open := bytes.IndexByte(raw, '(')
+	closing := bytes.LastIndexByte(raw, ')')
+	if open < 0 || closing < open {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	// state ppid pgrp session tty_nr tpgid ...
+	fields := strings.Fields(string(raw[closing+1:]))
+	if len(fields) < 6 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	stat := procStat{pid: pid, name: string(raw[open+1 : closing])}
+	stat.ppid, _ = strconv.Atoi(fields[1])
+	stat.pgrp, _ = strconv.Atoi(fields[2])
+	stat.tpgid, _ = strconv.Atoi(fields[5])
+	return stat, nil
+}
+
+func listProcStats() []procStat {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	out := make([]procStat, 0, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		stat, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+		out = append(out, stat)
+	}
+	return out
+}
+
+func describeProcStat(stat procStat) terminal.ProcessInfo {
+	out := terminal.ProcessInfo{PID: stat.pid, PGID: stat.pgrp, Name: stat.name}
+	procDir := filepath.Join("/proc", strconv.Itoa(stat.pid))
+	if cwd, err := os.Readlink(filepath.Join(procDir, "cwd")); err == nil {
+		out.Cwd = cwd
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(procDir, "cmdline")); err == nil {
+		for _, arg := range bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0}) {
+			out.Argv = append(out.Argv, string(arg))
+		}
+	}
+	return out
+}
+
+func foregroundProcessGroup(shellPID int) (int, error) {
+	if shellPID <= 0 {
+		return 0, os.ErrProcessDone
+	}
+	stat, err := readProcStat(shellPID)
+	if err != nil {
+		return 0, err
+	}
+	return stat.tpgid, nil
+}
+
+func processGroupMembers(pgid int) []terminal.ProcessInfo {
+	out := []terminal.ProcessInfo{}
+	for _, stat := range listProcStats() {
+		if stat.pgrp == pgid {
+			out = append(out, describeProcStat(stat))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].PID < out[j].PID
+	})
+	return out
+}
+
+func signalTerminalForeground(shellPID int, name string) error {
+	pgid, err := foregroundProcessGroup(shellPID)
+	if err != nil {
+		return err
+	}
+	if pgid <= 0 {
+		return os.ErrProcessDone
+	}
+	return killProcess(-pgid, terminalSignals[name])
+}
+
+// signalTerminalTree delivers the signal to the shell and every descendant,
+// children before parents so a dying shell cannot reparent them first.
+func signalTerminalTree(shellPID int, name string) error {
+	if shellPID <= 0 {
+		return os.ErrProcessDone
+	}
+
+	children := map[int][]int{}
+	for _, stat := range listProcStats() {
+		children[stat.ppid] = append(children[stat.ppid], stat.pid)
+	}
+
+	order := []int{}
+	var walk func(pid int)
+	walk = func(pid int) {
+		for _, child := range children[pid] {
+			walk(child)
+		}
+		order = append(order, pid)
+	}
+	walk(shellPID)
+
+	signal := terminalSignals[name]
+	var firstErr error
+	for _, pid := range order {
+		if err := killProcess(pid, signal); err != nil && firstErr == nil && pid == shellPID {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func killProcess(pid int, signal syscall.Signal) error {
+	if err := syscall.Kill(pid, signal); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
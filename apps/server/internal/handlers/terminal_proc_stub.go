@@ -0,0 +1,21 @@
+//go:build !linux
+
+package handlers
+
+import "local/monorepo/internal/terminal"
+
+func foregroundProcessGroup(_ int) (int, error) {
+	return 0, errTerminalProcessUnsupported
+}
+
+func processGroupMembers(_ int) []terminal.ProcessInfo {
+	return nil
+}
+
+func signalTerminalForeground(_ int, _ string) error {
+	return errTerminalProcessUnsupported
+}
+
+func signalTerminalTree(_ int, _ string) error {
+	return errTerminalProcessUnsupported
+}
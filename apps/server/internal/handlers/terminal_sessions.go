@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/terminal"
+)
+
+var (
+	errTerminalSessionNotFound     = errors.New("terminal session not found")
+	errTerminalProcessUnsupported  = errors.New("terminal process inspection is not supported on this platform")
+	errTerminalUnsupportedSignal   = errors.New("unsupported terminal signal")
+	errTerminalInvalidSignalTarget = errors.New("invalid terminal signal target")
+)
+
+// terminalOutputTailBytes is how much recent raw output each session keeps
+// for attaching to prompts.
+const terminalOutputTailBytes = 128 * 1024
+
+// terminalSignalNames lists the signals clients may deliver to a session.
+var terminalSignalNames = []string{"SIGINT", "SIGTERM", "SIGKILL", "SIGTSTP"}
+
+type terminalSignalRequest struct {
+	ID     string `json:"id"`
+	Signal string `json:"signal"`
+	Target string `json:"target"`
+}
+
+type terminalSession struct {
+	id        string
+	shell     string
+	cmd       *exec.Cmd
+	ptyFile   *os.File
+	createdAt time.Time
+	output    terminalOutputTail
+}
+
+// terminalOutputTail keeps the last terminalOutputTailBytes of a session's
+// output.
+type terminalOutputTail struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (t *terminalOutputTail) write(chunk []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, chunk...)
+	if excess := len(t.buf) - terminalOutputTailBytes; excess > 0 {
+		t.buf = append(t.buf[:0], t.buf[excess:]...)
+		t.truncated = true
+	}
+}
+
+// text renders the kept output as plain text. Once older output has been
+// dropped, the partial first line is dropped too.
+func (t *terminalOutputTail) text() string {
+	t.mu.Lock()
+	raw := append([]byte(nil), t.buf...)
+	truncated := t.truncated
+	t.mu.Unlock()
+	if truncated {
+		if index := bytes.IndexByte(raw, '\n'); index >= 0 {
+			raw = raw[index+1:]
+		}
+	}
+	return terminal.PlainText(raw)
+}
+
+func (s *terminalSession) shellPID() int {
+	if s.cmd == nil || s.cmd.Process == nil {
+		return 0
+	}
+	return s.cmd.Process.Pid
+}
+
+// describe reports the session and, when detailed is set, its foreground
+// process group. Busy means something other than the shell owns the terminal.
+func (s *terminalSession) describe(detailed bool) terminal.SessionInfo {
+	out := terminal.SessionInfo{
+		ID:        s.id,
+		Shell:     s.shell,
+		ShellPID:  s.shellPID(),
+		CreatedAt: s.createdAt,
+	}
+
+	pgid, err := foregroundProcessGroup(out.ShellPID)
+	if err != nil || pgid <= 0 {
+		return out
+	}
+	out.Busy = pgid != out.ShellPID
+	if !detailed {
+		return out
+	}
+
+	group := processGroupMembers(pgid)
+	for i := range group {
+		if group[i].PID == pgid {
+			leader := group[i]
+			out.Foreground = &leader
+			break
+		}
+	}
+	if out.Foreground == nil && len(group) > 0 {
+		leader := group[0]
+		out.Foreground = &leader
+	}
+	out.Group = group
+	return out
+}
+
+func (s *terminalSession) signal(name, target string) error {
+	normalized := normalizeTerminalSignalName(name)
+	if normalized == "" {
+		return fmt.Errorf("%w: %s", errTerminalUnsupportedSignal, name)
+	}
+
+	switch target {
+	case "", terminal.SignalTargetForeground:
+		return signalTerminalForeground(s.shellPID(), normalized)
+	case terminal.SignalTargetTree:
+		return signalTerminalTree(s.shellPID(), normalized)
+	default:
+		return fmt.Errorf("%w: %s", errTerminalInvalidSignalTarget, target)
+	}
+}
+
+type terminalSessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*terminalSession
+}
+
+var terminalSessions = &terminalSessionRegistry{sessions: map[string]*terminalSession{}}
+
+func (r *terminalSessionRegistry) add(session *terminalSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.id] = session
+}
+
+func (r *terminalSessionRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+}
+
+func (r *terminalSessionRegistry) get(id string) (*terminalSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	session, ok := r.sessions[strings.TrimSpace(id)]
+	return session, ok
+}
+
+func (r *terminalSessionRegistry) list() []*terminalSession {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*terminalSession, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		out = append(out, session)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].createdAt.Before(out[j].createdAt)
+	})
+	return out
+}
+
+// TerminalOutput returns the recent output of a live terminal session as
+// plain text.
+func TerminalOutput(id string) (string, error) {
+	session, ok := terminalSessions.get(id)
+	if !ok {
+		return "", errTerminalSessionNotFound
+	}
+	return session.output.text(), nil
+}
+
+func newTerminalSessionID() string {
+	var raw [12]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("t%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}
+
+func normalizeTerminalSignalName(name string) string {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(upper, "SIG") {
+		upper = "SIG" + upper
+	}
+	for _, allowed := range terminalSignalNames {
+		if upper == allowed {
+			return upper
+		}
+	}
+	return ""
+}
+
+func TerminalSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "terminal sessions") {
+		return
+	}
+
+	sessions := terminalSessions.list()
+	out := make([]terminal.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		out = append(out, session.describe(false))
+	}
+	writeJSON(w, out)
+}
+
+func TerminalProcessHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "terminal process") {
+		return
+	}
+
+	session, ok := terminalSessions.get(r.URL.Query().Get("id"))
+	if !ok {
+		writeTerminalError(w, errTerminalSessionNotFound)
+		return
+	}
+	writeJSON(w, session.describe(true))
+}
+
+func TerminalSignalHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "terminal signal") {
+		return
+	}
+
+	var req terminalSignalRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	session, ok := terminalSessions.get(req.ID)
+	if !ok {
+		writeTerminalError(w, errTerminalSessionNotFound)
+		return
+	}
+	if err := session.signal(req.Signal, req.Target); err != nil {
+		writeTerminalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTerminalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTerminalSessionNotFound):
+		http.Error(w, "terminal session not found", http.StatusNotFound)
+	case errors.Is(err, errTerminalUnsupportedSignal), errors.Is(err, errTerminalInvalidSignalTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errTerminalProcessUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, os.ErrProcessDone):
+		http.Error(w, "process already exited", http.StatusConflict)
+	default:
+		http.Error(w, "terminal operation failed", http.StatusInternalServerError)
+	}
+}
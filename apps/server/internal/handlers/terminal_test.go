@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"local/monorepo/internal/terminal"
+)
+
+// dialTerminal opens a terminal over a test server, asking for the given
+// subprotocols, and returns the connection and its ready message.
+func dialTerminal(t *testing.T, subprotocols []string) (*websocket.Conn, terminal.ServerMessage) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("terminals are not supported on windows")
+	}
+	t.Setenv("SHELL", "/bin/sh")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OMT_TERMINAL_AUTH_TOKEN", "")
+
+	server := httptest.NewServer(http.HandlerFunc(TerminalWebSocketHandler))
+	t.Cleanup(server.Close)
+	dialer := websocket.Dialer{Subprotocols: subprotocols, HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ready, _ := readTerminal(t, conn, func(message *terminal.ServerMessage, _ string) bool {
+		return message != nil && message.Type == terminal.TypeReady
+	})
+	return conn, *ready
+}
+
+// readTerminal reads frames until done accepts one. Text frames are decoded
+// as control messages; binary frames are PTY output, accumulated in the
+// string passed to done.
+func readTerminal(t *testing.T, conn *websocket.Conn, done func(*terminal.ServerMessage, string) bool) (*terminal.ServerMessage, string) {
+	t.Helper()
+	var output strings.Builder
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v (output so far %q)", err, output.String())
+		}
+		switch messageType {
+		case websocket.TextMessage:
+			var message terminal.ServerMessage
+			if err := json.Unmarshal(payload, &message); err != nil {
+				t.Fatalf("control frame %q: %v", payload, err)
+			}
+			if done(&message, output.String()) {
+				return &message, output.String()
+			}
+		case websocket.BinaryMessage:
+			output.Write(payload)
+			if done(nil, output.String()) {
+				return nil, output.String()
+			}
+		}
+	}
+}
+
+func sendControl(t *testing.T, conn *websocket.Conn, message terminal.ClientMessage) {
+	t.Helper()
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestTerminalProtocolNegotiation(t *testing.T) {
+	tests := []struct {
+		name         string
+		subprotocols []string
+		wantProtocol string
+		wantVersion  int
+		wantFlow     string
+	}{
+		{name: "no subprotocol speaks v1", wantVersion: 0},
+		{name: "v1", subprotocols: []string{terminal.ProtocolV1}, wantVersion: 0},
+		{name: "v2", subprotocols: []string{terminal.ProtocolV2}, wantProtocol: terminal.ProtocolV2, wantVersion: 2, wantFlow: "ack"},
+		{name: "server prefers v2", subprotocols: []string{terminal.ProtocolV1, terminal.ProtocolV2}, wantProtocol: terminal.ProtocolV2, wantVersion: 2, wantFlow: "ack"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, ready := dialTerminal(t, tt.subprotocols)
+			if ready.Protocol != tt.wantProtocol || ready.Version != tt.wantVersion || ready.Flow != tt.wantFlow {
+				t.Errorf("ready = %+v, want protocol %q version %d flow %q", ready, tt.wantProtocol, tt.wantVersion, tt.wantFlow)
+			}
+			if ready.Shell != "/bin/sh" || ready.SessionID == "" {
+				t.Errorf("ready = %+v, want the shell and a session ID", ready)
+			}
+			if tt.wantVersion >= 2 && len(ready.Capabilities) == 0 {
+				t.Error("v2 ready advertises no capabilities")
+			}
+			if tt.wantVersion < 2 && ready.Capabilities != nil {
+				t.Errorf("v1 ready advertises capabilities %v", ready.Capabilities)
+			}
+			wantSubprotocol := ""
+			if len(tt.subprotocols) > 0 {
+				wantSubprotocol = tt.wantProtocol
+				if wantSubprotocol == "" {
+					wantSubprotocol = terminal.ProtocolV1
+				}
+			}
+			if conn.Subprotocol() != wantSubprotocol {
+				t.Errorf("negotiated %q, want %q", conn.Subprotocol(), wantSubprotocol)
+			}
+		})
+	}
+}
+
+func TestTerminalControlFrames(t *testing.T) {
+	tests := []struct {
+		name         string
+		subprotocols []string
+		send         terminal.ClientMessage
+		wantType     string
+	}{
+		{name: "v2 heartbeat", subprotocols: []string{terminal.ProtocolV2}, send: terminal.ClientMessage{Type: terminal.TypeHeartbeat, ID: "h1"}, wantType: terminal.TypeHeartbeat},
+		{name: "v1 rejects heartbeat", send: terminal.ClientMessage{Type: terminal.TypeHeartbeat, ID: "h1"}, wantType: terminal.TypeError},
+		{name: "invalid resize", subprotocols: []string{terminal.ProtocolV2}, send: terminal.ClientMessage{Type: terminal.TypeResize}, wantType: terminal.TypeError},
+		{name: "unknown type", subprotocols: []string{terminal.ProtocolV2}, send: terminal.ClientMessage{Type: "paste"}, wantType: terminal.TypeError},
+		{name: "process", subprotocols: []string{terminal.ProtocolV2}, send: terminal.ClientMessage{Type: terminal.TypeProcess}, wantType: terminal.TypeProcess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, ready := dialTerminal(t, tt.subprotocols)
+			sendControl(t, conn, tt.send)
+			reply, _ := readTerminal(t, conn, func(message *terminal.ServerMessage, _ string) bool {
+				return message != nil && (message.Type == terminal.TypeError || message.Type == tt.send.Type)
+			})
+			if reply.Type != tt.wantType {
+				t.Fatalf("reply = %+v, want type %q", reply, tt.wantType)
+			}
+			switch reply.Type {
+			case terminal.TypeHeartbeat:
+				if reply.ID != tt.send.ID || reply.Time == nil {
+					t.Errorf("heartbeat reply = %+v", reply)
+				}
+			case terminal.TypeProcess:
+				if reply.Process == nil || reply.SessionID != ready.SessionID || reply.Process.ShellPID == 0 {
+					t.Errorf("process reply = %+v", reply)
+				}
+			case terminal.TypeError:
+				if reply.Message == "" {
+					t.Error("error reply has no message")
+				}
+			}
+		})
+	}
+}
+
+func TestTerminalBinaryFramesAndEvents(t *testing.T) {
+	conn, _ := dialTerminal(t, []string{terminal.ProtocolV2})
+
+	// input and output travel as binary frames; the marker is split so the
+	// echoed command line does not match
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("echo fra''med\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, output := readTerminal(t, conn, func(_ *terminal.ServerMessage, output string) bool {
+		return strings.Contains(output, "framed")
+	}); !strings.Contains(output, "framed") {
+		t.Fatalf("output = %q", output)
+	}
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("printf '\\033]0;%s\\007' test-title\n")); err != nil {
+		t.Fatal(err)
+	}
+	title, _ := readTerminal(t, conn, func(message *terminal.ServerMessage, _ string) bool {
+		return message != nil && message.Type == terminal.TypeTitle
+	})
+	if title.Title != "test-title" {
+		t.Errorf("title event = %+v", title)
+	}
+}
+
+func TestForwardTerminalOutputCapsFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []int
+	}{
+		{name: "small chunks coalesce", chunks: []int{10, 20, 30}},
+		{name: "chunk crossing the cap", chunks: []int{terminalMaxFrameBytes - 10, 100}},
+		{name: "chunk of twice the cap", chunks: []int{1, 2*terminalMaxFrameBytes + 5}},
+		{name: "exactly the cap", chunks: []int{terminalMaxFrameBytes, terminalMaxFrameBytes}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := make(chan []byte, len(tt.chunks))
+			var want strings.Builder
+			for i, size := range tt.chunks {
+				chunk := strings.Repeat(string(rune('a'+i)), size)
+				want.WriteString(chunk)
+				chunks <- []byte(chunk)
+			}
+			close(chunks)
+
+			upgrader := websocket.Upgrader{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				writer := &terminalSocketWriter{conn: conn}
+				if err := forwardTerminalOutput(writer, newTerminalFlowController(false), chunks, nil); err != nil {
+					t.Error(err)
+				}
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			}))
+			defer server.Close()
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			var got strings.Builder
+			_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			for {
+				_, payload, err := conn.ReadMessage()
+				if err != nil {
+					break
+				}
+				if len(payload) > terminalMaxFrameBytes {
+					t.Errorf("frame of %d bytes exceeds %d", len(payload), terminalMaxFrameBytes)
+				}
+				got.Write(payload)
+			}
+			if got.String() != want.String() {
+				t.Errorf("forwarded %d bytes, want %d in order", got.Len(), want.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"local/monorepo/internal/threads"
+)
+
+const maxThreadMessageBodyBytes = 8 * 1024 * 1024
+
+type ThreadCreateRequest struct {
+	Title       string `json:"title"`
+	Workspace   string `json:"workspace"`
+	Mode        string `json:"mode"`
+	Environment string `json:"environment"`
+	Branch      string `json:"branch"`
+}
+
+type ThreadAppendRequest struct {
+	ID      string          `json:"id"`
+	Role    string          `json:"role"`
+	Content string          `json:"content"`
+	Meta    json.RawMessage `json:"meta,omitempty"`
+}
+
+type ThreadUpdateRequest struct {
+	ID          string  `json:"id"`
+	Title       *string `json:"title,omitempty"`
+	Archived    *bool   `json:"archived,omitempty"`
+	Mode        *string `json:"mode,omitempty"`
+	Environment *string `json:"environment,omitempty"`
+	Branch      *string `json:"branch,omitempty"`
+}
+
+type ThreadRenameRequest struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type ThreadArchiveRequest struct {
+	ID       string `json:"id"`
+	Archived *bool  `json:"archived,omitempty"`
+}
+
+type ThreadIDRequest struct {
+	ID string `json:"id"`
+}
+
+type ThreadsHandler struct {
+	store *threads.Store
+}
+
+func NewThreadsHandler(store *threads.Store) *ThreadsHandler {
+	return &ThreadsHandler{store: store}
+}
+
+// List pages through threads, newest activity first. ?archived=only lists
+// archived threads and ?archived=1 includes them.
+func (h *ThreadsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "threads list") {
+		return
+	}
+
+	query := r.URL.Query()
+	offset, limit, ok := parsePageQuery(w, query.Get("offset"), query.Get("limit"))
+	if !ok {
+		return
+	}
+	opts := threads.ListOptions{Workspace: query.Get("workspace"), Offset: offset, Limit: limit}
+	if archived := strings.TrimSpace(query.Get("archived")); archived == "only" {
+		opts.ArchivedOnly = true
+	} else {
+		opts.IncludeArchived, _ = strconv.ParseBool(archived)
+	}
+	writeJSON(w, h.store.List(opts))
+}
+
+func (h *ThreadsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread create") {
+		return
+	}
+
+	var req ThreadCreateRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+
+	thread, err := h.store.Create(threads.CreateOptions{
+		Title:       req.Title,
+		Workspace:   req.Workspace,
+		Mode:        req.Mode,
+		Environment: req.Environment,
+		Branch:      req.Branch,
+	})
+	if err != nil {
+		writeThreadError(w, err)
+		return
+	}
+	writeJSON(w, thread)
+}
+
+// Messages returns the thread with a page of its messages, oldest first.
+func (h *ThreadsHandler) Messages(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodGet, "thread messages") {
+		return
+	}
+
+	query := r.URL.Query()
+	offset, limit, ok := parsePageQuery(w, query.Get("offset"), query.Get("limit"))
+	if !ok {
+		return
+	}
+	page, err := h.store.Messages(query.Get("id"), offset, limit)
+	if err != nil {
+		writeThreadError(w, err)
+		return
+	}
+	writeJSON(w, page)
+}
+
+func (h *ThreadsHandler) Append(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread append") {
+		return
+	}
+
+	var req ThreadAppendRequest
+	if !decodeJSONBody(w, r, &req, maxThreadMessageBodyBytes) {
+		return
+	}
+
+	message, err := h.store.Append(req.ID, threads.Message{Role: req.Role, Content: req.Content, Meta: req.Meta})
+	if err != nil {
+		writeThreadError(w, err)
+		return
+	}
+	writeJSON(w, message)
+}
+
+func (h *ThreadsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread update") {
+		return
+	}
+
+	var req ThreadUpdateRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	h.writeUpdate(w, req.ID, threads.Update{
+		Title:       req.Title,
+		Archived:    req.Archived,
+		Mode:        req.Mode,
+		Environment: req.Environment,
+		Branch:      req.Branch,
+	})
+}
+
+func (h *ThreadsHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread rename") {
+		return
+	}
+
+	var req ThreadRenameRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	h.writeUpdate(w, req.ID, threads.Update{Title: &req.Title})
+}
+
+// Archive archives a thread, or restores it with "archived": false.
+func (h *ThreadsHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread archive") {
+		return
+	}
+
+	var req ThreadArchiveRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	archived := true
+	if req.Archived != nil {
+		archived = *req.Archived
+	}
+	h.writeUpdate(w, req.ID, threads.Update{Archived: &archived})
+}
+
+func (h *ThreadsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !requireFSAccess(w, r, http.MethodPost, "thread delete") {
+		return
+	}
+
+	var req ThreadIDRequest
+	if !decodeJSONBody(w, r, &req, maxPathRequestBodyBytes) {
+		return
+	}
+	if err := h.store.Delete(req.ID); err != nil {
+		writeThreadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ThreadsHandler) writeUpdate(w http.ResponseWriter, id string, update threads.Update) {
+	thread, err := h.store.Update(id, update)
+	if err != nil {
+		writeThreadError(w, err)
+		return
+	}
+	writeJSON(w, thread)
+}
+
+func parsePageQuery(w http.ResponseWriter, rawOffset, rawLimit string) (int, int, bool) {
+	offset, ok := parseOptionalInt(rawOffset)
+	if !ok {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	limit, ok := parseOptionalInt(rawLimit)
+	if !ok {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
+
+func writeThreadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, threads.ErrThreadNotFound):
+		http.Error(w, "thread not found", http.StatusNotFound)
+	case errors.Is(err, threads.ErrWorkspaceRequired):
+		http.Error(w, "thread workspace is required", http.StatusBadRequest)
+	case errors.Is(err, threads.ErrInvalidMode):
+		http.Error(w, "mode must be agent, plan or ask", http.StatusBadRequest)
+	case errors.Is(err, threads.ErrInvalidEnvironment):
+		http.Error(w, "environment must be local or worktree", http.StatusBadRequest)
+	case errors.Is(err, threads.ErrInvalidRole):
+		http.Error(w, "role must be user, assistant, system or tool", http.StatusBadRequest)
+	default:
+		http.Error(w, "thread operation failed", http.StatusInternalServerError)
+	}
+}
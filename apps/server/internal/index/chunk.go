@@ -0,0 +1,219 @@
+package index
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"local/monorepo/internal/symbols"
+)
+
+const (
+	KindHeader = "header"
+	KindBlock  = "block"
+)
+
+// chunkWindowOverlap is how many lines consecutive windows of an oversized
+// span share, so a match near a cut still sees its surroundings.
+const chunkWindowOverlap = 10
+
+// minChunkLines is the size below which neighbouring spans are merged, so
+// runs of one-line constants do not each become a chunk.
+const minChunkLines = 6
+
+// Chunk is one indexed piece of a file. Lines are 1-based and inclusive.
+// Kind and Name describe the declaration the chunk holds when the file's
+// outline has one; Kind is a symbols kind, KindHeader for what precedes
+// the first declaration or KindBlock for code between or across
+// declarations.
+type Chunk struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type span struct {
+	start, end int // 0-based line indexes, end inclusive
+	kind       string
+	names      []string
+}
+
+// chunkFile splits content into chunks of at most maxLines lines along the
+// declarations of its outline. Lines outside any declaration become chunks
+// of their own, and files without an outline are cut into overlapping
+// windows.
+func chunkFile(path, content string, maxLines int) []Chunk {
+	lines := strings.Split(content, "\n")
+	var spans []span
+	collectSpans(&spans, symbols.Parse(path, content), nil, len(lines), maxLines)
+	spans = fillGaps(overlapping(spans), len(lines))
+
+	var chunks []Chunk
+	for _, s := range mergeSmall(trimSpans(lines, spans), maxLines) {
+		for _, part := range splitSpan(s, maxLines) {
+			chunks = append(chunks, Chunk{
+				Path:      path,
+				StartLine: part.start + 1,
+				EndLine:   part.end + 1,
+				Kind:      part.kind,
+				Name:      joinNames(part.names),
+			})
+		}
+	}
+	return chunks
+}
+
+// collectSpans adds a span for every symbol that is not inside its parent,
+// which is every top-level symbol and, in Go, methods declared away from
+// their receiver type. A container longer than maxLines is replaced by its
+// members so a large class is chunked per method rather than per window.
+func collectSpans(spans *[]span, list []symbols.Symbol, parent *symbols.Symbol, lineCount, maxLines int) {
+	for i := range list {
+		symbol := &list[i]
+		inside := parent != nil && symbol.StartLine >= parent.StartLine && symbol.EndLine <= parent.EndLine
+		if !inside && symbol.StartLine >= 1 && symbol.EndLine <= lineCount {
+			if len(symbol.Children) > 0 && symbol.EndLine-symbol.StartLine+1 > maxLines {
+				collectSpans(spans, symbol.Children, nil, lineCount, maxLines)
+				continue
+			}
+			name := symbol.Name
+			if symbol.Container != "" {
+				name = symbol.Container + "." + name
+			}
+			*spans = append(*spans, span{
+				start: symbol.StartLine - 1,
+				end:   symbol.EndLine - 1,
+				kind:  symbol.Kind,
+				names: []string{name},
+			})
+		}
+		collectSpans(spans, symbol.Children, symbol, lineCount, maxLines)
+	}
+}
+
+// overlapping sorts spans and merges those that share lines, such as the
+// names of one Go var declaration.
+func overlapping(spans []span) []span {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var out []span
+	for _, s := range spans {
+		if len(out) > 0 && s.start <= out[len(out)-1].end {
+			prev := &out[len(out)-1]
+			if s.end > prev.end {
+				prev.end = s.end
+			}
+			if prev.kind != s.kind {
+				prev.kind = KindBlock
+			}
+			prev.names = append(prev.names, s.names...)
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// fillGaps adds spans for the lines no declaration covers.
+func fillGaps(spans []span, lineCount int) []span {
+	var out []span
+	next := 0
+	for _, s := range spans {
+		if s.start > next {
+			kind := KindBlock
+			if next == 0 {
+				kind = KindHeader
+			}
+			out = append(out, span{start: next, end: s.start - 1, kind: kind})
+		}
+		out = append(out, s)
+		next = s.end + 1
+	}
+	if next < lineCount {
+		kind := KindBlock
+		if next == 0 {
+			kind = ""
+		}
+		out = append(out, span{start: next, end: lineCount - 1, kind: kind})
+	}
+	return out
+}
+
+// trimSpans drops blank lines at either end of each span and spans that
+// are entirely blank.
+func trimSpans(lines []string, spans []span) []span {
+	out := spans[:0]
+	for _, s := range spans {
+		for s.start <= s.end && strings.TrimSpace(lines[s.start]) == "" {
+			s.start++
+		}
+		for s.end >= s.start && strings.TrimSpace(lines[s.end]) == "" {
+			s.end--
+		}
+		if s.start <= s.end {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// mergeSmall folds spans shorter than minChunkLines into the span before
+// them while the result stays within maxLines.
+func mergeSmall(spans []span, maxLines int) []span {
+	var out []span
+	for _, s := range spans {
+		if len(out) > 0 {
+			prev := &out[len(out)-1]
+			small := s.end-s.start+1 < minChunkLines || prev.end-prev.start+1 < minChunkLines
+			if small && s.end-prev.start+1 <= maxLines {
+				prev.end = s.end
+				if prev.kind != s.kind {
+					prev.kind = KindBlock
+				}
+				prev.names = append(prev.names, s.names...)
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// splitSpan cuts a span longer than maxLines into overlapping windows.
+func splitSpan(s span, maxLines int) []span {
+	if s.end-s.start+1 <= maxLines {
+		return []span{s}
+	}
+	step := maxLines - chunkWindowOverlap
+	if step < 1 {
+		step = maxLines
+	}
+	var parts []span
+	for start := s.start; start <= s.end; start += step {
+		end := start + maxLines - 1
+		if end >= s.end {
+			end = s.end
+		}
+		parts = append(parts, span{start: start, end: end, kind: s.kind, names: s.names})
+		if end == s.end {
+			break
+		}
+	}
+	return parts
+}
+
+// joinNames lists up to three non-empty names, then how many more there
+// are.
+func joinNames(names []string) string {
+	var kept []string
+	for _, name := range names {
+		if name != "" {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) > 3 {
+		kept = append(kept[:3], "+"+strconv.Itoa(len(kept)-3))
+	}
+	return strings.Join(kept, ", ")
+}
@@ -0,0 +1,312 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"local/monorepo/internal/llm"
+)
+
+const (
+	EmbedderOpenAI = "openai"
+	EmbedderOllama = "ollama"
+	EmbedderLocal  = "local"
+)
+
+const (
+	defaultLocalDimensions = 512
+	maxEmbedErrorBytes     = 64 * 1024
+)
+
+// EmbedderConfig selects the endpoint that turns chunks into vectors.
+// OpenAI-compatible servers (including llama.cpp, vLLM and LM Studio) are
+// called at BaseURL/embeddings and Ollama at BaseURL/api/embed. The local
+// embedder needs no model: it hashes identifiers and words into a fixed
+// number of dimensions, which ranks by shared vocabulary rather than
+// meaning but works offline.
+type EmbedderConfig struct {
+	Type       string `json:"type"`
+	BaseURL    string `json:"baseUrl,omitempty"`
+	Model      string `json:"model,omitempty"`
+	APIKeyEnv  string `json:"apiKeyEnv,omitempty"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// Embedder computes one vector per text. ID names the embedder and model;
+// vectors from different IDs are never compared.
+type Embedder interface {
+	ID() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder builds the embedder cfg describes. API keys are resolved the
+// way model providers resolve theirs: from APIKeyEnv, then the OS keyring
+// under the "embeddings" account.
+func NewEmbedder(cfg EmbedderConfig, client *http.Client) (Embedder, error) {
+	if client == nil {
+		client = &http.Client{Timeout: embedRequestTimeout}
+	}
+	switch cfg.Type {
+	case "", EmbedderLocal:
+		dimensions := cfg.Dimensions
+		if dimensions <= 0 {
+			dimensions = defaultLocalDimensions
+		}
+		return &localEmbedder{dimensions: dimensions}, nil
+	case EmbedderOpenAI:
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("%w: openai embedder needs a model", ErrEmbedderConfig)
+		}
+		key, _, err := llm.ResolveKey(llm.ProviderConfig{
+			Name:      "embeddings",
+			Type:      llm.TypeOpenAI,
+			BaseURL:   cfg.BaseURL,
+			APIKeyEnv: cfg.APIKeyEnv,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEmbedderConfig, err)
+		}
+		baseURL := strings.TrimRight(cfg.BaseURL, "/")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return &openAIEmbedder{cfg: cfg, baseURL: baseURL, key: key, client: client}, nil
+	case EmbedderOllama:
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("%w: ollama embedder needs a model", ErrEmbedderConfig)
+		}
+		baseURL := strings.TrimRight(cfg.BaseURL, "/")
+		if baseURL == "" {
+			baseURL = "http://127.0.0.1:11434"
+		}
+		return &ollamaEmbedder{cfg: cfg, baseURL: baseURL, client: client}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown embedder type %q", ErrEmbedderConfig, cfg.Type)
+	}
+}
+
+type openAIEmbedder struct {
+	cfg     EmbedderConfig
+	baseURL string
+	key     string
+	client  *http.Client
+}
+
+func (e *openAIEmbedder) ID() string {
+	return EmbedderOpenAI + ":" + e.cfg.Model
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp openAIEmbeddingResponse
+	err := postJSON(ctx, e.client, e.baseURL+"/embeddings", e.key, openAIEmbeddingRequest{
+		Model:      e.cfg.Model,
+		Input:      texts,
+		Dimensions: e.cfg.Dimensions,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("%w: embedding index %d out of range", ErrEmbedFailed, item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return checkVectors(vectors)
+}
+
+type ollamaEmbedder struct {
+	cfg     EmbedderConfig
+	baseURL string
+	client  *http.Client
+}
+
+func (e *ollamaEmbedder) ID() string {
+	return EmbedderOllama + ":" + e.cfg.Model
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (e *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp ollamaEmbedResponse
+	err := postJSON(ctx, e.client, e.baseURL+"/api/embed", "", ollamaEmbedRequest{Model: e.cfg.Model, Input: texts}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d embeddings for %d inputs", ErrEmbedFailed, len(resp.Embeddings), len(texts))
+	}
+	return checkVectors(resp.Embeddings)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, key string, body, out any) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEmbedFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxEmbedErrorBytes))
+		return fmt.Errorf("%w: %s: %s", ErrEmbedFailed, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: decode response: %v", ErrEmbedFailed, err)
+	}
+	return nil
+}
+
+// checkVectors makes sure every input got a vector of the same length and
+// scales them to unit length, so ranking is a dot product.
+func checkVectors(vectors [][]float32) ([][]float32, error) {
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("%w: no embedding for input %d", ErrEmbedFailed, i)
+		}
+		if len(vector) != len(vectors[0]) {
+			return nil, fmt.Errorf("%w: embeddings have mixed dimensions", ErrEmbedFailed)
+		}
+		normalize(vector)
+	}
+	return vectors, nil
+}
+
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(sum))
+	for i := range vector {
+		vector[i] *= scale
+	}
+}
+
+// localEmbedder is a feature-hashing embedder. Each text is split into
+// lower-cased terms, with identifiers also split at camelCase and
+// snake_case boundaries, and every term adds a signed, log-scaled weight to
+// the dimension its hash picks.
+type localEmbedder struct {
+	dimensions int
+}
+
+func (e *localEmbedder) ID() string {
+	return fmt.Sprintf("%s:hash-%d", EmbedderLocal, e.dimensions)
+}
+
+func (e *localEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		for _, term := range terms(text) {
+			counts[term]++
+		}
+		vector := make([]float32, e.dimensions)
+		for term, count := range counts {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(term))
+			sum := h.Sum64()
+			weight := float32(1 + math.Log(float64(count)))
+			if sum&(1<<63) != 0 {
+				weight = -weight
+			}
+			vector[sum%uint64(e.dimensions)] += weight
+		}
+		normalize(vector)
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// terms returns the words of text and the parts of its identifiers, so that
+// "parseConfig" matches queries for "parse config" as well as itself.
+func terms(text string) []string {
+	var out []string
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, field := range fields {
+		if len(field) < 2 {
+			continue
+		}
+		out = append(out, strings.ToLower(field))
+		parts := splitIdentifier(field)
+		if len(parts) < 2 {
+			continue
+		}
+		for _, part := range parts {
+			if len(part) >= 2 {
+				out = append(out, strings.ToLower(part))
+			}
+		}
+	}
+	return out
+}
+
+func splitIdentifier(word string) []string {
+	var parts []string
+	runes := []rune(word)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		boundary := i == len(runes) || runes[i] == '_'
+		if !boundary && unicode.IsUpper(runes[i]) {
+			// "parseHTTPRequest" splits before "Request", not inside "HTTP"
+			boundary = unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1]))
+		}
+		if !boundary {
+			continue
+		}
+		if part := strings.Trim(string(runes[start:i]), "_"); part != "" {
+			parts = append(parts, part)
+		}
+		start = i
+	}
+	return parts
+}
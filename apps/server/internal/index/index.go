@@ -0,0 +1,586 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWorkspaceRequired = errors.New("workspace is required")
+	ErrWorkspaceNotFound = errors.New("workspace does not exist")
+	ErrQueryRequired     = errors.New("query is required")
+	ErrEmbedderConfig    = errors.New("invalid embedder config")
+	ErrEmbedFailed       = errors.New("embedding request failed")
+)
+
+const (
+	defaultMaxFiles       = 20_000
+	defaultMaxFileBytes   = 512 * 1024
+	defaultMaxChunkLines  = 60
+	defaultMaxEmbedBytes  = 8 * 1024
+	defaultBatchSize      = 32
+	defaultQueryLimit     = 10
+	defaultMaxQueryLimit  = 50
+	defaultRescanInterval = time.Minute
+	defaultUpdateDelay    = 2 * time.Second
+	defaultQueryWait      = 5 * time.Second
+	embedRequestTimeout   = 2 * time.Minute
+)
+
+type Config struct {
+	// Dir holds one index directory per workspace.
+	Dir      string
+	Embedder EmbedderConfig
+	// MaxFiles caps how many files of one workspace are indexed.
+	MaxFiles     int
+	MaxFileBytes int64
+	// MaxChunkLines is the longest chunk; longer declarations are cut
+	// into overlapping windows.
+	MaxChunkLines int
+	// MaxEmbedBytes caps the text sent to the embedder for one chunk.
+	MaxEmbedBytes int
+	// BatchSize is how many chunks go into one embedding request.
+	BatchSize     int
+	QueryLimit    int
+	MaxQueryLimit int
+	// RescanInterval is how old the last full scan may be before a query
+	// starts another, catching edits made outside the server.
+	RescanInterval time.Duration
+	// UpdateDelay batches change notifications into one update.
+	UpdateDelay time.Duration
+	// QueryWait is how long a query waits for a running update before
+	// answering from what is already indexed.
+	QueryWait time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Embedder:       EmbedderConfig{Type: EmbedderLocal},
+		MaxFiles:       defaultMaxFiles,
+		MaxFileBytes:   defaultMaxFileBytes,
+		MaxChunkLines:  defaultMaxChunkLines,
+		MaxEmbedBytes:  defaultMaxEmbedBytes,
+		BatchSize:      defaultBatchSize,
+		QueryLimit:     defaultQueryLimit,
+		MaxQueryLimit:  defaultMaxQueryLimit,
+		RescanInterval: defaultRescanInterval,
+		UpdateDelay:    defaultUpdateDelay,
+		QueryWait:      defaultQueryWait,
+	}
+}
+
+// LoadConfig returns the default config with the embedder from the JSON
+// file at path, if it exists:
+//
+//	{"embedder": {"type": "ollama", "model": "nomic-embed-text"}}
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var file struct {
+		Embedder *EmbedderConfig `json:"embedder"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Embedder != nil {
+		cfg.Embedder = *file.Embedder
+	}
+	return cfg, nil
+}
+
+// Index keeps a vector index of the source files of each workspace it has
+// been asked about. Indexes are loaded from disk on first use, brought up
+// to date in the background and kept there by change notifications and
+// periodic rescans.
+type Index struct {
+	cfg      Config
+	embedder Embedder
+	// embedderErr is the config error that left the index without an
+	// embedder; every call reports it.
+	embedderErr error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	workspaces map[string]*workspace
+}
+
+type workspace struct {
+	root string
+	dir  string
+
+	// mu guards the indexed files; updates hold it only to install results.
+	mu         sync.RWMutex
+	files      map[string]*fileEntry
+	dimensions int
+	updatedAt  time.Time
+
+	// stateMu guards the update schedule.
+	stateMu   sync.Mutex
+	running   bool
+	done      chan struct{}
+	wantFull  bool
+	pending   map[string]bool
+	timer     *time.Timer
+	scannedAt time.Time
+	lastErr   string
+}
+
+// Status describes one workspace index.
+type Status struct {
+	Workspace  string     `json:"workspace"`
+	Embedder   string     `json:"embedder"`
+	Files      int        `json:"files"`
+	Chunks     int        `json:"chunks"`
+	Dimensions int        `json:"dimensions,omitempty"`
+	Indexing   bool       `json:"indexing"`
+	Pending    int        `json:"pending"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+	ScannedAt  *time.Time `json:"scannedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type QueryRequest struct {
+	Workspace string
+	Query     string
+	Limit     int
+	// Paths limits results to files under these workspace-relative paths.
+	Paths []string
+}
+
+// Match is a ranked chunk with its current content. Score is the cosine
+// similarity between the query and the chunk.
+type Match struct {
+	Chunk
+	Score   float64 `json:"score"`
+	Content string  `json:"content"`
+}
+
+type QueryResult struct {
+	Matches []Match `json:"matches"`
+	Index   Status  `json:"index"`
+}
+
+// New returns an index that stores its data under cfg.Dir. An invalid
+// embedder config does not fail construction; it is reported by every call
+// instead, so the rest of the server starts.
+func New(cfg Config) *Index {
+	defaults := DefaultConfig()
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaults.MaxFiles
+	}
+	if cfg.MaxFileBytes <= 0 {
+		cfg.MaxFileBytes = defaults.MaxFileBytes
+	}
+	if cfg.MaxChunkLines <= 0 {
+		cfg.MaxChunkLines = defaults.MaxChunkLines
+	}
+	if cfg.MaxEmbedBytes <= 0 {
+		cfg.MaxEmbedBytes = defaults.MaxEmbedBytes
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.QueryLimit <= 0 {
+		cfg.QueryLimit = defaults.QueryLimit
+	}
+	if cfg.MaxQueryLimit <= 0 {
+		cfg.MaxQueryLimit = defaults.MaxQueryLimit
+	}
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = defaults.RescanInterval
+	}
+	if cfg.UpdateDelay <= 0 {
+		cfg.UpdateDelay = defaults.UpdateDelay
+	}
+	if cfg.QueryWait <= 0 {
+		cfg.QueryWait = defaults.QueryWait
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ix := &Index{cfg: cfg, ctx: ctx, cancel: cancel, workspaces: map[string]*workspace{}}
+	ix.embedder, ix.embedderErr = NewEmbedder(cfg.Embedder, nil)
+	return ix
+}
+
+// Close stops background updates and waits for the running ones to end.
+func (ix *Index) Close() {
+	ix.cancel()
+	ix.mu.Lock()
+	for _, w := range ix.workspaces {
+		w.stateMu.Lock()
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		w.stateMu.Unlock()
+	}
+	ix.mu.Unlock()
+	ix.wg.Wait()
+}
+
+// Query ranks the chunks of a workspace by similarity to the query text.
+// The first query of a workspace starts indexing it; queries wait up to
+// QueryWait for a running update and otherwise answer from the chunks
+// indexed so far, with Index.Indexing set.
+func (ix *Index) Query(ctx context.Context, req QueryRequest) (QueryResult, error) {
+	if ix.embedderErr != nil {
+		return QueryResult{}, ix.embedderErr
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return QueryResult{}, ErrQueryRequired
+	}
+	w, err := ix.workspace(req.Workspace)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = ix.cfg.QueryLimit
+	}
+	if limit > ix.cfg.MaxQueryLimit {
+		limit = ix.cfg.MaxQueryLimit
+	}
+
+	if done := ix.refresh(w, false); done != nil {
+		wait := time.NewTimer(ix.cfg.QueryWait)
+		select {
+		case <-done:
+		case <-wait.C:
+		case <-ctx.Done():
+			wait.Stop()
+			return QueryResult{}, ctx.Err()
+		}
+		wait.Stop()
+	}
+
+	vectors, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return QueryResult{}, err
+	}
+	matches := w.rank(vectors[0], limit, scopes(req.Paths))
+	attachContent(w.root, matches)
+	return QueryResult{Matches: matches, Index: ix.status(w)}, nil
+}
+
+// Status reports the index of a workspace without starting an update.
+func (ix *Index) Status(workspace string) (Status, error) {
+	if ix.embedderErr != nil {
+		return Status{}, ix.embedderErr
+	}
+	w, err := ix.workspace(workspace)
+	if err != nil {
+		return Status{}, err
+	}
+	return ix.status(w), nil
+}
+
+// Refresh starts a full scan of a workspace and returns its status. With
+// rebuild, every file is chunked and embedded again.
+func (ix *Index) Refresh(workspace string, rebuild bool) (Status, error) {
+	if ix.embedderErr != nil {
+		return Status{}, ix.embedderErr
+	}
+	w, err := ix.workspace(workspace)
+	if err != nil {
+		return Status{}, err
+	}
+	if rebuild {
+		w.mu.Lock()
+		w.files = map[string]*fileEntry{}
+		w.dimensions = 0
+		w.mu.Unlock()
+	}
+	ix.refresh(w, true)
+	return ix.status(w), nil
+}
+
+// Notify tells the index that path changed on disk. Loaded workspaces
+// containing it update that path after UpdateDelay, batching bursts of
+// changes into one update.
+func (ix *Index) Notify(path string) {
+	ix.mu.Lock()
+	workspaces := make([]*workspace, 0, len(ix.workspaces))
+	for _, w := range ix.workspaces {
+		workspaces = append(workspaces, w)
+	}
+	ix.mu.Unlock()
+
+	for _, w := range workspaces {
+		rel, ok := relativeTo(w.root, path)
+		if !ok || inSkippedDir(rel) {
+			continue
+		}
+		w.stateMu.Lock()
+		w.pending[rel] = true
+		if w.timer == nil {
+			w.timer = time.AfterFunc(ix.cfg.UpdateDelay, func() { ix.schedule(w, false) })
+		} else {
+			w.timer.Reset(ix.cfg.UpdateDelay)
+		}
+		w.stateMu.Unlock()
+	}
+}
+
+// workspace returns the loaded index of root, loading it from disk first.
+func (ix *Index) workspace(raw string) (*workspace, error) {
+	root := strings.TrimSpace(raw)
+	if root == "" {
+		return nil, ErrWorkspaceRequired
+	}
+	root, err := filepath.Abs(filepath.Clean(root))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if w, ok := ix.workspaces[root]; ok {
+		return w, nil
+	}
+	w := &workspace{root: root, dir: storeDir(ix.cfg.Dir, root), pending: map[string]bool{}}
+	files, dimensions, updatedAt, err := loadStore(w.dir, ix.embedder.ID())
+	if err != nil {
+		w.lastErr = err.Error()
+	}
+	w.files, w.dimensions, w.updatedAt = files, dimensions, updatedAt
+	ix.workspaces[root] = w
+	return w, nil
+}
+
+// refresh schedules an update when the workspace has changes pending, has
+// not been scanned within RescanInterval or force is set, and returns the
+// channel closed when the update ends, or nil when none is needed.
+func (ix *Index) refresh(w *workspace, force bool) <-chan struct{} {
+	w.stateMu.Lock()
+	full := force || time.Since(w.scannedAt) > ix.cfg.RescanInterval
+	needed := full || len(w.pending) > 0 || w.running
+	w.stateMu.Unlock()
+	if !needed {
+		return nil
+	}
+	return ix.schedule(w, full)
+}
+
+func (ix *Index) schedule(w *workspace, full bool) <-chan struct{} {
+	w.stateMu.Lock()
+	defer w.stateMu.Unlock()
+	if full {
+		w.wantFull = true
+	}
+	if w.running {
+		return w.done
+	}
+	if ix.ctx.Err() != nil {
+		return nil
+	}
+	w.running = true
+	w.done = make(chan struct{})
+	ix.wg.Add(1)
+	go ix.run(w)
+	return w.done
+}
+
+// run applies scheduled updates until none are left. A full scan covers
+// every pending path; otherwise only the pending paths are synced.
+func (ix *Index) run(w *workspace) {
+	defer ix.wg.Done()
+	for {
+		w.stateMu.Lock()
+		full, pending := w.wantFull, w.pending
+		w.wantFull, w.pending = false, map[string]bool{}
+		w.stateMu.Unlock()
+
+		var err error
+		if full {
+			err = ix.sync(w, "")
+		} else {
+			for _, scope := range sortedKeys(pending) {
+				if err = ix.sync(w, scope); err != nil {
+					break
+				}
+			}
+		}
+
+		w.stateMu.Lock()
+		w.lastErr = ""
+		if err != nil {
+			w.lastErr = err.Error()
+			// a failed update may have skipped files; the next query
+			// rescans everything
+			w.scannedAt = time.Time{}
+		} else if full {
+			w.scannedAt = time.Now()
+		}
+		if ix.ctx.Err() != nil || (!w.wantFull && len(w.pending) == 0) {
+			w.running = false
+			close(w.done)
+			w.stateMu.Unlock()
+			return
+		}
+		w.stateMu.Unlock()
+	}
+}
+
+func (ix *Index) status(w *workspace) Status {
+	status := Status{Workspace: w.root, Embedder: ix.embedder.ID()}
+	w.mu.RLock()
+	status.Files = len(w.files)
+	for _, entry := range w.files {
+		status.Chunks += len(entry.chunks)
+	}
+	status.Dimensions = w.dimensions
+	if !w.updatedAt.IsZero() {
+		updatedAt := w.updatedAt
+		status.UpdatedAt = &updatedAt
+	}
+	w.mu.RUnlock()
+
+	w.stateMu.Lock()
+	status.Indexing = w.running
+	status.Pending = len(w.pending)
+	if !w.scannedAt.IsZero() {
+		scannedAt := w.scannedAt
+		status.ScannedAt = &scannedAt
+	}
+	status.Error = w.lastErr
+	w.stateMu.Unlock()
+	return status
+}
+
+// rank scores every chunk under scopes against the query vector and
+// returns the best limit with a positive score.
+func (w *workspace) rank(query []float32, limit int, scopes []string) []Match {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	matches := []Match{}
+	for path, entry := range w.files {
+		if !inScopes(path, scopes) {
+			continue
+		}
+		for i, vector := range entry.vectors {
+			if len(vector) != len(query) {
+				continue
+			}
+			score := dot(query, vector)
+			if score <= 0 {
+				continue
+			}
+			matches = append(matches, Match{Chunk: entry.chunks[i], Score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].StartLine < matches[j].StartLine
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// attachContent fills each match with its lines as they are on disk now.
+func attachContent(root string, matches []Match) {
+	lines := map[string][]string{}
+	for i := range matches {
+		path := matches[i].Path
+		fileLines, ok := lines[path]
+		if !ok {
+			if raw, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path))); err == nil {
+				fileLines = strings.Split(string(raw), "\n")
+			}
+			lines[path] = fileLines
+		}
+		start, end := matches[i].StartLine-1, matches[i].EndLine
+		if end > len(fileLines) {
+			end = len(fileLines)
+		}
+		if start < end {
+			matches[i].Content = strings.Join(fileLines[start:end], "\n")
+		}
+	}
+}
+
+func scopes(paths []string) []string {
+	var out []string
+	for _, path := range paths {
+		path = strings.Trim(filepath.ToSlash(filepath.Clean(strings.TrimSpace(path))), "/")
+		if path == "" || path == "." {
+			return nil
+		}
+		out = append(out, path)
+	}
+	return out
+}
+
+func inScopes(path string, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if inScope(path, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func inScope(path, scope string) bool {
+	return scope == "" || path == scope || strings.HasPrefix(path, scope+"/")
+}
+
+// relativeTo returns path relative to root with forward slashes, and false
+// when path is outside root.
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,199 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	manifestName    = "index.json"
+	vectorsName     = "vectors.bin"
+	manifestVersion = 2
+)
+
+// manifest describes a workspace index on disk. Vectors live in a separate
+// file of little-endian float32s, one row of Dimensions per chunk in
+// manifest order; Vectors is that file's SHA-256, so a crash between the two
+// writes is detected and the index rebuilt.
+type manifest struct {
+	Version    int            `json:"version"`
+	Root       string         `json:"root"`
+	Embedder   string         `json:"embedder"`
+	Dimensions int            `json:"dimensions"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+	Vectors    string         `json:"vectors"`
+	Files      []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Path    string          `json:"path"`
+	Size    int64           `json:"size"`
+	ModTime time.Time       `json:"modTime"`
+	Hash    string          `json:"hash"`
+	Chunks  []manifestChunk `json:"chunks"`
+}
+
+type manifestChunk struct {
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// fileEntry is one indexed file: the stat and content hash it was indexed
+// at and a vector per chunk.
+type fileEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+	chunks  []Chunk
+	vectors [][]float32
+}
+
+// storeDir is where the index of root lives under dir, named by a hash of
+// the root so any path maps to a safe directory name.
+func storeDir(dir, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8]))
+}
+
+// loadStore reads the index in dir. An index from another embedder or
+// format version, or one whose vectors do not match the manifest, loads as
+// empty so the next scan rebuilds it.
+func loadStore(dir, embedder string) (map[string]*fileEntry, int, time.Time, error) {
+	files := map[string]*fileEntry{}
+	raw, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return files, 0, time.Time{}, nil
+	}
+	if err != nil {
+		return files, 0, time.Time{}, err
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return files, 0, time.Time{}, fmt.Errorf("parse index manifest: %w", err)
+	}
+	if m.Version != manifestVersion || m.Embedder != embedder || m.Dimensions <= 0 {
+		return files, 0, time.Time{}, nil
+	}
+
+	vectors, err := os.ReadFile(filepath.Join(dir, vectorsName))
+	if err != nil {
+		return files, 0, time.Time{}, nil
+	}
+	sum := sha256.Sum256(vectors)
+	total := 0
+	for _, file := range m.Files {
+		total += len(file.Chunks)
+	}
+	if hex.EncodeToString(sum[:]) != m.Vectors || len(vectors) != total*m.Dimensions*4 {
+		return files, 0, time.Time{}, nil
+	}
+
+	offset := 0
+	for _, file := range m.Files {
+		entry := &fileEntry{size: file.Size, modTime: file.ModTime, hash: file.Hash}
+		for _, chunk := range file.Chunks {
+			entry.chunks = append(entry.chunks, Chunk{
+				Path:      file.Path,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Kind:      chunk.Kind,
+				Name:      chunk.Name,
+			})
+			vector := make([]float32, m.Dimensions)
+			for i := range vector {
+				vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(vectors[offset:]))
+				offset += 4
+			}
+			entry.vectors = append(entry.vectors, vector)
+		}
+		files[file.Path] = entry
+	}
+	return files, m.Dimensions, m.UpdatedAt, nil
+}
+
+// saveStore writes the vectors and then the manifest that vouches for them,
+// each atomically.
+func saveStore(dir, root, embedder string, dimensions int, files map[string]*fileEntry, updatedAt time.Time) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	m := manifest{
+		Version:    manifestVersion,
+		Root:       root,
+		Embedder:   embedder,
+		Dimensions: dimensions,
+		UpdatedAt:  updatedAt,
+		Files:      make([]manifestFile, 0, len(paths)),
+	}
+	var vectors bytes.Buffer
+	word := make([]byte, 4)
+	for _, path := range paths {
+		entry := files[path]
+		file := manifestFile{Path: path, Size: entry.size, ModTime: entry.modTime, Hash: entry.hash}
+		for i, chunk := range entry.chunks {
+			file.Chunks = append(file.Chunks, manifestChunk{
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Kind:      chunk.Kind,
+				Name:      chunk.Name,
+			})
+			for _, v := range entry.vectors[i] {
+				binary.LittleEndian.PutUint32(word, math.Float32bits(v))
+				vectors.Write(word)
+			}
+		}
+		m.Files = append(m.Files, file)
+	}
+	sum := sha256.Sum256(vectors.Bytes())
+	m.Vectors = hex.EncodeToString(sum[:])
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(dir, vectorsName, vectors.Bytes()); err != nil {
+		return err
+	}
+	return writeAtomic(dir, manifestName, raw)
+}
+
+func writeAtomic(dir, name string, content []byte) error {
+	tmp, err := os.CreateTemp(dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/monorepo/internal/symbols"
+)
+
+var errFileLimit = errors.New("index file limit reached")
+
+// skippedDirs hold dependencies and build output, which are never indexed.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	".next":        true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+func inSkippedDir(rel string) bool {
+	for _, segment := range strings.Split(rel, "/") {
+		if skippedDirs[segment] {
+			return true
+		}
+	}
+	return false
+}
+
+// candidate is a source file found on disk and how it compares to the
+// index.
+type candidate struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// changedFile is a file whose content differs from what was indexed.
+type changedFile struct {
+	candidate
+	hash   string
+	chunks []Chunk
+	texts  []string
+}
+
+// sync brings the files under scope, a workspace-relative path or "" for
+// the whole workspace, up to date: new and modified files are chunked and
+// embedded, files that are gone are dropped, and files whose stat changed
+// but whose content did not only have their stat refreshed. Embedding runs
+// without holding the index lock; results are installed batch by batch and
+// saved to disk at the end, also when a batch fails.
+func (ix *Index) sync(w *workspace, scope string) (err error) {
+	w.mu.RLock()
+	known := make(map[string]*fileEntry, len(w.files))
+	for path, entry := range w.files {
+		if inScope(path, scope) {
+			known[path] = entry
+		}
+	}
+	outside := len(w.files) - len(known)
+	w.mu.RUnlock()
+
+	found, err := ix.walk(w.root, scope, ix.cfg.MaxFiles-outside)
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	seen := map[string]bool{}
+	var touched []changedFile
+	var changed []changedFile
+	for _, c := range found {
+		seen[c.path] = true
+		entry := known[c.path]
+		if entry != nil && entry.size == c.size && entry.modTime.Equal(c.modTime) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(w.root, filepath.FromSlash(c.path)))
+		if err != nil || !isText(raw) {
+			seen[c.path] = false
+			continue
+		}
+		sum := sha256.Sum256(raw)
+		file := changedFile{candidate: c, hash: hex.EncodeToString(sum[:])}
+		if entry != nil && entry.hash == file.hash {
+			touched = append(touched, file)
+			continue
+		}
+		file.chunks = chunkFile(c.path, string(raw), ix.cfg.MaxChunkLines)
+		file.texts = embedTexts(c.path, string(raw), file.chunks, ix.cfg.MaxEmbedBytes)
+		changed = append(changed, file)
+	}
+	for path := range known {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	if len(removed) == 0 && len(touched) == 0 && len(changed) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	for _, path := range removed {
+		delete(w.files, path)
+	}
+	for _, file := range touched {
+		if entry := w.files[file.path]; entry != nil {
+			entry.size, entry.modTime = file.size, file.modTime
+		}
+	}
+	w.mu.Unlock()
+
+	defer func() {
+		if saveErr := ix.save(w); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}()
+
+	for start := 0; start < len(changed); {
+		end, texts := start, 0
+		for end < len(changed) && (texts == 0 || texts+len(changed[end].texts) <= ix.cfg.BatchSize) {
+			texts += len(changed[end].texts)
+			end++
+		}
+		if err := ix.embedFiles(w, changed[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// walk lists the indexable files under scope, at most limit of them.
+func (ix *Index) walk(root, scope string, limit int) ([]candidate, error) {
+	start := filepath.Join(root, filepath.FromSlash(scope))
+	info, err := os.Stat(start)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() || symbols.Language(scope) == "" || info.Size() > ix.cfg.MaxFileBytes || limit <= 0 {
+			return nil, nil
+		}
+		return []candidate{{path: scope, size: info.Size(), modTime: info.ModTime()}}, nil
+	}
+
+	var found []candidate
+	err = filepath.WalkDir(start, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if current == start {
+				return err
+			}
+			return nil
+		}
+		if ctxErr := ix.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if entry.IsDir() {
+			if current != start && (skippedDirs[entry.Name()] || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || symbols.Language(entry.Name()) == "" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > ix.cfg.MaxFileBytes {
+			return nil
+		}
+		if len(found) >= limit {
+			return errFileLimit
+		}
+		rel, _ := relativeTo(root, current)
+		found = append(found, candidate{path: rel, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFileLimit) {
+		return nil, err
+	}
+	return found, nil
+}
+
+// embedFiles embeds the chunks of files in requests of up to BatchSize
+// texts and installs the files once all their vectors are in.
+func (ix *Index) embedFiles(w *workspace, files []changedFile) error {
+	var texts []string
+	for _, file := range files {
+		texts = append(texts, file.texts...)
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += ix.cfg.BatchSize {
+		end := start + ix.cfg.BatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := ix.embedder.Embed(ix.ctx, texts[start:end])
+		if err != nil {
+			return err
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(vectors) > 0 {
+		dimensions := len(vectors[0])
+		if w.dimensions != 0 && w.dimensions != dimensions {
+			// the endpoint now returns vectors of another size, so none of
+			// the old ones can be compared with the new
+			w.files = map[string]*fileEntry{}
+		}
+		w.dimensions = dimensions
+	}
+	offset := 0
+	for _, file := range files {
+		entry := &fileEntry{size: file.size, modTime: file.modTime, hash: file.hash, chunks: file.chunks}
+		entry.vectors = vectors[offset : offset+len(file.chunks)]
+		offset += len(file.chunks)
+		w.files[file.path] = entry
+	}
+	w.updatedAt = time.Now()
+	return nil
+}
+
+func (ix *Index) save(w *workspace) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if err := saveStore(w.dir, w.root, ix.embedder.ID(), w.dimensions, w.files, w.updatedAt); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	return nil
+}
+
+// embedTexts is what the embedder sees for each chunk: the path and
+// declaration name give it context the lines alone may lack.
+func embedTexts(path, content string, chunks []Chunk, maxBytes int) []string {
+	lines := strings.Split(content, "\n")
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		header := path
+		if chunk.Name != "" {
+			header += " " + chunk.Name
+		}
+		text := header + "\n" + strings.Join(lines[chunk.StartLine-1:chunk.EndLine], "\n")
+		if len(text) > maxBytes {
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			text = text[:cut]
+		}
+		texts[i] = text
+	}
+	return texts
+}
+
+// isText rejects binary files: those with NUL bytes or invalid UTF-8 near
+// the start.
+func isText(raw []byte) bool {
+	head := raw
+	if len(head) > 8*1024 {
+		head = head[:8*1024]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size == 1 && len(head) >= utf8.UTFMax {
+			return false
+		}
+		head = head[size:]
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TypeOpenAI = "openai"
+	TypeOllama = "ollama"
+	TypeFake   = "fake"
+)
+
+const requestTimeout = 10 * time.Minute
+
+// ProviderConfig describes one model endpoint. API keys are never part of
+// the config: they are read from APIKeyEnv or the OS keyring when needed.
+type ProviderConfig struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	BaseURL       string   `json:"baseUrl,omitempty"`
+	Model         string   `json:"model"`
+	Models        []string `json:"models,omitempty"`
+	APIKeyEnv     string   `json:"apiKeyEnv,omitempty"`
+	ContextWindow int      `json:"contextWindow,omitempty"`
+}
+
+type Config struct {
+	Default   string           `json:"default"`
+	Providers []ProviderConfig `json:"providers"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Default: "openai",
+		Providers: []ProviderConfig{
+			{
+				Name:          "openai",
+				Type:          TypeOpenAI,
+				BaseURL:       "https://api.openai.com/v1",
+				Model:         "gpt-4o-mini",
+				APIKeyEnv:     "OPENAI_API_KEY",
+				ContextWindow: 128_000,
+			},
+			{
+				Name:          "ollama",
+				Type:          TypeOllama,
+				BaseURL:       "http://127.0.0.1:11434",
+				Model:         "llama3.1",
+				ContextWindow: 8_192,
+			},
+			{Name: "fake", Type: TypeFake, Model: "echo", ContextWindow: 32_000},
+		},
+	}
+}
+
+// LoadConfig returns the default providers merged with the JSON file at
+// path, if it exists. Entries replace defaults with the same name.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var file Config
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, provider := range file.Providers {
+		cfg.Set(provider)
+	}
+	if strings.TrimSpace(file.Default) != "" {
+		cfg.Default = strings.TrimSpace(file.Default)
+	}
+	return cfg, nil
+}
+
+// Set adds provider or replaces the one with the same name.
+func (c *Config) Set(provider ProviderConfig) {
+	provider.Name = strings.TrimSpace(provider.Name)
+	if provider.Name == "" {
+		return
+	}
+	for i := range c.Providers {
+		if c.Providers[i].Name == provider.Name {
+			c.Providers[i] = provider
+			return
+		}
+	}
+	c.Providers = append(c.Providers, provider)
+}
+
+// ProviderInfo is what the renderer may learn about a provider: whether a
+// key is available and where from, but never the key itself.
+type ProviderInfo struct {
+	ProviderConfig
+	Default   bool   `json:"default"`
+	HasKey    bool   `json:"hasKey"`
+	KeySource string `json:"keySource,omitempty"`
+}
+
+// Registry builds providers from config on first use.
+type Registry struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	providers map[string]Provider
+}
+
+func NewRegistry(cfg Config) *Registry {
+	return &Registry{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: requestTimeout},
+		providers: map[string]Provider{},
+	}
+}
+
+// Get returns the named provider, or the default one when name is empty.
+func (r *Registry) Get(name string) (Provider, ProviderConfig, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = r.cfg.Default
+	}
+	var cfg ProviderConfig
+	found := false
+	for _, candidate := range r.cfg.Providers {
+		if candidate.Name == name {
+			cfg, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		return nil, ProviderConfig{}, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if provider, ok := r.providers[name]; ok {
+		return provider, cfg, nil
+	}
+	provider, err := r.build(cfg)
+	if err != nil {
+		return nil, cfg, err
+	}
+	r.providers[name] = provider
+	return provider, cfg, nil
+}
+
+func (r *Registry) build(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Type {
+	case TypeOpenAI:
+		key, _, err := ResolveKey(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewOpenAI(cfg, key, r.client), nil
+	case TypeOllama:
+		return NewOllama(cfg, r.client), nil
+	case TypeFake:
+		return NewFake(cfg.Name), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, cfg.Type)
+	}
+}
+
+func (r *Registry) List() []ProviderInfo {
+	out := make([]ProviderInfo, 0, len(r.cfg.Providers))
+	for _, cfg := range r.cfg.Providers {
+		info := ProviderInfo{ProviderConfig: cfg, Default: cfg.Name == r.cfg.Default}
+		if _, source, err := ResolveKey(cfg); err == nil {
+			info.HasKey = source != ""
+			info.KeySource = source
+		}
+		out = append(out, info)
+	}
+	return out
+}
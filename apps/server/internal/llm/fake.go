@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Fake is an offline provider for tests and UI work. It replays scripted
+// responses in order and, once the script is exhausted, echoes the last user
+// message. Content is streamed word by word like a real provider.
+type Fake struct {
+	name string
+
+	mu       sync.Mutex
+	script   []Response
+	requests []Request
+}
+
+func NewFake(name string) *Fake {
+	return &Fake{name: name}
+}
+
+func (p *Fake) Name() string {
+	return p.name
+}
+
+// Script queues responses returned by the next calls to Chat.
+func (p *Fake) Script(responses ...Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = append(p.script, responses...)
+}
+
+// Requests returns every request Chat has received.
+func (p *Fake) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Request(nil), p.requests...)
+}
+
+func (p *Fake) Chat(ctx context.Context, req Request, onEvent func(Event)) (Response, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	var out Response
+	if len(p.script) > 0 {
+		out = p.script[0]
+		p.script = p.script[1:]
+	} else {
+		out = Response{Message: Message{Content: "echo: " + lastUserContent(req.Messages)}}
+	}
+	p.mu.Unlock()
+
+	out.Message.Role = RoleAssistant
+	if out.Model == "" {
+		out.Model = firstNonEmpty(req.Model, "echo")
+	}
+
+	for _, word := range splitWords(out.Message.Content) {
+		if err := ctx.Err(); err != nil {
+			return Response{}, err
+		}
+		emit(onEvent, Event{Type: EventDelta, Delta: word})
+	}
+	for i := range out.Message.ToolCalls {
+		call := &out.Message.ToolCalls[i]
+		if call.ID == "" {
+			call.ID = generatedCallID(i)
+		}
+		if len(call.Arguments) == 0 {
+			call.Arguments = rawArguments("")
+		}
+		emitted := *call
+		emit(onEvent, Event{Type: EventToolCall, ToolCall: &emitted})
+	}
+
+	if out.Usage == (Usage{}) {
+		prompt := 0
+		for _, message := range req.Messages {
+			prompt += estimateTokens(message.Content)
+		}
+		completion := estimateTokens(out.Message.Content)
+		out.Usage = Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	}
+	usage := out.Usage
+	emit(onEvent, Event{Type: EventUsage, Usage: &usage})
+
+	if out.FinishReason == "" {
+		out.FinishReason = FinishStop
+		if len(out.Message.ToolCalls) > 0 {
+			out.FinishReason = FinishToolCalls
+		}
+	}
+	return out, ctx.Err()
+}
+
+func lastUserContent(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// splitWords splits text into chunks that each keep their trailing
+// whitespace, so joining them restores the original text.
+func splitWords(text string) []string {
+	var out []string
+	for text != "" {
+		end := strings.IndexAny(text, " \n\t")
+		if end < 0 {
+			out = append(out, text)
+			break
+		}
+		out = append(out, text[:end+1])
+		text = text[end+1:]
+	}
+	return out
+}
+
+// estimateTokens approximates a token count at four bytes per token.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFakeChat(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       []Response
+		messages     []Message
+		wantContent  string
+		wantCalls    []string
+		wantFinish   string
+		wantRequests int
+	}{
+		{
+			name:        "echoes the last user message without a script",
+			messages:    []Message{{Role: RoleUser, Content: "first"}, {Role: RoleAssistant, Content: "ok"}, {Role: RoleUser, Content: "hello there"}},
+			wantContent: "echo: hello there",
+			wantFinish:  FinishStop,
+		},
+		{
+			name:        "replays scripted content",
+			script:      []Response{{Message: Message{Content: "scripted reply\nwith two lines"}}},
+			messages:    []Message{{Role: RoleUser, Content: "hi"}},
+			wantContent: "scripted reply\nwith two lines",
+			wantFinish:  FinishStop,
+		},
+		{
+			name: "fills in tool call IDs and arguments",
+			script: []Response{{Message: Message{ToolCalls: []ToolCall{
+				{Name: "read_file", Arguments: json.RawMessage(`{"path":"a.txt"}`)},
+				{Name: "list_directory"},
+			}}}},
+			messages:   []Message{{Role: RoleUser, Content: "look around"}},
+			wantCalls:  []string{"read_file", "list_directory"},
+			wantFinish: FinishToolCalls,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake("fake")
+			fake.Script(tt.script...)
+
+			var deltas strings.Builder
+			var calls []ToolCall
+			var usage *Usage
+			resp, err := fake.Chat(context.Background(), Request{Model: "m", Messages: tt.messages}, func(event Event) {
+				switch event.Type {
+				case EventDelta:
+					deltas.WriteString(event.Delta)
+				case EventToolCall:
+					calls = append(calls, *event.ToolCall)
+				case EventUsage:
+					usage = event.Usage
+				}
+			})
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+
+			if resp.Message.Role != RoleAssistant {
+				t.Errorf("role = %q, want %q", resp.Message.Role, RoleAssistant)
+			}
+			if resp.Message.Content != tt.wantContent || deltas.String() != tt.wantContent {
+				t.Errorf("content = %q, deltas = %q, want %q", resp.Message.Content, deltas.String(), tt.wantContent)
+			}
+			if resp.FinishReason != tt.wantFinish {
+				t.Errorf("finish reason = %q, want %q", resp.FinishReason, tt.wantFinish)
+			}
+			if len(calls) != len(tt.wantCalls) || len(resp.Message.ToolCalls) != len(tt.wantCalls) {
+				t.Fatalf("got %d tool call events and %d tool calls, want %d", len(calls), len(resp.Message.ToolCalls), len(tt.wantCalls))
+			}
+			for i, name := range tt.wantCalls {
+				call := resp.Message.ToolCalls[i]
+				if call.Name != name || calls[i].Name != name {
+					t.Errorf("tool call %d = %q, want %q", i, call.Name, name)
+				}
+				if call.ID == "" || call.ID != calls[i].ID {
+					t.Errorf("tool call %d ID = %q, event ID = %q", i, call.ID, calls[i].ID)
+				}
+				if !json.Valid(call.Arguments) {
+					t.Errorf("tool call %d arguments %q are not JSON", i, call.Arguments)
+				}
+			}
+			if usage == nil || *usage != resp.Usage {
+				t.Errorf("usage event = %v, response usage = %v", usage, resp.Usage)
+			}
+			if requests := fake.Requests(); len(requests) != 1 || requests[0].Model != "m" {
+				t.Errorf("requests = %+v", requests)
+			}
+		})
+	}
+}
+
+func TestFakeScriptOrder(t *testing.T) {
+	fake := NewFake("fake")
+	fake.Script(Response{Message: Message{Content: "one"}}, Response{Message: Message{Content: "two"}})
+
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "again"}}}
+	for _, want := range []string{"one", "two", "echo: again"} {
+		resp, err := fake.Chat(context.Background(), req, nil)
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if resp.Message.Content != want {
+			t.Errorf("content = %q, want %q", resp.Message.Content, want)
+		}
+	}
+	if got := len(fake.Requests()); got != 3 {
+		t.Errorf("recorded %d requests, want 3", got)
+	}
+}
+
+func TestFakeCanceled(t *testing.T) {
+	fake := NewFake("fake")
+	fake.Script(Response{Message: Message{Content: "never streamed"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deltas := 0
+	_, err := fake.Chat(ctx, Request{}, func(event Event) {
+		if event.Type == EventDelta {
+			deltas++
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if deltas != 0 {
+		t.Errorf("streamed %d deltas after cancellation", deltas)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+
+package llm
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// keyringLookup reads a generic password from the login keychain.
+func keyringLookup(service, account string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
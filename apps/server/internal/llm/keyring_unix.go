@@ -0,0 +1,26 @@
+//go:build !darwin && !windows
+
+package llm
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// keyringLookup reads a secret from the Secret Service (GNOME Keyring,
+// KWallet) through secret-tool, if it is installed.
+func keyringLookup(service, account string) (string, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package llm
+
+import "errors"
+
+// keyringLookup is not implemented on Windows; keys come from the
+// environment there.
+func keyringLookup(_, _ string) (string, error) {
+	return "", errors.New("keyring lookup is not supported on windows")
+}
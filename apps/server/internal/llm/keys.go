@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"os"
+	"strings"
+)
+
+// keyringService is the service name provider keys are stored under in the
+// OS keyring, with the provider name as the account.
+const keyringService = "omt"
+
+const (
+	KeySourceEnv     = "env"
+	KeySourceKeyring = "keyring"
+)
+
+// ResolveKey finds the API key for a provider, first in its APIKeyEnv
+// variable, then in the OS keyring. Providers that need no key resolve to an
+// empty key and source; a provider that needs one fails with ErrMissingKey.
+func ResolveKey(cfg ProviderConfig) (string, string, error) {
+	if cfg.APIKeyEnv != "" {
+		if key := strings.TrimSpace(os.Getenv(cfg.APIKeyEnv)); key != "" {
+			return key, KeySourceEnv, nil
+		}
+	}
+	if key, err := keyringLookup(keyringService, cfg.Name); err == nil && key != "" {
+		return key, KeySourceKeyring, nil
+	}
+	if cfg.Type == TypeOpenAI && !isLocalURL(cfg.BaseURL) {
+		return "", "", ErrMissingKey
+	}
+	return "", "", nil
+}
+
+// isLocalURL reports whether an OpenAI-compatible endpoint is a local
+// server, such as llama.cpp or LM Studio, that accepts requests without a
+// key.
+func isLocalURL(raw string) bool {
+	raw = strings.ToLower(raw)
+	for _, prefix := range []string{"http://127.0.0.1", "http://localhost", "http://[::1]"} {
+		if strings.HasPrefix(raw, prefix) {
+			return true
+		}
+	}
+	return false
+}
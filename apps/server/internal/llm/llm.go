@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrProviderNotFound = errors.New("llm provider not found")
+	ErrMissingKey       = errors.New("llm provider has no API key")
+	ErrMissingModel     = errors.New("llm model is required")
+	ErrUnknownType      = errors.New("unknown llm provider type")
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+const (
+	FinishStop      = "stop"
+	FinishToolCalls = "tool_calls"
+	FinishLength    = "length"
+)
+
+const (
+	EventDelta    = "delta"
+	EventToolCall = "tool_call"
+	EventUsage    = "usage"
+)
+
+// Message is one chat message. Assistant messages may carry tool calls;
+// tool messages answer the call named by ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+	ToolCallID string     `json:"toolCallId,omitempty"`
+	Name       string     `json:"name,omitempty"`
+}
+
+// ToolCall is a function call requested by the model. Arguments is the JSON
+// object the model produced, which may be malformed.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Tool describes a function the model may call. Parameters is a JSON Schema
+// object.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type Request struct {
+	// Model overrides the provider's configured model.
+	Model       string
+	Messages    []Message
+	Tools       []Tool
+	Temperature *float64
+	MaxTokens   int
+}
+
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Event is streamed while a completion is generated: text deltas as they
+// arrive, each tool call once its arguments are complete, and usage when the
+// provider reports it.
+type Event struct {
+	Type     string    `json:"type"`
+	Delta    string    `json:"delta,omitempty"`
+	ToolCall *ToolCall `json:"toolCall,omitempty"`
+	Usage    *Usage    `json:"usage,omitempty"`
+}
+
+// Response is the assembled assistant message of a completion.
+type Response struct {
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finishReason"`
+	Usage        Usage   `json:"usage"`
+	Model        string  `json:"model"`
+}
+
+// Provider generates streaming chat completions. onEvent may be nil and is
+// called from the goroutine running Chat.
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, req Request, onEvent func(Event)) (Response, error)
+}
+
+// ProviderError is a non-success reply from a provider's API.
+type ProviderError struct {
+	Provider string
+	Status   int
+	Message  string
+}
+
+func (e *ProviderError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+	}
+	return fmt.Sprintf("%s: status %d: %s", e.Provider, e.Status, e.Message)
+}
+
+func emit(onEvent func(Event), event Event) {
+	if onEvent != nil {
+		onEvent(event)
+	}
+}
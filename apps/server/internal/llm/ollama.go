@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Ollama talks to a local Ollama server through its native /api/chat
+// endpoint, which streams newline-delimited JSON.
+type Ollama struct {
+	cfg    ProviderConfig
+	client *http.Client
+}
+
+func NewOllama(cfg ProviderConfig, client *http.Client) *Ollama {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Ollama{cfg: cfg, client: client}
+}
+
+func (p *Ollama) Name() string {
+	return p.cfg.Name
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaChunk struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *Ollama) Chat(ctx context.Context, req Request, onEvent func(Event)) (Response, error) {
+	model := firstNonEmpty(req.Model, p.cfg.Model)
+	if model == "" {
+		return Response{}, ErrMissingModel
+	}
+
+	body := ollamaRequest{Model: model, Stream: true}
+	for _, message := range req.Messages {
+		body.Messages = append(body.Messages, toOllamaMessage(message))
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{Type: "function", Function: tool})
+	}
+	options := map[string]any{}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if p.cfg.ContextWindow > 0 {
+		options["num_ctx"] = p.cfg.ContextWindow
+	}
+	if len(options) > 0 {
+		body.Options = options
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/api/chat"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, readProviderError(p.cfg.Name, resp)
+	}
+
+	out := Response{Message: Message{Role: RoleAssistant}, Model: model}
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return Response{}, &ProviderError{Provider: p.cfg.Name, Message: chunk.Error}
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			emit(onEvent, Event{Type: EventDelta, Delta: chunk.Message.Content})
+		}
+		for _, wire := range chunk.Message.ToolCalls {
+			call := ToolCall{
+				ID:        generatedCallID(len(out.Message.ToolCalls)),
+				Name:      wire.Function.Name,
+				Arguments: rawArguments(string(wire.Function.Arguments)),
+			}
+			out.Message.ToolCalls = append(out.Message.ToolCalls, call)
+			emitted := call
+			emit(onEvent, Event{Type: EventToolCall, ToolCall: &emitted})
+		}
+		if chunk.Done {
+			out.Usage = Usage{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+				TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+			}
+			usage := out.Usage
+			emit(onEvent, Event{Type: EventUsage, Usage: &usage})
+			out.FinishReason = chunk.DoneReason
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, err
+	}
+
+	out.Message.Content = content.String()
+	switch {
+	case len(out.Message.ToolCalls) > 0:
+		out.FinishReason = FinishToolCalls
+	case out.FinishReason == FinishLength:
+	default:
+		out.FinishReason = FinishStop
+	}
+	return out, nil
+}
+
+func toOllamaMessage(message Message) ollamaMessage {
+	out := ollamaMessage{Role: message.Role, Content: message.Content}
+	for _, call := range message.ToolCalls {
+		var wire ollamaToolCall
+		wire.Function.Name = call.Name
+		wire.Function.Arguments = call.Arguments
+		if len(wire.Function.Arguments) == 0 || !json.Valid(wire.Function.Arguments) {
+			wire.Function.Arguments = json.RawMessage("{}")
+		}
+		out.ToolCalls = append(out.ToolCalls, wire)
+	}
+	return out
+}
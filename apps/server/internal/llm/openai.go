@@ -0,0 +1,303 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxErrorBodyBytes = 64 * 1024
+
+// OpenAI talks to any endpoint implementing the OpenAI chat completions API,
+// including llama.cpp, vLLM and LM Studio.
+type OpenAI struct {
+	cfg    ProviderConfig
+	key    string
+	client *http.Client
+}
+
+func NewOpenAI(cfg ProviderConfig, key string, client *http.Client) *OpenAI {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &OpenAI{cfg: cfg, key: key, client: client}
+}
+
+func (p *OpenAI) Name() string {
+	return p.cfg.Name
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	Name       string           `json:"name,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function Tool   `json:"function"`
+}
+
+type openAIRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Tools         []openAITool    `json:"tools,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Stream        bool            `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type openAIChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAI) Chat(ctx context.Context, req Request, onEvent func(Event)) (Response, error) {
+	model := firstNonEmpty(req.Model, p.cfg.Model)
+	if model == "" {
+		return Response{}, ErrMissingModel
+	}
+
+	body := openAIRequest{
+		Model:       model,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Stream:      true,
+	}
+	body.StreamOptions.IncludeUsage = true
+	for _, message := range req.Messages {
+		body.Messages = append(body.Messages, toOpenAIMessage(message))
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{Type: "function", Function: tool})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if p.key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.key)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, readProviderError(p.cfg.Name, resp)
+	}
+
+	out := Response{Message: Message{Role: RoleAssistant}, Model: model}
+	var content strings.Builder
+	calls := map[int]*ToolCall{}
+	arguments := map[int]*strings.Builder{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != nil {
+			return Response{}, &ProviderError{Provider: p.cfg.Name, Message: chunk.Error.Message}
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+			usage := out.Usage
+			emit(onEvent, Event{Type: EventUsage, Usage: &usage})
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				emit(onEvent, Event{Type: EventDelta, Delta: choice.Delta.Content})
+			}
+			for i, delta := range choice.Delta.ToolCalls {
+				index := i
+				if delta.Index != nil {
+					index = *delta.Index
+				}
+				call, ok := calls[index]
+				if !ok {
+					call = &ToolCall{}
+					calls[index] = call
+					arguments[index] = &strings.Builder{}
+				}
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Function.Name != "" {
+					call.Name = delta.Function.Name
+				}
+				arguments[index].WriteString(delta.Function.Arguments)
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				out.FinishReason = *choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, err
+	}
+
+	out.Message.Content = content.String()
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		call := *calls[index]
+		call.Arguments = rawArguments(arguments[index].String())
+		if call.ID == "" {
+			call.ID = generatedCallID(index)
+		}
+		out.Message.ToolCalls = append(out.Message.ToolCalls, call)
+		emitted := call
+		emit(onEvent, Event{Type: EventToolCall, ToolCall: &emitted})
+	}
+	if len(out.Message.ToolCalls) > 0 && out.FinishReason == "" {
+		out.FinishReason = FinishToolCalls
+	}
+	if out.FinishReason == "" {
+		out.FinishReason = FinishStop
+	}
+	return out, nil
+}
+
+func toOpenAIMessage(message Message) openAIMessage {
+	content := message.Content
+	out := openAIMessage{
+		Role:       message.Role,
+		Content:    &content,
+		ToolCallID: message.ToolCallID,
+		Name:       message.Name,
+	}
+	if message.Role == RoleAssistant && content == "" && len(message.ToolCalls) > 0 {
+		out.Content = nil
+	}
+	for _, call := range message.ToolCalls {
+		var wire openAIToolCall
+		wire.ID = call.ID
+		wire.Type = "function"
+		wire.Function.Name = call.Name
+		wire.Function.Arguments = string(call.Arguments)
+		out.ToolCalls = append(out.ToolCalls, wire)
+	}
+	return out
+}
+
+// rawArguments keeps valid JSON as-is and wraps anything else as a JSON
+// string, so a malformed call still round-trips and the tool can report it.
+func rawArguments(text string) json.RawMessage {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(text)) {
+		return json.RawMessage(text)
+	}
+	quoted, _ := json.Marshal(text)
+	return quoted
+}
+
+func readProviderError(name string, resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	message := strings.TrimSpace(string(raw))
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(raw, &parsed) == nil && len(parsed.Error) > 0 {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(parsed.Error, &detail) == nil && detail.Message != "" {
+			message = detail.Message
+		} else {
+			var text string
+			if json.Unmarshal(parsed.Error, &text) == nil && text != "" {
+				message = text
+			}
+		}
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	return &ProviderError{Provider: name, Status: resp.StatusCode, Message: message}
+}
+
+// generatedCallID names a tool call for backends that do not assign IDs, so
+// tool results can still be matched to their call.
+func generatedCallID(index int) string {
+	return "call_" + strconv.Itoa(index)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
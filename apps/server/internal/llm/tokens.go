@@ -0,0 +1,342 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+const (
+	TokenizerO200K         = "o200k"
+	TokenizerCL100K        = "cl100k"
+	TokenizerLlama3        = "llama3"
+	TokenizerSentencePiece = "sentencepiece"
+	// TokenizerEstimate is the fallback for models of unknown family.
+	TokenizerEstimate = "estimate"
+)
+
+const defaultContextWindow = 8_192
+
+// messageOverheadTokens is what chat templates add around each message
+// (role markers and separators); replyOverheadTokens primes the reply.
+const (
+	messageOverheadTokens = 4
+	replyOverheadTokens   = 3
+)
+
+// Tokenizer counts tokens for one model family. The OpenAI families are
+// counted exactly with their BPE ranks, which are embedded in the server.
+// Vocabularies of other families do not ship with it, so their counts come
+// from splitting text the way the family's pre-tokenizer does and sizing
+// each piece by the family's average merge length; Exact reports false for
+// those estimates.
+type Tokenizer struct {
+	name string
+	bpe  *bpeEncoding
+	// wordChars is the average number of letters per token inside words
+	// too long to be a single vocabulary entry.
+	wordChars int
+	// maxWord is the longest word assumed to be a single token.
+	maxWord int
+}
+
+var tokenizers = map[string]Tokenizer{
+	TokenizerO200K:         {name: TokenizerO200K, bpe: &bpeEncoding{name: tiktoken.MODEL_O200K_BASE}, wordChars: 5, maxWord: 9},
+	TokenizerCL100K:        {name: TokenizerCL100K, bpe: &bpeEncoding{name: tiktoken.MODEL_CL100K_BASE}, wordChars: 4, maxWord: 8},
+	TokenizerLlama3:        {name: TokenizerLlama3, wordChars: 4, maxWord: 8},
+	TokenizerSentencePiece: {name: TokenizerSentencePiece, wordChars: 3, maxWord: 6},
+	TokenizerEstimate:      {name: TokenizerEstimate, wordChars: 4, maxWord: 8},
+}
+
+func init() {
+	// read the embedded ranks instead of downloading them
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// bpeCacheEntries bounds the remembered counts of each encoding, and
+// bpeCacheMinBytes is the shortest text worth remembering.
+const (
+	bpeCacheEntries  = 4096
+	bpeCacheMinBytes = 256
+)
+
+// bpeEncoding loads a BPE vocabulary on first use; parsing the ranks takes
+// a moment and most servers only ever need one of them. Counts of longer
+// texts are remembered, since every prompt of a thread repeats its history.
+type bpeEncoding struct {
+	name    string
+	once    sync.Once
+	encoder *tiktoken.Tiktoken
+
+	mu     sync.Mutex
+	counts map[[sha256.Size]byte]int
+}
+
+func (e *bpeEncoding) get() *tiktoken.Tiktoken {
+	e.once.Do(func() {
+		if encoder, err := tiktoken.GetEncoding(e.name); err == nil {
+			e.encoder = encoder
+		}
+	})
+	return e.encoder
+}
+
+func (e *bpeEncoding) count(encoder *tiktoken.Tiktoken, text string) int {
+	if len(text) < bpeCacheMinBytes {
+		return len(encoder.EncodeOrdinary(text))
+	}
+	key := sha256.Sum256([]byte(text))
+	e.mu.Lock()
+	n, ok := e.counts[key]
+	e.mu.Unlock()
+	if ok {
+		return n
+	}
+
+	n = len(encoder.EncodeOrdinary(text))
+	e.mu.Lock()
+	if e.counts == nil || len(e.counts) >= bpeCacheEntries {
+		e.counts = make(map[[sha256.Size]byte]int)
+	}
+	e.counts[key] = n
+	e.mu.Unlock()
+	return n
+}
+
+// modelFamilies maps model name prefixes to their tokenizer; the longest
+// matching prefix wins.
+var modelFamilies = map[string]string{
+	"gpt-4o":    TokenizerO200K,
+	"gpt-4.1":   TokenizerO200K,
+	"gpt-4.5":   TokenizerO200K,
+	"gpt-5":     TokenizerO200K,
+	"o1":        TokenizerO200K,
+	"o3":        TokenizerO200K,
+	"o4":        TokenizerO200K,
+	"gpt-4":     TokenizerCL100K,
+	"gpt-3.5":   TokenizerCL100K,
+	"llama3":    TokenizerLlama3,
+	"llama-3":   TokenizerLlama3,
+	"llama2":    TokenizerSentencePiece,
+	"mistral":   TokenizerSentencePiece,
+	"mixtral":   TokenizerSentencePiece,
+	"gemma":     TokenizerSentencePiece,
+	"codellama": TokenizerSentencePiece,
+}
+
+// modelContextWindows holds the context length of well-known models by
+// name prefix; the longest matching prefix wins.
+var modelContextWindows = map[string]int{
+	"gpt-4o":        128_000,
+	"gpt-4.1":       1_047_576,
+	"gpt-4.5":       128_000,
+	"gpt-5":         400_000,
+	"gpt-4-turbo":   128_000,
+	"gpt-4-32k":     32_768,
+	"gpt-4":         8_192,
+	"gpt-3.5-turbo": 16_385,
+	"o1":            200_000,
+	"o3":            200_000,
+	"o4":            200_000,
+	"llama3.1":      131_072,
+	"llama3.2":      131_072,
+	"llama3.3":      131_072,
+	"llama3":        8_192,
+	"mistral":       32_768,
+	"mixtral":       32_768,
+	"qwen2.5":       32_768,
+	"gemma2":        8_192,
+	"codellama":     16_384,
+}
+
+// TokenizerFor returns the tokenizer of model's family, falling back to an
+// estimate sized like cl100k, which sits between the larger and smaller
+// vocabularies.
+func TokenizerFor(model string) Tokenizer {
+	name := normalizeModel(model)
+	family, best := TokenizerEstimate, -1
+	for prefix, candidate := range modelFamilies {
+		if strings.HasPrefix(name, prefix) && len(prefix) > best {
+			family, best = candidate, len(prefix)
+		}
+	}
+	return tokenizers[family]
+}
+
+// ContextWindow returns the context length to budget for model on a
+// provider. A configured window wins for the provider's own model and for
+// Ollama, where the server passes it as num_ctx; other models use the
+// known-model table.
+func ContextWindow(cfg ProviderConfig, model string) int {
+	if model == "" {
+		model = cfg.Model
+	}
+	if cfg.ContextWindow > 0 && (model == cfg.Model || cfg.Type == TypeOllama) {
+		return cfg.ContextWindow
+	}
+	name := normalizeModel(model)
+	window, best := 0, -1
+	for prefix, candidate := range modelContextWindows {
+		if strings.HasPrefix(name, prefix) && len(prefix) > best {
+			window, best = candidate, len(prefix)
+		}
+	}
+	if window > 0 {
+		return window
+	}
+	if cfg.ContextWindow > 0 {
+		return cfg.ContextWindow
+	}
+	return defaultContextWindow
+}
+
+func normalizeModel(model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	// drop Ollama tags ("llama3.1:8b") and vendor paths ("meta/llama3")
+	if name, _, ok := strings.Cut(model, ":"); ok {
+		model = name
+	}
+	if index := strings.LastIndex(model, "/"); index >= 0 {
+		model = model[index+1:]
+	}
+	return model
+}
+
+func (t Tokenizer) Name() string {
+	return t.name
+}
+
+// Exact reports whether counts come from the family's vocabulary rather
+// than an estimate.
+func (t Tokenizer) Exact() bool {
+	return t.bpe != nil && t.bpe.get() != nil
+}
+
+// Count returns the tokens in text.
+func (t Tokenizer) Count(text string) int {
+	if t.bpe != nil {
+		if encoder := t.bpe.get(); encoder != nil {
+			return t.bpe.count(encoder, text)
+		}
+	}
+	return t.estimate(text)
+}
+
+// estimate sizes text from its pre-tokenized pieces.
+func (t Tokenizer) estimate(text string) int {
+	total := 0
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		switch {
+		case r == '\n' || r == '\r':
+			// runs of newlines merge into one token
+			n := runLength(text, func(r rune) bool { return r == '\n' || r == '\r' })
+			text = text[n:]
+			total++
+		case r == ' ' || r == '\t':
+			// a single space joins the following word or punctuation;
+			// other whitespace becomes tokens of up to four columns
+			n := runLength(text, func(r rune) bool { return r == ' ' || r == '\t' })
+			text = text[n:]
+			if n == 1 && r == ' ' && len(text) > 0 {
+				if next := firstRune(text); !unicode.IsSpace(next) && !unicode.IsDigit(next) {
+					continue
+				}
+			}
+			total += (n + 3) / 4
+		case unicode.IsLetter(r) && r < utf8.RuneSelf:
+			total += t.word(&text)
+		case unicode.IsDigit(r):
+			// numbers split into groups of up to three digits
+			n := runLength(text, unicode.IsDigit)
+			text = text[n:]
+			total += (n + 2) / 3
+		case r >= utf8.RuneSelf && isWideScript(r):
+			// CJK and similar scripts take roughly one token per character
+			text = text[size:]
+			total++
+		case r >= utf8.RuneSelf && unicode.IsLetter(r):
+			// other non-ASCII letters cost about one token per two bytes
+			n := runLength(text, func(r rune) bool { return r >= utf8.RuneSelf && unicode.IsLetter(r) && !isWideScript(r) })
+			text = text[n:]
+			total += (n + 1) / 2
+		default:
+			// punctuation and symbols merge in pairs, as in "()" or "//"
+			n := runLength(text, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+			})
+			text = text[n:]
+			total += (n + 1) / 2
+		}
+	}
+	return total
+}
+
+// word consumes the run of ASCII letters text starts with and sizes it.
+func (t Tokenizer) word(text *string) int {
+	n := runLength(*text, func(r rune) bool { return r < utf8.RuneSelf && unicode.IsLetter(r) })
+	*text = (*text)[n:]
+	if n <= t.maxWord {
+		return 1
+	}
+	return (n + t.wordChars - 1) / t.wordChars
+}
+
+// CountMessages counts the prompt tokens of a chat request's messages,
+// including per-message framing.
+func (t Tokenizer) CountMessages(messages []Message) int {
+	total := replyOverheadTokens
+	for _, message := range messages {
+		total += t.CountMessage(message)
+	}
+	return total
+}
+
+func (t Tokenizer) CountMessage(message Message) int {
+	total := messageOverheadTokens + t.Count(message.Content)
+	for _, call := range message.ToolCalls {
+		total += t.Count(call.Name) + t.Count(string(call.Arguments)) + messageOverheadTokens
+	}
+	return total
+}
+
+// CountTools counts what tool definitions add to a prompt. Providers
+// render them into the system prompt, close to their JSON form.
+func (t Tokenizer) CountTools(tools []Tool) int {
+	total := 0
+	for _, tool := range tools {
+		total += messageOverheadTokens + t.Count(tool.Name) + t.Count(tool.Description) + t.Count(string(tool.Parameters))
+	}
+	return total
+}
+
+// runLength returns the byte length of the run of runes at the start of
+// text that match, or of the first rune when none does.
+func runLength(text string, match func(rune) bool) int {
+	n := 0
+	for n < len(text) {
+		r, size := utf8.DecodeRuneInString(text[n:])
+		if !match(r) {
+			break
+		}
+		n += size
+	}
+	if n == 0 {
+		_, n = utf8.DecodeRuneInString(text)
+	}
+	return n
+}
+
+func firstRune(text string) rune {
+	r, _ := utf8.DecodeRuneInString(text)
+	return r
+}
+
+func isWideScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai)
+}
@@ -0,0 +1,77 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ServerConfig describes how to start the language server for a language
+// and which file extensions it serves.
+type ServerConfig struct {
+	Language   string   `json:"language"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args,omitempty"`
+	Extensions []string `json:"extensions"`
+}
+
+func DefaultServers() []ServerConfig {
+	return []ServerConfig{
+		{Language: "go", Command: "gopls", Extensions: []string{".go"}},
+		{
+			Language:   "typescript",
+			Command:    "typescript-language-server",
+			Args:       []string{"--stdio"},
+			Extensions: []string{".ts", ".tsx", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs"},
+		},
+		{Language: "python", Command: "pyright-langserver", Args: []string{"--stdio"}, Extensions: []string{".py", ".pyi"}},
+		{Language: "rust", Command: "rust-analyzer", Extensions: []string{".rs"}},
+		{Language: "c", Command: "clangd", Extensions: []string{".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".hh"}},
+	}
+}
+
+// LoadServers returns the default servers overridden by the JSON array in
+// path, if it exists. An entry replaces the default with the same language;
+// an entry without a command removes it.
+func LoadServers(path string) ([]ServerConfig, error) {
+	servers := DefaultServers()
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return servers, nil
+	}
+	if err != nil {
+		return servers, err
+	}
+
+	var overrides []ServerConfig
+	if err := json.Unmarshal(raw, &overrides); err != nil {
+		return servers, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, override := range overrides {
+		override.Language = strings.ToLower(strings.TrimSpace(override.Language))
+		if override.Language == "" {
+			continue
+		}
+		replaced := false
+		for i := range servers {
+			if servers[i].Language == override.Language {
+				servers[i] = override
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			servers = append(servers, override)
+		}
+	}
+
+	kept := servers[:0]
+	for _, server := range servers {
+		if strings.TrimSpace(server.Command) != "" {
+			kept = append(kept, server)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"unicode/utf8"
+)
+
+// document is the proxy's copy of an open text document, kept so a restarted
+// server can be sent the current text instead of what was first opened.
+type document struct {
+	URI        string
+	LanguageID string
+	Version    int
+	Text       string
+	// refs counts the clients that have the document open.
+	refs int
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type contentChange struct {
+	Range *lspRange `json:"range,omitempty"`
+	Text  string    `json:"text"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []contentChange `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+// applyChanges applies full or incremental content changes in order.
+func applyChanges(text string, changes []contentChange) string {
+	for _, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		start := offsetAt(text, change.Range.Start)
+		end := offsetAt(text, change.Range.End)
+		if end < start {
+			start, end = end, start
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	return text
+}
+
+// offsetAt converts an LSP position, whose character counts UTF-16 code
+// units, to a byte offset. Positions past the end of a line or the text are
+// clamped, as the protocol requires.
+func offsetAt(text string, pos lspPosition) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := indexByteFrom(text, '\n', offset)
+		if next < 0 {
+			return len(text)
+		}
+		offset = next + 1
+	}
+
+	units := 0
+	for offset < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' || r == '\r' {
+			break
+		}
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += size
+	}
+	return offset
+}
+
+func indexByteFrom(text string, b byte, from int) int {
+	for i := from; i < len(text); i++ {
+		if text[i] == b {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,832 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/procgroup"
+)
+
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateStopped    = "stopped"
+)
+
+const (
+	clientQueueSize     = 1024
+	serverQueueSize     = 4096
+	maxBacklogMessages  = 4096
+	maxStderrTailBytes  = 8 * 1024
+	maxRestarts         = 5
+	restartWindow       = 3 * time.Minute
+	restartBaseDelay    = 500 * time.Millisecond
+	restartMaxDelay     = 5 * time.Second
+	shutdownGrace       = 3 * time.Second
+	terminateGrace      = 2 * time.Second
+	messageTypeError    = 1
+	messageTypeWarning  = 2
+	messageTypeInfo     = 3
+	showMessageMethod   = "window/showMessage"
+	configurationMethod = "workspace/configuration"
+)
+
+// InstanceStatus is a snapshot of one running language server.
+type InstanceStatus struct {
+	Root      string    `json:"root"`
+	State     string    `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	Clients   int       `json:"clients"`
+	Documents int       `json:"documents"`
+	Restarts  int       `json:"restarts"`
+	StartedAt time.Time `json:"startedAt"`
+	Stderr    string    `json:"stderr,omitempty"`
+}
+
+// pendingRequest is a request forwarded to the server under a proxy ID.
+// Requests the proxy sends itself have no client and a callback instead.
+type pendingRequest struct {
+	client   *Client
+	id       json.RawMessage
+	onResult func(msg *message)
+}
+
+type initWaiter struct {
+	client *Client
+	id     json.RawMessage
+}
+
+type backlogEntry struct {
+	client *Client
+	msg    *message
+}
+
+// process is one run of the server binary. Messages for its stdin go
+// through a queue so callers never block on a slow server.
+type process struct {
+	cmd        *exec.Cmd
+	generation int
+	writes     chan []byte
+	done       chan struct{}
+	startedAt  time.Time
+}
+
+// instance is a language server shared by every client attached to the same
+// language and workspace root. Client request IDs are rewritten so replies
+// reach the tab that asked, and didOpen/didClose are reference counted so
+// two tabs showing the same file do not confuse the server.
+type instance struct {
+	manager *Manager
+	key     instanceKey
+	config  ServerConfig
+	notify  NotificationHandler
+	exit    ExitHandler
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	// primary receives the server's own requests; it is the oldest client.
+	primary *Client
+	proc    *process
+	stopped bool
+	ready   bool
+	backlog []backlogEntry
+
+	nextID      int64
+	pending     map[int64]*pendingRequest
+	serverCalls map[string]*Client
+
+	initParams      json.RawMessage
+	initResult      json.RawMessage
+	initInFlight    bool
+	initWaiters     []initWaiter
+	clientInitiated bool
+	initializedSent bool
+
+	documents map[string]*document
+	restarts  []time.Time
+	total     int
+	idle      *time.Timer
+	stderr    *procgroup.TailBuffer
+}
+
+func newInstance(manager *Manager, key instanceKey, config ServerConfig, notify NotificationHandler, exit ExitHandler) *instance {
+	return &instance{
+		manager:     manager,
+		key:         key,
+		config:      config,
+		notify:      notify,
+		exit:        exit,
+		clients:     map[*Client]struct{}{},
+		pending:     map[int64]*pendingRequest{},
+		serverCalls: map[string]*Client{},
+		documents:   map[string]*document{},
+		stderr:      procgroup.NewTailBuffer(maxStderrTailBytes),
+	}
+}
+
+func (inst *instance) start() error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if err := inst.spawnLocked(); err != nil {
+		return err
+	}
+	inst.ready = true
+	return nil
+}
+
+func (inst *instance) spawnLocked() error {
+	cmd := exec.Command(inst.config.Command, inst.config.Args...)
+	cmd.Dir = inst.key.root
+	cmd.Env = os.Environ()
+	procgroup.Configure(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = inst.stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStartFailed, err)
+	}
+
+	generation := 1
+	if inst.proc != nil {
+		generation = inst.proc.generation + 1
+	}
+	proc := &process{
+		cmd:        cmd,
+		generation: generation,
+		writes:     make(chan []byte, serverQueueSize),
+		done:       make(chan struct{}),
+		startedAt:  time.Now().UTC(),
+	}
+	inst.proc = proc
+	inst.initializedSent = false
+
+	go func() {
+		broken := false
+		for body := range proc.writes {
+			if broken {
+				continue
+			}
+			if err := writeFrame(stdin, body); err != nil {
+				broken = true
+			}
+		}
+		_ = stdin.Close()
+	}()
+
+	go func() {
+		reader := bufio.NewReaderSize(stdout, 64*1024)
+		for {
+			body, err := readFrame(reader)
+			if err != nil {
+				break
+			}
+			inst.handleServerMessage(proc, body)
+		}
+		// Drain so the server never blocks on a full pipe while exiting.
+		_, _ = io.Copy(io.Discard, stdout)
+		err := cmd.Wait()
+		close(proc.done)
+		inst.handleExit(proc, err)
+	}()
+	return nil
+}
+
+// sendLocked queues a message for the server's stdin. It reports false if
+// the server is not running or not keeping up.
+func (inst *instance) sendLocked(body []byte) bool {
+	if inst.proc == nil {
+		return false
+	}
+	select {
+	case <-inst.proc.done:
+		return false
+	default:
+	}
+	select {
+	case inst.proc.writes <- body:
+		return true
+	default:
+		return false
+	}
+}
+
+func (inst *instance) requestLocked(method string, params json.RawMessage, onResult func(msg *message)) bool {
+	inst.nextID++
+	id := inst.nextID
+	inst.pending[id] = &pendingRequest{onResult: onResult}
+	if !inst.sendLocked((&message{ID: intID(id), Method: method, Params: params}).encode()) {
+		delete(inst.pending, id)
+		return false
+	}
+	return true
+}
+
+func (inst *instance) attach(seq int64) (*Client, error) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.stopped {
+		return nil, ErrClosed
+	}
+	if inst.idle != nil {
+		inst.idle.Stop()
+		inst.idle = nil
+	}
+	client := &Client{
+		inst: inst,
+		seq:  seq,
+		out:  make(chan []byte, clientQueueSize),
+		done: make(chan struct{}),
+		open: map[string]bool{},
+	}
+	inst.clients[client] = struct{}{}
+	if inst.primary == nil {
+		inst.primary = client
+	}
+	return client, nil
+}
+
+func (inst *instance) detach(client *Client) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	inst.detachLocked(client)
+}
+
+func (inst *instance) detachLocked(client *Client) {
+	if _, ok := inst.clients[client]; !ok {
+		return
+	}
+	delete(inst.clients, client)
+	client.closeLocked()
+
+	for uri := range client.open {
+		inst.closeDocumentLocked(uri)
+	}
+	for id, pending := range inst.pending {
+		if pending.client == client {
+			// The reply is dropped when it arrives; tell the server to stop.
+			pending.client = nil
+			pending.onResult = func(*message) {}
+			inst.sendLocked(newNotification("$/cancelRequest", map[string]int64{"id": id}))
+		}
+	}
+	for id, owner := range inst.serverCalls {
+		if owner == client {
+			delete(inst.serverCalls, id)
+			inst.sendLocked(newErrorResponse(json.RawMessage(id), codeRequestFailed, "editor tab closed"))
+		}
+	}
+	kept := inst.initWaiters[:0]
+	for _, waiter := range inst.initWaiters {
+		if waiter.client != client {
+			kept = append(kept, waiter)
+		}
+	}
+	inst.initWaiters = kept
+	kept2 := inst.backlog[:0]
+	for _, entry := range inst.backlog {
+		if entry.client != client {
+			kept2 = append(kept2, entry)
+		}
+	}
+	inst.backlog = kept2
+
+	if inst.primary == client {
+		inst.primary = nil
+		var oldest *Client
+		for candidate := range inst.clients {
+			if oldest == nil || candidate.seq < oldest.seq {
+				oldest = candidate
+			}
+		}
+		inst.primary = oldest
+	}
+
+	if len(inst.clients) == 0 && !inst.stopped && inst.manager.idleTimeout > 0 {
+		inst.idle = time.AfterFunc(inst.manager.idleTimeout, func() {
+			inst.manager.stopIdle(inst)
+		})
+	}
+}
+
+func (inst *instance) deliverLocked(client *Client, body []byte) {
+	if client.closed {
+		return
+	}
+	select {
+	case client.out <- body:
+	default:
+		// A tab that stops reading must not stall the other tabs.
+		inst.detachLocked(client)
+	}
+}
+
+func (inst *instance) broadcastLocked(body []byte) {
+	for client := range inst.clients {
+		inst.deliverLocked(client, body)
+	}
+}
+
+func (inst *instance) notifyLocked(messageType int, text string) {
+	inst.broadcastLocked(newNotification(showMessageMethod, map[string]interface{}{
+		"type":    messageType,
+		"message": text,
+	}))
+}
+
+func (inst *instance) handleClientMessage(client *Client, msg *message) error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if client.closed {
+		return ErrClosed
+	}
+	if !inst.ready {
+		if len(inst.backlog) >= maxBacklogMessages {
+			inst.detachLocked(client)
+			return ErrClosed
+		}
+		inst.backlog = append(inst.backlog, backlogEntry{client: client, msg: msg})
+		return nil
+	}
+	inst.routeClientLocked(client, msg)
+	return nil
+}
+
+func (inst *instance) routeClientLocked(client *Client, msg *message) {
+	switch {
+	case msg.isResponse():
+		key := string(msg.ID)
+		if inst.serverCalls[key] != client {
+			return
+		}
+		delete(inst.serverCalls, key)
+		inst.sendLocked(msg.encode())
+
+	case msg.isRequest():
+		switch msg.Method {
+		case "initialize":
+			inst.initializeLocked(client, msg)
+		case "shutdown":
+			// The server is shared; a tab going away must not stop it.
+			inst.deliverLocked(client, newResponse(msg.ID, nil))
+		default:
+			inst.forwardRequestLocked(client, msg)
+		}
+
+	case msg.isNotification():
+		switch msg.Method {
+		case "initialized":
+			inst.clientInitiated = true
+			if !inst.initializedSent {
+				inst.initializedSent = true
+				inst.sendLocked(msg.encode())
+			}
+		case "exit":
+		case "textDocument/didOpen":
+			inst.didOpenLocked(client, msg)
+		case "textDocument/didChange":
+			inst.didChangeLocked(client, msg)
+		case "textDocument/didClose":
+			var params didCloseParams
+			if json.Unmarshal(msg.Params, &params) == nil && client.open[params.TextDocument.URI] {
+				delete(client.open, params.TextDocument.URI)
+				inst.closeDocumentLocked(params.TextDocument.URI)
+			}
+		case "$/cancelRequest":
+			inst.cancelLocked(client, msg)
+		default:
+			inst.sendLocked(msg.encode())
+		}
+	}
+}
+
+func (inst *instance) forwardRequestLocked(client *Client, msg *message) {
+	inst.nextID++
+	id := inst.nextID
+	inst.pending[id] = &pendingRequest{client: client, id: msg.ID}
+	forwarded := *msg
+	forwarded.ID = intID(id)
+	if !inst.sendLocked(forwarded.encode()) {
+		delete(inst.pending, id)
+		inst.deliverLocked(client, newErrorResponse(msg.ID, codeRequestFailed, "language server is not accepting requests"))
+	}
+}
+
+func (inst *instance) initializeLocked(client *Client, msg *message) {
+	if inst.initResult != nil {
+		inst.deliverLocked(client, newResponse(msg.ID, inst.initResult))
+		return
+	}
+	inst.initWaiters = append(inst.initWaiters, initWaiter{client: client, id: msg.ID})
+	if inst.initInFlight {
+		return
+	}
+
+	params := withProcessID(msg.Params)
+	inst.initInFlight = true
+	ok := inst.requestLocked("initialize", params, func(reply *message) {
+		inst.initInFlight = false
+		waiters := inst.initWaiters
+		inst.initWaiters = nil
+		if len(reply.Error) > 0 {
+			for _, waiter := range waiters {
+				inst.deliverLocked(waiter.client, (&message{ID: waiter.id, Error: reply.Error}).encode())
+			}
+			return
+		}
+		inst.initParams = params
+		inst.initResult = reply.Result
+		for _, waiter := range waiters {
+			inst.deliverLocked(waiter.client, newResponse(waiter.id, reply.Result))
+		}
+	})
+	if !ok {
+		inst.initInFlight = false
+		inst.initWaiters = nil
+		inst.deliverLocked(client, newErrorResponse(msg.ID, codeRequestFailed, "language server is not accepting requests"))
+	}
+}
+
+// withProcessID points the server's parent-process watch at this process;
+// the editor's own PID means nothing to a server started here.
+func withProcessID(params json.RawMessage) json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if len(params) > 0 && json.Unmarshal(params, &fields) != nil {
+		return params
+	}
+	fields["processId"] = json.RawMessage(fmt.Sprint(os.Getpid()))
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return params
+	}
+	return raw
+}
+
+func (inst *instance) didOpenLocked(client *Client, msg *message) {
+	var params didOpenParams
+	if json.Unmarshal(msg.Params, &params) != nil || params.TextDocument.URI == "" {
+		return
+	}
+	item := params.TextDocument
+	if client.open[item.URI] {
+		return
+	}
+	client.open[item.URI] = true
+
+	doc, ok := inst.documents[item.URI]
+	if !ok {
+		doc = &document{URI: item.URI, LanguageID: item.LanguageID, Version: item.Version, Text: item.Text}
+		inst.documents[item.URI] = doc
+		doc.refs = 1
+		inst.sendLocked(msg.encode())
+		return
+	}
+	doc.refs++
+	if doc.Text != item.Text {
+		inst.replaceDocumentLocked(doc, item.Text)
+	}
+}
+
+func (inst *instance) didChangeLocked(client *Client, msg *message) {
+	var params didChangeParams
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	doc, ok := inst.documents[params.TextDocument.URI]
+	if !ok || !client.open[doc.URI] {
+		return
+	}
+	doc.Text = applyChanges(doc.Text, params.ContentChanges)
+	// Tabs keep their own version counters; the server needs one sequence.
+	doc.Version++
+	params.TextDocument.Version = doc.Version
+	raw, _ := json.Marshal(params)
+	inst.sendLocked((&message{Method: msg.Method, Params: raw}).encode())
+}
+
+func (inst *instance) replaceDocumentLocked(doc *document, text string) {
+	doc.Text = text
+	doc.Version++
+	var params didChangeParams
+	params.TextDocument.URI = doc.URI
+	params.TextDocument.Version = doc.Version
+	params.ContentChanges = []contentChange{{Text: text}}
+	inst.sendLocked(newNotification("textDocument/didChange", params))
+}
+
+func (inst *instance) closeDocumentLocked(uri string) {
+	doc, ok := inst.documents[uri]
+	if !ok {
+		return
+	}
+	doc.refs--
+	if doc.refs > 0 {
+		return
+	}
+	delete(inst.documents, uri)
+	var params didCloseParams
+	params.TextDocument.URI = uri
+	inst.sendLocked(newNotification("textDocument/didClose", params))
+}
+
+func (inst *instance) cancelLocked(client *Client, msg *message) {
+	var params struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	for id, pending := range inst.pending {
+		if pending.client == client && string(pending.id) == string(params.ID) {
+			inst.sendLocked(newNotification("$/cancelRequest", map[string]int64{"id": id}))
+			return
+		}
+	}
+}
+
+func (inst *instance) handleServerMessage(proc *process, body []byte) {
+	msg, err := parseMessage(body)
+	if err != nil {
+		return
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.proc != proc {
+		return
+	}
+
+	switch {
+	case msg.isResponse():
+		id, ok := parseIntID(msg.ID)
+		if !ok {
+			return
+		}
+		pending, ok := inst.pending[id]
+		if !ok {
+			return
+		}
+		delete(inst.pending, id)
+		if pending.client == nil {
+			if pending.onResult != nil {
+				pending.onResult(msg)
+			}
+			return
+		}
+		msg.ID = pending.id
+		inst.deliverLocked(pending.client, msg.encode())
+
+	case msg.isRequest():
+		if inst.primary == nil {
+			inst.sendLocked(newResponse(msg.ID, unattendedResult(msg)))
+			return
+		}
+		inst.serverCalls[string(msg.ID)] = inst.primary
+		inst.deliverLocked(inst.primary, body)
+
+	default:
+		if inst.notify != nil {
+			inst.notify(inst.key.language, inst.key.root, msg.Method, msg.Params)
+		}
+		inst.broadcastLocked(body)
+	}
+}
+
+// unattendedResult answers a server request while no editor is attached.
+// workspace/configuration must get one entry per requested item.
+func unattendedResult(msg *message) json.RawMessage {
+	if msg.Method != configurationMethod {
+		return nil
+	}
+	var params struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+	nulls := make([]interface{}, len(params.Items))
+	raw, _ := json.Marshal(nulls)
+	return raw
+}
+
+func (inst *instance) handleExit(proc *process, exitErr error) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.proc != proc {
+		return
+	}
+	close(proc.writes)
+	if inst.exit != nil {
+		inst.exit(inst.key.language, inst.key.root)
+	}
+	if inst.stopped {
+		return
+	}
+
+	inst.ready = false
+	for id, pending := range inst.pending {
+		delete(inst.pending, id)
+		if pending.client != nil {
+			inst.deliverLocked(pending.client, newErrorResponse(pending.id, codeRequestFailed, "language server exited"))
+		}
+	}
+	inst.serverCalls = map[string]*Client{}
+	if inst.initInFlight {
+		inst.initInFlight = false
+		for _, waiter := range inst.initWaiters {
+			inst.deliverLocked(waiter.client, newErrorResponse(waiter.id, codeRequestFailed, "language server exited"))
+		}
+		inst.initWaiters = nil
+	}
+
+	now := time.Now()
+	recent := inst.restarts[:0]
+	for _, at := range inst.restarts {
+		if now.Sub(at) < restartWindow {
+			recent = append(recent, at)
+		}
+	}
+	inst.restarts = recent
+
+	reason := "exited"
+	if exitErr != nil {
+		reason = exitErr.Error()
+	}
+	if len(inst.restarts) >= maxRestarts {
+		inst.notifyLocked(messageTypeError, fmt.Sprintf("%s %s; giving up after %d restarts", inst.config.Command, reason, len(inst.restarts)))
+		inst.stopLocked()
+		go inst.manager.remove(inst)
+		return
+	}
+
+	delay := restartBaseDelay << uint(len(inst.restarts))
+	if delay > restartMaxDelay {
+		delay = restartMaxDelay
+	}
+	inst.restarts = append(inst.restarts, now)
+	inst.total++
+	inst.notifyLocked(messageTypeWarning, fmt.Sprintf("%s %s; restarting", inst.config.Command, reason))
+	time.AfterFunc(delay, inst.restart)
+}
+
+// restart starts a new server process and brings it to the state the
+// previous one was in: initialized with the first client's parameters and
+// with every open document re-opened. Client messages that arrived in the
+// meantime are replayed afterwards.
+func (inst *instance) restart() {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.stopped {
+		return
+	}
+	if err := inst.spawnLocked(); err != nil {
+		inst.notifyLocked(messageTypeError, fmt.Sprintf("restart %s: %v", inst.config.Command, err))
+		inst.stopLocked()
+		go inst.manager.remove(inst)
+		return
+	}
+	if inst.initParams == nil {
+		inst.flushBacklogLocked()
+		return
+	}
+
+	ok := inst.requestLocked("initialize", inst.initParams, func(reply *message) {
+		if len(reply.Error) > 0 {
+			inst.notifyLocked(messageTypeError, fmt.Sprintf("%s failed to initialize after restart", inst.config.Command))
+			return
+		}
+		inst.initResult = reply.Result
+		if inst.clientInitiated {
+			inst.initializedSent = true
+			inst.sendLocked(newNotification("initialized", struct{}{}))
+		}
+		for _, doc := range inst.documents {
+			inst.sendLocked(newNotification("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{
+				URI:        doc.URI,
+				LanguageID: doc.LanguageID,
+				Version:    doc.Version,
+				Text:       doc.Text,
+			}}))
+		}
+		inst.notifyLocked(messageTypeInfo, fmt.Sprintf("%s restarted", inst.config.Command))
+		inst.flushBacklogLocked()
+	})
+	if !ok {
+		inst.flushBacklogLocked()
+	}
+}
+
+func (inst *instance) flushBacklogLocked() {
+	inst.ready = true
+	backlog := inst.backlog
+	inst.backlog = nil
+	for _, entry := range backlog {
+		if !entry.client.closed {
+			inst.routeClientLocked(entry.client, entry.msg)
+		}
+	}
+}
+
+// stop detaches every client and shuts the server down, politely first.
+// The returned channel is closed once the process has exited.
+func (inst *instance) stop() <-chan struct{} {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	return inst.stopLocked()
+}
+
+func (inst *instance) stopLocked() <-chan struct{} {
+	proc := inst.proc
+	if inst.stopped {
+		if proc == nil {
+			return closedChan()
+		}
+		return proc.done
+	}
+	inst.stopped = true
+	if inst.idle != nil {
+		inst.idle.Stop()
+		inst.idle = nil
+	}
+	for client := range inst.clients {
+		delete(inst.clients, client)
+		client.closeLocked()
+	}
+	inst.primary = nil
+	inst.backlog = nil
+	if proc == nil {
+		return closedChan()
+	}
+
+	if inst.initResult != nil {
+		inst.requestLocked("shutdown", nil, func(*message) {
+			inst.sendLocked(newNotification("exit", nil))
+		})
+	}
+	go func() {
+		select {
+		case <-proc.done:
+		case <-time.After(shutdownGrace):
+			procgroup.Terminate(proc.cmd, terminateGrace, proc.done)
+		}
+	}()
+	return proc.done
+}
+
+func (inst *instance) status() InstanceStatus {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	status := InstanceStatus{
+		Root:      inst.key.root,
+		State:     StateRunning,
+		Clients:   len(inst.clients),
+		Documents: len(inst.documents),
+		Restarts:  inst.total,
+		Stderr:    inst.stderr.String(),
+	}
+	switch {
+	case inst.stopped:
+		status.State = StateStopped
+	case !inst.ready:
+		status.State = StateRestarting
+	}
+	if inst.proc != nil {
+		status.StartedAt = inst.proc.startedAt
+		if inst.proc.cmd.Process != nil {
+			status.PID = inst.proc.cmd.Process.Pid
+		}
+	}
+	return status
+}
+
+func (inst *instance) openDocuments() []OpenDocument {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	out := make([]OpenDocument, 0, len(inst.documents))
+	for _, doc := range inst.documents {
+		out = append(out, OpenDocument{
+			URI:        doc.URI,
+			LanguageID: doc.LanguageID,
+			Version:    doc.Version,
+			Text:       doc.Text,
+			Root:       inst.key.root,
+		})
+	}
+	return out
+}
+
+func closedChan() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
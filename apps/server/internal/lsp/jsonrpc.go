@@ -0,0 +1,126 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const maxMessageBytes = 64 * 1024 * 1024
+
+// JSON-RPC and LSP error codes sent by the proxy itself.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeRequestFailed  = -32803
+)
+
+var errMessageTooLarge = errors.New("language server message too large")
+
+// message is a JSON-RPC 2.0 request, notification or response. Params,
+// Result and Error stay raw so messages pass through unchanged apart from
+// their IDs.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+func (m *message) hasID() bool {
+	return len(m.ID) > 0 && !bytes.Equal(m.ID, []byte("null"))
+}
+
+func (m *message) isRequest() bool {
+	return m.Method != "" && m.hasID()
+}
+
+func (m *message) isNotification() bool {
+	return m.Method != "" && !m.hasID()
+}
+
+func (m *message) isResponse() bool {
+	return m.Method == "" && m.hasID()
+}
+
+func parseMessage(raw []byte) (*message, error) {
+	var msg message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Method == "" && !msg.hasID() {
+		return nil, errors.New("message has neither method nor id")
+	}
+	return &msg, nil
+}
+
+func (m *message) encode() []byte {
+	m.JSONRPC = "2.0"
+	raw, _ := json.Marshal(m)
+	return raw
+}
+
+func intID(id int64) json.RawMessage {
+	return json.RawMessage(strconv.FormatInt(id, 10))
+}
+
+func parseIntID(id json.RawMessage) (int64, bool) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	return n, err == nil
+}
+
+func newResponse(id, result json.RawMessage) []byte {
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+	return (&message{ID: id, Result: result}).encode()
+}
+
+func newErrorResponse(id json.RawMessage, code int, text string) []byte {
+	payload, _ := json.Marshal(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, text})
+	return (&message{ID: id, Error: payload}).encode()
+}
+
+func newNotification(method string, params interface{}) []byte {
+	raw, _ := json.Marshal(params)
+	return (&message{Method: method, Params: raw}).encode()
+}
+
+// readFrame reads one Content-Length framed message from a language server.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length header %q", headers.Get("Content-Length"))
+	}
+	if length > maxMessageBytes {
+		return nil, errMessageTooLarge
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeFrame(w io.Writer, body []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
@@ -0,0 +1,334 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/fs"
+)
+
+var (
+	ErrUnknownLanguage   = errors.New("no language server configured for language")
+	ErrServerUnavailable = errors.New("language server is not installed")
+	ErrRootRequired      = fs.ErrRootRequired
+	ErrRootNotFound      = fs.ErrRootNotFound
+	ErrStartFailed       = errors.New("failed to start language server")
+	ErrClosed            = errors.New("language server connection closed")
+)
+
+const (
+	defaultIdleTimeout = 2 * time.Minute
+	closeWaitPeriod    = 5 * time.Second
+)
+
+// ServerStatus describes a configured language server and its running
+// instances.
+type ServerStatus struct {
+	ServerConfig
+	Available bool             `json:"available"`
+	Path      string           `json:"path,omitempty"`
+	Instances []InstanceStatus `json:"instances"`
+}
+
+type instanceKey struct {
+	language string
+	root     string
+}
+
+// Manager starts language servers on demand, one per language and
+// workspace root, and shares each between every client attached to it. An
+// instance is stopped once its last client has been gone for a while.
+type Manager struct {
+	mu          sync.Mutex
+	servers     []ServerConfig
+	instances   map[instanceKey]*instance
+	idleTimeout time.Duration
+	clientSeq   int64
+	closed      bool
+	notify      NotificationHandler
+	exit        ExitHandler
+}
+
+// NotificationHandler observes notifications from a language server, such
+// as textDocument/publishDiagnostics, before they are broadcast to clients.
+// It is called with the instance locked and must not block.
+type NotificationHandler func(language, root, method string, params json.RawMessage)
+
+// ExitHandler observes a language server process ending, whether it
+// crashed, is about to be restarted or was stopped; whatever it published
+// is stale from then on. It is called with the instance locked and must not
+// block.
+type ExitHandler func(language, root string)
+
+func NewManager(servers []ServerConfig) *Manager {
+	if servers == nil {
+		servers = DefaultServers()
+	}
+	return &Manager{
+		servers:     servers,
+		instances:   map[instanceKey]*instance{},
+		idleTimeout: defaultIdleTimeout,
+	}
+}
+
+// OnNotification installs handler for server notifications. It must be
+// called before the first Attach.
+func (m *Manager) OnNotification(handler NotificationHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = handler
+}
+
+// OnExit installs handler for server exits. It must be called before the
+// first Attach.
+func (m *Manager) OnExit(handler ExitHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exit = handler
+}
+
+// Resolve finds the server for a language ID, such as "go", or a file
+// extension, such as ".tsx" or "tsx".
+func (m *Manager) Resolve(lang string) (ServerConfig, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return ServerConfig{}, ErrUnknownLanguage
+	}
+	for _, server := range m.servers {
+		if server.Language == lang {
+			return server, nil
+		}
+	}
+	ext := lang
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	for _, server := range m.servers {
+		for _, candidate := range server.Extensions {
+			if strings.EqualFold(candidate, ext) {
+				return server, nil
+			}
+		}
+	}
+	return ServerConfig{}, ErrUnknownLanguage
+}
+
+// Attach connects a new client to the server for lang in root, starting it
+// if needed.
+func (m *Manager) Attach(lang, rawRoot string) (*Client, error) {
+	config, err := m.Resolve(lang)
+	if err != nil {
+		return nil, err
+	}
+	root, err := fs.ResolveRoot(rawRoot)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath(config.Command); err != nil {
+		return nil, ErrServerUnavailable
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	key := instanceKey{language: config.Language, root: root}
+	if inst, ok := m.instances[key]; ok {
+		m.clientSeq++
+		if client, err := inst.attach(m.clientSeq); err == nil {
+			return client, nil
+		}
+		delete(m.instances, key)
+	}
+
+	inst := newInstance(m, key, config, m.notify, m.exit)
+	if err := inst.start(); err != nil {
+		return nil, err
+	}
+	m.instances[key] = inst
+	m.clientSeq++
+	return inst.attach(m.clientSeq)
+}
+
+func (m *Manager) Status() []ServerStatus {
+	m.mu.Lock()
+	instances := make([]*instance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		instances = append(instances, inst)
+	}
+	m.mu.Unlock()
+
+	out := make([]ServerStatus, 0, len(m.servers))
+	for _, server := range m.servers {
+		status := ServerStatus{ServerConfig: server, Instances: []InstanceStatus{}}
+		if path, err := exec.LookPath(server.Command); err == nil {
+			status.Available = true
+			status.Path = path
+		}
+		for _, inst := range instances {
+			if inst.key.language == server.Language {
+				status.Instances = append(status.Instances, inst.status())
+			}
+		}
+		sort.Slice(status.Instances, func(i, j int) bool {
+			return status.Instances[i].Root < status.Instances[j].Root
+		})
+		out = append(out, status)
+	}
+	return out
+}
+
+// OpenDocument is a document some client has open, with the text the
+// proxy last saw, which may not be saved yet.
+type OpenDocument struct {
+	URI        string
+	LanguageID string
+	Version    int
+	Text       string
+	Root       string
+}
+
+// Documents lists the documents open in every running instance, ordered by
+// URI. A document open under two languages is listed once.
+func (m *Manager) Documents() []OpenDocument {
+	m.mu.Lock()
+	instances := make([]*instance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		instances = append(instances, inst)
+	}
+	m.mu.Unlock()
+
+	seen := map[string]bool{}
+	var out []OpenDocument
+	for _, inst := range instances {
+		for _, doc := range inst.openDocuments() {
+			if !seen[doc.URI] {
+				seen[doc.URI] = true
+				out = append(out, doc)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URI < out[j].URI })
+	return out
+}
+
+// Close stops every language server and waits briefly for them to exit.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	instances := m.instances
+	m.instances = map[instanceKey]*instance{}
+	m.mu.Unlock()
+
+	done := make([]<-chan struct{}, 0, len(instances))
+	for _, inst := range instances {
+		done = append(done, inst.stop())
+	}
+	deadline := time.After(closeWaitPeriod)
+	for _, ch := range done {
+		select {
+		case <-ch:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func (m *Manager) remove(inst *instance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.instances[inst.key] == inst {
+		delete(m.instances, inst.key)
+	}
+}
+
+func (m *Manager) stopIdle(inst *instance) {
+	m.mu.Lock()
+	if m.instances[inst.key] != inst {
+		m.mu.Unlock()
+		return
+	}
+	inst.mu.Lock()
+	idle := len(inst.clients) == 0
+	inst.mu.Unlock()
+	if !idle {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.instances, inst.key)
+	m.mu.Unlock()
+	inst.stop()
+}
+
+// Client is one editor connection to a shared language server. Messages
+// sent and received are single JSON-RPC messages without framing.
+type Client struct {
+	inst   *instance
+	seq    int64
+	out    chan []byte
+	done   chan struct{}
+	closed bool
+	// open holds the URIs this client has opened.
+	open map[string]bool
+}
+
+func (c *Client) Language() string {
+	return c.inst.key.language
+}
+
+func (c *Client) Root() string {
+	return c.inst.key.root
+}
+
+// Messages delivers messages from the server to this client.
+func (c *Client) Messages() <-chan []byte {
+	return c.out
+}
+
+// Done is closed when the client has been detached, either by Close or
+// because the server stopped or the client fell too far behind.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Send routes one message from the client to the server. Malformed messages
+// are answered with a JSON-RPC error rather than rejected.
+func (c *Client) Send(raw []byte) error {
+	msg, err := parseMessage(raw)
+	if err != nil {
+		c.inst.mu.Lock()
+		defer c.inst.mu.Unlock()
+		if c.closed {
+			return ErrClosed
+		}
+		var probe struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(raw, &probe) != nil {
+			c.inst.deliverLocked(c, newErrorResponse(json.RawMessage("null"), codeParseError, "parse error"))
+		} else {
+			c.inst.deliverLocked(c, newErrorResponse(json.RawMessage("null"), codeInvalidRequest, err.Error()))
+		}
+		return nil
+	}
+	return c.inst.handleClientMessage(c, msg)
+}
+
+func (c *Client) Close() {
+	c.inst.detach(c)
+}
+
+func (c *Client) closeLocked() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+}
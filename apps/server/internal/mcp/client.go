@@ -0,0 +1,150 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// maxListPages bounds how many pages of a list a server may return, in
+// case its cursors never end.
+const maxListPages = 100
+
+// client is one initialized connection to an external server.
+type client struct {
+	transport transport
+	nextID    int64
+	info      InitializeResult
+}
+
+func (c *client) call(ctx context.Context, method string, params, result interface{}) error {
+	msg := &Message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	msg.ID = json.RawMessage(strconv.FormatInt(atomic.AddInt64(&c.nextID, 1), 10))
+
+	reply, err := c.transport.send(ctx, msg)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Tell the server to stop; it may still be working.
+			_ = c.notify(context.Background(), MethodCancelled, cancelledParams{RequestID: msg.ID, Reason: ctx.Err().Error()})
+		}
+		return err
+	}
+	if reply == nil {
+		return fmt.Errorf("%s: no response", method)
+	}
+	if reply.Error != nil {
+		return reply.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(reply.Result, result); err != nil {
+		return fmt.Errorf("%s: invalid result: %v", method, err)
+	}
+	return nil
+}
+
+func (c *client) notify(ctx context.Context, method string, params interface{}) error {
+	msg := &Message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		msg.Params = data
+	}
+	_, err := c.transport.send(ctx, msg)
+	return err
+}
+
+// initialize runs the handshake, after which the server may be used.
+func (c *client) initialize(ctx context.Context, name, version string) error {
+	params := InitializeParams{
+		ProtocolVersion: LatestProtocolVersion,
+		Capabilities:    json.RawMessage("{}"),
+		ClientInfo:      Implementation{Name: name, Version: version},
+	}
+	if err := c.call(ctx, MethodInitialize, params, &c.info); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	if !supportedProtocolVersions[c.info.ProtocolVersion] {
+		return fmt.Errorf("initialize: unsupported protocol version %q", c.info.ProtocolVersion)
+	}
+	c.transport.setProtocolVersion(c.info.ProtocolVersion)
+	return c.notify(ctx, MethodInitialized, nil)
+}
+
+func (c *client) listTools(ctx context.Context) ([]Tool, error) {
+	if c.info.Capabilities.Tools == nil {
+		return nil, nil
+	}
+	var tools []Tool
+	cursor := ""
+	for page := 0; page < maxListPages; page++ {
+		var result ListToolsResult
+		if err := c.call(ctx, MethodToolsList, listParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if cursor = result.NextCursor; cursor == "" {
+			break
+		}
+	}
+	return tools, nil
+}
+
+func (c *client) listResources(ctx context.Context) ([]Resource, error) {
+	if c.info.Capabilities.Resources == nil {
+		return nil, nil
+	}
+	var resources []Resource
+	cursor := ""
+	for page := 0; page < maxListPages; page++ {
+		var result ListResourcesResult
+		if err := c.call(ctx, MethodResourcesList, listParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		resources = append(resources, result.Resources...)
+		if cursor = result.NextCursor; cursor == "" {
+			break
+		}
+	}
+	return resources, nil
+}
+
+func (c *client) listPrompts(ctx context.Context) ([]Prompt, error) {
+	if c.info.Capabilities.Prompts == nil {
+		return nil, nil
+	}
+	var prompts []Prompt
+	cursor := ""
+	for page := 0; page < maxListPages; page++ {
+		var result ListPromptsResult
+		if err := c.call(ctx, MethodPromptsList, listParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, result.Prompts...)
+		if cursor = result.NextCursor; cursor == "" {
+			break
+		}
+	}
+	return prompts, nil
+}
+
+func (c *client) callTool(ctx context.Context, name string, arguments json.RawMessage) (CallToolResult, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	err := c.call(ctx, MethodToolsCall, CallToolParams{Name: name, Arguments: arguments}, &result)
+	return result, err
+}
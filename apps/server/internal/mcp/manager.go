@@ -0,0 +1,566 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/llm"
+)
+
+const (
+	StateConnecting = "connecting"
+	StateReady      = "ready"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+	StateDisabled   = "disabled"
+	StateStopped    = "stopped"
+)
+
+const (
+	maxRestarts        = 5
+	restartWindow      = 3 * time.Minute
+	restartBaseDelay   = 500 * time.Millisecond
+	restartMaxDelay    = 5 * time.Second
+	connectTimeout     = 30 * time.Second
+	defaultCallTimeout = 2 * time.Minute
+	toolNameSeparator  = "__"
+	maxToolNameLength  = 64
+)
+
+var emptyInputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// ServerStatus is a snapshot of one configured external server. Env and
+// headers are left out since they may hold secrets.
+type ServerStatus struct {
+	Name            string          `json:"name"`
+	Transport       string          `json:"transport"`
+	Command         string          `json:"command,omitempty"`
+	Args            []string        `json:"args,omitempty"`
+	URL             string          `json:"url,omitempty"`
+	State           string          `json:"state"`
+	Error           string          `json:"error,omitempty"`
+	PID             int             `json:"pid,omitempty"`
+	Restarts        int             `json:"restarts"`
+	ConnectedAt     *time.Time      `json:"connectedAt,omitempty"`
+	ServerInfo      *Implementation `json:"serverInfo,omitempty"`
+	ProtocolVersion string          `json:"protocolVersion,omitempty"`
+	Tools           []ToolInfo      `json:"tools"`
+	Resources       []Resource      `json:"resources"`
+	Prompts         []Prompt        `json:"prompts"`
+	Stderr          string          `json:"stderr,omitempty"`
+}
+
+// ToolInfo is a tool of an external server and the name the agent knows
+// it by. Conflict marks a name another server's tool also maps to; such
+// tools are not offered.
+type ToolInfo struct {
+	Name        string `json:"name"`
+	Tool        string `json:"tool"`
+	Description string `json:"description,omitempty"`
+	Conflict    bool   `json:"conflict,omitempty"`
+}
+
+// Manager keeps a connection to every enabled external server, lists
+// their tools, resources and prompts, and offers the tools to the agent as
+// <server>__<tool>. A server that exits or drops its session is reconnected
+// with backoff, up to a few times in a short window before it is marked
+// failed.
+type Manager struct {
+	remotes []*remote
+	byName  map[string]*remote
+}
+
+// NewManager connects to the enabled servers in the background.
+func NewManager(configs []ServerConfig) *Manager {
+	defaults := DefaultConfig()
+	m := &Manager{byName: map[string]*remote{}}
+	for _, config := range configs {
+		r := &remote{config: config, clientName: defaults.Name, clientVersion: defaults.Version, state: StateConnecting}
+		m.remotes = append(m.remotes, r)
+		m.byName[config.Name] = r
+		if config.Disabled {
+			r.state = StateDisabled
+			continue
+		}
+		go r.connect()
+	}
+	return m
+}
+
+// Status reports every configured server in configuration order.
+func (m *Manager) Status() []ServerStatus {
+	statuses := make([]ServerStatus, 0, len(m.remotes))
+	counts := map[string]int{}
+	for _, r := range m.remotes {
+		status := r.status()
+		for _, tool := range status.Tools {
+			counts[tool.Name]++
+		}
+		statuses = append(statuses, status)
+	}
+	for i := range statuses {
+		for j := range statuses[i].Tools {
+			statuses[i].Tools[j].Conflict = counts[statuses[i].Tools[j].Name] > 1
+		}
+	}
+	return statuses
+}
+
+// Restart drops the connection to a server, if any, and connects again
+// with a fresh restart budget.
+func (m *Manager) Restart(name string) error {
+	r := m.byName[name]
+	if r == nil {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if r.config.Disabled {
+		return fmt.Errorf("%w: %s", ErrServerDisabled, name)
+	}
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrConnClosed, name)
+	}
+	conn := r.conn
+	r.conn = nil
+	r.generation++
+	r.restarts = nil
+	r.state = StateConnecting
+	r.err = ""
+	r.mu.Unlock()
+
+	if conn != nil {
+		conn.transport.close()
+	}
+	go r.connect()
+	return nil
+}
+
+// Tools returns the tools of the connected servers, named for the agent.
+// Names more than one server maps to are left out rather than guessed.
+func (m *Manager) Tools() []llm.Tool {
+	counts := m.nameCounts()
+	var tools []llm.Tool
+	for _, r := range m.remotes {
+		r.mu.Lock()
+		if r.state == StateReady {
+			for _, tool := range r.offered {
+				if counts[tool.name] == 1 {
+					tools = append(tools, llm.Tool{Name: tool.name, Description: tool.description, Parameters: tool.schema})
+				}
+			}
+		}
+		r.mu.Unlock()
+	}
+	return tools
+}
+
+// nameCounts counts the servers offering each agent tool name.
+func (m *Manager) nameCounts() map[string]int {
+	counts := map[string]int{}
+	for _, r := range m.remotes {
+		r.mu.Lock()
+		if r.state == StateReady {
+			for _, tool := range r.offered {
+				counts[tool.name]++
+			}
+		}
+		r.mu.Unlock()
+	}
+	return counts
+}
+
+// Call runs the tool the agent knows as name and renders its content as
+// text. isError reports a failure the tool itself described.
+func (m *Manager) Call(ctx context.Context, name string, arguments json.RawMessage) (string, bool, error) {
+	if m.nameCounts()[name] > 1 {
+		return "", false, fmt.Errorf("tool name %s is offered by more than one server", name)
+	}
+	for _, r := range m.remotes {
+		r.mu.Lock()
+		var conn *client
+		tool := ""
+		for _, offered := range r.offered {
+			if offered.name == name {
+				conn, tool = r.conn, offered.tool
+				break
+			}
+		}
+		ready := r.state == StateReady
+		r.mu.Unlock()
+		if tool == "" {
+			continue
+		}
+		if !ready || conn == nil {
+			return "", false, fmt.Errorf("%w: %s", ErrServerNotReady, r.config.Name)
+		}
+
+		timeout := defaultCallTimeout
+		if r.config.TimeoutSeconds > 0 {
+			timeout = time.Duration(r.config.TimeoutSeconds) * time.Second
+		}
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result, err := conn.callTool(callCtx, tool, arguments)
+		if err != nil {
+			if ctx.Err() == nil && callCtx.Err() != nil {
+				return "", false, fmt.Errorf("%s timed out after %s", name, timeout)
+			}
+			return "", false, err
+		}
+		return renderContent(result), result.IsError, nil
+	}
+	return "", false, fmt.Errorf("%w: no tool %s", ErrServerNotFound, name)
+}
+
+// Close disconnects from every server and stops the ones it started.
+func (m *Manager) Close() {
+	var wg sync.WaitGroup
+	for _, r := range m.remotes {
+		r.mu.Lock()
+		conn := r.conn
+		r.conn = nil
+		r.stopped = true
+		r.generation++
+		if r.state != StateDisabled {
+			r.state = StateStopped
+		}
+		r.mu.Unlock()
+		if conn == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.transport.close()
+		}()
+	}
+	wg.Wait()
+}
+
+type offeredTool struct {
+	name        string
+	tool        string
+	description string
+	schema      json.RawMessage
+}
+
+// remote is one configured server. Each connection attempt has its own
+// generation, so a stale attempt, exit or refresh never touches a newer
+// connection.
+type remote struct {
+	config        ServerConfig
+	clientName    string
+	clientVersion string
+
+	mu          sync.Mutex
+	state       string
+	err         string
+	conn        *client
+	generation  int
+	stopped     bool
+	restarts    []time.Time
+	total       int
+	connectedAt time.Time
+	offered     []offeredTool
+	resources   []Resource
+	prompts     []Prompt
+	lastStderr  string
+}
+
+func (r *remote) connect() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.generation++
+	generation := r.generation
+	r.state = StateConnecting
+	r.mu.Unlock()
+
+	conn, lists, err := r.dial(generation)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped || generation != r.generation {
+		if conn != nil {
+			go conn.transport.close()
+		}
+		return
+	}
+	if err != nil {
+		// A missing command will not appear by retrying.
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			r.state = StateFailed
+			r.err = err.Error()
+			return
+		}
+		r.scheduleRestartLocked(err.Error())
+		return
+	}
+	r.conn = conn
+	r.state = StateReady
+	r.err = ""
+	r.connectedAt = time.Now().UTC()
+	r.setListsLocked(lists)
+	go r.watch(conn, generation)
+}
+
+type serverLists struct {
+	tools     []Tool
+	resources []Resource
+	prompts   []Prompt
+}
+
+// dial starts or reaches the server, initializes it and lists what it
+// offers. Servers that fail to list resources or prompts are still used
+// for their tools.
+func (r *remote) dial(generation int) (*client, serverLists, error) {
+	notify := func(method string, _ json.RawMessage) {
+		switch method {
+		case MethodToolsListChanged, MethodResourcesListChanged, MethodPromptsListChanged:
+			go r.refresh(generation)
+		}
+	}
+	var t transport
+	var err error
+	if r.config.URL != "" {
+		t, err = newHTTPTransport(r.config, notify)
+	} else {
+		t, err = startStdio(r.config, notify)
+	}
+	if err != nil {
+		return nil, serverLists{}, err
+	}
+
+	conn := &client{transport: t}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	lists, err := r.initialize(ctx, conn)
+	if err != nil {
+		t.close()
+		r.mu.Lock()
+		r.lastStderr = t.stderr()
+		r.mu.Unlock()
+		return nil, serverLists{}, err
+	}
+	return conn, lists, nil
+}
+
+func (r *remote) initialize(ctx context.Context, conn *client) (serverLists, error) {
+	if err := conn.initialize(ctx, r.clientName, r.clientVersion); err != nil {
+		return serverLists{}, err
+	}
+	return fetchLists(ctx, conn)
+}
+
+func fetchLists(ctx context.Context, conn *client) (serverLists, error) {
+	var lists serverLists
+	var err error
+	if lists.tools, err = conn.listTools(ctx); err != nil {
+		return lists, fmt.Errorf("list tools: %w", err)
+	}
+	lists.resources, _ = conn.listResources(ctx)
+	lists.prompts, _ = conn.listPrompts(ctx)
+	return lists, nil
+}
+
+// watch waits for the connection to end and schedules a reconnect unless
+// it was closed on purpose.
+func (r *remote) watch(conn *client, generation int) {
+	<-conn.transport.done()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped || generation != r.generation {
+		return
+	}
+	r.conn = nil
+	r.lastStderr = conn.transport.stderr()
+	reason := "connection lost"
+	if r.config.URL == "" {
+		reason = "server exited"
+	}
+	if err := conn.transport.err(); err != nil {
+		reason += ": " + err.Error()
+	}
+	r.scheduleRestartLocked(reason)
+}
+
+// scheduleRestartLocked reconnects after an exponential delay, giving up
+// once the server failed too often within restartWindow.
+func (r *remote) scheduleRestartLocked(reason string) {
+	now := time.Now()
+	recent := r.restarts[:0]
+	for _, at := range r.restarts {
+		if now.Sub(at) < restartWindow {
+			recent = append(recent, at)
+		}
+	}
+	r.restarts = recent
+
+	if len(r.restarts) >= maxRestarts {
+		r.state = StateFailed
+		r.err = fmt.Sprintf("%s; gave up after %d restarts", reason, len(r.restarts))
+		return
+	}
+	delay := restartBaseDelay << uint(len(r.restarts))
+	if delay > restartMaxDelay {
+		delay = restartMaxDelay
+	}
+	r.restarts = append(r.restarts, now)
+	r.total++
+	r.state = StateRestarting
+	r.err = reason
+	generation := r.generation
+	time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		current := !r.stopped && generation == r.generation
+		r.mu.Unlock()
+		if current {
+			r.connect()
+		}
+	})
+}
+
+// refresh lists the server's tools, resources and prompts again after it
+// announced a change.
+func (r *remote) refresh(generation int) {
+	r.mu.Lock()
+	conn := r.conn
+	current := generation == r.generation
+	r.mu.Unlock()
+	if conn == nil || !current {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	lists, err := fetchLists(ctx, conn)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation == r.generation && r.conn == conn {
+		r.setListsLocked(lists)
+	}
+}
+
+func (r *remote) setListsLocked(lists serverLists) {
+	r.resources = lists.resources
+	r.prompts = lists.prompts
+	r.offered = r.offered[:0]
+	seen := map[string]bool{}
+	for _, tool := range lists.tools {
+		name := toolName(r.config.Name, tool.Name)
+		if tool.Name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		schema := tool.InputSchema
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = emptyInputSchema
+		}
+		description := tool.Description
+		if description == "" {
+			description = fmt.Sprintf("The %s tool of the %s MCP server.", tool.Name, r.config.Name)
+		}
+		r.offered = append(r.offered, offeredTool{name: name, tool: tool.Name, description: description, schema: schema})
+	}
+}
+
+func (r *remote) status() ServerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := ServerStatus{
+		Name:      r.config.Name,
+		Transport: r.config.transport(),
+		Command:   r.config.Command,
+		Args:      r.config.Args,
+		URL:       r.config.URL,
+		State:     r.state,
+		Error:     r.err,
+		Restarts:  r.total,
+		Tools:     []ToolInfo{},
+		Resources: []Resource{},
+		Prompts:   []Prompt{},
+		Stderr:    r.lastStderr,
+	}
+	if r.state != StateReady || r.conn == nil {
+		return status
+	}
+	connectedAt := r.connectedAt
+	info := r.conn.info.ServerInfo
+	status.ConnectedAt = &connectedAt
+	status.ServerInfo = &info
+	status.ProtocolVersion = r.conn.info.ProtocolVersion
+	status.PID = r.conn.transport.pid()
+	status.Stderr = r.conn.transport.stderr()
+	for _, tool := range r.offered {
+		status.Tools = append(status.Tools, ToolInfo{Name: tool.name, Tool: tool.tool, Description: tool.description})
+	}
+	status.Resources = append(status.Resources, r.resources...)
+	status.Prompts = append(status.Prompts, r.prompts...)
+	return status
+}
+
+// toolName joins a server and tool name into one that model providers
+// accept: letters, digits, underscores and dashes, at most 64 long. A name
+// that had to be changed ends in a hash of the original, so a.b and a_b, or
+// two long names sharing a prefix, stay distinct.
+func toolName(server, tool string) string {
+	raw := server + toolNameSeparator + tool
+	name := []byte(raw)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			name[i] = '_'
+		}
+	}
+	if string(name) == raw && len(name) <= maxToolNameLength {
+		return raw
+	}
+	sum := sha1.Sum([]byte(raw))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	if len(name) > maxToolNameLength-len(suffix) {
+		name = name[:maxToolNameLength-len(suffix)]
+	}
+	return string(name) + suffix
+}
+
+// renderContent turns a tool result into text for the model. Media is
+// described rather than inlined.
+func renderContent(result CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "resource":
+			if content.Resource == nil {
+				continue
+			}
+			if content.Resource.Text != "" {
+				parts = append(parts, content.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s %s]", content.Resource.URI, content.Resource.MimeType))
+			}
+		case "resource_link":
+			parts = append(parts, "[resource "+content.URI+"]")
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content %s, %d bytes base64]", content.Type, content.MimeType, len(content.Data)))
+		}
+	}
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		return string(result.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,492 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/agent"
+	"local/monorepo/internal/approvals"
+	fsservice "local/monorepo/internal/fs"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/lsp"
+	"local/monorepo/internal/threads"
+)
+
+var (
+	ErrWorkspaceRequired = errors.New("workspace is required unless exactly one is open")
+	ErrWorkspaceNotOpen  = errors.New("workspace is not open")
+	ErrSessionNotFound   = errors.New("mcp session not found")
+)
+
+const (
+	defaultMaxSessions = 32
+	defaultSessionIdle = time.Hour
+)
+
+// Config describes the server to peers and picks the agent tools it
+// exposes by thread mode: ask and plan read and search, agent also edits
+// files and runs commands.
+type Config struct {
+	Name        string
+	Version     string
+	Mode        string
+	Tools       agent.Config
+	MaxSessions int
+	SessionIdle time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Name:        "omt",
+		Version:     "0.0.0",
+		Mode:        threads.ModePlan,
+		Tools:       agent.DefaultConfig(),
+		MaxSessions: defaultMaxSessions,
+		SessionIdle: defaultSessionIdle,
+	}
+}
+
+// Server answers MCP requests for sessions bound to one open workspace
+// each. Tools are the agent's, confined to the workspace and checked
+// against its approval rules; resources are the workspace files open in
+// the editor, and any other workspace file by URI.
+type Server struct {
+	cfg       Config
+	fs        *fsservice.Service
+	gate      *approvals.Gate
+	documents *lsp.Manager
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewServer serves the workspaces registered with fsService. gate and
+// documents may be nil, for no approval checks and no open documents.
+func NewServer(cfg Config, fsService *fsservice.Service, gate *approvals.Gate, documents *lsp.Manager) *Server {
+	defaults := DefaultConfig()
+	if cfg.Name == "" {
+		cfg.Name = defaults.Name
+	}
+	if cfg.Version == "" {
+		cfg.Version = defaults.Version
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = defaults.Mode
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaults.MaxSessions
+	}
+	if cfg.SessionIdle <= 0 {
+		cfg.SessionIdle = defaults.SessionIdle
+	}
+	return &Server{
+		cfg:       cfg,
+		fs:        fsService,
+		gate:      gate,
+		documents: documents,
+		sessions:  map[string]*Session{},
+	}
+}
+
+// Session is one MCP connection. Its requests may run concurrently; each
+// can be canceled by ID with notifications/cancelled.
+type Session struct {
+	ID    string
+	tools *agent.Toolbox
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	inflight map[string]context.CancelFunc
+}
+
+func (sess *Session) Workspace() string {
+	return sess.tools.Workspace()
+}
+
+// OpenSession starts a session on workspace, which must be inside a
+// workspace root registered with the fs service. An empty workspace picks
+// the only open root.
+func (s *Server) OpenSession(workspace string) (*Session, error) {
+	workspace = strings.TrimSpace(workspace)
+	if workspace == "" {
+		roots := s.fs.WorkspaceRoots()
+		if len(roots) != 1 {
+			return nil, ErrWorkspaceRequired
+		}
+		workspace = roots[0].Path
+	}
+	if !filepath.IsAbs(workspace) {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotOpen, workspace)
+	}
+	workspace = filepath.Clean(workspace)
+	if _, ok := s.fs.WorkspaceRootFor(workspace); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotOpen, workspace)
+	}
+	tools, err := agent.NewToolbox(s.cfg.Tools, s.fs, s.gate, workspace, s.cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	sess := &Session{
+		ID:       newSessionID(),
+		tools:    tools,
+		lastUsed: time.Now(),
+		inflight: map[string]context.CancelFunc{},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+	for len(s.sessions) >= s.cfg.MaxSessions {
+		var oldest *Session
+		for _, candidate := range s.sessions {
+			if oldest == nil || candidate.lastUsedAt().Before(oldest.lastUsedAt()) {
+				oldest = candidate
+			}
+		}
+		s.closeLocked(oldest.ID)
+	}
+	s.sessions[sess.ID] = sess
+	return sess, nil
+}
+
+// Session returns an open session and marks it used.
+func (s *Server) Session(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	sess.mu.Lock()
+	sess.lastUsed = time.Now()
+	sess.mu.Unlock()
+	return sess, nil
+}
+
+// CloseSession cancels the session's requests and forgets it.
+func (s *Server) CloseSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	s.closeLocked(id)
+	return nil
+}
+
+func (s *Server) closeLocked(id string) {
+	sess := s.sessions[id]
+	delete(s.sessions, id)
+	sess.mu.Lock()
+	for _, cancel := range sess.inflight {
+		cancel()
+	}
+	sess.mu.Unlock()
+}
+
+func (s *Server) expireLocked() {
+	cutoff := time.Now().Add(-s.cfg.SessionIdle)
+	for id, sess := range s.sessions {
+		if sess.lastUsedAt().Before(cutoff) {
+			s.closeLocked(id)
+		}
+	}
+}
+
+func (sess *Session) lastUsedAt() time.Time {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.lastUsed
+}
+
+// HandleBatch handles messages in order and returns the responses to
+// send, one per request.
+func (s *Server) HandleBatch(ctx context.Context, sess *Session, msgs []*Message) []*Message {
+	var out []*Message
+	for _, msg := range msgs {
+		if resp := s.Handle(ctx, sess, msg); resp != nil {
+			out = append(out, resp)
+		}
+	}
+	return out
+}
+
+// Handle handles one message and returns the response to send, or nil
+// for notifications and for responses from the peer.
+func (s *Server) Handle(ctx context.Context, sess *Session, msg *Message) *Message {
+	if msg.JSONRPC != jsonrpcVersion {
+		if msg.hasID() {
+			return newErrorResponse(msg.ID, CodeInvalidRequest, "jsonrpc must be \"2.0\"")
+		}
+		return nil
+	}
+	if msg.IsNotification() {
+		s.notification(sess, msg)
+		return nil
+	}
+	if !msg.IsRequest() {
+		if msg.Result == nil && msg.Error == nil {
+			return newErrorResponse(msg.ID, CodeInvalidRequest, "message has an id but no method or result")
+		}
+		return nil
+	}
+
+	key := string(msg.ID)
+	ctx, cancel := context.WithCancel(ctx)
+	sess.mu.Lock()
+	sess.inflight[key] = cancel
+	sess.mu.Unlock()
+	defer func() {
+		sess.mu.Lock()
+		delete(sess.inflight, key)
+		sess.mu.Unlock()
+		cancel()
+	}()
+
+	result, rpcErr := s.request(ctx, sess, msg)
+	if rpcErr != nil {
+		return newErrorResponse(msg.ID, rpcErr.Code, rpcErr.Message)
+	}
+	return newResponse(msg.ID, result)
+}
+
+func (s *Server) notification(sess *Session, msg *Message) {
+	if msg.Method != MethodCancelled {
+		return
+	}
+	var params cancelledParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+	sess.mu.Lock()
+	cancel := sess.inflight[string(params.RequestID)]
+	sess.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *Server) request(ctx context.Context, sess *Session, msg *Message) (interface{}, *Error) {
+	switch msg.Method {
+	case MethodInitialize:
+		return s.initialize(sess, msg.Params)
+	case MethodPing:
+		return struct{}{}, nil
+	case MethodToolsList:
+		return s.listTools(sess), nil
+	case MethodToolsCall:
+		return s.callTool(ctx, sess, msg.ID, msg.Params)
+	case MethodResourcesList:
+		return s.listResources(sess), nil
+	case MethodResourceTemplatesList:
+		return ListResourceTemplatesResult{ResourceTemplates: []ResourceTemplate{{
+			URITemplate: "file://{+path}",
+			Name:        "workspace file",
+			Description: "Any text file in the workspace, by absolute path.",
+			MimeType:    "text/plain",
+		}}}, nil
+	case MethodResourcesRead:
+		return s.readResource(ctx, sess, msg.Params)
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// initialize agrees on the protocol version: the client's when it is
+// supported, otherwise the latest, which the client may reject.
+func (s *Server) initialize(sess *Session, raw json.RawMessage) (interface{}, *Error) {
+	var params InitializeParams
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: "invalid initialize params"}
+		}
+	}
+	version := params.ProtocolVersion
+	if !supportedProtocolVersions[version] {
+		version = LatestProtocolVersion
+	}
+
+	return InitializeResult{
+		ProtocolVersion: version,
+		Capabilities: ServerCapabilities{
+			Tools:     &ListCapability{},
+			Resources: &ListCapability{},
+		},
+		ServerInfo: Implementation{Name: s.cfg.Name, Version: s.cfg.Version},
+		Instructions: fmt.Sprintf("Tools and resources are confined to the workspace %s; tool paths may be relative to it. "+
+			"Resources list the files open in the editor, whose text may be newer than what is saved.", sess.Workspace()),
+	}, nil
+}
+
+func (s *Server) listTools(sess *Session) ListToolsResult {
+	defs := sess.tools.Tools()
+	out := ListToolsResult{Tools: make([]Tool, 0, len(defs))}
+	for _, def := range defs {
+		out.Tools = append(out.Tools, Tool{Name: def.Name, Description: def.Description, InputSchema: def.Parameters})
+	}
+	return out
+}
+
+func (s *Server) callTool(ctx context.Context, sess *Session, id json.RawMessage, raw json.RawMessage) (interface{}, *Error) {
+	var params CallToolParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.Name == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "tools/call needs a tool name"}
+	}
+	known := false
+	for _, def := range sess.tools.Tools() {
+		if def.Name == params.Name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, &Error{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	args := params.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	result, err := sess.tools.Call(ctx, llm.ToolCall{ID: string(id), Name: params.Name, Arguments: args})
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: "tool call canceled"}
+	}
+	return CallToolResult{
+		Content: []Content{{Type: "text", Text: result.Content}},
+		IsError: result.IsError,
+	}, nil
+}
+
+// openDocuments returns the documents open in the editor that lie in the
+// session's workspace, by path.
+func (s *Server) openDocuments(sess *Session) map[string]lsp.OpenDocument {
+	out := map[string]lsp.OpenDocument{}
+	if s.documents == nil {
+		return out
+	}
+	for _, doc := range s.documents.Documents() {
+		path, err := pathFromURI(doc.URI)
+		if err != nil {
+			continue
+		}
+		if path, err = sess.tools.Resolve(path); err == nil {
+			out[path] = doc
+		}
+	}
+	return out
+}
+
+func (s *Server) listResources(sess *Session) ListResourcesResult {
+	docs := s.openDocuments(sess)
+	out := ListResourcesResult{Resources: make([]Resource, 0, len(docs))}
+	for path, doc := range docs {
+		name := path
+		if rel, err := filepath.Rel(sess.Workspace(), path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		out.Resources = append(out.Resources, Resource{
+			URI:         fileURI(path),
+			Name:        name,
+			Description: fmt.Sprintf("Open in the editor (%s, version %d)", doc.LanguageID, doc.Version),
+			MimeType:    mimeType(doc.LanguageID),
+		})
+	}
+	sort.Slice(out.Resources, func(i, j int) bool { return out.Resources[i].Name < out.Resources[j].Name })
+	return out
+}
+
+func (s *Server) readResource(ctx context.Context, sess *Session, raw json.RawMessage) (interface{}, *Error) {
+	var params ReadResourceParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.URI == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "resources/read needs a uri"}
+	}
+	path, err := pathFromURI(params.URI)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	path, err = sess.tools.Resolve(path)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	if doc, ok := s.openDocuments(sess)[path]; ok {
+		return ReadResourceResult{Contents: []ResourceContents{{
+			URI:      params.URI,
+			MimeType: mimeType(doc.LanguageID),
+			Text:     doc.Text,
+		}}}, nil
+	}
+	result, err := s.fs.ReadText(ctx, path)
+	switch {
+	case errors.Is(err, fsservice.ErrPathNotFound):
+		return nil, &Error{Code: CodeResourceNotFound, Message: "resource not found: " + params.URI}
+	case err != nil && ctx.Err() != nil:
+		return nil, &Error{Code: CodeInternalError, Message: "request canceled"}
+	case err != nil:
+		return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return ReadResourceResult{Contents: []ResourceContents{{
+		URI:      params.URI,
+		MimeType: "text/plain",
+		Text:     result.Content,
+	}}}, nil
+}
+
+func pathFromURI(raw string) (string, error) {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid uri %q", raw)
+	}
+	if uri.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri scheme %q", uri.Scheme)
+	}
+	path := uri.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path), nil
+}
+
+func fileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// mimeType maps an LSP language ID to the MIME type resources report.
+func mimeType(languageID string) string {
+	switch languageID {
+	case "markdown":
+		return "text/markdown"
+	case "json", "jsonc":
+		return "application/json"
+	case "javascript", "javascriptreact":
+		return "text/javascript"
+	case "html":
+		return "text/html"
+	case "css":
+		return "text/css"
+	}
+	return "text/plain"
+}
+
+func newSessionID() string {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}
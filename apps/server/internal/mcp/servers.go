@@ -0,0 +1,91 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrServerNotFound = errors.New("mcp server not found")
+	ErrServerDisabled = errors.New("mcp server is disabled")
+	ErrServerNotReady = errors.New("mcp server is not connected")
+	ErrConnClosed     = errors.New("mcp connection closed")
+)
+
+var serverNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+(_[A-Za-z0-9-]+)*$`)
+
+// ServerConfig describes an external MCP server whose tools the agent may
+// use. A server with a command is started and spoken to over stdio; one
+// with a URL is reached over streamable HTTP. A started server sees only
+// PATH, HOME and a few other basics of the server's environment, plus Env.
+// Only the name of the variable holding a bearer token is configured, never
+// the token.
+type ServerConfig struct {
+	Name           string            `json:"name"`
+	Command        string            `json:"command,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Dir            string            `json:"cwd,omitempty"`
+	URL            string            `json:"url,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	TokenEnv       string            `json:"tokenEnv,omitempty"`
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"`
+	Disabled       bool              `json:"disabled,omitempty"`
+}
+
+func (c ServerConfig) transport() string {
+	if c.URL != "" {
+		return "http"
+	}
+	return "stdio"
+}
+
+// LoadServers reads the JSON array of servers in path; a missing file
+// means none. Names become the prefix of the server's tools, so they must
+// be unique and made of letters, digits, dashes and single underscores.
+// Invalid entries are left out and reported in the error alongside the
+// valid ones.
+func LoadServers(path string) ([]ServerConfig, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []ServerConfig
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var servers []ServerConfig
+	var problems []string
+	seen := map[string]bool{}
+	for i, server := range configs {
+		server.Name = strings.TrimSpace(server.Name)
+		server.Command = strings.TrimSpace(server.Command)
+		server.URL = strings.TrimSpace(server.URL)
+		switch {
+		case !serverNamePattern.MatchString(server.Name):
+			problems = append(problems, fmt.Sprintf("server %d: invalid name %q", i, server.Name))
+		case seen[server.Name]:
+			problems = append(problems, fmt.Sprintf("server %q: duplicate name", server.Name))
+		case (server.Command == "") == (server.URL == ""):
+			problems = append(problems, fmt.Sprintf("server %q: exactly one of command and url is required", server.Name))
+		case server.URL != "" && !strings.HasPrefix(server.URL, "http://") && !strings.HasPrefix(server.URL, "https://"):
+			problems = append(problems, fmt.Sprintf("server %q: url must be http or https", server.Name))
+		default:
+			seen[server.Name] = true
+			servers = append(servers, server)
+		}
+	}
+	if len(problems) > 0 {
+		return servers, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return servers, nil
+}
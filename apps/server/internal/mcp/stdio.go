@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// maxStdioMessageBytes bounds one line of the stdio transport.
+const maxStdioMessageBytes = 16 * 1024 * 1024
+
+// ServeStdio runs one session on workspace over newline-delimited JSON-RPC
+// on r and w until r ends or ctx is done. Requests run concurrently, so a
+// long command does not hold up pings or cancellations, and responses are
+// written as they finish.
+func (s *Server) ServeStdio(ctx context.Context, workspace string, r io.Reader, w io.Writer) error {
+	sess, err := s.OpenSession(workspace)
+	if err != nil {
+		return err
+	}
+	defer s.CloseSession(sess.ID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(w)
+	send := func(payload interface{}) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = encoder.Encode(payload)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdioMessageBytes)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		msgs, batch, err := ParseMessages(scanner.Bytes())
+		if err != nil {
+			send(ParseErrorResponse(err))
+			continue
+		}
+		if !batch && !msgs[0].IsRequest() {
+			if resp := s.Handle(ctx, sess, msgs[0]); resp != nil {
+				send(resp)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses := s.HandleBatch(ctx, sess, msgs)
+			switch {
+			case len(responses) == 0:
+			case batch:
+				send(responses)
+			default:
+				send(responses[0])
+			}
+		}()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return scanner.Err()
+}
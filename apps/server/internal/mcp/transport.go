@@ -0,0 +1,257 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"local/monorepo/internal/procgroup"
+)
+
+const (
+	maxStderrTailBytes = 8 * 1024
+	stdinCloseGrace    = 2 * time.Second
+	waitDelay          = 2 * time.Second
+	terminateGrace     = 2 * time.Second
+)
+
+// transport carries JSON-RPC messages to one external server. send
+// returns the response to a request, or nil for a notification; messages
+// the server sends on its own go to the notify callback given when the
+// transport was made. done is closed once the connection is lost, and err
+// then tells why if the transport cut it off itself.
+type transport interface {
+	send(ctx context.Context, msg *Message) (*Message, error)
+	setProtocolVersion(version string)
+	done() <-chan struct{}
+	close()
+	pid() int
+	stderr() string
+	err() error
+}
+
+type notifyFunc func(method string, params json.RawMessage)
+
+// stdioTransport runs the server as a child process and exchanges
+// newline-delimited messages over its stdin and stdout.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	notify notifyFunc
+	tail   *procgroup.TailBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan *Message
+	exited  chan struct{}
+	readErr error
+}
+
+func startStdio(config ServerConfig, notify notifyFunc) (*stdioTransport, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Dir = config.Dir
+	cmd.Env = inheritedEnv()
+	keys := make([]string, 0, len(config.Env))
+	for key := range config.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cmd.Env = append(cmd.Env, key+"="+config.Env[key])
+	}
+	procgroup.Configure(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Output goes through a pipe of our own rather than StdoutPipe, so Wait
+	// copies it and WaitDelay can cut it off: a crashed server's orphaned
+	// children may hold its stdout and stderr open indefinitely.
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.WaitDelay = waitDelay
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		notify:  notify,
+		tail:    procgroup.NewTailBuffer(maxStderrTailBytes),
+		pending: map[string]chan *Message{},
+		exited:  make(chan struct{}),
+	}
+	cmd.Stderr = t.tail
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_ = cmd.Wait()
+		_ = stdoutWriter.Close()
+		close(t.exited)
+	}()
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			msgs, _, err := ParseMessages(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+			for _, msg := range msgs {
+				t.receive(msg)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			// An unreadable stdout leaves every request waiting for a reply
+			// that never comes; stop the server so it is restarted.
+			t.mu.Lock()
+			t.readErr = fmt.Errorf("read stdout: %w", err)
+			t.mu.Unlock()
+			go procgroup.Terminate(cmd, terminateGrace, t.exited)
+		}
+		// Drain so the copy into the pipe never blocks while exiting.
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+	return t, nil
+}
+
+// inheritedEnv is the part of the server's environment a stdio server
+// gets before its own env: enough to find programs and a home directory,
+// but none of the server's tokens or API keys.
+func inheritedEnv() []string {
+	names := []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR", "LANG", "LC_ALL", "LC_CTYPE"}
+	if runtime.GOOS == "windows" {
+		names = []string{
+			"PATH", "PATHEXT", "SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "TEMP", "TMP",
+			"USERNAME", "USERPROFILE", "HOMEDRIVE", "HOMEPATH", "APPDATA", "LOCALAPPDATA",
+			"PROGRAMFILES", "PROCESSOR_ARCHITECTURE",
+		}
+	}
+	var env []string
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+func (t *stdioTransport) receive(msg *Message) {
+	switch {
+	case msg.IsRequest():
+		// Sampling, roots and elicitation are not offered, so ping is the
+		// only request a server may send.
+		reply := newErrorResponse(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method)
+		if msg.Method == MethodPing {
+			reply = newResponse(msg.ID, struct{}{})
+		}
+		_ = t.write(reply)
+	case msg.IsNotification():
+		if t.notify != nil {
+			t.notify(msg.Method, msg.Params)
+		}
+	case msg.hasID():
+		t.mu.Lock()
+		ch := t.pending[string(msg.ID)]
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	}
+}
+
+func (t *stdioTransport) write(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	if !msg.IsRequest() {
+		if err := t.write(msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrConnClosed, err)
+		}
+		return nil, nil
+	}
+
+	key := string(msg.ID)
+	ch := make(chan *Message, 1)
+	t.mu.Lock()
+	t.pending[key] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, key)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnClosed, err)
+	}
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-t.exited:
+		// the reply may have been the server's last words
+		select {
+		case reply := <-ch:
+			return reply, nil
+		default:
+		}
+		return nil, ErrConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) setProtocolVersion(string) {}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.exited
+}
+
+// close ends the server the way the stdio transport asks for: stdin is
+// closed first, then the process group is terminated if it lingers.
+func (t *stdioTransport) close() {
+	t.writeMu.Lock()
+	_ = t.stdin.Close()
+	t.writeMu.Unlock()
+	select {
+	case <-t.exited:
+		return
+	case <-time.After(stdinCloseGrace):
+	}
+	procgroup.Terminate(t.cmd, terminateGrace, t.exited)
+	<-t.exited
+}
+
+func (t *stdioTransport) pid() int {
+	if t.cmd.Process == nil {
+		return 0
+	}
+	return t.cmd.Process.Pid
+}
+
+func (t *stdioTransport) stderr() string {
+	return t.tail.String()
+}
+
+func (t *stdioTransport) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.readErr
+}
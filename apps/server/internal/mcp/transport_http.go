@@ -0,0 +1,247 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionHeader         = "Mcp-Session-Id"
+	protocolVersionHeader = "MCP-Protocol-Version"
+	maxHTTPErrorBytes     = 4 * 1024
+	deleteSessionTimeout  = 5 * time.Second
+)
+
+// httpTransport speaks the streamable HTTP transport: every message is a
+// POST answered with JSON or an event stream. The server's own GET stream
+// is not opened, so it can only send messages while answering a request.
+type httpTransport struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+	notify  notifyFunc
+
+	mu        sync.Mutex
+	sessionID string
+	version   string
+	lost      chan struct{}
+	lostOnce  sync.Once
+}
+
+func newHTTPTransport(config ServerConfig, notify notifyFunc) (*httpTransport, error) {
+	headers := map[string]string{}
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
+	if config.TokenEnv != "" {
+		token := strings.TrimSpace(os.Getenv(config.TokenEnv))
+		if token == "" {
+			return nil, fmt.Errorf("token variable %s is not set", config.TokenEnv)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+	return &httpTransport{
+		client:  &http.Client{},
+		url:     config.URL,
+		headers: headers,
+		notify:  notify,
+		lost:    make(chan struct{}),
+	}, nil
+}
+
+func (t *httpTransport) request(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionHeader, t.sessionID)
+	}
+	if t.version != "" {
+		req.Header.Set(protocolVersionHeader, t.version)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	select {
+	case <-t.lost:
+		return nil, ErrConnClosed
+	default:
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.request(ctx, http.MethodPost, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		t.markLost()
+		return nil, fmt.Errorf("%w: %v", ErrConnClosed, err)
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(sessionHeader); id != "" && msg.Method == MethodInitialize {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && req.Header.Get(sessionHeader) != "":
+		// The server forgot the session; a new one needs a new initialize.
+		t.markLost()
+		return nil, fmt.Errorf("%w: session expired", ErrConnClosed)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBytes))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(text)))
+	case !msg.IsRequest():
+		return nil, nil
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	if mediaType == "text/event-stream" {
+		return t.readEvents(ctx, resp.Body, msg.ID)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return t.dispatch(ctx, data, msg.ID)
+}
+
+// readEvents reads an event stream until the response to id arrives.
+func (t *httpTransport) readEvents(ctx context.Context, body io.Reader, id json.RawMessage) (*Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				reply, err := t.dispatch(ctx, data.Bytes(), id)
+				if reply != nil || err != nil {
+					return reply, err
+				}
+				data.Reset()
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if data.Len() > 0 {
+		if reply, err := t.dispatch(ctx, data.Bytes(), id); reply != nil || err != nil {
+			return reply, err
+		}
+	}
+	return nil, errors.New("event stream ended without a response")
+}
+
+// dispatch handles the messages in data and returns the response to id
+// among them, if any. Server requests are answered as on stdio.
+func (t *httpTransport) dispatch(ctx context.Context, data []byte, id json.RawMessage) (*Message, error) {
+	msgs, _, err := ParseMessages(data)
+	if err != nil {
+		return nil, err
+	}
+	var reply *Message
+	for _, msg := range msgs {
+		switch {
+		case msg.IsRequest():
+			answer := newErrorResponse(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method)
+			if msg.Method == MethodPing {
+				answer = newResponse(msg.ID, struct{}{})
+			}
+			go func() { _, _ = t.send(context.Background(), answer) }()
+		case msg.IsNotification():
+			if t.notify != nil {
+				t.notify(msg.Method, msg.Params)
+			}
+		case bytes.Equal(msg.ID, id):
+			reply = msg
+		}
+	}
+	return reply, nil
+}
+
+func (t *httpTransport) markLost() {
+	t.lostOnce.Do(func() { close(t.lost) })
+}
+
+func (t *httpTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version = version
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.lost
+}
+
+// close ends the session on the server, if it gave one.
+func (t *httpTransport) close() {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	select {
+	case <-t.lost:
+		return
+	default:
+	}
+	t.markLost()
+	if sessionID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deleteSessionTimeout)
+	defer cancel()
+	req, err := t.request(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := t.client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (t *httpTransport) pid() int {
+	return 0
+}
+
+func (t *httpTransport) stderr() string {
+	return ""
+}
+
+func (t *httpTransport) err() error {
+	return nil
+}
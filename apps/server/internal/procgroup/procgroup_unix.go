@@ -0,0 +1,39 @@
+//go:build !windows
+
+// Package procgroup runs child processes in their own process group so
+// stopping one also stops every helper it spawned.
+package procgroup
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Configure puts cmd in its own process group. It must be called before
+// cmd is started.
+func Configure(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Terminate sends SIGTERM to cmd's group and SIGKILL if it is still running
+// after grace. done is closed once cmd has exited.
+func Terminate(cmd *exec.Cmd, grace time.Duration, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	default:
+	}
+	if cmd.Process == nil {
+		return
+	}
+
+	pgid := cmd.Process.Pid
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
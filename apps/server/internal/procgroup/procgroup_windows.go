@@ -0,0 +1,21 @@
+//go:build windows
+
+package procgroup
+
+import (
+	"os/exec"
+	"time"
+)
+
+func Configure(_ *exec.Cmd) {}
+
+func Terminate(cmd *exec.Cmd, _ time.Duration, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	default:
+	}
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,32 @@
+package procgroup
+
+import "sync"
+
+// TailBuffer keeps the last bytes written to it, such as the end of a
+// child's stderr.
+type TailBuffer struct {
+	mu   sync.Mutex
+	max  int
+	data []byte
+}
+
+// NewTailBuffer keeps at most max bytes.
+func NewTailBuffer(max int) *TailBuffer {
+	return &TailBuffer{max: max}
+}
+
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if excess := len(b.data) - b.max; excess > 0 {
+		b.data = append(b.data[:0], b.data[excess:]...)
+	}
+	return len(p), nil
+}
+
+func (b *TailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -9,24 +10,104 @@ import (
 
 	"go.uber.org/zap"
 
+	"local/monorepo/internal/agent"
+	"local/monorepo/internal/approvals"
+	"local/monorepo/internal/attachments"
+	"local/monorepo/internal/changesets"
 	"local/monorepo/internal/config"
+	"local/monorepo/internal/diagnostics"
 	"local/monorepo/internal/fs"
+	"local/monorepo/internal/git"
 	"local/monorepo/internal/handlers"
+	"local/monorepo/internal/index"
+	"local/monorepo/internal/llm"
+	"local/monorepo/internal/lsp"
+	"local/monorepo/internal/mcp"
 	"local/monorepo/internal/middleware"
+	"local/monorepo/internal/symbols"
+	"local/monorepo/internal/tasks"
+	"local/monorepo/internal/threads"
 )
 
 type Server struct {
 	srv    *http.Server
 	logger *zap.Logger
 	errCh  chan error
+	tasks  *tasks.Manager
+	lsp    *lsp.Manager
+	mcp    *mcp.Manager
+	agent  *agent.Runner
+	index  *index.Index
 }
 
 func New(cfg config.Config, logger *zap.Logger) *Server {
 	mux := http.NewServeMux()
-	fsHandler := handlers.NewFSHandler(fs.NewService(fs.DefaultConfig()))
+	fsConfig := fs.DefaultConfig()
+	fsConfig.HistoryDir = filepath.Join(cfg.DataDir, "history")
+	fsService := fs.NewService(fsConfig)
+	changesetManager, err := changesets.NewManager(filepath.Join(cfg.DataDir, "changesets"), fsService)
+	if err != nil {
+		logger.Error("changesets unavailable", zap.Error(err))
+	}
+	fsHandler := handlers.NewFSHandler(fsService, changesetManager)
+	indexConfig, err := index.LoadConfig(filepath.Join(cfg.DataDir, "index.json"))
+	if err != nil {
+		logger.Error("index config ignored", zap.Error(err))
+	}
+	indexConfig.Dir = filepath.Join(cfg.DataDir, "index")
+	applyIndexEnv(&indexConfig, cfg.Index)
+	codeIndex := index.New(indexConfig)
+	fsService.OnChange(codeIndex.Notify)
+	indexHandler := handlers.NewIndexHandler(codeIndex)
+	symbolTable := symbols.NewTable(symbols.DefaultConfig(), fsService)
+	fsService.OnChange(symbolTable.Notify)
+	symbolsHandler := handlers.NewSymbolsHandler(symbolTable)
+	diagnosticsStore := diagnostics.NewStore()
+	diagnosticsHandler := handlers.NewDiagnosticsHandler(diagnosticsStore)
+	taskConfig := tasks.DefaultConfig()
+	taskConfig.OnFinish = func(run tasks.RunInfo) {
+		if run.Status != tasks.StatusCanceled {
+			diagnosticsStore.SetWorkspace(run.Root, "task:"+run.Task.ID, diagnostics.FromTaskRun(run))
+		}
+	}
+	taskManager := tasks.NewManager(taskConfig)
+	tasksHandler := handlers.NewTasksHandler(taskManager)
+	lspServers, err := lsp.LoadServers(filepath.Join(cfg.DataDir, "lsp.json"))
+	if err != nil {
+		logger.Error("language server config ignored", zap.Error(err))
+	}
+	lspManager := lsp.NewManager(lspServers)
+	lspManager.OnNotification(func(language, root, method string, params json.RawMessage) {
+		if method != diagnostics.PublishDiagnosticsMethod {
+			return
+		}
+		path, found, err := diagnostics.FromLSP(params, language)
+		if err == nil {
+			diagnosticsStore.SetFile(root, "lsp:"+language, path, found)
+		}
+	})
+	lspManager.OnExit(func(language, root string) {
+		diagnosticsStore.ClearProducer(root, "lsp:"+language)
+	})
+	lspHandler := handlers.NewLSPHandler(lspManager)
+	llmConfig, err := llm.LoadConfig(filepath.Join(cfg.DataDir, "llm.json"))
+	if err != nil {
+		logger.Error("llm config ignored", zap.Error(err))
+	}
+	applyLLMEnv(&llmConfig, cfg.LLM)
+	llmRegistry := llm.NewRegistry(llmConfig)
+	llmHandler := handlers.NewLLMHandler(llmRegistry)
+	gitConfig := git.DefaultConfig()
+	gitConfig.WorktreeDir = filepath.Join(cfg.DataDir, "worktrees")
+	gitService := git.NewService(gitConfig)
+	gitHandler := handlers.NewGitHandler(gitService, fsService)
 	mux.HandleFunc("/v1/global/health", handlers.HealthHandler)
 	mux.HandleFunc("/v1/terminals/auth", handlers.TerminalAuthHandler)
 	mux.HandleFunc("/v1/terminals/ws", handlers.TerminalWebSocketHandler)
+	mux.HandleFunc("/v1/terminals/protocol", handlers.TerminalProtocolHandler)
+	mux.HandleFunc("/v1/terminals/sessions", handlers.TerminalSessionsHandler)
+	mux.HandleFunc("/v1/terminals/process", handlers.TerminalProcessHandler)
+	mux.Handle("/v1/terminals/signal", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(handlers.TerminalSignalHandler)))
 
 	// filesystem / workspace APIs
 	mux.HandleFunc("/v1/fs/stat", fsHandler.Stat)
@@ -35,8 +116,146 @@ func New(cfg config.Config, logger *zap.Logger) *Server {
 	mux.Handle("/v1/fs/write", middleware.MaxBodyBytes(6*1024*1024)(http.HandlerFunc(fsHandler.Write)))
 	mux.Handle("/v1/fs/create", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(fsHandler.Create)))
 	mux.Handle("/v1/fs/delete", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(fsHandler.Delete)))
+	mux.Handle("/v1/fs/patch", middleware.MaxBodyBytes(6*1024*1024)(http.HandlerFunc(fsHandler.Patch)))
+	mux.Handle("/v1/fs/batch", middleware.MaxBodyBytes(40*1024*1024)(http.HandlerFunc(fsHandler.Batch)))
+	mux.HandleFunc("/v1/fs/history", fsHandler.History)
+	mux.Handle("/v1/fs/history/restore", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(fsHandler.RestoreHistory)))
+	mux.HandleFunc("/v1/workspaces", fsHandler.Workspaces)
 	mux.Handle("/v1/workspaces/open", middleware.MaxBodyBytes(256*1024)(http.HandlerFunc(fsHandler.WorkspaceOpen)))
 
+	// agent changesets
+	if changesetManager != nil {
+		changesetsHandler := handlers.NewChangesetsHandler(changesetManager)
+		mux.HandleFunc("/v1/changesets", changesetsHandler.List)
+		mux.HandleFunc("/v1/changesets/get", changesetsHandler.Get)
+		mux.Handle("/v1/changesets/create", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(changesetsHandler.Create)))
+		mux.Handle("/v1/changesets/apply", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(changesetsHandler.Apply)))
+		mux.Handle("/v1/changesets/reject", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(changesetsHandler.Reject)))
+		mux.Handle("/v1/changesets/discard", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(changesetsHandler.Discard)))
+	}
+
+	// language servers
+	mux.HandleFunc("/v1/lsp/servers", lspHandler.Servers)
+	mux.HandleFunc("/v1/lsp/ws", lspHandler.WebSocket)
+
+	// model providers
+	mux.HandleFunc("/v1/llm/providers", llmHandler.Providers)
+
+	// chat threads
+	var agentRunner *agent.Runner
+	threadStore, err := threads.NewStore(filepath.Join(cfg.DataDir, "threads"))
+	if err != nil {
+		logger.Error("threads unavailable", zap.Error(err))
+	} else {
+		threadsHandler := handlers.NewThreadsHandler(threadStore)
+		mux.HandleFunc("/v1/threads", threadsHandler.List)
+		mux.HandleFunc("/v1/threads/messages", threadsHandler.Messages)
+		mux.Handle("/v1/threads/create", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(threadsHandler.Create)))
+		mux.Handle("/v1/threads/append", middleware.MaxBodyBytes(8*1024*1024)(http.HandlerFunc(threadsHandler.Append)))
+		mux.Handle("/v1/threads/update", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(threadsHandler.Update)))
+		mux.Handle("/v1/threads/rename", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(threadsHandler.Rename)))
+		mux.Handle("/v1/threads/archive", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(threadsHandler.Archive)))
+		mux.Handle("/v1/threads/delete", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(threadsHandler.Delete)))
+	}
+
+	// external MCP servers whose tools the agent may call
+	mcpServers, err := mcp.LoadServers(filepath.Join(cfg.DataDir, "mcp.json"))
+	if err != nil {
+		logger.Error("mcp server config partly ignored", zap.Error(err))
+	}
+	mcpClients := mcp.NewManager(mcpServers)
+	mcpServersHandler := handlers.NewMCPServersHandler(mcpClients)
+	mux.HandleFunc("/v1/mcp/servers", mcpServersHandler.Servers)
+	mux.Handle("/v1/mcp/servers/restart", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(mcpServersHandler.Restart)))
+
+	// agent runs and the approvals that gate their tool calls; without a
+	// rule store there is no way to gate, so the agent stays disabled
+	approvalStore, err := approvals.NewStore(filepath.Join(cfg.DataDir, "approvals"))
+	if err != nil {
+		logger.Error("approvals unavailable", zap.Error(err))
+	} else if threadStore != nil {
+		approvalGate := approvals.NewGate(approvalStore)
+		approvalsHandler := handlers.NewApprovalsHandler(approvalGate)
+		mux.HandleFunc("/v1/approvals", approvalsHandler.List)
+		mux.HandleFunc("/v1/approvals/stream", approvalsHandler.Stream)
+		mux.HandleFunc("/v1/approvals/rules", approvalsHandler.Rules)
+		mux.Handle("/v1/approvals/rules/add", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(approvalsHandler.AddRule)))
+		mux.Handle("/v1/approvals/rules/delete", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(approvalsHandler.DeleteRule)))
+		mux.Handle("/v1/approvals/", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(approvalsHandler.Approval)))
+
+		agentRunner = agent.NewRunner(agent.DefaultConfig(), fsService, threadStore, llmRegistry, approvalGate)
+		agentRunner.SetExternalTools(mcpClients)
+		agentHandler := handlers.NewAgentHandler(agentRunner)
+		mux.HandleFunc("/v1/agent/runs", agentHandler.Runs)
+		mux.HandleFunc("/v1/agent/status", agentHandler.Status)
+		mux.HandleFunc("/v1/agent/stream", agentHandler.Stream)
+		mux.Handle("/v1/agent/run", middleware.MaxBodyBytes(8*1024*1024)(http.HandlerFunc(agentHandler.Run)))
+		mux.Handle("/v1/agent/cancel", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(agentHandler.Cancel)))
+
+		// Model Context Protocol for other agent tools, with the agent's
+		// tools, sandbox and approvals
+		mcpConfig := mcp.DefaultConfig()
+		if cfg.MCP.Mode != "" {
+			mcpConfig.Mode = cfg.MCP.Mode
+		}
+		mcpHandler := handlers.NewMCPHandler(mcp.NewServer(mcpConfig, fsService, approvalGate, lspManager))
+		mux.Handle("/v1/mcp", middleware.MaxBodyBytes(8*1024*1024)(http.HandlerFunc(mcpHandler.Endpoint)))
+	}
+
+	// prompt context: attachments, token accounting and history compaction
+	contextResolver := attachments.NewResolver(attachments.DefaultConfig(), fsService, gitService, diagnosticsStore, handlers.TerminalOutput)
+	contextHandler := handlers.NewContextHandler(agentRunner, contextResolver)
+	mux.Handle("/v1/context/resolve", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(contextHandler.Resolve)))
+	if agentRunner != nil {
+		mux.Handle("/v1/context/usage", middleware.MaxBodyBytes(8*1024*1024)(http.HandlerFunc(contextHandler.Usage)))
+		mux.Handle("/v1/context/compact", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(contextHandler.Compact)))
+	}
+
+	// semantic codebase index
+	mux.Handle("/v1/index/query", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(indexHandler.Query)))
+	mux.HandleFunc("/v1/index/status", indexHandler.Status)
+	mux.Handle("/v1/index/refresh", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(indexHandler.Refresh)))
+
+	// symbol outlines and workspace symbol search
+	mux.HandleFunc("/v1/symbols/document", symbolsHandler.Document)
+	mux.HandleFunc("/v1/symbols/workspace", symbolsHandler.Workspace)
+
+	// diagnostics from language servers, tasks and checkers
+	mux.HandleFunc("/v1/diagnostics", diagnosticsHandler.List)
+	mux.HandleFunc("/v1/diagnostics/stream", diagnosticsHandler.Stream)
+	mux.Handle("/v1/diagnostics/check", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(diagnosticsHandler.Check)))
+
+	// workspace task runner
+	mux.HandleFunc("/v1/tasks", tasksHandler.List)
+	mux.Handle("/v1/tasks/run", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(tasksHandler.Run)))
+	mux.HandleFunc("/v1/tasks/runs", tasksHandler.Runs)
+	mux.HandleFunc("/v1/tasks/status", tasksHandler.Status)
+	mux.HandleFunc("/v1/tasks/logs", tasksHandler.Logs)
+	mux.Handle("/v1/tasks/cancel", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(tasksHandler.Cancel)))
+
+	// git APIs
+	mux.HandleFunc("/v1/git/status", gitHandler.Status)
+	mux.HandleFunc("/v1/git/branches", gitHandler.Branches)
+	mux.Handle("/v1/git/branches/create", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.CreateBranch)))
+	mux.Handle("/v1/git/switch", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.Switch)))
+	mux.HandleFunc("/v1/git/diff", gitHandler.Diff)
+	mux.Handle("/v1/git/stage", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.Stage)))
+	mux.Handle("/v1/git/unstage", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.Unstage)))
+	mux.Handle("/v1/git/commit", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.Commit)))
+	mux.Handle("/v1/git/stash", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.Stash)))
+	mux.HandleFunc("/v1/git/log", gitHandler.Log)
+	mux.HandleFunc("/v1/git/blame", gitHandler.Blame)
+	mux.HandleFunc("/v1/git/show", gitHandler.Show)
+	mux.HandleFunc("/v1/git/conflicts", gitHandler.Conflicts)
+	mux.HandleFunc("/v1/git/conflicts/file", gitHandler.Conflict)
+	mux.Handle("/v1/git/conflicts/resolve", middleware.MaxBodyBytes(6*1024*1024)(http.HandlerFunc(gitHandler.ResolveConflict)))
+	mux.HandleFunc("/v1/git/worktrees", gitHandler.Worktrees)
+	mux.Handle("/v1/git/worktrees/create", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.CreateWorktree)))
+	mux.Handle("/v1/git/worktrees/remove", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.RemoveWorktree)))
+	mux.Handle("/v1/git/worktrees/prune", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.PruneWorktrees)))
+	mux.HandleFunc("/v1/git/worktrees/diff", gitHandler.WorktreeDiff)
+	mux.Handle("/v1/git/worktrees/merge", middleware.MaxBodyBytes(128*1024)(http.HandlerFunc(gitHandler.MergeWorktree)))
+
 	// optionally serve the renderer web UI (serve-web)
 	webRoot := os.Getenv("OMT_WEB_ROOT")
 	if webRoot == "" {
@@ -76,7 +295,54 @@ func New(cfg config.Config, logger *zap.Logger) *Server {
 		MaxHeaderBytes:    1 << 20,
 	}
 
-	return &Server{srv: srv, logger: logger}
+	return &Server{srv: srv, logger: logger, tasks: taskManager, lsp: lspManager, mcp: mcpClients, agent: agentRunner, index: codeIndex}
+}
+
+// applyLLMEnv lets OMT_LLM_* pick the default provider and override or
+// define its endpoint without editing llm.json.
+func applyLLMEnv(llmConfig *llm.Config, env config.LLMConfig) {
+	if env.Provider == "" {
+		return
+	}
+	provider := llm.ProviderConfig{Name: env.Provider, Type: llm.TypeOpenAI}
+	for _, existing := range llmConfig.Providers {
+		if existing.Name == env.Provider {
+			provider = existing
+			break
+		}
+	}
+	if env.Type != "" {
+		provider.Type = env.Type
+	}
+	if env.BaseURL != "" {
+		provider.BaseURL = env.BaseURL
+	}
+	if env.Model != "" {
+		provider.Model = env.Model
+	}
+	if env.APIKeyEnv != "" {
+		provider.APIKeyEnv = env.APIKeyEnv
+	}
+	llmConfig.Set(provider)
+	llmConfig.Default = env.Provider
+}
+
+// applyIndexEnv lets OMT_INDEX_* replace the embedding endpoint from
+// index.json. Changing the embedder type starts from an empty endpoint
+// rather than mixing fields of two embedders.
+func applyIndexEnv(indexConfig *index.Config, env config.IndexConfig) {
+	if env.Embedder != "" && env.Embedder != indexConfig.Embedder.Type {
+		indexConfig.Embedder = index.EmbedderConfig{Type: env.Embedder}
+	}
+	if env.BaseURL != "" {
+		indexConfig.Embedder.BaseURL = env.BaseURL
+	}
+	if env.Model != "" {
+		indexConfig.Embedder.Model = env.Model
+	}
+	if env.APIKeyEnv != "" {
+		indexConfig.Embedder.APIKeyEnv = env.APIKeyEnv
+	}
 }
 
 func (s *Server) Start() <-chan error {
@@ -89,5 +355,15 @@ func (s *Server) Start() <-chan error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	// finish agent runs first so their event streams end before the
+	// server waits for open requests
+	if s.agent != nil {
+		s.agent.Close()
+	}
+	err := s.srv.Shutdown(ctx)
+	s.tasks.Close()
+	s.lsp.Close()
+	s.mcp.Close()
+	s.index.Close()
+	return err
 }
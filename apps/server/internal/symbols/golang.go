@@ -0,0 +1,202 @@
+package symbols
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// parseGo outlines a Go file with go/parser. Methods become children of
+// their receiver type when the type is declared in the same file and are
+// top-level with Container set otherwise. A file with syntax errors is
+// outlined as far as the parser got; it reports false only when nothing
+// parsed.
+func parseGo(content string) ([]Symbol, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil {
+		return nil, false
+	}
+	if err != nil && len(file.Decls) == 0 {
+		return nil, false
+	}
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	source := func(from, to token.Pos) string {
+		start, end := fset.Position(from).Offset, fset.Position(to).Offset
+		if start < 0 || end > len(content) || start >= end {
+			return ""
+		}
+		return collapseSpace(content[start:end])
+	}
+
+	var out []Symbol
+	types := map[string]int{}
+	var methods []Symbol
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			symbol := Symbol{
+				Name:      d.Name.Name,
+				Kind:      KindFunction,
+				Detail:    source(d.Pos(), d.Type.End()),
+				StartLine: line(start),
+				EndLine:   line(d.End()),
+				Line:      line(d.Name.Pos()),
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				symbol.Kind = KindMethod
+				symbol.Container = receiverName(d.Recv.List[0].Type)
+				methods = append(methods, symbol)
+				continue
+			}
+			out = append(out, symbol)
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				start, end := spec.Pos(), spec.End()
+				doc := specDoc(spec)
+				if len(d.Specs) == 1 || !d.Lparen.IsValid() {
+					start, end = d.Pos(), d.End()
+					if doc == nil {
+						doc = d.Doc
+					}
+				}
+				if doc != nil {
+					start = doc.Pos()
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					symbol := Symbol{
+						Name:      s.Name.Name,
+						Kind:      KindType,
+						StartLine: line(start),
+						EndLine:   line(end),
+						Line:      line(s.Name.Pos()),
+					}
+					switch t := s.Type.(type) {
+					case *ast.StructType:
+						symbol.Kind = KindStruct
+						symbol.Children = goFields(t.Fields, KindField, symbol.Name, line, source)
+					case *ast.InterfaceType:
+						symbol.Kind = KindInterface
+						symbol.Children = goFields(t.Methods, KindMethod, symbol.Name, line, source)
+					default:
+						symbol.Detail = truncateDetail(source(s.Type.Pos(), s.Type.End()))
+					}
+					types[symbol.Name] = len(out)
+					out = append(out, symbol)
+				case *ast.ValueSpec:
+					kind := KindVariable
+					if d.Tok == token.CONST {
+						kind = KindConstant
+					}
+					detail := ""
+					if s.Type != nil {
+						detail = source(s.Type.Pos(), s.Type.End())
+					}
+					for _, name := range s.Names {
+						if name.Name == "_" {
+							continue
+						}
+						out = append(out, Symbol{
+							Name:      name.Name,
+							Kind:      kind,
+							Detail:    detail,
+							StartLine: line(start),
+							EndLine:   line(end),
+							Line:      line(name.Pos()),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	for _, method := range methods {
+		if index, ok := types[method.Container]; ok {
+			out[index].Children = append(out[index].Children, method)
+			continue
+		}
+		out = append(out, method)
+	}
+	sortSymbols(out)
+	return out, true
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// goFields lists struct fields or interface methods; embedded types are
+// listed under their type name.
+func goFields(fields *ast.FieldList, kind, container string, line func(token.Pos) int, source func(token.Pos, token.Pos) string) []Symbol {
+	if fields == nil {
+		return nil
+	}
+	var out []Symbol
+	for _, field := range fields.List {
+		start := field.Pos()
+		if field.Doc != nil {
+			start = field.Doc.Pos()
+		}
+		detail := truncateDetail(source(field.Type.Pos(), field.Type.End()))
+		if len(field.Names) == 0 {
+			out = append(out, Symbol{
+				Name:      receiverName(field.Type),
+				Kind:      KindField,
+				Detail:    "embedded",
+				Container: container,
+				StartLine: line(start),
+				EndLine:   line(field.End()),
+				Line:      line(field.Type.Pos()),
+			})
+			continue
+		}
+		for _, name := range field.Names {
+			symbol := Symbol{
+				Name:      name.Name,
+				Kind:      kind,
+				Detail:    detail,
+				Container: container,
+				StartLine: line(start),
+				EndLine:   line(field.End()),
+				Line:      line(name.Pos()),
+			}
+			if kind == KindMethod {
+				symbol.Detail = strings.TrimPrefix(detail, "func")
+			}
+			out = append(out, symbol)
+		}
+	}
+	return out
+}
+
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
@@ -0,0 +1,381 @@
+package symbols
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rule matches the line a declaration starts on. The kind group holds the
+// declaration keyword and the name group its identifier; rules without a
+// kind group declare Kind.
+type rule struct {
+	re   *regexp.Regexp
+	kind string
+	// topLevel rules only match unindented lines, so locals such as
+	// JavaScript consts inside functions are not listed.
+	topLevel bool
+	// member rules only match inside a class-like symbol, where method
+	// declarations have no keyword to recognise them by.
+	member bool
+}
+
+func declRule(pattern, kind string) rule {
+	return rule{re: regexp.MustCompile(pattern), kind: kind}
+}
+
+func topRule(pattern, kind string) rule {
+	return rule{re: regexp.MustCompile(pattern), kind: kind, topLevel: true}
+}
+
+func memberRule(pattern, kind string) rule {
+	return rule{re: regexp.MustCompile(pattern), kind: kind, member: true}
+}
+
+var jsRules = []rule{
+	declRule(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?(?P<kind>function\*?|class|interface|enum|namespace|module)\s+(?P<name>[A-Za-z_$][\w$.]*)`, ""),
+	topRule(`^(?:export\s+)?(?:declare\s+)?(?P<kind>type)\s+(?P<name>[A-Za-z_$][\w$]*)`, ""),
+	topRule(`^(?:export\s+)?(?:declare\s+)?(?P<kind>const|let|var)\s+(?P<name>[A-Za-z_$][\w$]*)`, ""),
+	memberRule(`^\s+(?:(?:public|private|protected|static|readonly|abstract|override|async|get|set|declare)\s+)*(?P<name>#?[A-Za-z_$][\w$]*)\s*(?:<[^>]*>)?\s*\([^)]*\)?\s*(?::\s*[^=;{]+)?[{;]?\s*$`, KindMethod),
+	memberRule(`^\s+(?:(?:public|private|protected|static|readonly|declare)\s+)*(?P<name>#?[A-Za-z_$][\w$]*)\??\s*[:=][^=>]`, KindField),
+}
+
+var classRules = []rule{
+	declRule(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|static|final|abstract|sealed|open|override|data|inner|partial|readonly|unsafe|export)\s+)*(?P<kind>class|interface|enum|record|struct|object|protocol|extension|trait|namespace)\s+(?P<name>[A-Za-z_]\w*)`, ""),
+	declRule(`^\s*(?:(?:public|private|protected|internal|static|final|abstract|open|override|inline|suspend|operator|infix|mutating)\s+)*(?P<kind>fun|func|function)\s+(?:<[^>]*>\s*)?(?:[A-Za-z_][\w<>?,\s]*\.)?(?P<name>[A-Za-z_]\w*)`, ""),
+	memberRule(`^\s+(?:(?:public|private|protected|internal|static|final|abstract|synchronized|native|virtual|override|async|extern|unsafe|new|sealed|default)\s+)*(?:<[^>]*>\s+)?[\w<>\[\],.?]+\s+(?P<name>[A-Za-z_]\w*)\s*\([^;]*$`, KindMethod),
+}
+
+var cRules = []rule{
+	topRule(`^(?:typedef\s+)?(?P<kind>struct|class|enum|union|namespace)\s+(?P<name>[A-Za-z_]\w*)\s*[{:]?\s*$`, ""),
+	topRule(`^(?:template\s*<[^>]*>\s*)?[A-Za-z_][\w\s\*&:<>,]*?\b(?P<name>[A-Za-z_~][\w:~]*)\s*\([^;]*$`, KindFunction),
+	memberRule(`^\s+(?:(?:virtual|static|inline|explicit|constexpr)\s+)*[\w:<>\*&\s]+?\b(?P<name>[A-Za-z_~]\w*)\s*\([^;]*\)\s*(?:const\s*)?(?:override\s*)?\{?\s*$`, KindMethod),
+}
+
+// languageRules holds the declaration rules of each language the pattern
+// outliner knows. Go is outlined with go/parser instead.
+var languageRules = map[string][]rule{
+	"javascript": jsRules,
+	"jsx":        jsRules,
+	"typescript": jsRules,
+	"tsx":        jsRules,
+	"python": {
+		declRule(`^\s*(?:async\s+)?(?P<kind>def|class)\s+(?P<name>[A-Za-z_]\w*)`, ""),
+		topRule(`^(?P<name>[A-Z_][A-Z0-9_]*)\s*(?::[^=]+)?=[^=]`, KindConstant),
+	},
+	"rust": {
+		declRule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|unsafe|const|extern\s+"[^"]*")\s+)*(?P<kind>fn|struct|enum|trait|mod|type|static|const|union|macro_rules!)\s*(?P<name>[A-Za-z_]\w*)`, ""),
+		declRule(`^\s*(?:unsafe\s+)?(?P<kind>impl)(?:\s*<[^>]*>)?\s+(?P<name>[^{]+?)\s*(?:where\b.*)?\{?\s*$`, ""),
+	},
+	"java":   classRules,
+	"kotlin": classRules,
+	"csharp": classRules,
+	"swift":  classRules,
+	"php":    classRules,
+	"ruby": {
+		declRule(`^\s*(?P<kind>def|class|module)\s+(?P<name>(?:self\.)?[A-Za-z_][\w:?!=]*)`, ""),
+	},
+	"c":   cRules,
+	"cpp": cRules,
+	"bash": {
+		topRule(`^(?:function\s+)?(?P<name>[A-Za-z_][\w-]*)\s*\(\)\s*\{?`, KindFunction),
+		topRule(`^function\s+(?P<name>[A-Za-z_][\w-]*)`, KindFunction),
+	},
+	"protobuf": {
+		declRule(`^\s*(?P<kind>message|service|enum)\s+(?P<name>\w+)`, ""),
+		memberRule(`^\s+(?P<kind>rpc)\s+(?P<name>\w+)`, ""),
+	},
+	"sql": {
+		declRule(`(?i)^\s*create\s+(?:or\s+replace\s+)?(?:temporary\s+|temp\s+|unique\s+)?(?P<kind>table|view|index|function|procedure|trigger|type)\s+(?:if\s+not\s+exists\s+)?(?P<name>[\w."]+)`, ""),
+	},
+}
+
+// keywordKinds maps declaration keywords to symbol kinds.
+var keywordKinds = map[string]string{
+	"def":         KindFunction,
+	"fn":          KindFunction,
+	"fun":         KindFunction,
+	"func":        KindFunction,
+	"function":    KindFunction,
+	"function*":   KindFunction,
+	"macro_rules": KindFunction,
+	"procedure":   KindFunction,
+	"trigger":     KindFunction,
+	"rpc":         KindMethod,
+	"class":       KindClass,
+	"record":      KindClass,
+	"object":      KindClass,
+	"interface":   KindInterface,
+	"protocol":    KindInterface,
+	"trait":       KindInterface,
+	"service":     KindInterface,
+	"struct":      KindStruct,
+	"message":     KindStruct,
+	"union":       KindStruct,
+	"table":       KindStruct,
+	"view":        KindStruct,
+	"enum":        KindEnum,
+	"type":        KindType,
+	"index":       KindType,
+	"impl":        KindModule,
+	"extension":   KindModule,
+	"namespace":   KindModule,
+	"module":      KindModule,
+	"mod":         KindModule,
+	"const":       KindConstant,
+	"static":      KindVariable,
+	"let":         KindVariable,
+	"var":         KindVariable,
+}
+
+// controlWords are never method names, although "if (x) {" looks like a
+// method declaration to the member rules.
+var controlWords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"new": true, "else": true, "do": true, "try": true, "throw": true, "await": true,
+	"sizeof": true, "typeof": true, "delete": true, "super": true, "this": true,
+}
+
+// parsePatterns outlines content with the language's declaration rules.
+// Nesting and where each symbol ends come from indentation: a symbol ends
+// before the next non-blank line indented no deeper than its first line,
+// and includes that line when it closes the block ("}", "end", ")").
+// Comments and decorators directly above a declaration are part of it.
+func parsePatterns(content, language string) []Symbol {
+	if language == "markdown" {
+		return parseMarkdown(content)
+	}
+	rules := languageRules[language]
+	if len(rules) == 0 {
+		return nil
+	}
+	lines := strings.Split(content, "\n")
+
+	var roots []*Symbol
+	// stack holds the symbols whose end has not been passed yet
+	var stack []*Symbol
+	for i, text := range lines {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].EndLine < i+1 {
+			stack = stack[:len(stack)-1]
+		}
+		var parent *Symbol
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		kind, name, ok := matchRules(rules, text, parent)
+		if !ok {
+			continue
+		}
+		indent := indentOf(text)
+		if parent != nil && isContainer(parent.Kind) && kind == KindFunction {
+			kind = KindMethod
+		}
+		start := i
+		for start > 0 && isLeadingLine(lines[start-1]) && indentOf(lines[start-1]) == indent {
+			start--
+		}
+		symbol := &Symbol{
+			Name:      name,
+			Kind:      kind,
+			Detail:    truncateDetail(collapseSpace(text)),
+			StartLine: start + 1,
+			EndLine:   blockEnd(lines, i, indent) + 1,
+			Line:      i + 1,
+		}
+		if parent != nil {
+			symbol.Container = parent.Name
+			parent.Children = append(parent.Children, *symbol)
+			symbol = &parent.Children[len(parent.Children)-1]
+		} else {
+			roots = append(roots, symbol)
+		}
+		stack = append(stack, symbol)
+	}
+
+	out := make([]Symbol, 0, len(roots))
+	for _, root := range roots {
+		out = append(out, *root)
+	}
+	return out
+}
+
+func matchRules(rules []rule, line string, parent *Symbol) (string, string, bool) {
+	inContainer := parent != nil && isContainer(parent.Kind)
+	for _, r := range rules {
+		if r.topLevel && (parent != nil || indentOf(line) > 0) {
+			continue
+		}
+		if r.member && !inContainer {
+			continue
+		}
+		match := r.re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		kind := r.kind
+		if index := r.re.SubexpIndex("kind"); index >= 0 && match[index] != "" {
+			keyword := strings.TrimRight(strings.ToLower(match[index]), "!")
+			if mapped, ok := keywordKinds[keyword]; ok {
+				kind = mapped
+			} else {
+				kind = keyword
+			}
+		}
+		name := ""
+		if index := r.re.SubexpIndex("name"); index >= 0 {
+			name = strings.TrimSpace(match[index])
+		}
+		if name == "" || controlWords[name] {
+			continue
+		}
+		if (kind == KindConstant || kind == KindVariable) && (strings.Contains(line, "=>") || strings.Contains(line, "function")) {
+			kind = KindFunction
+		}
+		return kind, name, true
+	}
+	return "", "", false
+}
+
+// blockEnd returns the index of the last line of the block declared at
+// lines[start].
+func blockEnd(lines []string, start, indent int) int {
+	end := start
+	for j := start + 1; j < len(lines); j++ {
+		text := lines[j]
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			continue
+		}
+		if indentOf(text) > indent {
+			end = j
+			continue
+		}
+		if indentOf(text) < indent {
+			break
+		}
+		if isCloser(trimmed) {
+			return j
+		}
+		// a brace on the line after the declaration, as in C, opens the
+		// block rather than ending it
+		if j == end+1 && end == start && strings.HasPrefix(trimmed, "{") {
+			end = j
+			continue
+		}
+		break
+	}
+	return end
+}
+
+func isCloser(trimmed string) bool {
+	for _, prefix := range []string{"}", ")", "]", "end", "});", "};"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			rest := strings.TrimPrefix(trimmed, prefix)
+			return prefix != "end" || rest == "" || !isWordByte(rest[0])
+		}
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// indentOf returns the indentation width of line, counting a tab as four
+// columns.
+func indentOf(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// isLeadingLine reports whether line is a comment or decorator that
+// belongs to the declaration below it.
+func isLeadingLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#include") || strings.HasPrefix(trimmed, "#define") || strings.HasPrefix(trimmed, "#!") {
+		return false
+	}
+	for _, prefix := range []string{"//", "/*", "*", "#", "@", "--", "///", "#["} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// parseMarkdown outlines headings, each section nested under the closest
+// heading of a higher level and ending before the next heading of the same
+// or a higher level. Headings inside fenced code blocks are ignored.
+func parseMarkdown(content string) []Symbol {
+	lines := strings.Split(content, "\n")
+	type heading struct {
+		level int
+		line  int
+		name  string
+	}
+	var headings []heading
+	fenced := false
+	for i, text := range lines {
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		if match := headingPattern.FindStringSubmatch(text); match != nil {
+			headings = append(headings, heading{level: len(match[1]), line: i, name: match[2]})
+		}
+	}
+
+	var build func(from, to, level int) []Symbol
+	build = func(from, to, level int) []Symbol {
+		var out []Symbol
+		for i := from; i < to; i++ {
+			h := headings[i]
+			if h.level < level {
+				continue
+			}
+			next := i + 1
+			for next < to && headings[next].level > h.level {
+				next++
+			}
+			end := len(lines) - 1
+			if next < len(headings) {
+				end = headings[next].line - 1
+			}
+			for end > h.line && strings.TrimSpace(lines[end]) == "" {
+				end--
+			}
+			out = append(out, Symbol{
+				Name:      h.name,
+				Kind:      KindSection,
+				StartLine: h.line + 1,
+				EndLine:   end + 1,
+				Line:      h.line + 1,
+				Children:  build(i+1, next, h.level+1),
+			})
+			for j := range out[len(out)-1].Children {
+				out[len(out)-1].Children[j].Container = h.name
+			}
+			i = next - 1
+		}
+		return out
+	}
+	return build(0, len(headings), 1)
+}
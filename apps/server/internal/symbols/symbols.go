@@ -0,0 +1,578 @@
+package symbols
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	fsservice "local/monorepo/internal/fs"
+)
+
+var (
+	ErrPathRequired        = errors.New("path is required")
+	ErrWorkspaceRequired   = errors.New("workspace is required")
+	ErrWorkspaceNotFound   = errors.New("workspace does not exist")
+	ErrUnsupportedLanguage = errors.New("no outline support for this file type")
+)
+
+const (
+	KindModule    = "module"
+	KindClass     = "class"
+	KindInterface = "interface"
+	KindStruct    = "struct"
+	KindEnum      = "enum"
+	KindType      = "type"
+	KindFunction  = "function"
+	KindMethod    = "method"
+	KindField     = "field"
+	KindConstant  = "constant"
+	KindVariable  = "variable"
+	KindSection   = "section"
+)
+
+const (
+	defaultMaxFiles       = 20_000
+	defaultMaxFileBytes   = 1024 * 1024
+	defaultLimit          = 100
+	defaultMaxLimit       = 1_000
+	defaultRescanInterval = 30 * time.Second
+	maxDetailLength       = 120
+)
+
+// Symbol is a declaration in a file. StartLine and EndLine span the whole
+// declaration, including its doc comment; Line is where its name is. Lines
+// are 1-based. Container names the enclosing symbol, such as the receiver
+// type of a Go method.
+type Symbol struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	Detail    string   `json:"detail,omitempty"`
+	Container string   `json:"container,omitempty"`
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	Line      int      `json:"line"`
+	Children  []Symbol `json:"children,omitempty"`
+}
+
+var languages = map[string]string{
+	".go":    "go",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".py":    "python",
+	".rs":    "rust",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".rb":    "ruby",
+	".php":   "php",
+	".cs":    "csharp",
+	".sh":    "bash",
+	".sql":   "sql",
+	".md":    "markdown",
+	".proto": "protobuf",
+}
+
+// Language returns the language ID of path by extension, or "" when
+// symbols cannot be extracted from it.
+func Language(path string) string {
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
+
+// Parse outlines content as the language of path: Go with go/parser, the
+// other languages with declaration patterns and indentation. Symbols are
+// ordered by position.
+func Parse(path, content string) []Symbol {
+	language := Language(path)
+	if language == "go" {
+		if symbols, ok := parseGo(content); ok {
+			return symbols
+		}
+		return nil
+	}
+	symbols := parsePatterns(content, language)
+	sortSymbols(symbols)
+	return symbols
+}
+
+// skippedDirs hold dependencies and build output, which the workspace
+// table never descends into.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	".next":        true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+type Config struct {
+	// MaxFiles caps how many files of one workspace are outlined.
+	MaxFiles     int
+	MaxFileBytes int64
+	Limit        int
+	MaxLimit     int
+	// RescanInterval is how old the last walk of a workspace may be before
+	// a search walks it again, catching edits made outside the server.
+	RescanInterval time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxFiles:       defaultMaxFiles,
+		MaxFileBytes:   defaultMaxFileBytes,
+		Limit:          defaultLimit,
+		MaxLimit:       defaultMaxLimit,
+		RescanInterval: defaultRescanInterval,
+	}
+}
+
+// Table caches file outlines by content hash and keeps a symbol table per
+// searched workspace. Changes made through fs.Service arrive via Notify;
+// other edits are picked up by stat checks and periodic rescans.
+type Table struct {
+	cfg Config
+	fs  *fsservice.Service
+
+	mu         sync.Mutex
+	files      map[string]*fileSymbols
+	byHash     map[string][]Symbol
+	workspaces map[string]*workspaceTable
+}
+
+type fileSymbols struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+type workspaceTable struct {
+	scannedAt time.Time
+	files     []string
+	known     map[string]bool
+	truncated bool
+	dirty     map[string]bool
+}
+
+// Outline is the symbol tree of one file.
+type Outline struct {
+	Path     string   `json:"path"`
+	Language string   `json:"language"`
+	Hash     string   `json:"hash"`
+	Symbols  []Symbol `json:"symbols"`
+}
+
+// Match is a workspace symbol found by a search. Its children are left
+// out; nested symbols are matches of their own.
+type Match struct {
+	Symbol
+	Path  string `json:"path"`
+	Score int    `json:"score"`
+}
+
+type SearchResult struct {
+	Symbols []Match `json:"symbols"`
+	Files   int     `json:"files"`
+	// Truncated is set when the workspace has more files than are
+	// outlined or more matches than were returned.
+	Truncated bool `json:"truncated"`
+}
+
+func NewTable(cfg Config, fsService *fsservice.Service) *Table {
+	defaults := DefaultConfig()
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaults.MaxFiles
+	}
+	if cfg.MaxFileBytes <= 0 {
+		cfg.MaxFileBytes = defaults.MaxFileBytes
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = defaults.Limit
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = defaults.MaxLimit
+	}
+	if cfg.RescanInterval <= 0 {
+		cfg.RescanInterval = defaults.RescanInterval
+	}
+	return &Table{
+		cfg:        cfg,
+		fs:         fsService,
+		files:      map[string]*fileSymbols{},
+		byHash:     map[string][]Symbol{},
+		workspaces: map[string]*workspaceTable{},
+	}
+}
+
+// Document returns the outline of the file at path, parsing it only when
+// its content hash is not cached.
+func (t *Table) Document(ctx context.Context, rawPath string) (Outline, error) {
+	path := strings.TrimSpace(rawPath)
+	if path == "" {
+		return Outline{}, ErrPathRequired
+	}
+	stat, err := t.fs.Stat(ctx, path)
+	if err != nil {
+		return Outline{}, err
+	}
+	if !stat.Exists {
+		return Outline{}, fsservice.ErrPathNotFound
+	}
+	if stat.IsDir {
+		return Outline{}, fsservice.ErrPathIsDirectory
+	}
+	language := Language(stat.Path)
+	if language == "" {
+		return Outline{}, ErrUnsupportedLanguage
+	}
+	hash, symbols, err := t.file(ctx, stat.Path, stat.Size, stat.ModTime)
+	if err != nil {
+		return Outline{}, err
+	}
+	if symbols == nil {
+		symbols = []Symbol{}
+	}
+	return Outline{Path: stat.Path, Language: language, Hash: hash, Symbols: symbols}, nil
+}
+
+// file returns the hash and outline of the file at path, reusing the
+// cached outline when the file's stat or content hash is unchanged.
+func (t *Table) file(ctx context.Context, path string, size int64, modTime time.Time) (string, []Symbol, error) {
+	t.mu.Lock()
+	if cached := t.files[path]; cached != nil && cached.size == size && cached.modTime.Equal(modTime) {
+		if symbols, ok := t.byHash[cached.hash]; ok {
+			t.mu.Unlock()
+			return cached.hash, symbols, nil
+		}
+	}
+	t.mu.Unlock()
+
+	read, err := t.fs.ReadText(ctx, path)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256([]byte(read.Content))
+	hash := hex.EncodeToString(sum[:])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	symbols, ok := t.byHash[hash]
+	if !ok {
+		symbols = Parse(path, read.Content)
+		t.byHash[hash] = symbols
+	}
+	if previous := t.files[path]; previous != nil && previous.hash != hash {
+		t.release(previous.hash, path)
+	}
+	t.files[path] = &fileSymbols{size: size, modTime: modTime, hash: hash}
+	return hash, symbols, nil
+}
+
+// release drops the outline of hash once no file but except has it.
+func (t *Table) release(hash, except string) {
+	for path, cached := range t.files {
+		if path != except && cached.hash == hash {
+			return
+		}
+	}
+	delete(t.byHash, hash)
+}
+
+// Search finds symbols in a workspace whose name matches query: exact
+// names first, then prefixes, substrings and finally subsequences, such as
+// "nrn" for "NewRunner". An empty query lists symbols in path order.
+func (t *Table) Search(ctx context.Context, workspace, query string, limit int) (SearchResult, error) {
+	root := strings.TrimSpace(workspace)
+	if root == "" {
+		return SearchResult{}, ErrWorkspaceRequired
+	}
+	root = filepath.Clean(root)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return SearchResult{}, ErrWorkspaceNotFound
+	}
+	if limit <= 0 {
+		limit = t.cfg.Limit
+	}
+	if limit > t.cfg.MaxLimit {
+		limit = t.cfg.MaxLimit
+	}
+
+	files, truncated, err := t.workspaceFiles(ctx, root)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	query = strings.TrimSpace(query)
+	matches := []Match{}
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return SearchResult{}, err
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		_, symbols, err := t.file(ctx, path, info.Size(), info.ModTime())
+		if err != nil {
+			continue
+		}
+		matches = collectMatches(matches, symbols, path, query)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if len(matches[i].Name) != len(matches[j].Name) && query != "" {
+			return len(matches[i].Name) < len(matches[j].Name)
+		}
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].Line < matches[j].Line
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+		truncated = true
+	}
+	return SearchResult{Symbols: matches, Files: len(files), Truncated: truncated}, nil
+}
+
+// workspaceFiles returns the outlinable files of root. It walks root
+// again when the last walk is older than RescanInterval or Notify reported
+// a path that was created, deleted or renamed; edits to known files need
+// no walk, as each search checks their stat.
+func (t *Table) workspaceFiles(ctx context.Context, root string) ([]string, bool, error) {
+	t.mu.Lock()
+	table := t.workspaces[root]
+	if table == nil {
+		table = &workspaceTable{dirty: map[string]bool{}}
+		t.workspaces[root] = table
+	}
+	fresh := time.Since(table.scannedAt) <= t.cfg.RescanInterval
+	for path := range table.dirty {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() || !table.known[path] {
+			fresh = false
+		}
+	}
+	if fresh {
+		table.dirty = map[string]bool{}
+	}
+	files, truncated := table.files, table.truncated
+	t.mu.Unlock()
+	if fresh {
+		return files, truncated, nil
+	}
+
+	files, truncated, err := t.walk(ctx, root)
+	if err != nil {
+		return nil, false, err
+	}
+	t.mu.Lock()
+	table.files, table.truncated = files, truncated
+	table.known = make(map[string]bool, len(files))
+	for _, path := range files {
+		table.known[path] = true
+	}
+	table.scannedAt = time.Now()
+	table.dirty = map[string]bool{}
+	t.mu.Unlock()
+	return files, truncated, nil
+}
+
+func (t *Table) walk(ctx context.Context, root string) ([]string, bool, error) {
+	var files []string
+	truncated := false
+	err := filepath.WalkDir(root, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if current == root {
+				return err
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if entry.IsDir() {
+			if current != root && (skippedDirs[entry.Name()] || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || Language(entry.Name()) == "" {
+			return nil
+		}
+		if info, err := entry.Info(); err != nil || info.Size() > t.cfg.MaxFileBytes {
+			return nil
+		}
+		if len(files) >= t.cfg.MaxFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+		files = append(files, current)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return files, truncated, nil
+}
+
+// Notify tells the table that path changed on disk: its cached outline is
+// dropped and workspaces containing it refresh their file list on the next
+// search. A directory drops everything below it.
+func (t *Table) Notify(path string) {
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for file, cached := range t.files {
+		if file == path || strings.HasPrefix(file, prefix) {
+			delete(t.files, file)
+			t.release(cached.hash, file)
+		}
+	}
+	for root, table := range t.workspaces {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			table.dirty[path] = true
+		}
+	}
+}
+
+// collectMatches appends the symbols matching query, with nested symbols
+// flattened and their children dropped.
+func collectMatches(matches []Match, symbols []Symbol, path, query string) []Match {
+	for _, symbol := range symbols {
+		if score := matchScore(symbol.Name, query); score > 0 {
+			flat := symbol
+			flat.Children = nil
+			matches = append(matches, Match{Symbol: flat, Path: path, Score: score + kindBonus(symbol.Kind)})
+		}
+		matches = collectMatches(matches, symbol.Children, path, query)
+	}
+	return matches
+}
+
+// matchScore rates how well name matches query, case-insensitively; 0 is
+// no match.
+func matchScore(name, query string) int {
+	if query == "" {
+		return 1
+	}
+	lowerName, lowerQuery := strings.ToLower(name), strings.ToLower(query)
+	switch {
+	case name == query:
+		return 1000
+	case lowerName == lowerQuery:
+		return 900
+	case strings.HasPrefix(lowerName, lowerQuery):
+		return 700
+	case strings.Contains(lowerName, lowerQuery):
+		// earlier and word-aligned substrings rank higher
+		index := utf8.RuneCountInString(lowerName[:strings.Index(lowerName, lowerQuery)])
+		score := 500 - index
+		if isWordStart(name, index) {
+			score += 50
+		}
+		return score
+	}
+	return subsequenceScore(name, lowerQuery)
+}
+
+func isWordStart(name string, index int) bool {
+	if index == 0 {
+		return true
+	}
+	runes := []rune(name)
+	if index >= len(runes) {
+		return false
+	}
+	return unicode.IsUpper(runes[index]) || runes[index-1] == '_' || runes[index-1] == '.'
+}
+
+// subsequenceScore rates query as letters of name in order, so "nrn"
+// finds "NewRunner"; letters that start a word count extra. It is 0 when
+// name does not contain query in order.
+func subsequenceScore(name, lowerQuery string) int {
+	rest := []rune(lowerQuery)
+	score := 200
+	for i, r := range []rune(name) {
+		if len(rest) > 0 && unicode.ToLower(r) == rest[0] {
+			if isWordStart(name, i) {
+				score += 20
+			}
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 {
+		return 0
+	}
+	return score
+}
+
+// kindBonus breaks ties toward declarations people usually look for.
+func kindBonus(kind string) int {
+	switch kind {
+	case KindClass, KindInterface, KindStruct, KindType, KindEnum:
+		return 5
+	case KindFunction, KindMethod:
+		return 4
+	case KindModule, KindSection:
+		return 2
+	}
+	return 0
+}
+
+func isContainer(kind string) bool {
+	switch kind {
+	case KindClass, KindInterface, KindStruct, KindEnum, KindModule:
+		return true
+	}
+	return false
+}
+
+func sortSymbols(symbols []Symbol) {
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].StartLine < symbols[j].StartLine })
+	for i := range symbols {
+		sortSymbols(symbols[i].Children)
+	}
+}
+
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func truncateDetail(detail string) string {
+	if len(detail) <= maxDetailLength {
+		return detail
+	}
+	cut := maxDetailLength
+	for cut > 0 && !isRuneStart(detail[cut]) {
+		cut--
+	}
+	return detail[:cut] + "…"
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,336 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	fsservice "local/monorepo/internal/fs"
+)
+
+var (
+	ErrRootRequired = fsservice.ErrRootRequired
+	ErrRootNotFound = fsservice.ErrRootNotFound
+	ErrTaskNotFound = errors.New("task not found")
+	ErrRunNotFound  = errors.New("task run not found")
+	ErrRunFinished  = errors.New("task run already finished")
+	ErrStartFailed  = errors.New("failed to start task")
+)
+
+const (
+	SourceNPM  = "npm"
+	SourceMake = "make"
+	SourceMoon = "moon"
+	SourceGo   = "go"
+	SourceJust = "just"
+)
+
+const (
+	maxDiscoveryDepth    = 4
+	maxDiscoveryDirs     = 2_000
+	maxManifestReadBytes = 1024 * 1024
+)
+
+// skippedDirs are never descended into during discovery.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".moon":        true,
+	".astro":       true,
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"tmp":          true,
+}
+
+type Task struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Source  string   `json:"source"`
+	Dir     string   `json:"dir"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Detail  string   `json:"detail,omitempty"`
+}
+
+// Discover finds runnable tasks in root and its subdirectories. Task IDs are
+// stable across calls: "<source>:<relative dir>:<name>".
+func Discover(ctx context.Context, rawRoot string) ([]Task, error) {
+	root, err := fsservice.ResolveRoot(rawRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Task{}
+	visited := 0
+	walkErr := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path != root && (skippedDirs[entry.Name()] || strings.HasPrefix(entry.Name(), ".")) {
+			return filepath.SkipDir
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		if rel != "." && strings.Count(rel, string(filepath.Separator))+1 > maxDiscoveryDepth {
+			return filepath.SkipDir
+		}
+		visited++
+		if visited > maxDiscoveryDirs {
+			return filepath.SkipAll
+		}
+
+		out = append(out, discoverDir(root, path)...)
+		return nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// Find rediscovers tasks in root and returns the one with the given ID. Runs
+// are always resolved this way so clients cannot submit arbitrary commands.
+func Find(ctx context.Context, root, id string) (Task, error) {
+	found, err := Discover(ctx, root)
+	if err != nil {
+		return Task{}, err
+	}
+	for _, task := range found {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return Task{}, ErrTaskNotFound
+}
+
+func discoverDir(root, dir string) []Task {
+	rel, _ := filepath.Rel(root, dir)
+	rel = filepath.ToSlash(rel)
+
+	var out []Task
+	add := func(source, name, command string, args []string, detail string) {
+		out = append(out, Task{
+			ID:      source + ":" + rel + ":" + name,
+			Name:    name,
+			Source:  source,
+			Dir:     dir,
+			Command: command,
+			Args:    args,
+			Detail:  detail,
+		})
+	}
+
+	if content, ok := readManifest(filepath.Join(dir, "package.json")); ok {
+		runner := packageRunner(dir)
+		for _, script := range packageScripts(content) {
+			add(SourceNPM, script.name, runner, []string{"run", script.name}, script.command)
+		}
+	}
+
+	for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+		if content, ok := readManifest(filepath.Join(dir, name)); ok {
+			for _, target := range makeTargets(content) {
+				add(SourceMake, target, "make", []string{target}, "")
+			}
+			break
+		}
+	}
+
+	for _, name := range []string{"moon.yml", "moon.yaml"} {
+		if content, ok := readManifest(filepath.Join(dir, name)); ok {
+			project := moonProjectID(content, filepath.Base(dir))
+			for _, task := range moonTasks(content) {
+				add(SourceMoon, task, "moon", []string{"run", project + ":" + task}, "")
+			}
+			break
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		for _, verb := range []string{"build", "test", "vet"} {
+			add(SourceGo, verb, "go", []string{verb, "./..."}, "")
+		}
+	}
+
+	for _, name := range []string{"justfile", "Justfile", ".justfile"} {
+		if content, ok := readManifest(filepath.Join(dir, name)); ok {
+			for _, recipe := range justRecipes(content) {
+				add(SourceJust, recipe, "just", []string{recipe}, "")
+			}
+			break
+		}
+	}
+
+	return out
+}
+
+func readManifest(path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxManifestReadBytes {
+		return nil, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+type packageScript struct {
+	name    string
+	command string
+}
+
+func packageScripts(content []byte) []packageScript {
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil
+	}
+
+	out := make([]packageScript, 0, len(manifest.Scripts))
+	for name, command := range manifest.Scripts {
+		out = append(out, packageScript{name: name, command: command})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+// packageRunner picks the package manager from the lockfile next to
+// package.json, falling back to npm.
+func packageRunner(dir string) string {
+	lockfiles := []struct {
+		name   string
+		runner string
+	}{
+		{"bun.lock", "bun"},
+		{"bun.lockb", "bun"},
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+	}
+	for _, lockfile := range lockfiles {
+		if _, err := os.Stat(filepath.Join(dir, lockfile.name)); err == nil {
+			return lockfile.runner
+		}
+	}
+	return "npm"
+}
+
+var makeTargetPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_./-]*)\s*:([^=]|$)`)
+
+func makeTargets(content []byte) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		match := makeTargetPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		target := match[1]
+		if strings.Contains(target, "%") || seen[target] {
+			continue
+		}
+		seen[target] = true
+		out = append(out, target)
+	}
+	return out
+}
+
+var justRecipePattern = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)(\s+[^:=]*)?:([^=]|$)`)
+
+func justRecipes(content []byte) []string {
+	out := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "set ") || strings.HasPrefix(line, "alias ") || strings.HasPrefix(line, "import ") {
+			continue
+		}
+		if match := justRecipePattern.FindStringSubmatch(line); match != nil {
+			out = append(out, match[1])
+		}
+	}
+	return out
+}
+
+// moonProjectID returns the explicit `id:` of a moon project or its
+// directory name.
+func moonProjectID(content []byte, fallback string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "id:"); ok {
+			if id := strings.Trim(strings.TrimSpace(value), `'"`); id != "" {
+				return id
+			}
+		}
+	}
+	return fallback
+}
+
+// moonTasks lists the keys directly under the top-level `tasks:` mapping. It
+// only understands block-style YAML, which is what moon configs use.
+func moonTasks(content []byte) []string {
+	out := []string{}
+	inTasks := false
+	taskIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+
+		if indent == 0 {
+			inTasks = strings.HasPrefix(trimmed, "tasks:")
+			taskIndent = -1
+			continue
+		}
+		if !inTasks {
+			continue
+		}
+		if taskIndent < 0 {
+			taskIndent = indent
+		}
+		if indent != taskIndent {
+			continue
+		}
+
+		key, _, ok := strings.Cut(trimmed, ":")
+		key = strings.Trim(strings.TrimSpace(key), `'"`)
+		if ok && key != "" {
+			out = append(out, key)
+		}
+	}
+	return out
+}
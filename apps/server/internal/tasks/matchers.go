@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+const maxRunDiagnostics = 1_000
+
+// Diagnostic is a file/line problem reported by a compiler or linter.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+}
+
+// problemMatcher recognises one diagnostic line format. Submatch indexes are
+// 1-based; zero means the format has no such group.
+type problemMatcher struct {
+	name     string
+	pattern  *regexp.Regexp
+	file     int
+	line     int
+	column   int
+	severity int
+	code     int
+	message  int
+}
+
+var problemMatchers = []problemMatcher{
+	{
+		// main.go:12:5: undefined: foo
+		name:    "go",
+		pattern: regexp.MustCompile(`^(?:vet: )?([^\s:][^:]*\.go):(\d+)(?::(\d+))?: (.+)$`),
+		file:    1, line: 2, column: 3, message: 4,
+	},
+	{
+		// src/app.ts(12,5): error TS2304: Cannot find name 'foo'.
+		name:    "tsc",
+		pattern: regexp.MustCompile(`^(.+?)\((\d+),(\d+)\): (error|warning) (TS\d+): (.+)$`),
+		file:    1, line: 2, column: 3, severity: 4, code: 5, message: 6,
+	},
+	{
+		// src/app.ts:12:5 - error TS2304: Cannot find name 'foo'.
+		name:    "tsc",
+		pattern: regexp.MustCompile(`^(.+?):(\d+):(\d+) - (error|warning) (TS\d+): (.+)$`),
+		file:    1, line: 2, column: 3, severity: 4, code: 5, message: 6,
+	},
+	{
+		// main.c:12:5: error: expected ';'
+		name:    "gcc",
+		pattern: regexp.MustCompile(`^([^\s:][^:]*):(\d+):(\d+): (fatal error|error|warning|note): (.+)$`),
+		file:    1, line: 2, column: 3, severity: 4, message: 5,
+	},
+}
+
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// MatchProblem parses a single output line. Relative paths are resolved
+// against dir.
+func MatchProblem(line, dir string) (Diagnostic, bool) {
+	clean := strings.TrimSpace(ansiEscapePattern.ReplaceAllString(line, ""))
+	if clean == "" {
+		return Diagnostic{}, false
+	}
+
+	for _, matcher := range problemMatchers {
+		match := matcher.pattern.FindStringSubmatch(clean)
+		if match == nil {
+			continue
+		}
+
+		diagnostic := Diagnostic{
+			File:     resolveDiagnosticPath(match[matcher.file], dir),
+			Severity: SeverityError,
+			Message:  strings.TrimSpace(match[matcher.message]),
+			Source:   matcher.name,
+		}
+		diagnostic.Line, _ = strconv.Atoi(match[matcher.line])
+		if matcher.column > 0 {
+			diagnostic.Column, _ = strconv.Atoi(match[matcher.column])
+		}
+		if matcher.severity > 0 {
+			diagnostic.Severity = normalizeSeverity(match[matcher.severity])
+		}
+		if matcher.code > 0 {
+			diagnostic.Code = match[matcher.code]
+		}
+		return diagnostic, true
+	}
+	return Diagnostic{}, false
+}
+
+// MatchProblems parses every line of output.
+func MatchProblems(output, dir string) []Diagnostic {
+	out := []Diagnostic{}
+	for _, line := range strings.Split(output, "\n") {
+		if diagnostic, ok := MatchProblem(line, dir); ok {
+			out = append(out, diagnostic)
+		}
+	}
+	return out
+}
+
+func normalizeSeverity(value string) string {
+	switch strings.ToLower(value) {
+	case "warning":
+		return SeverityWarning
+	case "note", "info":
+		return SeverityInfo
+	default:
+		return SeverityError
+	}
+}
+
+// resolveDiagnosticPath anchors a reported path at dir, even when the file
+// is gone by now; left relative, it would later resolve against the
+// server's working directory.
+func resolveDiagnosticPath(file, dir string) string {
+	file = strings.TrimSpace(file)
+	if filepath.IsAbs(file) || dir == "" {
+		return filepath.Clean(file)
+	}
+	return filepath.Join(dir, file)
+}
@@ -0,0 +1,400 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	fsservice "local/monorepo/internal/fs"
+	"local/monorepo/internal/procgroup"
+)
+
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+const (
+	defaultMaxRuns        = 50
+	defaultMaxLogBytes    = 1024 * 1024
+	runCancelGrace        = 3 * time.Second
+	runOutputWaitDelay    = 2 * time.Second
+	maxMatchedLineBytes   = 64 * 1024
+	maxLogRequestBytes    = 256 * 1024
+	runFinishedWaitPeriod = 10 * time.Second
+)
+
+type Config struct {
+	MaxRuns     int
+	MaxLogBytes int
+	// OnFinish, if set, is called with the final snapshot of every run.
+	OnFinish func(RunInfo)
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRuns:     defaultMaxRuns,
+		MaxLogBytes: defaultMaxLogBytes,
+	}
+}
+
+// RunInfo is a snapshot of a tracked run.
+type RunInfo struct {
+	ID          string       `json:"id"`
+	Task        Task         `json:"task"`
+	Root        string       `json:"root"`
+	Status      string       `json:"status"`
+	ExitCode    *int         `json:"exitCode,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	StartedAt   time.Time    `json:"startedAt"`
+	FinishedAt  *time.Time   `json:"finishedAt,omitempty"`
+	LogBytes    int64        `json:"logBytes"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// LogChunk is a window of a run's combined output. Offset counts bytes since
+// the run started, so clients can poll with the returned Next offset.
+type LogChunk struct {
+	Offset    int64  `json:"offset"`
+	Next      int64  `json:"next"`
+	Data      string `json:"data"`
+	Truncated bool   `json:"truncated"`
+	Done      bool   `json:"done"`
+}
+
+type run struct {
+	mu          sync.Mutex
+	info        RunInfo
+	log         []byte
+	logStart    int64
+	maxLogBytes int
+	cancel      context.CancelFunc
+	canceled    bool
+	done        chan struct{}
+}
+
+func (r *run) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log = append(r.log, p...)
+	r.info.LogBytes += int64(len(p))
+	if excess := len(r.log) - r.maxLogBytes; excess > 0 {
+		r.log = append(r.log[:0], r.log[excess:]...)
+		r.logStart += int64(excess)
+	}
+	return len(p), nil
+}
+
+func (r *run) addDiagnostic(diagnostic Diagnostic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.info.Diagnostics) < maxRunDiagnostics {
+		r.info.Diagnostics = append(r.info.Diagnostics, diagnostic)
+	}
+}
+
+func (r *run) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *run) snapshot() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := r.info
+	info.Diagnostics = append([]Diagnostic{}, r.info.Diagnostics...)
+	return info
+}
+
+// Manager starts discovered tasks as child processes and keeps the most
+// recent runs, their output and their parsed diagnostics.
+type Manager struct {
+	cfg  Config
+	mu   sync.Mutex
+	runs map[string]*run
+	// order holds run IDs oldest first.
+	order []string
+}
+
+func NewManager(cfg Config) *Manager {
+	if cfg.MaxRuns <= 0 {
+		cfg.MaxRuns = defaultMaxRuns
+	}
+	if cfg.MaxLogBytes <= 0 {
+		cfg.MaxLogBytes = defaultMaxLogBytes
+	}
+	return &Manager{cfg: cfg, runs: map[string]*run{}}
+}
+
+// Start launches the task with the given ID from root.
+func (m *Manager) Start(ctx context.Context, root, taskID string) (RunInfo, error) {
+	task, err := Find(ctx, root, taskID)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	resolvedRoot, err := fsservice.ResolveRoot(root)
+	if err != nil {
+		return RunInfo{}, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	cmd := exec.Command(task.Command, task.Args...)
+	cmd.Dir = task.Dir
+	cmd.Env = append(os.Environ(), "FORCE_COLOR=0", "NO_COLOR=1", "CI=1")
+	procgroup.Configure(cmd)
+
+	r := &run{
+		info: RunInfo{
+			ID:          newRunID(),
+			Task:        task,
+			Root:        resolvedRoot,
+			Status:      StatusRunning,
+			StartedAt:   time.Now(),
+			Diagnostics: []Diagnostic{},
+		},
+		maxLogBytes: m.cfg.MaxLogBytes,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	outputReader, outputWriter := io.Pipe()
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+	// A backgrounded grandchild may keep the pipe open after the task
+	// exits; stop copying its output rather than waiting on it forever.
+	cmd.WaitDelay = runOutputWaitDelay
+	if err := cmd.Start(); err != nil {
+		cancel()
+		_ = outputWriter.Close()
+		return RunInfo{}, fmt.Errorf("%w: %s: %v", ErrStartFailed, task.Command, err)
+	}
+
+	m.track(r)
+
+	scanDone := make(chan struct{})
+	go func() {
+		defer close(scanDone)
+		m.consumeOutput(r, outputReader)
+	}()
+
+	go func() {
+		<-runCtx.Done()
+		procgroup.Terminate(cmd, runCancelGrace, r.done)
+	}()
+
+	go func() {
+		waitErr := cmd.Wait()
+		_ = outputWriter.Close()
+		<-scanDone
+		m.finish(r, waitErr)
+		cancel()
+	}()
+
+	return r.snapshot(), nil
+}
+
+// consumeOutput records raw output in the run log and feeds complete lines
+// to the problem matchers.
+func (m *Manager) consumeOutput(r *run, output io.Reader) {
+	scanner := bufio.NewScanner(io.TeeReader(output, r))
+	scanner.Buffer(make([]byte, 0, 4096), maxMatchedLineBytes)
+	for scanner.Scan() {
+		if diagnostic, ok := MatchProblem(scanner.Text(), r.info.Task.Dir); ok {
+			r.addDiagnostic(diagnostic)
+		}
+	}
+	// keep draining so the child never blocks on a full pipe
+	_, _ = io.Copy(r, output)
+}
+
+func (m *Manager) finish(r *run, waitErr error) {
+	r.mu.Lock()
+	now := time.Now()
+	r.info.FinishedAt = &now
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case waitErr == nil, errors.Is(waitErr, exec.ErrWaitDelay):
+		// ErrWaitDelay means the task exited cleanly but left its output open
+		r.info.Status = StatusSucceeded
+	case errors.As(waitErr, &exitErr):
+		exitCode = exitErr.ExitCode()
+		r.info.Status = StatusFailed
+	default:
+		exitCode = -1
+		r.info.Status = StatusFailed
+		r.info.Error = waitErr.Error()
+	}
+	if r.canceled {
+		r.info.Status = StatusCanceled
+	}
+	r.info.ExitCode = &exitCode
+	close(r.done)
+	r.mu.Unlock()
+
+	if m.cfg.OnFinish != nil {
+		m.cfg.OnFinish(r.snapshot())
+	}
+}
+
+func (m *Manager) track(r *run) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs[r.info.ID] = r
+	m.order = append(m.order, r.info.ID)
+
+	// evict the oldest finished runs beyond the limit
+	excess := len(m.order) - m.cfg.MaxRuns
+	if excess <= 0 {
+		return
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if excess > 0 && m.runs[id].finished() {
+			delete(m.runs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+func (m *Manager) get(id string) (*run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return r, nil
+}
+
+// List returns all tracked runs, newest first.
+func (m *Manager) List() []RunInfo {
+	m.mu.Lock()
+	runs := make([]*run, 0, len(m.order))
+	for _, id := range m.order {
+		runs = append(runs, m.runs[id])
+	}
+	m.mu.Unlock()
+
+	out := make([]RunInfo, 0, len(runs))
+	for _, r := range runs {
+		out = append(out, r.snapshot())
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].StartedAt.After(out[j].StartedAt)
+	})
+	return out
+}
+
+func (m *Manager) Get(id string) (RunInfo, error) {
+	r, err := m.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	return r.snapshot(), nil
+}
+
+// Logs returns output starting at offset. Offsets older than the retained
+// window are clamped and reported as truncated.
+func (m *Manager) Logs(id string, offset int64) (LogChunk, error) {
+	r, err := m.get(id)
+	if err != nil {
+		return LogChunk{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chunk := LogChunk{Offset: offset}
+	if offset < r.logStart {
+		chunk.Offset = r.logStart
+		chunk.Truncated = true
+	}
+	end := r.logStart + int64(len(r.log))
+	if chunk.Offset > end {
+		chunk.Offset = end
+	}
+
+	start := chunk.Offset - r.logStart
+	stop := int64(len(r.log))
+	if stop-start > maxLogRequestBytes {
+		stop = start + maxLogRequestBytes
+	}
+	chunk.Data = string(r.log[start:stop])
+	chunk.Next = r.logStart + stop
+	chunk.Done = r.info.Status != StatusRunning && chunk.Next == end
+	return chunk, nil
+}
+
+// Cancel stops a running task, escalating to SIGKILL after a grace period.
+func (m *Manager) Cancel(id string) (RunInfo, error) {
+	r, err := m.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+
+	r.mu.Lock()
+	if r.info.Status != StatusRunning {
+		r.mu.Unlock()
+		return RunInfo{}, ErrRunFinished
+	}
+	r.canceled = true
+	r.mu.Unlock()
+
+	r.cancel()
+	return r.snapshot(), nil
+}
+
+// Close cancels every running task and waits briefly for them to exit.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	runs := make([]*run, 0, len(m.runs))
+	for _, r := range m.runs {
+		runs = append(runs, r)
+	}
+	m.mu.Unlock()
+
+	for _, r := range runs {
+		r.mu.Lock()
+		if r.info.Status == StatusRunning {
+			r.canceled = true
+		}
+		r.mu.Unlock()
+		r.cancel()
+	}
+	for _, r := range runs {
+		select {
+		case <-r.done:
+		case <-time.After(runFinishedWaitPeriod):
+			return
+		}
+	}
+}
+
+func newRunID() string {
+	var raw [8]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("run-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}
@@ -0,0 +1,127 @@
+package terminal
+
+import (
+	"net/url"
+	"strings"
+)
+
+const maxOSCPayloadBytes = 4096
+
+const (
+	oscStateGround = iota
+	oscStateEscape
+	oscStatePayload
+	oscStatePayloadEscape
+)
+
+// Event is a terminal state change recognised in PTY output.
+type Event struct {
+	Type  string
+	Value string
+}
+
+// OSCScanner watches PTY output for OSC 0/2 (title), OSC 7 (cwd) and bare BEL
+// characters. It keeps state across calls so sequences split between reads
+// are still recognised. The zero value is ready to use.
+type OSCScanner struct {
+	state    int
+	payload  []byte
+	overflow bool
+}
+
+// Scan consumes a chunk of output and returns the events it completed. At
+// most one bell is reported per chunk.
+func (s *OSCScanner) Scan(chunk []byte) []Event {
+	var events []Event
+	bell := false
+
+	for _, b := range chunk {
+		switch s.state {
+		case oscStateGround:
+			switch b {
+			case 0x07:
+				bell = true
+			case 0x1b:
+				s.state = oscStateEscape
+			}
+		case oscStateEscape:
+			switch b {
+			case ']':
+				s.state = oscStatePayload
+				s.payload = s.payload[:0]
+				s.overflow = false
+			case 0x1b:
+			default:
+				s.state = oscStateGround
+			}
+		case oscStatePayload:
+			switch b {
+			case 0x07:
+				events = s.finish(events)
+			case 0x1b:
+				s.state = oscStatePayloadEscape
+			default:
+				if len(s.payload) < maxOSCPayloadBytes {
+					s.payload = append(s.payload, b)
+				} else {
+					s.overflow = true
+				}
+			}
+		case oscStatePayloadEscape:
+			if b == '\\' {
+				events = s.finish(events)
+				continue
+			}
+			// any other escape aborts the sequence
+			s.state = oscStateGround
+			if b == 0x1b {
+				s.state = oscStateEscape
+			}
+		}
+	}
+
+	if bell {
+		events = append(events, Event{Type: TypeBell})
+	}
+	return events
+}
+
+func (s *OSCScanner) finish(events []Event) []Event {
+	s.state = oscStateGround
+	if s.overflow {
+		return events
+	}
+
+	command, value, ok := strings.Cut(string(s.payload), ";")
+	if !ok {
+		return events
+	}
+
+	switch command {
+	case "0", "2":
+		return append(events, Event{Type: TypeTitle, Value: sanitizeTitle(value)})
+	case "7":
+		if cwd := parseCwdURL(value); cwd != "" {
+			return append(events, Event{Type: TypeCwd, Value: cwd})
+		}
+	}
+	return events
+}
+
+func sanitizeTitle(value string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value))
+}
+
+// parseCwdURL extracts the path from an OSC 7 "file://host/path" URL.
+func parseCwdURL(value string) string {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || !strings.EqualFold(parsed.Scheme, "file") {
+		return ""
+	}
+	return parsed.Path
+}
@@ -0,0 +1,118 @@
+package terminal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOSCScanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []Event
+	}{
+		{
+			name:   "title terminated by BEL",
+			chunks: []string{"\x1b]0;build: ok\x07"},
+			want:   []Event{{Type: TypeTitle, Value: "build: ok"}},
+		},
+		{
+			name:   "title terminated by ST",
+			chunks: []string{"\x1b]2;vim main.go\x1b\\"},
+			want:   []Event{{Type: TypeTitle, Value: "vim main.go"}},
+		},
+		{
+			name:   "title control characters are dropped",
+			chunks: []string{"\x1b]0;  a\x01b\x7fc  \x07"},
+			want:   []Event{{Type: TypeTitle, Value: "abc"}},
+		},
+		{
+			name:   "cwd from a file URL",
+			chunks: []string{"\x1b]7;file://host/home/me/my%20project\x07"},
+			want:   []Event{{Type: TypeCwd, Value: "/home/me/my project"}},
+		},
+		{
+			name:   "cwd with another scheme is ignored",
+			chunks: []string{"\x1b]7;https://example.com/x\x07"},
+		},
+		{
+			name:   "unknown OSC commands are ignored",
+			chunks: []string{"\x1b]8;;https://example.com\x07link\x1b]8;;\x07"},
+		},
+		{
+			name:   "payload without a separator is ignored",
+			chunks: []string{"\x1b]0\x07"},
+		},
+		{
+			name:   "sequence split across chunks",
+			chunks: []string{"out\x1b", "]0;spl", "it\x1b", "\\more"},
+			want:   []Event{{Type: TypeTitle, Value: "split"}},
+		},
+		{
+			name:   "bare bell",
+			chunks: []string{"ding\x07"},
+			want:   []Event{{Type: TypeBell}},
+		},
+		{
+			name:   "one bell per chunk",
+			chunks: []string{"\x07\x07\x07", "\x07"},
+			want:   []Event{{Type: TypeBell}, {Type: TypeBell}},
+		},
+		{
+			name:   "BEL ending an OSC is not a bell",
+			chunks: []string{"\x1b]0;t\x07"},
+			want:   []Event{{Type: TypeTitle, Value: "t"}},
+		},
+		{
+			name:   "other escapes abort the sequence",
+			chunks: []string{"\x1b]0;lost\x1b[31mred\x07"},
+			want:   []Event{{Type: TypeBell}},
+		},
+		{
+			name:   "escape inside a payload may start the next sequence",
+			chunks: []string{"\x1b]0;lost\x1b\x1b]0;kept\x07"},
+			want:   []Event{{Type: TypeTitle, Value: "kept"}},
+		},
+		{
+			name:   "CSI sequences pass through",
+			chunks: []string{"\x1b[2J\x1b[H\x1b]0;after\x07"},
+			want:   []Event{{Type: TypeTitle, Value: "after"}},
+		},
+		{
+			name:   "oversized payload is dropped",
+			chunks: []string{"\x1b]0;" + strings.Repeat("x", maxOSCPayloadBytes) + "\x07"},
+		},
+		{
+			name:   "scanning resumes after an oversized payload",
+			chunks: []string{"\x1b]0;" + strings.Repeat("x", maxOSCPayloadBytes) + "\x07", "\x1b]0;short\x07"},
+			want:   []Event{{Type: TypeTitle, Value: "short"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scanner OSCScanner
+			var got []Event
+			for _, chunk := range tt.chunks {
+				got = append(got, scanner.Scan([]byte(chunk))...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOSCScannerByteAtATime(t *testing.T) {
+	input := "prompt$ \x1b]0;user@host: ~/src\x07\x1b]7;file:///tmp/work\x1b\\ls\r\n"
+	var scanner OSCScanner
+	var got []Event
+	for i := 0; i < len(input); i++ {
+		got = append(got, scanner.Scan([]byte{input[i]})...)
+	}
+	want := []Event{{Type: TypeTitle, Value: "user@host: ~/src"}, {Type: TypeCwd, Value: "/tmp/work"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package terminal
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// PlainText renders raw PTY output as the text a reader would see: escape
+// sequences are removed, CRLF becomes LF, a bare carriage return starts the
+// line over and backspace deletes the previous character. Cursor movement
+// is not emulated, so full-screen programs come out garbled but readable.
+func PlainText(raw []byte) string {
+	var out strings.Builder
+	line := make([]rune, 0, 128)
+	flush := func() {
+		out.WriteString(string(line))
+		line = line[:0]
+	}
+
+	for i := 0; i < len(raw); {
+		b := raw[i]
+		switch {
+		case b == 0x1b:
+			i = skipEscape(raw, i)
+			continue
+		case b == '\n':
+			flush()
+			out.WriteByte('\n')
+		case b == '\r':
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				break
+			}
+			line = line[:0]
+		case b == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case b == '\t':
+			line = append(line, '\t')
+		case b < 0x20 || b == 0x7f:
+			// other control characters have no visible effect
+		default:
+			r, size := utf8.DecodeRune(raw[i:])
+			line = append(line, r)
+			i += size
+			continue
+		}
+		i++
+	}
+	flush()
+	return out.String()
+}
+
+// skipEscape returns the index just past the escape sequence starting at
+// raw[i]. Unterminated sequences run to the end of raw.
+func skipEscape(raw []byte, i int) int {
+	i++
+	if i >= len(raw) {
+		return i
+	}
+	switch raw[i] {
+	case '[':
+		// CSI: parameters and intermediates, then a final byte in 0x40-0x7e
+		for i++; i < len(raw); i++ {
+			if raw[i] >= 0x40 && raw[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return i
+	case ']', 'P', '_', '^':
+		// OSC, DCS, APC and PM run until BEL or ST (ESC \)
+		for i++; i < len(raw); i++ {
+			if raw[i] == 0x07 {
+				return i + 1
+			}
+			if raw[i] == 0x1b && i+1 < len(raw) && raw[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return i
+	case '(', ')', '*', '+':
+		// character set designation takes one more byte
+		return i + 2
+	default:
+		return i + 1
+	}
+}
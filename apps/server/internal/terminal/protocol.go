@@ -0,0 +1,150 @@
+// Package terminal defines the wire protocol spoken over /v1/terminals/ws.
+//
+// Binary frames carry raw PTY bytes in both directions. Text frames carry
+// JSON control messages: ClientMessage from the renderer and ServerMessage
+// from the server. Clients select a protocol version through the WebSocket
+// subprotocol header; connections without one speak ProtocolV1. The
+// machine-readable description lives in protocol.schema.json.
+package terminal
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ProtocolV1 = "omt.terminal.v1"
+	ProtocolV2 = "omt.terminal.v2"
+)
+
+// Subprotocols lists the supported versions in server preference order.
+var Subprotocols = []string{ProtocolV2, ProtocolV1}
+
+// ProtocolSchema is the JSON schema for control messages.
+//
+//go:embed protocol.schema.json
+var ProtocolSchema []byte
+
+// Client → server message types.
+const (
+	TypeResize    = "resize"
+	TypeAck       = "ack"
+	TypeSignal    = "signal"
+	TypeProcess   = "process"
+	TypeHeartbeat = "heartbeat"
+)
+
+// Server → client message types. TypeProcess and TypeHeartbeat are also used
+// for the corresponding replies.
+const (
+	TypeReady = "ready"
+	TypeExit  = "exit"
+	TypeError = "error"
+	TypeTitle = "title"
+	TypeCwd   = "cwd"
+	TypeBell  = "bell"
+)
+
+// Capabilities advertised in the v2 ready message.
+const (
+	CapabilityFlowControl = "flow-control"
+	CapabilityCompression = "compression"
+	CapabilitySignal      = "signal"
+	CapabilityProcess     = "process"
+	CapabilityTitle       = "title"
+	CapabilityCwd         = "cwd"
+	CapabilityBell        = "bell"
+	CapabilityHeartbeat   = "heartbeat"
+)
+
+const (
+	SignalTargetForeground = "foreground"
+	SignalTargetTree       = "tree"
+)
+
+var (
+	ErrInvalidMessage     = errors.New("invalid terminal control message")
+	ErrUnsupportedMessage = errors.New("unsupported terminal control message")
+)
+
+type ClientMessage struct {
+	Type   string `json:"type"`
+	Cols   uint16 `json:"cols,omitempty"`
+	Rows   uint16 `json:"rows,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Signal string `json:"signal,omitempty"`
+	Target string `json:"target,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+// Validate checks the fields required by the message type.
+func (m ClientMessage) Validate() error {
+	switch m.Type {
+	case TypeResize:
+		if m.Cols == 0 || m.Rows == 0 {
+			return fmt.Errorf("%w: resize requires cols and rows", ErrInvalidMessage)
+		}
+	case TypeAck:
+		if m.Bytes < 0 {
+			return fmt.Errorf("%w: ack requires non-negative bytes", ErrInvalidMessage)
+		}
+	case TypeSignal:
+		if m.Signal == "" {
+			return fmt.Errorf("%w: signal requires a signal name", ErrInvalidMessage)
+		}
+		switch m.Target {
+		case "", SignalTargetForeground, SignalTargetTree:
+		default:
+			return fmt.Errorf("%w: unknown signal target %q", ErrInvalidMessage, m.Target)
+		}
+	case TypeProcess, TypeHeartbeat:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedMessage, m.Type)
+	}
+	return nil
+}
+
+type ServerMessage struct {
+	Type         string       `json:"type"`
+	Protocol     string       `json:"protocol,omitempty"`
+	Version      int          `json:"version,omitempty"`
+	Capabilities []string     `json:"capabilities,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	Code         int          `json:"code,omitempty"`
+	Shell        string       `json:"shell,omitempty"`
+	Flow         string       `json:"flow,omitempty"`
+	SessionID    string       `json:"sessionId,omitempty"`
+	Process      *SessionInfo `json:"process,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Cwd          string       `json:"cwd,omitempty"`
+	ID           string       `json:"id,omitempty"`
+	Time         *time.Time   `json:"time,omitempty"`
+}
+
+type ProcessInfo struct {
+	PID  int      `json:"pid"`
+	PGID int      `json:"pgid"`
+	Name string   `json:"name"`
+	Cwd  string   `json:"cwd,omitempty"`
+	Argv []string `json:"argv,omitempty"`
+}
+
+type SessionInfo struct {
+	ID         string        `json:"id"`
+	Shell      string        `json:"shell"`
+	ShellPID   int           `json:"shellPid"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Busy       bool          `json:"busy"`
+	Foreground *ProcessInfo  `json:"foreground,omitempty"`
+	Group      []ProcessInfo `json:"group,omitempty"`
+}
+
+// VersionOf maps a negotiated subprotocol to its protocol version.
+func VersionOf(subprotocol string) int {
+	if subprotocol == ProtocolV2 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,199 @@
+package terminal
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr error
+	}{
+		{name: "resize", payload: `{"type":"resize","cols":120,"rows":32}`},
+		{name: "resize without rows", payload: `{"type":"resize","cols":120}`, wantErr: ErrInvalidMessage},
+		{name: "resize to zero", payload: `{"type":"resize","cols":0,"rows":0}`, wantErr: ErrInvalidMessage},
+		{name: "ack", payload: `{"type":"ack","bytes":4096}`},
+		{name: "ack of nothing", payload: `{"type":"ack","bytes":0}`},
+		{name: "negative ack", payload: `{"type":"ack","bytes":-1}`, wantErr: ErrInvalidMessage},
+		{name: "signal", payload: `{"type":"signal","signal":"SIGINT"}`},
+		{name: "signal to the foreground", payload: `{"type":"signal","signal":"SIGTERM","target":"foreground"}`},
+		{name: "signal to the tree", payload: `{"type":"signal","signal":"SIGKILL","target":"tree"}`},
+		{name: "signal without a name", payload: `{"type":"signal"}`, wantErr: ErrInvalidMessage},
+		{name: "signal to an unknown target", payload: `{"type":"signal","signal":"SIGINT","target":"parent"}`, wantErr: ErrInvalidMessage},
+		{name: "process", payload: `{"type":"process"}`},
+		{name: "heartbeat", payload: `{"type":"heartbeat","id":"h1"}`},
+		{name: "unknown type", payload: `{"type":"paste","data":"x"}`, wantErr: ErrUnsupportedMessage},
+		{name: "missing type", payload: `{}`, wantErr: ErrUnsupportedMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message ClientMessage
+			if err := json.Unmarshal([]byte(tt.payload), &message); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			err := message.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVersionOf(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        int
+	}{
+		{subprotocol: ProtocolV2, want: 2},
+		{subprotocol: ProtocolV1, want: 1},
+		{subprotocol: "", want: 1},
+		{subprotocol: "omt.terminal.v3", want: 1},
+	}
+	for _, tt := range tests {
+		if got := VersionOf(tt.subprotocol); got != tt.want {
+			t.Errorf("VersionOf(%q) = %d, want %d", tt.subprotocol, got, tt.want)
+		}
+	}
+	if Subprotocols[0] != ProtocolV2 {
+		t.Errorf("preferred subprotocol = %q, want %q", Subprotocols[0], ProtocolV2)
+	}
+}
+
+func TestServerMessageJSON(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		message ServerMessage
+		want    string
+	}{
+		{
+			name:    "v1 ready carries no version",
+			message: ServerMessage{Type: TypeReady, Shell: "/bin/sh", SessionID: "s1"},
+			want:    `{"type":"ready","shell":"/bin/sh","sessionId":"s1"}`,
+		},
+		{
+			name: "v2 ready",
+			message: ServerMessage{
+				Type: TypeReady, Protocol: ProtocolV2, Version: 2, Capabilities: []string{CapabilityFlowControl, CapabilityTitle},
+				Shell: "/bin/sh", Flow: "ack", SessionID: "s1",
+			},
+			want: `{"type":"ready","protocol":"omt.terminal.v2","version":2,"capabilities":["flow-control","title"],"shell":"/bin/sh","flow":"ack","sessionId":"s1"}`,
+		},
+		{
+			name:    "exit with code zero",
+			message: ServerMessage{Type: TypeExit},
+			want:    `{"type":"exit"}`,
+		},
+		{
+			name:    "title",
+			message: ServerMessage{Type: TypeTitle, Title: "vim"},
+			want:    `{"type":"title","title":"vim"}`,
+		},
+		{
+			name:    "cwd",
+			message: ServerMessage{Type: TypeCwd, Cwd: "/tmp"},
+			want:    `{"type":"cwd","cwd":"/tmp"}`,
+		},
+		{
+			name:    "bell",
+			message: ServerMessage{Type: TypeBell},
+			want:    `{"type":"bell"}`,
+		},
+		{
+			name:    "heartbeat echoes the id",
+			message: ServerMessage{Type: TypeHeartbeat, ID: "h1", Time: &at},
+			want:    `{"type":"heartbeat","id":"h1","time":"2026-01-02T03:04:05Z"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != tt.want {
+				t.Errorf("json = %s\nwant   %s", raw, tt.want)
+			}
+		})
+	}
+}
+
+// TestProtocolSchema checks that the schema describes exactly the message
+// types the Go types handle and only requires fields they have.
+func TestProtocolSchema(t *testing.T) {
+	var schema struct {
+		Defs map[string]struct {
+			OneOf []struct {
+				Required   []string `json:"required"`
+				Properties struct {
+					Type struct {
+						Const string `json:"const"`
+					} `json:"type"`
+				} `json:"properties"`
+			} `json:"oneOf"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(ProtocolSchema, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	tests := []struct {
+		def    string
+		fields map[string]bool
+		types  []string
+	}{
+		{
+			def:    "clientMessage",
+			fields: jsonFields(reflect.TypeOf(ClientMessage{})),
+			types:  []string{TypeResize, TypeAck, TypeSignal, TypeProcess, TypeHeartbeat},
+		},
+		{
+			def:    "serverMessage",
+			fields: jsonFields(reflect.TypeOf(ServerMessage{})),
+			types:  []string{TypeReady, TypeExit, TypeError, TypeProcess, TypeTitle, TypeCwd, TypeBell, TypeHeartbeat},
+		},
+	}
+	for _, tt := range tests {
+		def, ok := schema.Defs[tt.def]
+		if !ok {
+			t.Errorf("schema has no %s", tt.def)
+			continue
+		}
+		var got []string
+		for _, variant := range def.OneOf {
+			got = append(got, variant.Properties.Type.Const)
+			for _, field := range variant.Required {
+				if !tt.fields[field] {
+					t.Errorf("%s %q requires %q, which the Go type lacks", tt.def, variant.Properties.Type.Const, field)
+				}
+			}
+		}
+		sort.Strings(got)
+		want := append([]string(nil), tt.types...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s types = %v, want %v", tt.def, got, want)
+		}
+	}
+}
+
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}
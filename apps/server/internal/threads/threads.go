@@ -0,0 +1,517 @@
+package threads
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrThreadNotFound     = errors.New("thread not found")
+	ErrInvalidMode        = errors.New("invalid thread mode")
+	ErrInvalidEnvironment = errors.New("invalid thread environment")
+	ErrInvalidRole        = errors.New("invalid message role")
+	ErrWorkspaceRequired  = errors.New("thread workspace is required")
+)
+
+const (
+	ModeAgent = "agent"
+	ModePlan  = "plan"
+	ModeAsk   = "ask"
+)
+
+const (
+	EnvironmentLocal    = "local"
+	EnvironmentWorktree = "worktree"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+	RoleTool      = "tool"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+	maxTitleLength  = 200
+	maxRecordBytes  = 16 * 1024 * 1024
+	threadFileExt   = ".jsonl"
+)
+
+// Thread is a chat conversation tied to a workspace and the mode,
+// environment and branch it runs in.
+type Thread struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Workspace    string    `json:"workspace"`
+	Mode         string    `json:"mode"`
+	Environment  string    `json:"environment"`
+	Branch       string    `json:"branch,omitempty"`
+	Archived     bool      `json:"archived"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	MessageCount int       `json:"messageCount"`
+}
+
+// Message is one entry in a thread. Meta carries client-defined details such
+// as tool calls or attachments and is stored as given.
+type Message struct {
+	ID        string          `json:"id"`
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	Meta      json.RawMessage `json:"meta,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type CreateOptions struct {
+	Title       string
+	Workspace   string
+	Mode        string
+	Environment string
+	Branch      string
+}
+
+// Update changes thread metadata; nil fields are left alone.
+type Update struct {
+	Title       *string
+	Archived    *bool
+	Mode        *string
+	Environment *string
+	Branch      *string
+}
+
+type ListOptions struct {
+	Workspace       string
+	IncludeArchived bool
+	ArchivedOnly    bool
+	Offset          int
+	Limit           int
+}
+
+type Page struct {
+	Threads    []Thread `json:"threads"`
+	Total      int      `json:"total"`
+	NextOffset *int     `json:"nextOffset,omitempty"`
+}
+
+type MessagePage struct {
+	Thread     Thread    `json:"thread"`
+	Messages   []Message `json:"messages"`
+	Total      int       `json:"total"`
+	NextOffset *int      `json:"nextOffset,omitempty"`
+}
+
+// record is one line of a thread file. The file starts with a thread
+// record; later thread records replace the metadata and message records
+// append to the conversation.
+type record struct {
+	Type    string   `json:"type"`
+	Thread  *Thread  `json:"thread,omitempty"`
+	Message *Message `json:"message,omitempty"`
+}
+
+const (
+	recordThread  = "thread"
+	recordMessage = "message"
+)
+
+// Store keeps each thread in its own append-only JSONL file under dir.
+// Thread metadata is indexed in memory at startup; messages are read from
+// disk on demand.
+type Store struct {
+	dir     string
+	mu      sync.Mutex
+	threads map[string]*Thread
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	store := &Store{dir: dir, threads: map[string]*Thread{}}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, threadFileExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, threadFileExt)
+		_ = terminateLastLine(store.path(id))
+		thread, _, err := store.load(id, false)
+		if err != nil {
+			// A damaged file is skipped rather than failing the server.
+			continue
+		}
+		store.threads[thread.ID] = &thread
+	}
+	return store, nil
+}
+
+func (s *Store) Create(opts CreateOptions) (Thread, error) {
+	workspace := strings.TrimSpace(opts.Workspace)
+	if workspace == "" {
+		return Thread{}, ErrWorkspaceRequired
+	}
+	mode, err := normalizeMode(opts.Mode)
+	if err != nil {
+		return Thread{}, err
+	}
+	environment, err := normalizeEnvironment(opts.Environment)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	now := time.Now().UTC()
+	thread := Thread{
+		ID:          newID(),
+		Title:       normalizeTitle(opts.Title),
+		Workspace:   filepath.Clean(workspace),
+		Mode:        mode,
+		Environment: environment,
+		Branch:      strings.TrimSpace(opts.Branch),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.appendRecord(thread.ID, record{Type: recordThread, Thread: &thread}, true); err != nil {
+		return Thread{}, err
+	}
+	stored := thread
+	s.threads[thread.ID] = &stored
+	return thread, nil
+}
+
+// List returns threads most recently updated first.
+func (s *Store) List(opts ListOptions) Page {
+	workspace := ""
+	if strings.TrimSpace(opts.Workspace) != "" {
+		workspace = filepath.Clean(strings.TrimSpace(opts.Workspace))
+	}
+
+	s.mu.Lock()
+	matched := []Thread{}
+	for _, thread := range s.threads {
+		if workspace != "" && thread.Workspace != workspace {
+			continue
+		}
+		if opts.ArchivedOnly && !thread.Archived {
+			continue
+		}
+		if thread.Archived && !opts.IncludeArchived && !opts.ArchivedOnly {
+			continue
+		}
+		matched = append(matched, *thread)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].UpdatedAt.Equal(matched[j].UpdatedAt) {
+			return matched[i].UpdatedAt.After(matched[j].UpdatedAt)
+		}
+		return matched[i].ID > matched[j].ID
+	})
+
+	start, end, next := pageBounds(len(matched), opts.Offset, opts.Limit)
+	return Page{Threads: matched[start:end], Total: len(matched), NextOffset: next}
+}
+
+func (s *Store) Get(id string) (Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	thread, ok := s.threads[id]
+	if !ok {
+		return Thread{}, ErrThreadNotFound
+	}
+	return *thread, nil
+}
+
+// Messages returns a window of a thread's messages, oldest first.
+func (s *Store) Messages(id string, offset, limit int) (MessagePage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.threads[id]; !ok {
+		return MessagePage{}, ErrThreadNotFound
+	}
+	thread, messages, err := s.load(id, true)
+	if err != nil {
+		return MessagePage{}, err
+	}
+	start, end, next := pageBounds(len(messages), offset, limit)
+	return MessagePage{Thread: thread, Messages: messages[start:end], Total: len(messages), NextOffset: next}, nil
+}
+
+func (s *Store) Append(id string, message Message) (Message, error) {
+	role := strings.ToLower(strings.TrimSpace(message.Role))
+	switch role {
+	case RoleUser, RoleAssistant, RoleSystem, RoleTool:
+	default:
+		return Message{}, ErrInvalidRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	thread, ok := s.threads[id]
+	if !ok {
+		return Message{}, ErrThreadNotFound
+	}
+
+	message.ID = newID()
+	message.Role = role
+	message.CreatedAt = time.Now().UTC()
+	if err := s.appendRecord(id, record{Type: recordMessage, Message: &message}, false); err != nil {
+		return Message{}, err
+	}
+	thread.MessageCount++
+	thread.UpdatedAt = message.CreatedAt
+	if thread.Title == "" && role == RoleUser {
+		thread.Title = normalizeTitle(firstLine(message.Content))
+		_ = s.writeThreadLocked(thread)
+	}
+	return message, nil
+}
+
+func (s *Store) Update(id string, update Update) (Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.threads[id]
+	if !ok {
+		return Thread{}, ErrThreadNotFound
+	}
+
+	next := *current
+	if update.Title != nil {
+		next.Title = normalizeTitle(*update.Title)
+	}
+	if update.Archived != nil {
+		next.Archived = *update.Archived
+	}
+	if update.Mode != nil {
+		mode, err := normalizeMode(*update.Mode)
+		if err != nil {
+			return Thread{}, err
+		}
+		next.Mode = mode
+	}
+	if update.Environment != nil {
+		environment, err := normalizeEnvironment(*update.Environment)
+		if err != nil {
+			return Thread{}, err
+		}
+		next.Environment = environment
+	}
+	if update.Branch != nil {
+		next.Branch = strings.TrimSpace(*update.Branch)
+	}
+	next.UpdatedAt = time.Now().UTC()
+
+	if err := s.writeThreadLocked(&next); err != nil {
+		return Thread{}, err
+	}
+	*current = next
+	return next, nil
+}
+
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.threads[id]; !ok {
+		return ErrThreadNotFound
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(s.threads, id)
+	return nil
+}
+
+func (s *Store) writeThreadLocked(thread *Thread) error {
+	snapshot := *thread
+	return s.appendRecord(thread.ID, record{Type: recordThread, Thread: &snapshot}, false)
+}
+
+func (s *Store) appendRecord(id string, rec record, create bool) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_APPEND
+	if create {
+		flags |= os.O_CREATE | os.O_EXCL
+	}
+	file, err := os.OpenFile(s.path(id), flags, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// load replays a thread file. A torn final line, left by a crash during an
+// append, is ignored.
+func (s *Store) load(id string, withMessages bool) (Thread, []Message, error) {
+	file, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Thread{}, nil, ErrThreadNotFound
+	}
+	if err != nil {
+		return Thread{}, nil, err
+	}
+	defer file.Close()
+
+	var thread *Thread
+	messages := []Message{}
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordBytes)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		switch rec.Type {
+		case recordThread:
+			if rec.Thread != nil {
+				thread = rec.Thread
+			}
+		case recordMessage:
+			if rec.Message == nil {
+				continue
+			}
+			count++
+			if withMessages {
+				messages = append(messages, *rec.Message)
+			}
+			if thread != nil && rec.Message.CreatedAt.After(thread.UpdatedAt) {
+				thread.UpdatedAt = rec.Message.CreatedAt
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Thread{}, nil, err
+	}
+	if thread == nil || thread.ID != id {
+		return Thread{}, nil, fmt.Errorf("thread file %s has no thread record", id)
+	}
+	thread.MessageCount = count
+	return *thread, messages, nil
+}
+
+// terminateLastLine ends a torn final record with a newline so the next
+// append starts a fresh line instead of extending the damaged one.
+func terminateLastLine(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = file.WriteAt([]byte{'\n'}, info.Size())
+	return err
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+threadFileExt)
+}
+
+func pageBounds(total, offset, limit int) (int, int, *int) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	if end < total {
+		next := end
+		return offset, end, &next
+	}
+	return offset, end, nil
+}
+
+func normalizeMode(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", ModeAgent:
+		return ModeAgent, nil
+	case ModePlan:
+		return ModePlan, nil
+	case ModeAsk:
+		return ModeAsk, nil
+	default:
+		return "", ErrInvalidMode
+	}
+}
+
+func normalizeEnvironment(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", EnvironmentLocal:
+		return EnvironmentLocal, nil
+	case EnvironmentWorktree:
+		return EnvironmentWorktree, nil
+	default:
+		return "", ErrInvalidEnvironment
+	}
+}
+
+func normalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	runes := []rune(title)
+	if len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+	return title
+}
+
+func firstLine(text string) string {
+	text = strings.TrimSpace(text)
+	if line, _, ok := strings.Cut(text, "\n"); ok {
+		return line
+	}
+	return text
+}
+
+func newID() string {
+	var raw [12]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(raw[:])
+}